@@ -0,0 +1,160 @@
+// Package atrest encrypts message content before it is written to MongoDB.
+//
+// Every conversation, room and channel gets its own random data key, stored wrapped
+// by a key encryption key (envelope encryption). Content is sealed with AES-256-GCM
+// bound to its conversation, so ciphertext copied to another conversation does not
+// open. Reads decrypt transparently through models.Message's BSON hooks.
+package atrest
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// sealedVersion is the first byte of sealed content, for future format changes
+const sealedVersion = 1
+
+// maxCachedKeys bounds the unwrapped data keys kept in memory
+const maxCachedKeys = 10000
+
+// keyTimeout bounds loading or creating a data key, BSON hooks have no context
+const keyTimeout = 5 * time.Second
+
+var (
+	ErrNoKey     = errors.New("conversation has no data key")
+	ErrKeyExists = errors.New("conversation data key already exists")
+)
+
+// KeyStore persists the wrapped data keys
+type KeyStore interface {
+	// Get returns ErrNoKey if the scope has no data key yet
+	Get(ctx context.Context, scope string) (*models.ConversationKey, error)
+	// Create returns ErrKeyExists if another writer created the scope's key first
+	Create(ctx context.Context, key *models.ConversationKey) error
+}
+
+// Sealer encrypts and decrypts message content with per-conversation data keys
+type Sealer struct {
+	wrapper KeyWrapper
+	store   KeyStore
+
+	mu    sync.RWMutex
+	cache map[string]cipher.AEAD
+}
+
+func New(wrapper KeyWrapper, store KeyStore) *Sealer {
+	return &Sealer{wrapper: wrapper, store: store, cache: map[string]cipher.AEAD{}}
+}
+
+// Setup turns on encryption of message content when MESSAGE_ENCRYPTION_KEY_FILE is
+// set, storing data keys in db. Returns nil when it is not set.
+func Setup(db *mongo.Database) (*Sealer, error) {
+	policy := config.Encryption()
+	if !policy.Enabled() {
+		return nil, nil
+	}
+
+	keys, err := LoadKeyFile(policy.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	sealer := New(keys, NewMongoKeyStore(db))
+	models.UseContentCipher(sealer)
+	log.Println("Message content is encrypted at rest")
+	return sealer, nil
+}
+
+// Seal encrypts plaintext with the scope's data key, creating the key on first use
+func (s *Sealer) Seal(scope string, plaintext []byte) ([]byte, error) {
+	aead, err := s.dataKey(scope, true)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(aead, plaintext, []byte(scope))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{sealedVersion}, sealed...), nil
+}
+
+// Open decrypts content sealed for the scope
+func (s *Sealer) Open(scope string, sealed []byte) ([]byte, error) {
+	if len(sealed) == 0 || sealed[0] != sealedVersion {
+		return nil, fmt.Errorf("unknown sealed content version")
+	}
+	aead, err := s.dataKey(scope, false)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(aead, sealed[1:], []byte(scope))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting content of %s: %w", scope, err)
+	}
+	return plaintext, nil
+}
+
+// dataKey returns the scope's unwrapped data key, creating it if allowed
+func (s *Sealer) dataKey(scope string, create bool) (cipher.AEAD, error) {
+	s.mu.RLock()
+	aead, ok := s.cache[scope]
+	s.mu.RUnlock()
+	if ok {
+		return aead, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyTimeout)
+	defer cancel()
+
+	key, err := s.store.Get(ctx, scope)
+	if err == ErrNoKey && create {
+		key, err = s.createKey(ctx, scope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading data key of %s: %w", scope, err)
+	}
+
+	raw, err := s.wrapper.Unwrap(ctx, key.KeyID, scope, key.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key of %s: %w", scope, err)
+	}
+	if aead, err = newAEAD(raw); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if len(s.cache) >= maxCachedKeys {
+		s.cache = map[string]cipher.AEAD{}
+	}
+	s.cache[scope] = aead
+	s.mu.Unlock()
+	return aead, nil
+}
+
+// createKey stores a new data key for the scope, or loads the one a concurrent writer stored
+func (s *Sealer) createKey(ctx context.Context, scope string) (*models.ConversationKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := s.wrapper.Wrap(ctx, scope, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.ConversationKey{Scope: scope, KeyID: keyID, WrappedKey: wrapped, CreatedAt: time.Now()}
+	err = s.store.Create(ctx, key)
+	if err == ErrKeyExists {
+		return s.store.Get(ctx, scope)
+	}
+	return key, err
+}
@@ -0,0 +1,116 @@
+package atrest
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyWrapper protects data keys with key encryption keys that never leave it.
+// FileKeys reads them from a local file, a KMS client can take its place.
+type KeyWrapper interface {
+	// Wrap encrypts a data key for the scope with the active key encryption key
+	Wrap(ctx context.Context, scope string, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped by the key encryption key keyID
+	Unwrap(ctx context.Context, keyID, scope string, wrapped []byte) ([]byte, error)
+}
+
+// FileKeys holds key encryption keys loaded from a key file
+type FileKeys struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// LoadKeyFile reads key encryption keys, one "<id> <base64 32 byte key>" per line.
+// The first key wraps new data keys, the others only unwrap older ones, so keys are
+// rotated by adding a line on top. Blank lines and lines starting with # are ignored.
+func LoadKeyFile(path string) (*FileKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fk := &FileKeys{keys: map[string]cipher.AEAD{}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<id> <base64 key>\"", path, line)
+		}
+		id := fields[0]
+		if _, dup := fk.keys[id]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate key id %q", path, line, id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%s:%d: key %q is not 32 bytes of base64", path, line, id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		fk.keys[id] = aead
+		if fk.active == "" {
+			fk.active = id
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if fk.active == "" {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return fk, nil
+}
+
+func (fk *FileKeys) Wrap(ctx context.Context, scope string, dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(fk.keys[fk.active], dataKey, []byte(scope))
+	return fk.active, wrapped, err
+}
+
+func (fk *FileKeys) Unwrap(ctx context.Context, keyID, scope string, wrapped []byte) ([]byte, error) {
+	aead, ok := fk.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key encryption key %q is not in the key file", keyID)
+	}
+	return open(aead, wrapped, []byte(scope))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts with a random nonce, which is prepended to the ciphertext
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed data too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,38 @@
+package atrest
+
+import (
+	"context"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoKeyStore keeps wrapped data keys in the conversation_keys collection
+type MongoKeyStore struct {
+	keys *mongo.Collection
+}
+
+func NewMongoKeyStore(db *mongo.Database) MongoKeyStore {
+	return MongoKeyStore{keys: db.Collection("conversation_keys")}
+}
+
+func (s MongoKeyStore) Get(ctx context.Context, scope string) (*models.ConversationKey, error) {
+	var key models.ConversationKey
+	err := s.keys.FindOne(ctx, bson.M{"_id": scope}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s MongoKeyStore) Create(ctx context.Context, key *models.ConversationKey) error {
+	_, err := s.keys.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrKeyExists
+	}
+	return err
+}
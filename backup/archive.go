@@ -0,0 +1,136 @@
+// Package backup dumps MongoDB collections to a compressed archive and restores them.
+//
+// An archive is a gzip compressed tar. manifest.json comes first, followed by the
+// documents of each collection as concatenated BSON, the format of mongodump's
+// .bson files, split into entries named "<collection>/<n>.bson".
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+const (
+	manifestName    = "manifest.json"
+	manifestVersion = 1
+
+	// chunkBytes is how much BSON is buffered per archive entry
+	chunkBytes = 16 << 20
+)
+
+// Manifest describes what an archive holds
+type Manifest struct {
+	Version     int        `json:"version"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Since       *time.Time `json:"since,omitempty"` // Incremental: documents created at or after Since
+	Until       time.Time  `json:"until"`           // Documents created before Until, the next incremental starts here
+	Collections []string   `json:"collections"`
+}
+
+// archiveWriter writes the manifest and BSON chunks of a dump
+type archiveWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+
+	chunks map[string]int
+}
+
+func newArchiveWriter(w io.Writer) *archiveWriter {
+	gz := gzip.NewWriter(w)
+	return &archiveWriter{gz: gz, tw: tar.NewWriter(gz), chunks: map[string]int{}}
+}
+
+func (a *archiveWriter) writeEntry(name string, data []byte) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.tw.Write(data)
+	return err
+}
+
+func (a *archiveWriter) writeManifest(manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.writeEntry(manifestName, data)
+}
+
+// writeChunk stores concatenated BSON documents of the collection
+func (a *archiveWriter) writeChunk(collection string, docs []byte) error {
+	a.chunks[collection]++
+	return a.writeEntry(fmt.Sprintf("%s/%06d.bson", collection, a.chunks[collection]), docs)
+}
+
+func (a *archiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// archiveReader reads the manifest, then the BSON chunks of an archive
+type archiveReader struct {
+	gz *gzip.Reader
+	tr *tar.Reader
+}
+
+// newArchiveReader opens the archive and reads its manifest
+func newArchiveReader(r io.Reader) (*archiveReader, *Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	a := &archiveReader{gz: gz, tr: tar.NewReader(gz)}
+
+	header, err := a.tr.Next()
+	if err != nil || header.Name != manifestName {
+		return nil, nil, fmt.Errorf("not a backup archive: %s missing", manifestName)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(a.tr).Decode(&manifest); err != nil {
+		return nil, nil, fmt.Errorf("reading %s: %w", manifestName, err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, nil, fmt.Errorf("unsupported archive version %d", manifest.Version)
+	}
+	return a, &manifest, nil
+}
+
+// next returns the collection and documents of the next chunk, io.EOF at the end
+func (a *archiveReader) next() (string, []byte, error) {
+	for {
+		header, err := a.tr.Next()
+		if err != nil {
+			return "", nil, err
+		}
+		if header.Typeflag != tar.TypeReg || path.Ext(header.Name) != ".bson" {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, a.tr); err != nil {
+			return "", nil, err
+		}
+		return path.Dir(header.Name), buf.Bytes(), nil
+	}
+}
+
+// ReadManifest reads only the manifest of an archive, e.g. to continue an
+// incremental chain from it
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	_, manifest, err := newArchiveReader(r)
+	return manifest, err
+}
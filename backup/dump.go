@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultCollections are backed up unless others are asked for. Conversation keys
+// are needed to read messages encrypted at rest, messages_archive holds the content
+// of archived messages and fs.* hold GridFS media.
+var DefaultCollections = []string{"users", "messages", "messages_archive", "conversations", "conversation_keys", "fs.files", "fs.chunks"}
+
+// createdFields names the creation time field of collections that don't use created_at
+var createdFields = map[string]string{
+	"fs.files": "uploadDate",
+}
+
+// DumpOptions selects what a dump contains
+type DumpOptions struct {
+	Collections []string   // Default DefaultCollections
+	Since       *time.Time // Incremental dump of documents created at or after Since
+}
+
+// Dump writes the collections to w as an archive and returns its manifest with the
+// number of documents written per collection
+func Dump(ctx context.Context, db *mongo.Database, w io.Writer, opts DumpOptions) (*Manifest, map[string]int, error) {
+	collections := opts.Collections
+	if len(collections) == 0 {
+		collections = DefaultCollections
+	}
+
+	now := time.Now().UTC()
+	manifest := &Manifest{
+		Version:     manifestVersion,
+		CreatedAt:   now,
+		Since:       opts.Since,
+		Until:       now,
+		Collections: collections,
+	}
+
+	archive := newArchiveWriter(w)
+	if err := archive.writeManifest(manifest); err != nil {
+		return nil, nil, err
+	}
+
+	counts := map[string]int{}
+	for _, name := range collections {
+		n, err := dumpCollection(ctx, db.Collection(name), archive, incrementalFilter(name, opts.Since, now))
+		counts[name] = n
+		if err != nil {
+			return manifest, counts, err
+		}
+	}
+
+	return manifest, counts, archive.Close()
+}
+
+// incrementalFilter selects the documents created in [since, until), everything
+// for a full dump. GridFS chunks have no timestamp, their ObjectIDs are used.
+func incrementalFilter(collection string, since *time.Time, until time.Time) bson.M {
+	if since == nil {
+		return bson.M{}
+	}
+	if collection == "fs.chunks" {
+		return bson.M{"_id": bson.M{
+			"$gte": primitive.NewObjectIDFromTimestamp(*since),
+			"$lt":  primitive.NewObjectIDFromTimestamp(until),
+		}}
+	}
+
+	field, ok := createdFields[collection]
+	if !ok {
+		field = "created_at"
+	}
+	return bson.M{field: bson.M{"$gte": *since, "$lt": until}}
+}
+
+// dumpCollection streams the matching raw documents into archive chunks
+func dumpCollection(ctx context.Context, coll *mongo.Collection, archive *archiveWriter, filter bson.M) (int, error) {
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	var chunk []byte
+	for cursor.Next(ctx) {
+		chunk = append(chunk, cursor.Current...)
+		count++
+
+		if len(chunk) >= chunkBytes {
+			if err := archive.writeChunk(coll.Name(), chunk); err != nil {
+				return count, err
+			}
+			chunk = chunk[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+
+	if len(chunk) > 0 {
+		return count, archive.writeChunk(coll.Name(), chunk)
+	}
+	return count, nil
+}
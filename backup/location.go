@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Save writes an archive to a local path or an s3://bucket/key location. Local
+// archives are renamed into place once complete, S3 uploads are staged in a
+// temporary file since S3 needs the size and checksum up front.
+func Save(ctx context.Context, location string, write func(w io.Writer) error) error {
+	bucket, key, isS3 := ParseS3URL(location)
+
+	dir := os.TempDir()
+	if !isS3 {
+		dir = filepath.Dir(location)
+	}
+	f, err := os.CreateTemp(dir, ".backup-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	if err := write(io.MultiWriter(f, hash)); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	if !isS3 {
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return os.Rename(f.Name(), location)
+	}
+
+	s3, err := S3FromEnv()
+	if err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s3.Put(ctx, bucket, key, f, size, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// Open reads an archive from a local path or an s3://bucket/key location
+func Open(ctx context.Context, location string) (io.ReadCloser, error) {
+	bucket, key, isS3 := ParseS3URL(location)
+	if !isS3 {
+		return os.Open(location)
+	}
+
+	s3, err := S3FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return s3.Get(ctx, bucket, key)
+}
@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// restoreBatch is how many documents go into one bulk write
+const restoreBatch = 1000
+
+// RestoreOptions controls how an archive is applied
+type RestoreOptions struct {
+	Collections []string // Only restore these, default everything in the archive
+
+	// Overwrite replaces documents that already exist, by default they are kept so
+	// restoring never undoes changes made after the backup
+	Overwrite bool
+	DryRun    bool // Count documents without writing
+}
+
+// RestoreStats counts documents per collection
+type RestoreStats struct {
+	Read    map[string]int
+	Written map[string]int // Inserted, or replaced with Overwrite
+}
+
+// Restore applies an archive read from r. Incremental archives are restored after
+// the full archive they continue, in order.
+func Restore(ctx context.Context, db *mongo.Database, r io.Reader, opts RestoreOptions) (*Manifest, *RestoreStats, error) {
+	archive, manifest, err := newArchiveReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range opts.Collections {
+		wanted[name] = true
+	}
+
+	stats := &RestoreStats{Read: map[string]int{}, Written: map[string]int{}}
+	for {
+		collection, data, err := archive.next()
+		if err == io.EOF {
+			return manifest, stats, nil
+		}
+		if err != nil {
+			return manifest, stats, err
+		}
+		if len(wanted) > 0 && !wanted[collection] {
+			continue
+		}
+
+		docs, err := splitDocuments(data)
+		if err != nil {
+			return manifest, stats, fmt.Errorf("%s: %w", collection, err)
+		}
+		stats.Read[collection] += len(docs)
+		if opts.DryRun {
+			continue
+		}
+
+		for start := 0; start < len(docs); start += restoreBatch {
+			end := min(start+restoreBatch, len(docs))
+			n, err := writeDocuments(ctx, db.Collection(collection), docs[start:end], opts.Overwrite)
+			stats.Written[collection] += n
+			if err != nil {
+				return manifest, stats, fmt.Errorf("%s: %w", collection, err)
+			}
+		}
+	}
+}
+
+// splitDocuments cuts concatenated BSON into documents, each starts with its length
+func splitDocuments(data []byte) ([]bson.Raw, error) {
+	var docs []bson.Raw
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, errors.New("truncated document")
+		}
+		size := int(binary.LittleEndian.Uint32(data))
+		if size < 5 || size > len(data) {
+			return nil, errors.New("truncated document")
+		}
+		doc := bson.Raw(data[:size])
+		if err := doc.Validate(); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+		data = data[size:]
+	}
+	return docs, nil
+}
+
+// writeDocuments inserts the documents, skipping existing ones unless overwrite
+// replaces them. Returns how many were written.
+func writeDocuments(ctx context.Context, coll *mongo.Collection, docs []bson.Raw, overwrite bool) (int, error) {
+	models := make([]mongo.WriteModel, 0, len(docs))
+	for _, doc := range docs {
+		if overwrite {
+			models = append(models, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": doc.Lookup("_id")}).
+				SetReplacement(doc).
+				SetUpsert(true))
+		} else {
+			models = append(models, mongo.NewInsertOneModel().SetDocument(doc))
+		}
+	}
+
+	result, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	written := 0
+	if result != nil {
+		written = int(result.InsertedCount + result.ModifiedCount + result.UpsertedCount)
+	}
+
+	// Documents that are already there were kept on purpose
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return written, err
+			}
+		}
+		return written, nil
+	}
+	return written, err
+}
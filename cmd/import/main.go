@@ -0,0 +1,112 @@
+// Command import migrates a WhatsApp or Telegram chat export into NgobrolYuk.
+//
+//	go run ./cmd/import -format whatsapp -file chat.txt -map "Alice=001,Bob=002" -day-first
+//	go run ./cmd/import -format telegram -file result.json -participants 001
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/atrest"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/importer"
+)
+
+func main() {
+	format := flag.String("format", "", "export format: whatsapp or telegram")
+	file := flag.String("file", "", "path to the export file")
+	userMap := flag.String("map", "", "comma-separated Name=userID pairs mapping export senders to existing users")
+	participants := flag.String("participants", "", "comma-separated user IDs to add even if they never wrote")
+	dayFirst := flag.Bool("day-first", false, "WhatsApp dates are DD/MM instead of MM/DD")
+	tz := flag.String("tz", "", "time zone of export timestamps (default local), e.g. Asia/Jakarta")
+	batchSize := flag.Int("batch", importer.DefaultBatchSize, "messages per bulk insert")
+	dryRun := flag.Bool("dry-run", false, "parse and map senders without writing")
+	flag.Parse()
+
+	if *format == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := importer.ParseOptions{DayFirst: *dayFirst}
+	if *tz != "" {
+		loc, err := time.LoadLocation(*tz)
+		if err != nil {
+			log.Fatalf("Invalid time zone %q: %v", *tz, err)
+		}
+		opts.Location = loc
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Failed to open export: %v", err)
+	}
+	defer f.Close()
+
+	chat, err := importer.Parse(*format, f, opts)
+	if err != nil {
+		log.Fatalf("Failed to parse export: %v", err)
+	}
+	log.Printf("Parsed %d messages from %d senders", len(chat.Messages), len(chat.Senders()))
+
+	config.ConnectDB()
+	defer config.DisconnectDB()
+
+	if _, err := atrest.Setup(config.DB); err != nil {
+		log.Fatalf("Failed to set up message encryption: %v", err)
+	}
+
+	im := &importer.Importer{
+		DB:           config.DB,
+		UserMap:      parseUserMap(*userMap),
+		Participants: splitList(*participants),
+		BatchSize:    *batchSize,
+		DryRun:       *dryRun,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	stats, err := im.Run(ctx, chat)
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+
+	for name, id := range stats.Senders {
+		log.Printf("  %s -> %s", name, id)
+	}
+
+	kind := "conversation"
+	if stats.IsRoom {
+		kind = "room"
+	}
+	log.Printf("Imported %d messages into %s %s (%d already imported, %d placeholder users, dry run: %v)",
+		stats.Messages, kind, stats.ConversationID, stats.AlreadyImported, stats.PlaceholderUsers, *dryRun)
+}
+
+func parseUserMap(s string) map[string]string {
+	m := make(map[string]string)
+	for _, pair := range splitList(s) {
+		name, id, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Fatalf("Invalid -map entry %q, expected Name=userID", pair)
+		}
+		m[strings.TrimSpace(name)] = strings.TrimSpace(id)
+	}
+	return m
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/fasthttp/websocket"
+)
+
+// contentPrefix marks generated messages, the sequence number follows it
+const contentPrefix = "loadgen "
+
+type client struct {
+	userID  string
+	conn    *websocket.Conn
+	writeMu sync.Mutex // Connections support one concurrent writer
+	closed  atomic.Bool
+}
+
+// incoming covers both chat messages and events pushed by the server
+type incoming struct {
+	Event      string `json:"event"`
+	SenderID   string `json:"sender_id"`
+	ReceiverID string `json:"receiver_id"`
+	Content    string `json:"content"`
+}
+
+func (c *client) sendTo(receiverID string, stats *stats) {
+	seq := stats.nextSeq()
+	msg := models.SendMessageRequest{
+		ReceiverID: receiverID,
+		Content:    contentPrefix + strconv.FormatUint(seq, 10),
+		Type:       models.MessageTypeText,
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	stats.sent(seq)
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if err := c.conn.WriteJSON(msg); err != nil {
+		stats.sendFailed(seq, err)
+	}
+}
+
+func (c *client) readLoop(stats *stats) {
+	for {
+		var in incoming
+		if err := c.conn.ReadJSON(&in); err != nil {
+			if !c.closed.Load() {
+				stats.disconnected(c.userID, err)
+			}
+			return
+		}
+
+		switch {
+		case in.Event == models.EventMessageRejected:
+			stats.rejected()
+		case in.Event != "":
+			// Notifications and other events are not measured
+		case in.ReceiverID == c.userID && strings.HasPrefix(in.Content, contentPrefix):
+			if seq, err := strconv.ParseUint(strings.TrimPrefix(in.Content, contentPrefix), 10, 64); err == nil {
+				stats.delivered(seq)
+			}
+		}
+	}
+}
+
+func (c *client) close() {
+	c.closed.Store(true)
+
+	c.writeMu.Lock()
+	c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+
+	c.conn.Close()
+}
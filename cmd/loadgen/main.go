@@ -0,0 +1,216 @@
+// Command loadgen opens many authenticated WebSocket connections to a running
+// server, sends direct messages between random pairs at a fixed rate and reports
+// delivery latency percentiles and error rates.
+//
+//	go run ./cmd/loadgen -conns 200 -rate 500 -duration 1m
+//
+// Tokens are minted with JWT_SECRET for the user IDs first-id .. first-id+conns-1
+// (formatted like the server's IDs, e.g. 001), so those users must exist; on a
+// fresh database `make seed SEED_ARGS="-users 200"` creates them.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/fasthttp/websocket"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type options struct {
+	server      string
+	conns       int
+	firstID     int
+	rate        float64
+	duration    time.Duration
+	drain       time.Duration
+	dialWorkers int
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.server, "server", "http://localhost:8080", "base URL of the running server")
+	flag.IntVar(&opts.conns, "conns", 100, "number of concurrent WebSocket connections (one per user)")
+	flag.IntVar(&opts.firstID, "first-id", 1, "numeric user ID of the first connection")
+	flag.Float64Var(&opts.rate, "rate", 100, "messages per second across all connections")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "how long to send messages")
+	flag.DurationVar(&opts.drain, "drain", 5*time.Second, "how long to wait for in-flight deliveries after sending stops")
+	flag.IntVar(&opts.dialWorkers, "dial-workers", 20, "connections opened in parallel during ramp-up")
+	flag.Parse()
+
+	config.LoadEnv()
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		log.Fatal("JWT_SECRET environment variable is required to mint tokens")
+	}
+	if opts.conns < 2 {
+		log.Fatal("-conns must be at least 2")
+	}
+	if opts.rate <= 0 {
+		log.Fatal("-rate must be positive")
+	}
+
+	wsURL, err := websocketURL(opts.server)
+	if err != nil {
+		log.Fatalf("Invalid -server: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stats := newStats()
+
+	log.Printf("Opening %d connections to %s", opts.conns, wsURL)
+	clients := dialAll(ctx, wsURL, secret, opts, stats)
+	if len(clients) < 2 {
+		log.Fatalf("Only %d connections succeeded, need at least 2", len(clients))
+	}
+	log.Printf("Connected %d/%d in %v", len(clients), opts.conns, stats.connectTime.Round(time.Millisecond))
+
+	for _, c := range clients {
+		go c.readLoop(stats)
+	}
+
+	log.Printf("Sending %.0f msg/s for %v", opts.rate, opts.duration)
+	send(ctx, clients, opts, stats)
+
+	log.Printf("Waiting %v for in-flight deliveries", opts.drain)
+	select {
+	case <-time.After(opts.drain):
+	case <-ctx.Done():
+	}
+
+	for _, c := range clients {
+		c.close()
+	}
+
+	stats.report(os.Stdout)
+}
+
+// websocketURL maps http(s)://host to ws(s)://host/ws
+func websocketURL(server string) (string, error) {
+	u, err := url.Parse(strings.TrimRight(server, "/"))
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	u.Path += "/ws"
+	return u.String(), nil
+}
+
+// mintToken signs a JWT for the user the same way the server does at login
+func mintToken(secret, userID string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(ttl).Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// dialAll opens the connections with a bounded number of parallel dials
+func dialAll(ctx context.Context, wsURL, secret string, opts options, stats *stats) []*client {
+	start := time.Now()
+	ttl := opts.duration + opts.drain + 10*time.Minute
+
+	var (
+		mu      sync.Mutex
+		clients []*client
+		wg      sync.WaitGroup
+		ids     = make(chan string)
+	)
+
+	for w := 0; w < opts.dialWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range ids {
+				c, err := dial(ctx, wsURL, secret, userID, ttl)
+				if err != nil {
+					stats.connectFailed(userID, err)
+					continue
+				}
+				mu.Lock()
+				clients = append(clients, c)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < opts.conns && ctx.Err() == nil; i++ {
+		ids <- fmt.Sprintf("%03d", opts.firstID+i)
+	}
+	close(ids)
+	wg.Wait()
+
+	stats.connectTime = time.Since(start)
+	return clients
+}
+
+func dial(ctx context.Context, wsURL, secret, userID string, ttl time.Duration) (*client, error) {
+	token, err := mintToken(secret, userID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%w (HTTP %d)", err, resp.StatusCode)
+		}
+		return nil, err
+	}
+
+	return &client{userID: userID, conn: conn}, nil
+}
+
+// send spreads messages evenly over the duration, each from a random
+// connection to a different random connection
+func send(ctx context.Context, clients []*client, opts options, stats *stats) {
+	interval := time.Duration(float64(time.Second) / opts.rate)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	deadline := time.After(opts.duration)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+			i := rng.Intn(len(clients))
+			j := rng.Intn(len(clients) - 1)
+			if j >= i {
+				j++
+			}
+			go clients[i].sendTo(clients[j].userID, stats)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxLoggedErrors limits how many individual connection errors are logged
+const maxLoggedErrors = 10
+
+type stats struct {
+	mu          sync.Mutex
+	seq         uint64
+	pending     map[uint64]time.Time // Sent, not yet delivered
+	latencies   []time.Duration
+	connectTime time.Duration
+
+	connectErrors int
+	sendErrors    int
+	rejections    int
+	disconnects   int
+	duplicates    int
+	errorsLogged  int
+	errorCounts   map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		pending:     make(map[uint64]time.Time),
+		errorCounts: make(map[string]int),
+	}
+}
+
+func (s *stats) nextSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	return s.seq
+}
+
+func (s *stats) sent(seq uint64) {
+	s.mu.Lock()
+	s.pending[seq] = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *stats) delivered(seq uint64) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sentAt, ok := s.pending[seq]
+	if !ok {
+		s.duplicates++
+		return
+	}
+	delete(s.pending, seq)
+	s.latencies = append(s.latencies, now.Sub(sentAt))
+}
+
+func (s *stats) sendFailed(seq uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, seq)
+	s.sendErrors++
+	s.countError("send", err)
+}
+
+func (s *stats) rejected() {
+	s.mu.Lock()
+	s.rejections++
+	s.mu.Unlock()
+}
+
+func (s *stats) connectFailed(userID string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connectErrors++
+	s.countError("connect", err)
+	s.logError("Connect failed for user %s: %v", userID, err)
+}
+
+func (s *stats) disconnected(userID string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disconnects++
+	s.countError("read", err)
+	s.logError("Connection of user %s dropped: %v", userID, err)
+}
+
+// countError groups errors by kind and message for the report, callers hold mu
+func (s *stats) countError(kind string, err error) {
+	s.errorCounts[kind+": "+err.Error()]++
+}
+
+// logError logs the first few errors as they happen, callers hold mu
+func (s *stats) logError(format string, args ...interface{}) {
+	if s.errorsLogged < maxLoggedErrors {
+		log.Printf(format, args...)
+	}
+	s.errorsLogged++
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+func (s *stats) report(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sent := int(s.seq)
+	delivered := len(s.latencies)
+	lost := len(s.pending) - s.rejections
+	if lost < 0 {
+		lost = 0
+	}
+
+	fmt.Fprintln(w, "\n=== Load test results ===")
+	fmt.Fprintf(w, "Messages sent:       %d\n", sent)
+	fmt.Fprintf(w, "Delivered:           %d (%.2f%%)\n", delivered, rate(delivered, sent))
+	fmt.Fprintf(w, "Rejected by server:  %d (%.2f%%)\n", s.rejections, rate(s.rejections, sent))
+	fmt.Fprintf(w, "Send errors:         %d (%.2f%%)\n", s.sendErrors, rate(s.sendErrors, sent))
+	fmt.Fprintf(w, "Not delivered:       %d (%.2f%%)\n", lost, rate(lost, sent))
+	if s.duplicates > 0 {
+		fmt.Fprintf(w, "Duplicates:          %d\n", s.duplicates)
+	}
+	fmt.Fprintf(w, "Connect errors:      %d\n", s.connectErrors)
+	fmt.Fprintf(w, "Dropped connections: %d\n", s.disconnects)
+
+	if delivered > 0 {
+		sorted := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		var sum time.Duration
+		for _, l := range sorted {
+			sum += l
+		}
+
+		fmt.Fprintln(w, "\nDelivery latency:")
+		fmt.Fprintf(w, "  min   %v\n", sorted[0].Round(time.Microsecond))
+		fmt.Fprintf(w, "  mean  %v\n", (sum / time.Duration(delivered)).Round(time.Microsecond))
+		for _, p := range []float64{50, 90, 95, 99, 99.9} {
+			fmt.Fprintf(w, "  p%-4v %v\n", p, percentile(sorted, p).Round(time.Microsecond))
+		}
+		fmt.Fprintf(w, "  max   %v\n", sorted[len(sorted)-1].Round(time.Microsecond))
+	}
+
+	if len(s.errorCounts) > 0 {
+		fmt.Fprintln(w, "\nErrors:")
+		for msg, n := range s.errorCounts {
+			fmt.Fprintf(w, "  %5d  %s\n", n, msg)
+		}
+	}
+}
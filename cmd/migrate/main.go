@@ -0,0 +1,220 @@
+// Command migrate manages database schema migrations.
+//
+//	go run ./cmd/migrate status
+//	go run ./cmd/migrate up [-to VERSION]
+//	go run ./cmd/migrate down [-steps N]
+//	go run ./cmd/migrate create add_user_locale
+//	go run ./cmd/migrate encrypt [-batch N]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/atrest"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/migrations"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate <status|up|down|create|encrypt> [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "create":
+		create(args)
+		return
+	case "status", "up", "down", "encrypt":
+	default:
+		usage()
+	}
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	to := fs.Int64("to", 0, "up: apply migrations up to this version (default all)")
+	steps := fs.Int("steps", 1, "down: number of migrations to roll back")
+	batch := fs.Int("batch", 500, "encrypt: messages per bulk write")
+	fs.Parse(args)
+
+	config.ConnectDB()
+	defer config.DisconnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	switch cmd {
+	case "status":
+		statuses, err := migrations.GetStatus(ctx, config.DB)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+
+	case "up":
+		n, err := migrations.Up(ctx, config.DB, *to)
+		if err != nil {
+			log.Fatalf("Migration failed after %d applied: %v", n, err)
+		}
+		log.Printf("Applied %d migrations", n)
+
+	case "down":
+		n, err := migrations.Down(ctx, config.DB, *steps)
+		if err != nil {
+			log.Fatalf("Rollback failed after %d rolled back: %v", n, err)
+		}
+		log.Printf("Rolled back %d migrations", n)
+
+	case "encrypt":
+		n, err := encryptHistory(ctx, *batch)
+		if err != nil {
+			log.Fatalf("Encryption failed after %d messages: %v", n, err)
+		}
+		log.Printf("Encrypted %d messages", n)
+	}
+}
+
+// encryptHistory encrypts message content stored before encryption at rest was
+// enabled. It only touches plaintext messages, so it can be interrupted and rerun.
+func encryptHistory(ctx context.Context, batchSize int) (int, error) {
+	sealer, err := atrest.Setup(config.DB)
+	if err != nil {
+		return 0, err
+	}
+	if sealer == nil {
+		return 0, fmt.Errorf("MESSAGE_ENCRYPTION_KEY_FILE is not set")
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	messages := config.DB.Collection("messages")
+	cursor, err := messages.Find(ctx,
+		bson.M{"content": bson.M{"$ne": ""}, "sealed_content": bson.M{"$exists": false}},
+		options.Find().SetBatchSize(int32(batchSize)))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	encrypted := 0
+	var writes []mongo.WriteModel
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		result, err := messages.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if result != nil {
+			encrypted += int(result.ModifiedCount)
+		}
+		writes = writes[:0]
+		if err == nil {
+			log.Printf("Encrypted %d messages so far", encrypted)
+		}
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var message models.Message
+		if err := cursor.Decode(&message); err != nil {
+			return encrypted, err
+		}
+
+		sealed, err := sealer.Seal(message.EncryptionScope(), []byte(message.Content))
+		if err != nil {
+			return encrypted, err
+		}
+
+		set := bson.M{"content": "", "sealed_content": sealed}
+		update := bson.M{"$set": set}
+
+		// Link URLs in the formatting entities are sealed too
+		if len(message.Entities) > 0 {
+			entities, err := json.Marshal(message.Entities)
+			if err != nil {
+				return encrypted, err
+			}
+			sealedEntities, err := sealer.Seal(message.EncryptionScope(), entities)
+			if err != nil {
+				return encrypted, err
+			}
+			set["sealed_entities"] = sealedEntities
+			update["$unset"] = bson.M{"entities": ""}
+		}
+
+		// Matching the plaintext skips messages deleted since they were read
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": message.ID, "content": message.Content, "sealed_content": bson.M{"$exists": false}}).
+			SetUpdate(update))
+		if len(writes) >= batchSize {
+			if err := flush(); err != nil {
+				return encrypted, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return encrypted, err
+	}
+	return encrypted, flush()
+}
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+const migrationTemplate = `package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func init() {
+	Register(Migration{
+		Version: %d,
+		Name:    %q,
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return nil
+		},
+	})
+}
+`
+
+// create writes a new migration file with the next version number
+func create(args []string) {
+	if len(args) != 1 || !migrationName.MatchString(args[0]) {
+		log.Fatal("usage: migrate create <snake_case_name>")
+	}
+
+	version := migrations.Latest() + 1
+	path := filepath.Join("migrations", fmt.Sprintf("%04d_%s.go", version, args[0]))
+
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(migrationTemplate, version, args[0])), 0o644); err != nil {
+		log.Fatalf("Failed to create migration: %v", err)
+	}
+	log.Printf("Created %s", path)
+}
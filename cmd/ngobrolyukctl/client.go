@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// connectDB opens the database using the same env vars as the server
+func connectDB() func() {
+	config.ConnectDB()
+	return config.DisconnectDB
+}
+
+// adminToken mints a short-lived JWT for an admin user, signed with JWT_SECRET
+func adminToken(ctx context.Context) (string, error) {
+	filter := bson.M{"role": models.UserRoleAdmin, "deleted_at": bson.M{"$exists": false}}
+	if actAs != "" {
+		filter["_id"] = actAs
+	}
+
+	var admin models.User
+	if err := config.DB.Collection("users").FindOne(ctx, filter).Decode(&admin); err != nil {
+		return "", fmt.Errorf("no admin user found, create one with `ngobrolyukctl user create-admin`")
+	}
+
+	claims := jwt.MapClaims{
+		"user_id": admin.ID,
+		"exp":     time.Now().Add(5 * time.Minute).Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// adminRequest calls the admin API of the running server
+func adminRequest(ctx context.Context, method, path string, body interface{}) (map[string]interface{}, error) {
+	token, err := adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(serverURL, "/")+"/api/v1"+path, &payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("server unreachable at %s: %w", serverURL, err)
+	}
+	defer resp.Body.Close()
+
+	var out map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+
+	if resp.StatusCode >= 300 {
+		return out, fmt.Errorf("server returned %d: %v", resp.StatusCode, out["error"])
+	}
+	return out, nil
+}
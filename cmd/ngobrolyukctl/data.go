@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/migrations"
+	"github.com/Adisonsmn/ngobrolyuk/seed"
+	"github.com/spf13/cobra"
+)
+
+func migrateCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "migrate", Short: "Run database migrations"}
+
+	var to int64
+	up := &cobra.Command{
+		Use:   "up",
+		Short: "Apply pending migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+			defer cancel()
+
+			n, err := migrations.Up(ctx, config.DB, to)
+			fmt.Printf("Applied %d migrations\n", n)
+			return err
+		},
+	}
+	up.Flags().Int64Var(&to, "to", 0, "stop at this version (default all)")
+
+	var steps int
+	down := &cobra.Command{
+		Use:   "down",
+		Short: "Roll back the latest migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+			defer cancel()
+
+			n, err := migrations.Down(ctx, config.DB, steps)
+			fmt.Printf("Rolled back %d migrations\n", n)
+			return err
+		},
+	}
+	down.Flags().IntVar(&steps, "steps", 1, "number of migrations to roll back")
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "Show applied and pending migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			statuses, err := migrations.GetStatus(ctx, config.DB)
+			if err != nil {
+				return err
+			}
+			for _, s := range statuses {
+				state := "pending"
+				if s.Applied {
+					state = "applied " + s.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(up, down, status)
+	return cmd
+}
+
+func seedCmd() *cobra.Command {
+	opts := seed.DefaultOptions()
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Generate demo users and conversations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+			defer cancel()
+
+			stats, err := seed.Run(ctx, config.DB, opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created %d users, %d conversations, %d messages (password: %s)\n",
+				stats.Users, stats.Conversations, stats.Messages, opts.Password)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.Users, "users", opts.Users, "number of demo users")
+	cmd.Flags().IntVar(&opts.Conversations, "conversations", opts.Conversations, "number of conversations")
+	cmd.Flags().IntVar(&opts.MessagesPerConversation, "messages", opts.MessagesPerConversation, "messages per conversation")
+	return cmd
+}
@@ -0,0 +1,49 @@
+// Command ngobrolyukctl performs operational tasks against a NgobrolYuk deployment.
+//
+// Commands that change persistent state talk to MongoDB directly. Commands that
+// the running server has to react to (bans, kicks, notices) go through the admin API.
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverURL string
+	actAs     string
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:          "ngobrolyukctl",
+		Short:        "Operational tasks for NgobrolYuk",
+		SilenceUsage: true,
+	}
+
+	root.PersistentFlags().StringVar(&serverURL, "server", envOr("NGOBROLYUK_SERVER", "http://localhost:8080"),
+		"base URL of the running server, for commands that use the admin API")
+	root.PersistentFlags().StringVar(&actAs, "as", "",
+		"admin user ID to act as for admin API calls (default: first admin found)")
+
+	root.AddCommand(
+		userCmd(),
+		banCmd(),
+		kickCmd(),
+		noticeCmd(),
+		migrateCmd(),
+		seedCmd(),
+	)
+
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/spf13/cobra"
+)
+
+func banCmd() *cobra.Command {
+	var reason string
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "ban <user|ip|device> <value>",
+		Short: "Ban a user, IP/CIDR range, or device through the admin API",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			out, err := adminRequest(ctx, http.MethodPost, "/admin/bans", map[string]interface{}{
+				"type":     args[0],
+				"value":    args[1],
+				"reason":   reason,
+				"duration": int(duration.Seconds()),
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Banned %s %s (ban %v)\n", args[0], args[1], out["id"])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&reason, "reason", "", "reason recorded in the audit trail")
+	cmd.Flags().DurationVar(&duration, "duration", 0, "ban duration, e.g. 24h (0 = permanent)")
+	cmd.MarkFlagRequired("reason")
+	return cmd
+}
+
+func kickCmd() *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "kick <user-id>",
+		Short: "Disconnect a user's WebSocket session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			path := "/admin/users/" + args[0] + "/disconnect?reason=" + url.QueryEscape(reason)
+			if _, err := adminRequest(ctx, http.MethodPost, path, nil); err != nil {
+				return err
+			}
+
+			fmt.Printf("Disconnected %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&reason, "reason", models.DisconnectReasonKicked,
+		"reason shown to the client: kicked, password_changed or session_revoked")
+	return cmd
+}
+
+func noticeCmd() *cobra.Command {
+	var level string
+
+	cmd := &cobra.Command{
+		Use:   "notice <message>",
+		Short: "Send a service notice to every connected user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			out, err := adminRequest(ctx, http.MethodPost, "/admin/notices", map[string]interface{}{
+				"message": args[0],
+				"level":   level,
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Notice sent to %v connected users\n", out["recipients"])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&level, "level", models.NoticeLevelInfo, "info, warning or critical")
+	return cmd
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func userCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "user", Short: "Manage user accounts"}
+	cmd.AddCommand(createAdminCmd(), resetPasswordCmd())
+	return cmd
+}
+
+func createAdminCmd() *cobra.Command {
+	var username, email, password string
+
+	cmd := &cobra.Command{
+		Use:   "create-admin",
+		Short: "Create an admin user, or promote an existing user with that email",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			email = strings.TrimSpace(email)
+
+			var existing models.User
+			err := config.DB.Collection("users").FindOne(ctx, bson.M{"email_canonical": models.CanonicalEmail(email)}).Decode(&existing)
+			if err == nil {
+				_, err = config.DB.Collection("users").UpdateOne(ctx,
+					bson.M{"_id": existing.ID},
+					bson.M{"$set": bson.M{"role": models.UserRoleAdmin}})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Promoted existing user %s (%s) to admin\n", existing.Username, existing.ID)
+				return nil
+			} else if err != mongo.ErrNoDocuments {
+				return err
+			}
+
+			generated := password == ""
+			if generated {
+				if password, err = config.GenerateToken(12); err != nil {
+					return err
+				}
+			}
+
+			req := models.RegisterRequest{Username: username, Email: email, Password: password}
+			if errs := req.Validate(); len(errs) > 0 {
+				return fmt.Errorf("%s", strings.Join(errs, "; "))
+			}
+
+			hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 14)
+			if err != nil {
+				return err
+			}
+
+			user := models.User{
+				ID:        config.GetNextUserID(),
+				Username:  req.Username,
+				Email:     req.Email,
+				Password:  string(hash),
+				Role:      models.UserRoleAdmin,
+				Status:    models.UserStatusActive,
+				LastSeen:  time.Now(),
+				CreatedAt: time.Now(),
+			}
+			user.Canonicalize()
+			if _, err := config.DB.Collection("users").InsertOne(ctx, user); err != nil {
+				return err
+			}
+
+			fmt.Printf("Created admin %s (%s)\n", user.Username, user.ID)
+			if generated {
+				fmt.Printf("Generated password: %s\n", password)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&username, "username", "admin", "username for a new account")
+	cmd.Flags().StringVar(&email, "email", "", "email of the account")
+	cmd.Flags().StringVar(&password, "password", "", "password for a new account (generated if empty)")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func resetPasswordCmd() *cobra.Command {
+	var password string
+
+	cmd := &cobra.Command{
+		Use:   "reset-password <user-id-or-email>",
+		Short: "Set a new password for a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer connectDB()()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			generated := password == ""
+			if generated {
+				token, err := config.GenerateToken(12)
+				if err != nil {
+					return err
+				}
+				password = token
+			}
+			if len(password) < 6 {
+				return fmt.Errorf("password must be at least 6 characters")
+			}
+
+			hash, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+			if err != nil {
+				return err
+			}
+
+			var user models.User
+			err = config.DB.Collection("users").FindOneAndUpdate(ctx,
+				bson.M{
+					"$or":        []bson.M{{"_id": args[0]}, {"email_canonical": models.CanonicalEmail(args[0])}},
+					"deleted_at": bson.M{"$exists": false},
+				},
+				bson.M{"$set": bson.M{"password": string(hash)}}).Decode(&user)
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("user %s not found", args[0])
+			} else if err != nil {
+				return err
+			}
+
+			fmt.Println("Password updated")
+
+			// Close the live session so the client asks the user to log in again
+			path := "/admin/users/" + user.ID + "/disconnect?reason=" + models.DisconnectReasonPasswordChanged
+			if _, err := adminRequest(ctx, http.MethodPost, path, nil); err == nil {
+				fmt.Println("Disconnected active session")
+			}
+			if generated {
+				fmt.Printf("Generated password: %s\n", password)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&password, "password", "", "new password (generated if empty)")
+	return cmd
+}
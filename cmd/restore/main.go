@@ -0,0 +1,74 @@
+// Command restore loads an archive written by cmd/backup. Restore the full archive
+// first, then its incrementals in order.
+//
+//	go run ./cmd/restore -in backups/full.tar.gz
+//	go run ./cmd/restore -in s3://my-bucket/ngobrolyuk/2024-01-21.tar.gz -dry-run
+//	go run ./cmd/restore -in backups/full.tar.gz -collections users -overwrite
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/backup"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+)
+
+func main() {
+	in := flag.String("in", "", "archive path or s3://bucket/key")
+	collections := flag.String("collections", "", "comma-separated collections to restore (default all in the archive)")
+	overwrite := flag.Bool("overwrite", false, "replace documents that already exist instead of keeping them")
+	dryRun := flag.Bool("dry-run", false, "read the archive and count documents without writing")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := backup.RestoreOptions{Overwrite: *overwrite, DryRun: *dryRun}
+	if *collections != "" {
+		for _, name := range strings.Split(*collections, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.Collections = append(opts.Collections, name)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+	defer cancel()
+
+	archive, err := backup.Open(ctx, *in)
+	if err != nil {
+		log.Fatalf("Failed to open archive: %v", err)
+	}
+	defer archive.Close()
+
+	if !*dryRun {
+		config.ConnectDB()
+		defer config.DisconnectDB()
+	}
+
+	start := time.Now()
+	manifest, stats, err := backup.Restore(ctx, config.DB, archive, opts)
+	if manifest != nil {
+		kind := "full"
+		if manifest.Since != nil {
+			kind = "incremental since " + manifest.Since.Format(time.RFC3339)
+		}
+		log.Printf("Archive from %s (%s)", manifest.CreatedAt.Format(time.RFC3339), kind)
+	}
+	if stats != nil {
+		for name, n := range stats.Read {
+			log.Printf("  %-20s %d read, %d written", name, n, stats.Written[name])
+		}
+	}
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	log.Printf("Restore finished in %s", time.Since(start).Round(time.Second))
+}
@@ -0,0 +1,48 @@
+// Command seed fills the database with demo users and message histories.
+//
+//	go run ./cmd/seed -users 200 -conversations 500 -messages 80 -weeks 6
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/atrest"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/seed"
+)
+
+func main() {
+	opts := seed.DefaultOptions()
+
+	flag.IntVar(&opts.Users, "users", opts.Users, "number of demo users to create")
+	flag.IntVar(&opts.Conversations, "conversations", opts.Conversations, "number of direct conversations")
+	flag.IntVar(&opts.MessagesPerConversation, "messages", opts.MessagesPerConversation, "average messages per conversation")
+	weeks := flag.Int("weeks", int(opts.Span/(7*24*time.Hour)), "spread message timestamps over this many weeks")
+	flag.StringVar(&opts.Password, "password", opts.Password, "password shared by all demo users")
+	flag.Int64Var(&opts.RandSeed, "seed", 0, "random seed for reproducible data (default random)")
+	flag.Parse()
+
+	opts.Span = time.Duration(*weeks) * 7 * 24 * time.Hour
+
+	config.ConnectDB()
+	defer config.DisconnectDB()
+
+	if _, err := atrest.Setup(config.DB); err != nil {
+		log.Fatalf("Failed to set up message encryption: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	start := time.Now()
+	stats, err := seed.Run(ctx, config.DB, opts)
+	if err != nil {
+		log.Fatalf("Seeding failed: %v", err)
+	}
+
+	log.Printf("Created %d users, %d conversations, %d messages in %s (password: %s)",
+		stats.Users, stats.Conversations, stats.Messages, time.Since(start).Round(time.Millisecond), opts.Password)
+}
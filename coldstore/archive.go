@@ -0,0 +1,136 @@
+package coldstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// messageScope holds the fields a raw message document is grouped by
+type messageScope struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	SenderID   string             `bson:"sender_id"`
+	ReceiverID string             `bson:"receiver_id"`
+	RoomID     string             `bson:"room_id"`
+	ChannelID  string             `bson:"channel_id"`
+}
+
+// archivable matches messages that still have content worth keeping. Disappearing
+// messages are left to the expiry sweeper.
+func archivable(cutoff time.Time) bson.M {
+	return bson.M{
+		"created_at": bson.M{"$lt": cutoff},
+		"archived":   bson.M{"$ne": true},
+		"type":       bson.M{"$nin": []string{models.MessageTypeDeleted, models.MessageTypeExpired}},
+		"view_once":  bson.M{"$ne": true},
+		"expires_at": nil,
+	}
+}
+
+// Archive moves up to limit messages created before cutoff to the current target,
+// oldest first, and turns them into stubs. Returns how many messages were archived.
+func Archive(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	if db == nil || target == nil {
+		return 0, fmt.Errorf("cold storage is not set up")
+	}
+	messages := db.Collection("messages")
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := messages.Find(ctx, archivable(cutoff), opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	// Raw documents are copied as stored, sealed content included
+	byScope := map[string][]bson.Raw{}
+	idsByScope := map[string][]primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var s messageScope
+		if err := cursor.Decode(&s); err != nil {
+			return 0, err
+		}
+		m := models.Message{SenderID: s.SenderID, ReceiverID: s.ReceiverID, RoomID: s.RoomID, ChannelID: s.ChannelID}
+		scope := m.EncryptionScope()
+		byScope[scope] = append(byScope[scope], bson.Raw(append([]byte(nil), cursor.Current...)))
+		idsByScope[scope] = append(idsByScope[scope], s.ID)
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+
+	archived := 0
+	for scope, docs := range byScope {
+		ref, err := target.Put(ctx, scope, docs)
+		if err != nil {
+			return archived, fmt.Errorf("archiving %s: %w", scope, err)
+		}
+
+		// Messages deleted or expired since they were read keep their own, emptier state
+		filter := bson.M{
+			"_id":      bson.M{"$in": idsByScope[scope]},
+			"archived": bson.M{"$ne": true},
+			"type":     bson.M{"$nin": []string{models.MessageTypeDeleted, models.MessageTypeExpired}},
+		}
+		update := bson.M{
+			"$set":   bson.M{"archived": true, "archive_ref": ref, "content": ""},
+			"$unset": bson.M{"entities": "", "sealed_content": "", "sealed_entities": ""},
+		}
+		result, err := messages.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return archived, err
+		}
+		archived += int(result.ModifiedCount)
+	}
+	return archived, nil
+}
+
+// Scrub clears the archived copies of the messages matching filter, so deleting
+// content from the messages collection also removes it from cold storage. Archive
+// files holding any of them are rewritten without it.
+func Scrub(ctx context.Context, filter bson.M) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.Collection(archiveCollection).UpdateMany(ctx, filter, bson.M{
+		"$set":   bson.M{"content": ""},
+		"$unset": bson.M{"entities": "", "sealed_content": "", "sealed_entities": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The stubs tell which files hold the messages
+	stubs := bson.M{"archived": true, "archive_ref": bson.M{"$ne": collectionRef}}
+	for key, value := range filter {
+		stubs[key] = value
+	}
+	cursor, err := db.Collection("messages").Find(ctx, stubs,
+		options.Find().SetProjection(bson.M{"_id": 1, "archive_ref": 1}))
+	if err != nil {
+		return err
+	}
+	var found []struct {
+		ID         primitive.ObjectID `bson:"_id"`
+		ArchiveRef string             `bson:"archive_ref"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return err
+	}
+
+	byRef := map[string][]primitive.ObjectID{}
+	for _, stub := range found {
+		byRef[stub.ArchiveRef] = append(byRef[stub.ArchiveRef], stub.ID)
+	}
+	for ref, ids := range byRef {
+		if err := scrubFile(ctx, ref, ids); err != nil {
+			return fmt.Errorf("scrub %s: %w", ref, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Package coldstore keeps the content of old messages outside the messages collection.
+//
+// Archived messages stay in place as stubs (archived, archive_ref) without content,
+// so conversation lists, unread counts and pagination are unchanged. Hydrate puts
+// the content back when a client scrolls that far. Content is copied as stored, so
+// messages encrypted at rest stay encrypted in cold storage.
+package coldstore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Target writes archived message documents
+type Target interface {
+	// Put stores raw message documents of one conversation and returns the reference
+	// kept in their stubs
+	Put(ctx context.Context, scope string, docs []bson.Raw) (string, error)
+}
+
+var (
+	db     *mongo.Database
+	target Target
+)
+
+// Setup configures where messages are archived: "mongo" for the messages_archive
+// collection, a local directory or s3://bucket/prefix for gzipped JSON lines files.
+// Archives written to other targets before stay readable.
+func Setup(database *mongo.Database, location string) error {
+	db = database
+	switch {
+	case location == "" || location == "mongo":
+		target = collectionTarget{db.Collection(archiveCollection)}
+	case strings.HasPrefix(location, "s3://"):
+		target = fileTarget{location: strings.TrimRight(location, "/")}
+	default:
+		// References to local files are absolute so they don't depend on the working directory
+		dir, err := filepath.Abs(location)
+		if err != nil {
+			return err
+		}
+		target = fileTarget{location: dir}
+	}
+	return nil
+}
+
+// Current returns the configured target, nil before Setup
+func Current() Target {
+	return target
+}
+
+// fetch loads the archived messages with the IDs from the reference's storage
+func fetch(ctx context.Context, ref string, ids []primitive.ObjectID) ([]models.Message, error) {
+	if ref == collectionRef {
+		if db == nil {
+			return nil, fmt.Errorf("cold storage is not set up")
+		}
+		return fetchFromCollection(ctx, db.Collection(archiveCollection), ids)
+	}
+	return fetchFromFile(ctx, ref, ids)
+}
+
+// hydratable reports whether the message is a stub whose content is still wanted,
+// messages deleted or expired after archiving stay empty
+func hydratable(m *models.Message) bool {
+	return m.Archived && m.Type != models.MessageTypeDeleted && m.Type != models.MessageTypeExpired
+}
+
+// Hydrate fills in the content of archived stubs in place. Messages that are not
+// archived are left alone, so it is cheap to call on every page.
+func Hydrate(ctx context.Context, messages []models.Message) error {
+	byRef := map[string][]primitive.ObjectID{}
+	for i := range messages {
+		if hydratable(&messages[i]) {
+			byRef[messages[i].ArchiveRef] = append(byRef[messages[i].ArchiveRef], messages[i].ID)
+		}
+	}
+	if len(byRef) == 0 {
+		return nil
+	}
+
+	archived := map[primitive.ObjectID]models.Message{}
+	for ref, ids := range byRef {
+		found, err := fetch(ctx, ref, ids)
+		if err != nil {
+			return fmt.Errorf("fetching archive %s: %w", ref, err)
+		}
+		for _, m := range found {
+			archived[m.ID] = m
+		}
+	}
+
+	for i := range messages {
+		if a, ok := archived[messages[i].ID]; ok && hydratable(&messages[i]) {
+			messages[i].Content, messages[i].Entities = a.Content, a.Entities
+		}
+	}
+	return nil
+}
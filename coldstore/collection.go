@@ -0,0 +1,51 @@
+package coldstore
+
+import (
+	"context"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	archiveCollection = "messages_archive"
+	collectionRef     = "mongo:" + archiveCollection
+)
+
+// collectionTarget copies archived messages into the messages_archive collection,
+// which can live on cheaper storage (e.g. a zone sharded onto archive nodes)
+type collectionTarget struct {
+	coll *mongo.Collection
+}
+
+func (t collectionTarget) Put(ctx context.Context, scope string, docs []bson.Raw) (string, error) {
+	// Replacing keeps a retried batch from failing on documents copied the first time
+	writes := make([]mongo.WriteModel, 0, len(docs))
+	for _, doc := range docs {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": doc.Lookup("_id")}).
+			SetReplacement(doc).
+			SetUpsert(true))
+	}
+	if _, err := t.coll.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return "", err
+	}
+	return collectionRef, nil
+}
+
+func fetchFromCollection(ctx context.Context, coll *mongo.Collection, ids []primitive.ObjectID) ([]models.Message, error) {
+	cursor, err := coll.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
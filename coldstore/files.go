@@ -0,0 +1,228 @@
+package coldstore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/backup"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCachedFiles bounds the archive files kept in memory, scrolling back through a
+// conversation reads the same few files page after page
+const maxCachedFiles = 16
+
+// fileTarget writes one gzipped file of canonical extended JSON lines per
+// conversation and run, to a local directory or an s3://bucket/prefix
+type fileTarget struct {
+	location string
+}
+
+// fileName keeps scope characters out of the path
+var fileName = strings.NewReplacer(":", "-", "/", "-")
+
+func (t fileTarget) Put(ctx context.Context, scope string, docs []bson.Raw) (string, error) {
+	now := time.Now().UTC()
+	ref := fmt.Sprintf("%s/%s/%s-%s.jsonl.gz", t.location, now.Format("2006/01"),
+		fileName.Replace(scope), primitive.NewObjectID().Hex())
+
+	if _, _, isS3 := backup.ParseS3URL(ref); !isS3 {
+		if err := os.MkdirAll(filepath.Dir(ref), 0o700); err != nil {
+			return "", err
+		}
+	}
+	return ref, writeFile(ctx, ref, docs)
+}
+
+// writeFile stores documents as a gzipped JSON lines file, replacing any file at ref
+func writeFile(ctx context.Context, ref string, docs []bson.Raw) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for _, doc := range docs {
+		line, err := bson.MarshalExtJSON(doc, true, false)
+		if err != nil {
+			return err
+		}
+		gz.Write(append(line, '\n'))
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return backup.Save(ctx, ref, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+// readFile reads the documents of an archive file in order, bypassing the cache
+func readFile(ctx context.Context, ref string) ([]bson.Raw, error) {
+	f, err := backup.Open(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []bson.Raw
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var doc bson.Raw
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, scanner.Err()
+}
+
+// fileRewrites serializes the rewrites of archive files in this process, each one
+// reads a whole file and writes it back
+var fileRewrites sync.Mutex
+
+// scrubFile rewrites an archive file without the content of the given messages,
+// the way Scrub clears them in messages_archive
+func scrubFile(ctx context.Context, ref string, ids []primitive.ObjectID) error {
+	fileRewrites.Lock()
+	defer fileRewrites.Unlock()
+
+	scrub := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		scrub[id] = true
+	}
+
+	docs, err := readFile(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for i, doc := range docs {
+		id, ok := doc.Lookup("_id").ObjectIDOK()
+		if !ok || !scrub[id] {
+			continue
+		}
+
+		var fields bson.D
+		if err := bson.Unmarshal(doc, &fields); err != nil {
+			return err
+		}
+		kept := fields[:0]
+		for _, field := range fields {
+			switch field.Key {
+			case "entities", "sealed_content", "sealed_entities":
+				continue
+			case "content":
+				field.Value = ""
+			}
+			kept = append(kept, field)
+		}
+		if docs[i], err = bson.Marshal(kept); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := writeFile(ctx, ref, docs); err != nil {
+		return err
+	}
+	forgetFile(ref)
+	return nil
+}
+
+// fileCache keeps the documents of recently read archive files by ID
+var fileCache = struct {
+	sync.Mutex
+	files map[string]map[primitive.ObjectID]bson.Raw
+	order []string
+}{files: map[string]map[primitive.ObjectID]bson.Raw{}}
+
+func fetchFromFile(ctx context.Context, ref string, ids []primitive.ObjectID) ([]models.Message, error) {
+	docs, err := loadFile(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]models.Message, 0, len(ids))
+	for _, id := range ids {
+		doc, ok := docs[id]
+		if !ok {
+			continue
+		}
+		var message models.Message
+		if err := bson.Unmarshal(doc, &message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// loadFile reads an archive file, or returns it from the cache
+func loadFile(ctx context.Context, ref string) (map[primitive.ObjectID]bson.Raw, error) {
+	fileCache.Lock()
+	docs, ok := fileCache.files[ref]
+	fileCache.Unlock()
+	if ok {
+		return docs, nil
+	}
+
+	raw, err := readFile(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	docs = make(map[primitive.ObjectID]bson.Raw, len(raw))
+	for _, doc := range raw {
+		if id, ok := doc.Lookup("_id").ObjectIDOK(); ok {
+			docs[id] = doc
+		}
+	}
+
+	fileCache.Lock()
+	if _, ok := fileCache.files[ref]; !ok {
+		if len(fileCache.order) >= maxCachedFiles {
+			delete(fileCache.files, fileCache.order[0])
+			fileCache.order = fileCache.order[1:]
+		}
+		fileCache.files[ref] = docs
+		fileCache.order = append(fileCache.order, ref)
+	}
+	fileCache.Unlock()
+	return docs, nil
+}
+
+// forgetFile drops a rewritten archive file from the cache
+func forgetFile(ref string) {
+	fileCache.Lock()
+	defer fileCache.Unlock()
+
+	if _, ok := fileCache.files[ref]; !ok {
+		return
+	}
+	delete(fileCache.files, ref)
+	for i, cached := range fileCache.order {
+		if cached == ref {
+			fileCache.order = append(fileCache.order[:i], fileCache.order[i+1:]...)
+			break
+		}
+	}
+}
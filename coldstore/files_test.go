@@ -0,0 +1,64 @@
+package coldstore
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestScrubFile(t *testing.T) {
+	ctx := context.Background()
+	deleted, kept := primitive.NewObjectID(), primitive.NewObjectID()
+
+	var docs []bson.Raw
+	for _, doc := range []bson.D{
+		{{Key: "_id", Value: deleted}, {Key: "sender_id", Value: "001"}, {Key: "content", Value: "bye"},
+			{Key: "entities", Value: bson.A{bson.D{{Key: "type", Value: "bold"}}}}, {Key: "sealed_content", Value: []byte("x")}},
+		{{Key: "_id", Value: kept}, {Key: "sender_id", Value: "002"}, {Key: "content", Value: "hi"}},
+	} {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, raw)
+	}
+
+	ref, err := fileTarget{location: t.TempDir()}.Put(ctx, "direct:001_002", docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Read once so the file is cached, scrubbing must not leave the old content there
+	if _, err := fetchFromFile(ctx, ref, []primitive.ObjectID{kept}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scrubFile(ctx, ref, []primitive.ObjectID{deleted}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := fetchFromFile(ctx, ref, []primitive.ObjectID{deleted, kept})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+	if m := messages[0]; m.Content != "" || m.Entities != nil || m.SenderID != "001" {
+		t.Errorf("scrubbed message = %+v, want empty content with sender kept", m)
+	}
+	if m := messages[1]; m.Content != "hi" {
+		t.Errorf("other message content = %q, want %q", m.Content, "hi")
+	}
+
+	raw, err := readFile(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"entities", "sealed_content"} {
+		if _, err := raw[0].LookupErr(field); err == nil {
+			t.Errorf("scrubbed message still has %s", field)
+		}
+	}
+}
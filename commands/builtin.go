@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+)
+
+func init() {
+	Register(Info{Name: "me", Usage: "/me <action>", Description: "Say what you are doing, e.g. /me waves"}, HandlerFunc(me))
+	Register(Info{Name: "giphy", Usage: "/giphy <search>", Description: "Post a GIF from Giphy"}, HandlerFunc(giphy))
+	Register(Info{Name: "poll", Usage: "/poll <question> | <option> | <option>...", Description: "Ask a question with numbered options"}, HandlerFunc(poll))
+	Register(Info{Name: "help", Usage: "/help", Description: "List the available commands"}, HandlerFunc(help))
+}
+
+// escapeMarkup keeps names and user text from being read as formatting
+func escapeMarkup(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`).Replace(text)
+}
+
+func me(ctx context.Context, inv Invocation) (Response, error) {
+	if inv.Args == "" {
+		return Reply("Usage: /me <action>"), nil
+	}
+	return Response{Content: "_" + escapeMarkup(inv.UserName+" "+inv.Args) + "_"}, nil
+}
+
+// giphyEndpoint is Giphy's translate API, which picks one GIF for a phrase
+const giphyEndpoint = "https://api.giphy.com/v1/gifs/translate"
+
+func giphy(ctx context.Context, inv Invocation) (Response, error) {
+	apiKey := config.GetEnvWithDefault("GIPHY_API_KEY", "")
+	if apiKey == "" {
+		return Reply("/giphy is not available on this server"), nil
+	}
+	if inv.Args == "" {
+		return Reply("Usage: /giphy <search>"), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := url.Values{"api_key": {apiKey}, "s": {inv.Args}, "rating": {config.GetEnvWithDefault("GIPHY_RATING", "g")}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, giphyEndpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return Response{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("giphy returned status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Data struct {
+			Images struct {
+				Original struct {
+					URL string `json:"url"`
+				} `json:"original"`
+			} `json:"images"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Response{}, err
+	}
+	if out.Data.Images.Original.URL == "" {
+		return Reply(fmt.Sprintf("No GIF found for %q", inv.Args)), nil
+	}
+	return Response{Content: out.Data.Images.Original.URL, Type: "image"}, nil
+}
+
+// Limits of /poll
+const (
+	minPollOptions = 2
+	maxPollOptions = 10
+)
+
+func poll(ctx context.Context, inv Invocation) (Response, error) {
+	var parts []string
+	for _, part := range strings.Split(inv.Args, "|") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) < 1+minPollOptions || len(parts) > 1+maxPollOptions {
+		return Reply(fmt.Sprintf("Usage: /poll <question> | <option> | <option>... (%d to %d options)", minPollOptions, maxPollOptions)), nil
+	}
+
+	var b strings.Builder
+	b.WriteString("📊 **" + escapeMarkup(parts[0]) + "**")
+	for i, option := range parts[1:] {
+		fmt.Fprintf(&b, "\n%d. %s", i+1, escapeMarkup(option))
+	}
+	b.WriteString("\nReply with the number of your choice")
+	return Response{Content: b.String()}, nil
+}
+
+func help(ctx context.Context, inv Invocation) (Response, error) {
+	infos, err := List(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+
+	var b strings.Builder
+	b.WriteString("Available commands:")
+	for _, info := range infos {
+		usage := info.Usage
+		if usage == "" {
+			usage = "/" + info.Name
+		}
+		fmt.Fprintf(&b, "\n%s - %s", usage, info.Description)
+	}
+	b.WriteString("\nStart a message with // to send it as text")
+	return Reply(b.String()), nil
+}
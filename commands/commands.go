@@ -0,0 +1,191 @@
+// Package commands turns messages starting with a slash into commands and runs them.
+//
+// Built-in commands are registered at startup. Commands registered by bots are looked
+// up through a Resolver and run as webhooks. A command either posts a message in the
+// conversation on behalf of the user or answers with an ephemeral response that only
+// the user sees.
+package commands
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Command is a parsed slash command
+type Command struct {
+	Name string // Lowercase, without the slash
+	Args string // Everything after the name, trimmed
+}
+
+// Invocation is who ran a command and where
+type Invocation struct {
+	Command
+	UserID         string
+	UserName       string // Display name, or username without one
+	ReceiverID     string // Direct conversations
+	RoomID         string // Rooms
+	ConversationID string
+}
+
+// Response is the outcome of a command. Ephemeral responses go to the invoking user
+// only, others are posted as a message of Type with Content.
+type Response struct {
+	Content   string
+	Type      string // "text" or "image", text when empty
+	Ephemeral bool
+}
+
+// Reply returns an ephemeral response
+func Reply(text string) Response {
+	return Response{Content: text, Ephemeral: true}
+}
+
+// Handler runs a command
+type Handler interface {
+	Handle(ctx context.Context, inv Invocation) (Response, error)
+}
+
+// HandlerFunc adapts a function to a Handler
+type HandlerFunc func(ctx context.Context, inv Invocation) (Response, error)
+
+func (f HandlerFunc) Handle(ctx context.Context, inv Invocation) (Response, error) {
+	return f(ctx, inv)
+}
+
+// Info describes a command for help and client autocompletion
+type Info struct {
+	Name        string `json:"name"`
+	Usage       string `json:"usage,omitempty"`
+	Description string `json:"description"`
+	BuiltIn     bool   `json:"built_in"`
+}
+
+// Resolver finds commands registered outside this package, e.g. by bots
+type Resolver interface {
+	Resolve(ctx context.Context, name string) (Handler, bool, error)
+	List(ctx context.Context) ([]Info, error)
+}
+
+// ErrUnknownCommand is returned by Dispatch for names nobody registered
+var ErrUnknownCommand = errors.New("unknown command")
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ValidName reports whether name can be used for a command
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+type builtIn struct {
+	info    Info
+	handler Handler
+}
+
+var (
+	mu       sync.RWMutex
+	builtIns = map[string]builtIn{}
+	resolver Resolver
+)
+
+// Register adds a built-in command, it takes precedence over registered commands
+func Register(info Info, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	info.BuiltIn = true
+	builtIns[info.Name] = builtIn{info: info, handler: handler}
+}
+
+// IsBuiltIn reports whether a built-in command has the name
+func IsBuiltIn(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := builtIns[name]
+	return ok
+}
+
+// UseResolver sets where commands that are not built in are looked up
+func UseResolver(r Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+	resolver = r
+}
+
+// Parse reads a slash command from message content. "//" escapes a message that
+// should start with a slash, Unescape strips it.
+func Parse(content string) (Command, bool) {
+	if !strings.HasPrefix(content, "/") || strings.HasPrefix(content, "//") {
+		return Command{}, false
+	}
+
+	name, args, _ := strings.Cut(content[1:], " ")
+	if i := strings.IndexAny(name, "\n\t"); i >= 0 {
+		name, args = name[:i], name[i:]+" "+args
+	}
+	name = strings.ToLower(name)
+	if !ValidName(name) {
+		return Command{}, false
+	}
+	return Command{Name: name, Args: strings.TrimSpace(args)}, true
+}
+
+// Unescape removes the slash escaping a message that starts with "//"
+func Unescape(content string) string {
+	if strings.HasPrefix(content, "//") {
+		return content[1:]
+	}
+	return content
+}
+
+// Dispatch runs the command, built-ins first
+func Dispatch(ctx context.Context, inv Invocation) (Response, error) {
+	mu.RLock()
+	b, ok := builtIns[inv.Name]
+	r := resolver
+	mu.RUnlock()
+
+	handler := b.handler
+	if !ok {
+		if r == nil {
+			return Response{}, ErrUnknownCommand
+		}
+		h, found, err := r.Resolve(ctx, inv.Name)
+		if err != nil {
+			return Response{}, err
+		}
+		if !found {
+			return Response{}, ErrUnknownCommand
+		}
+		handler = h
+	}
+	return handler.Handle(ctx, inv)
+}
+
+// List returns every command the user can run, sorted by name
+func List(ctx context.Context) ([]Info, error) {
+	mu.RLock()
+	infos := make([]Info, 0, len(builtIns))
+	for _, b := range builtIns {
+		infos = append(infos, b.info)
+	}
+	r := resolver
+	mu.RUnlock()
+
+	if r != nil {
+		registered, err := r.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range registered {
+			if !IsBuiltIn(info.Name) {
+				infos = append(infos, info)
+			}
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook runs a bot command by posting the invocation to the bot's URL.
+//
+// Request:  POST {"command": "deploy", "args": "staging", "user_id": "1", "user_name": "Budi", "room_id": "", "receiver_id": "2", "conversation_id": "1_2"}
+// Response: {"text": "Deploying...", "response_type": "ephemeral" | "in_channel", "type": "text"}
+//
+// Requests are signed with the command's secret: X-Ngobrolyuk-Signature is the hex
+// HMAC-SHA256 of "<X-Ngobrolyuk-Timestamp>.<body>".
+type Webhook struct {
+	URL     string
+	Secret  string
+	Timeout time.Duration
+}
+
+// Response types a bot may answer with
+const (
+	ResponseEphemeral = "ephemeral"  // Only the invoking user sees the text
+	ResponseInChannel = "in_channel" // Posted as the user's message
+)
+
+// maxWebhookResponse caps how much of a bot's answer is read
+const maxWebhookResponse = 64 << 10
+
+// Sign returns the signature of a webhook request body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) Handle(ctx context.Context, inv Invocation) (Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{
+		"command":         inv.Name,
+		"args":            inv.Args,
+		"user_id":         inv.UserID,
+		"user_name":       inv.UserName,
+		"room_id":         inv.RoomID,
+		"receiver_id":     inv.ReceiverID,
+		"conversation_id": inv.ConversationID,
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ngobrolyuk-Timestamp", timestamp)
+	req.Header.Set("X-Ngobrolyuk-Signature", Sign(w.Secret, timestamp, body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("command webhook returned status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Text         string `json:"text"`
+		ResponseType string `json:"response_type"`
+		Type         string `json:"type"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWebhookResponse)).Decode(&out); err != nil {
+		return Response{}, err
+	}
+
+	// Bots answer privately unless they ask otherwise
+	if out.ResponseType != ResponseInChannel {
+		return Reply(out.Text), nil
+	}
+	return Response{Content: out.Text, Type: out.Type}, nil
+}
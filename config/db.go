@@ -7,19 +7,24 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 var DB *mongo.Database
 var Client *mongo.Client
 
-func ConnectDB() {
-	// Load environment variables
+// LoadEnv loads variables from .env when present
+func LoadEnv() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using system environment variables")
 	}
+}
+
+func ConnectDB() {
+	// Load environment variables
+	LoadEnv()
 
 	// Get MongoDB URI
 	mongoURI := os.Getenv("MONGO_URI")
@@ -33,7 +38,8 @@ func ConnectDB() {
 		SetMaxPoolSize(20).
 		SetMinPoolSize(5).
 		SetMaxConnIdleTime(30 * time.Second).
-		SetServerSelectionTimeout(5 * time.Second)
+		SetServerSelectionTimeout(5 * time.Second).
+		SetMonitor(otelmongo.NewMonitor()) // Span per command, parented on the caller's context
 
 	// Create client
 	client, err := mongo.NewClient(clientOptions)
@@ -58,9 +64,6 @@ func ConnectDB() {
 	Client = client
 	DB = client.Database("ngobrolyuk")
 
-	// Create indexes
-	createIndexes(DB)
-
 	log.Println("Successfully connected to MongoDB")
 }
 
@@ -76,55 +79,3 @@ func DisconnectDB() {
 		}
 	}
 }
-func createIndexes(db *mongo.Database) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	userCollection := db.Collection("users")
-	messageCollection := db.Collection("messages")
-
-	// ✅ Indexes untuk users
-	userIndexes := []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "username", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-		{
-			Keys:    bson.D{{Key: "email", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-		{
-			Keys: bson.D{{Key: "online", Value: 1}, {Key: "last_seen", Value: -1}},
-		},
-	}
-	if _, err := userCollection.Indexes().CreateMany(ctx, userIndexes); err != nil {
-		log.Printf("Failed to create user indexes: %v", err)
-		return err
-	}
-
-	// ✅ Indexes untuk messages
-	messageIndexes := []mongo.IndexModel{
-		{
-			Keys: bson.D{
-				{Key: "sender_id", Value: 1},
-				{Key: "receiver_id", Value: 1},
-				{Key: "created_at", Value: -1},
-			},
-		},
-		{
-			Keys: bson.D{
-				{Key: "receiver_id", Value: 1},
-				{Key: "read", Value: 1},
-			},
-		},
-		{
-			Keys: bson.D{{Key: "created_at", Value: -1}},
-		},
-	}
-	if _, err := messageCollection.Indexes().CreateMany(ctx, messageIndexes); err != nil {
-		log.Printf("Failed to create message indexes: %v", err)
-		return err
-	}
-
-	return nil
-}
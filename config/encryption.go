@@ -0,0 +1,20 @@
+package config
+
+import "strings"
+
+// EncryptionPolicy configures application-level encryption of message content in MongoDB
+type EncryptionPolicy struct {
+	KeyFile string // Key encryption keys, see atrest.LoadKeyFile. Empty = disabled
+}
+
+// Encryption reads the policy from MESSAGE_ENCRYPTION_KEY_FILE
+func Encryption() EncryptionPolicy {
+	return EncryptionPolicy{
+		KeyFile: strings.TrimSpace(GetEnvWithDefault("MESSAGE_ENCRYPTION_KEY_FILE", "")),
+	}
+}
+
+// Enabled reports whether new message content is encrypted
+func (p EncryptionPolicy) Enabled() bool {
+	return p.KeyFile != ""
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"sync"
 	"time"
@@ -36,3 +38,12 @@ func GetNextUserID() string {
 	// Format as 3-digit string with leading zeros
 	return fmt.Sprintf("%03d", result.Seq)
 }
+
+// GenerateToken returns a random hex token of nBytes bytes of entropy
+func GenerateToken(nBytes int) (string, error) {
+	b := make([]byte, nBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
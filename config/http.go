@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default origins of the local frontend dev servers
+const defaultAllowedOrigins = "http://localhost:3000,http://localhost:5173"
+
+// CORSPolicy controls which browser origins may call the API
+type CORSPolicy struct {
+	AllowedOrigins   []string // "*" allows any origin, only without credentials
+	AllowCredentials bool     // Send cookies cross-origin
+}
+
+// CORS reads the policy from CORS_ALLOWED_ORIGINS (comma separated) and
+// CORS_ALLOW_CREDENTIALS
+func CORS() CORSPolicy {
+	var origins []string
+	for _, origin := range strings.Split(GetEnvWithDefault("CORS_ALLOWED_ORIGINS", defaultAllowedOrigins), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	return CORSPolicy{
+		AllowedOrigins:   origins,
+		AllowCredentials: GetEnvWithDefault("CORS_ALLOW_CREDENTIALS", "true") == "true",
+	}
+}
+
+// AllowsAnyOrigin reports whether the wildcard origin is configured
+func (p CORSPolicy) AllowsAnyOrigin() bool {
+	for _, origin := range p.AllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether requests from origin are permitted
+func (p CORSPolicy) Allows(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsListed reports whether origin is named in the policy, ignoring the wildcard
+func (p CORSPolicy) AllowsListed(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed != "*" && strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate rejects combinations browsers refuse or that would leak credentials
+func (p CORSPolicy) Validate() error {
+	if len(p.AllowedOrigins) == 0 {
+		return fmt.Errorf("CORS_ALLOWED_ORIGINS is empty")
+	}
+	if p.AllowCredentials && p.AllowsAnyOrigin() {
+		return fmt.Errorf("CORS_ALLOWED_ORIGINS=* cannot be combined with CORS_ALLOW_CREDENTIALS=true")
+	}
+	return nil
+}
+
+// CookiePolicy holds the attributes of the session cookie
+type CookiePolicy struct {
+	SameSite string // "Strict", "Lax" or "None"
+	Secure   bool
+	Domain   string // Empty = host-only cookie
+}
+
+// Cookies reads the policy from COOKIE_SAMESITE, COOKIE_SECURE and COOKIE_DOMAIN.
+// Secure defaults to on in production. Frontends on another site need
+// COOKIE_SAMESITE=None, which browsers only accept on Secure cookies.
+func Cookies() CookiePolicy {
+	policy := CookiePolicy{
+		SameSite: "Strict",
+		Secure:   IsProduction(),
+		Domain:   strings.TrimSpace(GetEnvWithDefault("COOKIE_DOMAIN", "")),
+	}
+
+	switch strings.ToLower(GetEnvWithDefault("COOKIE_SAMESITE", "strict")) {
+	case "lax":
+		policy.SameSite = "Lax"
+	case "none":
+		policy.SameSite = "None"
+	}
+
+	switch GetEnvWithDefault("COOKIE_SECURE", "") {
+	case "true":
+		policy.Secure = true
+	case "false":
+		policy.Secure = false
+	}
+
+	return policy
+}
+
+// Validate rejects cookies browsers would drop
+func (p CookiePolicy) Validate() error {
+	if p.SameSite == "None" && !p.Secure {
+		return fmt.Errorf("COOKIE_SAMESITE=None requires COOKIE_SECURE=true")
+	}
+	return nil
+}
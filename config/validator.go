@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Validation helpers
@@ -40,3 +42,21 @@ func GetEnvWithDefault(key, defaultValue string) string {
 func IsProduction() bool {
 	return strings.ToLower(os.Getenv("ENVIRONMENT")) == "production"
 }
+
+func GetDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func GetIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/coldstore"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const accountDeletionSweepInterval = 10 * time.Minute
+
+// accountDeletionGracePeriod returns how long a deactivated account can still be restored
+func accountDeletionGracePeriod() time.Duration {
+	return config.GetDurationEnv("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+}
+
+func DeactivateAccount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	// Hide the account until the next login, incoming messages are still stored
+	_, err := config.DB.Collection("users").UpdateOne(c.UserContext(),
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{
+			"status":    models.UserStatusDeactivated,
+			"online":    false,
+			"last_seen": time.Now(),
+		}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to deactivate account",
+		})
+	}
+
+	hub.Disconnect(userID, models.DisconnectReasonAccountDeactivated)
+	clearJWTCookie(c)
+
+	return c.JSON(fiber.Map{
+		"message": "Account deactivated, log in again to reactivate",
+	})
+}
+
+func DeleteAccount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var input models.DeleteAccountRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if input.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Password is required",
+		})
+	}
+
+	var user models.User
+	err := config.DB.Collection("users").FindOne(c.UserContext(),
+		bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.DeletionScheduledAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":                 "Account deletion already scheduled",
+			"deletion_scheduled_at": user.DeletionScheduledAt,
+		})
+	}
+
+	// Require the current password before deactivating
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid password",
+		})
+	}
+
+	scheduledAt := time.Now().Add(accountDeletionGracePeriod())
+
+	// Deactivate immediately, scrubbing happens after the grace period
+	_, err = config.DB.Collection("users").UpdateOne(c.UserContext(),
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{
+			"deletion_scheduled_at": scheduledAt,
+			"online":                false,
+			"last_seen":             time.Now(),
+		}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to schedule account deletion",
+		})
+	}
+
+	hub.Disconnect(userID, models.DisconnectReasonAccountDeleted)
+	clearJWTCookie(c)
+
+	return c.JSON(fiber.Map{
+		"message":               "Account deactivated and scheduled for deletion",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+func CancelAccountDeletion(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	result, err := config.DB.Collection("users").UpdateOne(c.UserContext(),
+		bson.M{
+			"_id":                   userID,
+			"deletion_scheduled_at": bson.M{"$gt": time.Now()},
+			"deleted_at":            bson.M{"$exists": false},
+		},
+		bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel account deletion",
+		})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No pending account deletion",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Account deletion cancelled",
+	})
+}
+
+// StartAccountDeletionWorker periodically scrubs accounts whose grace period has ended
+func StartAccountDeletionWorker() {
+	go func() {
+		ticker := time.NewTicker(accountDeletionSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			scrubDeletedAccounts()
+			<-ticker.C
+		}
+	}()
+}
+
+func scrubDeletedAccounts() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Guests that were never upgraded are scrubbed once they expire
+	cursor, err := config.DB.Collection("users").Find(ctx, bson.M{
+		"$or": []bson.M{
+			{"deletion_scheduled_at": bson.M{"$lte": time.Now()}},
+			{"guest_expires_at": bson.M{"$lte": time.Now()}},
+		},
+		"deleted_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		log.Printf("Failed to fetch accounts pending deletion: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			log.Printf("Failed to decode account pending deletion: %v", err)
+			continue
+		}
+
+		if err := scrubAccount(ctx, user.ID); err != nil {
+			log.Printf("Failed to scrub account %s: %v", user.ID, err)
+			continue
+		}
+
+		log.Printf("Account %s scrubbed after deletion grace period", user.ID)
+	}
+}
+
+// scrubAccount removes the user's PII and anonymizes their side of message history
+func scrubAccount(ctx context.Context, userID string) error {
+	// Anonymize messages first so a failure leaves the account eligible for a retry
+	_, err := config.DB.Collection("messages").UpdateMany(ctx,
+		bson.M{"sender_id": userID},
+		bson.M{"$set": bson.M{"content": "", "type": models.MessageTypeDeleted}, "$unset": bson.M{"entities": "", "sealed_content": "", "sealed_entities": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if err := coldstore.Scrub(ctx, bson.M{"sender_id": userID}); err != nil {
+		return err
+	}
+
+	// Nobody should be able to start new encrypted sessions with a deleted account
+	_, err = config.DB.Collection("key_bundles").DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+
+	// Uploaded files go too, the messages linking to them were emptied above
+	if err := deleteUserAttachments(ctx, userID); err != nil {
+		return err
+	}
+
+	// Private nicknames and notes about other users go with the account
+	_, err = config.DB.Collection("contacts").DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+
+	// So do the labels and themes the user put on conversations
+	_, err = config.DB.Collection("labels").DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+	_, err = config.DB.Collection("appearances").DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+
+	// Placeholder username/email keep the unique indexes satisfied, the display name
+	// and its search index go so the account can't be found by it anymore, and
+	// former usernames are forgotten
+	_, err = config.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set": bson.M{
+				"username":           fmt.Sprintf("deleted_%s", userID),
+				"username_canonical": fmt.Sprintf("deleted_%s", userID),
+				"email":              fmt.Sprintf("deleted_%s@deleted.invalid", userID),
+				"email_canonical":    fmt.Sprintf("deleted_%s@deleted.invalid", userID),
+				"password":           "",
+				"bio":                "",
+				"avatar":             "",
+				"online":             false,
+				"deleted_at":         time.Now(),
+			},
+			"$unset": bson.M{
+				"display_name":        "",
+				"search_prefixes":     "",
+				"search_trigrams":     "",
+				"username_history":    "",
+				"username_changed_at": "",
+			},
+		},
+	)
+	return err
+}
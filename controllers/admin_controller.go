@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/coldstore"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DisconnectUserSession force-closes a user's WebSocket session. The optional
+// reason query is sent to the client (kicked, password_changed or session_revoked).
+func DisconnectUserSession(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	reason := c.Query("reason", models.DisconnectReasonKicked)
+	switch reason {
+	case models.DisconnectReasonKicked, models.DisconnectReasonPasswordChanged, models.DisconnectReasonSessionRevoked:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Reason must be kicked, password_changed or session_revoked",
+		})
+	}
+
+	if !hub.Disconnect(userID, reason) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User has no active session",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session disconnected",
+	})
+}
+
+// SendServiceNotice pushes an announcement to every connected user
+func SendServiceNotice(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var input models.ServiceNoticeRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	sent := hub.BroadcastAll(models.Event{
+		Event: models.EventServiceNotice,
+		Data: fiber.Map{
+			"message": input.Message,
+			"level":   input.Level,
+			"sent_at": time.Now(),
+		},
+	})
+
+	log.Printf("Service notice (%s) sent by %s to %d users: %s", input.Level, adminID, sent, input.Message)
+
+	return c.JSON(fiber.Map{
+		"message":    "Notice sent",
+		"recipients": sent,
+	})
+}
+
+// DeleteAnyMessage tombstones a direct, room or channel message regardless of sender
+func DeleteAnyMessage(c *fiber.Ctx) error {
+	moderatorID := c.Locals("user_id").(string)
+
+	messageID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid message ID",
+		})
+	}
+
+	var message models.Message
+	err = config.DB.Collection("messages").FindOneAndUpdate(c.UserContext(),
+		bson.M{"_id": messageID},
+		bson.M{"$set": bson.M{"content": "", "type": models.MessageTypeDeleted}, "$unset": bson.M{"entities": "", "sealed_content": "", "sealed_entities": ""}},
+	).Decode(&message)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Message not found",
+		})
+	}
+
+	if err := coldstore.Scrub(c.UserContext(), bson.M{"_id": message.ID}); err != nil {
+		log.Printf("Failed to scrub archived message %s: %v", message.ID.Hex(), err)
+	}
+
+	log.Printf("Message %s from user %s deleted by %s", message.ID.Hex(), message.SenderID, moderatorID)
+
+	event := fiber.Map{
+		"message_id": message.ID,
+		"deleted_by": moderatorID,
+	}
+	switch {
+	case message.RoomID != "":
+		var room models.Room
+		roomID, _ := primitive.ObjectIDFromHex(message.RoomID)
+		if err := config.DB.Collection("rooms").FindOne(c.UserContext(), bson.M{"_id": roomID}).Decode(&room); err == nil {
+			event["room_id"] = room.ID
+			notifyRoom(&room, models.EventMessageDeleted, event)
+		}
+	case message.ChannelID == "":
+		hub.sendToUsers([]string{message.SenderID, message.ReceiverID},
+			models.Event{Event: models.EventMessageDeleted, Data: event})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Message deleted successfully",
+	})
+}
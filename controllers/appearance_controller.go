@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// appearancesOf returns the owner's per-conversation theme settings keyed by
+// conversation or room ID, empty if there are none
+func appearancesOf(ctx context.Context, ownerID string) map[string]models.Appearance {
+	// Appearance is stored in MongoDB only, other backends have none
+	if config.DB == nil {
+		return nil
+	}
+
+	var appearances models.Appearances
+	err := config.DB.Collection("appearances").FindOne(ctx, bson.M{"_id": ownerID}).Decode(&appearances)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Failed to load appearance settings of user %s: %v", ownerID, err)
+		}
+		return nil
+	}
+	return appearances.Conversations
+}
+
+// appearanceField is the path of a field of the appearance of conversationID
+func appearanceField(conversationID, field string) string {
+	return "conversations." + conversationID + "." + field
+}
+
+// GetAppearances lists the caller's conversation themes, for devices that sync
+// over HTTP instead of the hello event
+func GetAppearances(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	appearances := appearancesOf(ctx, currentUserID)
+	if appearances == nil {
+		appearances = map[string]models.Appearance{}
+	}
+
+	return c.JSON(fiber.Map{
+		"conversations": appearances,
+	})
+}
+
+// setAppearance changes the caller's theme of a direct conversation or room and
+// tells the caller's other devices
+func setAppearance(c *fiber.Ctx, userID, conversationID string) error {
+	var input models.UpdateAppearanceRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	set := bson.M{appearanceField(conversationID, "updated_at"): time.Now()}
+	unset := bson.M{}
+
+	// Cleared fields are removed rather than stored empty
+	if input.AccentColor != nil {
+		*input.AccentColor = strings.ToLower(*input.AccentColor)
+	}
+	for field, value := range map[string]*string{"wallpaper": input.Wallpaper, "accent_color": input.AccentColor} {
+		if value == nil {
+			continue
+		}
+		if *value != "" {
+			set[appearanceField(conversationID, field)] = *value
+		} else {
+			unset[appearanceField(conversationID, field)] = ""
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var appearances models.Appearances
+	err := config.DB.Collection("appearances").FindOneAndUpdate(ctx,
+		bson.M{"_id": userID}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&appearances)
+	if err != nil {
+		log.Printf("Failed to update appearance of %s for user %s: %v", conversationID, userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update appearance",
+		})
+	}
+
+	appearance := appearances.Conversations[conversationID]
+
+	// Back to the default look, nothing left to remember
+	if appearance.IsEmpty() {
+		if _, err := config.DB.Collection("appearances").UpdateOne(ctx,
+			bson.M{"_id": userID},
+			bson.M{"$unset": bson.M{"conversations." + conversationID: ""}},
+		); err != nil {
+			log.Printf("Failed to remove default appearance of %s for user %s: %v", conversationID, userID, err)
+		}
+	}
+
+	hub.sendToUsers([]string{userID}, models.Event{
+		Event: models.EventAppearanceUpdated,
+		Data: fiber.Map{
+			"conversation_id": conversationID,
+			"appearance":      appearance,
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"conversation_id": conversationID,
+		"appearance":      appearance,
+	})
+}
+
+// UpdateConversationAppearance sets the caller's wallpaper or accent color for a
+// direct conversation, the other participant keeps their own
+func UpdateConversationAppearance(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	conversationID := c.Params("id")
+
+	// The ID becomes part of a field path
+	participants, ok := models.ConversationParticipants(conversationID)
+	if !ok || (participants[0] != currentUserID && participants[1] != currentUserID) ||
+		strings.ContainsAny(conversationID, ".$") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	return setAppearance(c, currentUserID, conversationID)
+}
+
+// UpdateRoomAppearance sets the caller's wallpaper or accent color for a room
+func UpdateRoomAppearance(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	return setAppearance(c, currentUserID, room.ID.Hex())
+}
@@ -0,0 +1,536 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/scan"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AttachmentMaxSize is the largest file a single upload may carry, in bytes
+func AttachmentMaxSize() int {
+	return config.GetIntEnv("ATTACHMENT_MAX_SIZE", 10<<20)
+}
+
+// defaultStorageQuota is how many attachment bytes an account may store unless an
+// admin set its own quota. Guests get a smaller one.
+func defaultStorageQuota(guest bool) int64 {
+	if guest {
+		return int64(config.GetIntEnv("GUEST_STORAGE_QUOTA", 10<<20))
+	}
+	return int64(config.GetIntEnv("STORAGE_QUOTA", 1<<30))
+}
+
+// storageQuota returns the quota that applies to the usage
+func storageQuota(usage *models.StorageUsage, guest bool) int64 {
+	if usage.Quota != nil {
+		return *usage.Quota
+	}
+	return defaultStorageQuota(guest)
+}
+
+// storageUsageOf returns the user's attachment usage, zero when they never uploaded
+func storageUsageOf(ctx context.Context, userID string) (*models.StorageUsage, error) {
+	usage := models.StorageUsage{UserID: userID}
+	err := config.DB.Collection("storage_usage").FindOne(ctx, bson.M{"_id": userID}).Decode(&usage)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// reserveStorage counts size against the user's quota before the upload starts,
+// reporting false when it does not fit. The check and the increment are one update
+// so concurrent uploads cannot overshoot the quota together.
+func reserveStorage(ctx context.Context, userID string, size int64, guest bool) (bool, error) {
+	coll := config.DB.Collection("storage_usage")
+	now := time.Now()
+
+	// The quota check below only matches an existing document
+	_, err := coll.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$setOnInsert": bson.M{"bytes": int64(0), "files": 0, "updated_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+
+	result, err := coll.UpdateOne(ctx,
+		bson.M{
+			"_id": userID,
+			"$expr": bson.M{"$lte": bson.A{
+				bson.M{"$add": bson.A{"$bytes", size}},
+				bson.M{"$ifNull": bson.A{"$quota", defaultStorageQuota(guest)}},
+			}},
+		},
+		bson.M{"$inc": bson.M{"bytes": size, "files": 1}, "$set": bson.M{"updated_at": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// releaseStorage gives back the bytes of a deleted or failed upload
+func releaseStorage(ctx context.Context, userID string, size int64) {
+	_, err := config.DB.Collection("storage_usage").UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"bytes": -size, "files": -1}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Failed to release %d bytes of storage for user %s: %v", size, userID, err)
+	}
+}
+
+// attachmentFile holds the fields of a GridFS files document the quota needs
+type attachmentFile struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	Length int64              `bson:"length"`
+}
+
+// attachmentURL is where clients download an attachment, used as the content of image messages
+func attachmentURL(id primitive.ObjectID) string {
+	return "/api/v1/attachments/" + id.Hex()
+}
+
+// attachmentFilename keeps the base name of an uploaded file, without any path a
+// client sent along, cut to a length that fits a header
+func attachmentFilename(name string) string {
+	name = config.SanitizeString(filepath.Base(filepath.Clean("/" + name)))
+	if name == "" || name == "/" || name == "." {
+		name = "attachment"
+	}
+	if utf8.RuneCountInString(name) > 200 {
+		name = string([]rune(name)[:200])
+	}
+	return name
+}
+
+// inlineContentType reports whether browsers may show the attachment in place.
+// SVG images can carry scripts, they are downloaded like any other document.
+func inlineContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "image/svg") {
+		return false
+	}
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "audio/") || strings.HasPrefix(contentType, "video/")
+}
+
+// storageUsageView describes usage against the quota that applies to it
+func storageUsageView(usage *models.StorageUsage, guest bool) fiber.Map {
+	quota := storageQuota(usage, guest)
+	return fiber.Map{
+		"bytes":               usage.Bytes,
+		"files":               usage.Files,
+		"quota":               quota,
+		"remaining":           max(quota-usage.Bytes, 0),
+		"custom_quota":        usage.Quota != nil,
+		"max_attachment_size": AttachmentMaxSize(),
+	}
+}
+
+// UploadAttachment stores a file sent as the "file" form field and returns its URL,
+// which can then be sent as an image message. With a scanner configured the file is
+// quarantined until scanned, infected files are rejected.
+func UploadAttachment(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	guest := middleware.IsGuest(c)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "file is required",
+		})
+	}
+
+	if file.Size > int64(AttachmentMaxSize()) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error":    fmt.Sprintf("Attachment too large (max %d bytes)", AttachmentMaxSize()),
+			"code":     models.ErrCodeAttachmentTooLarge,
+			"max_size": AttachmentMaxSize(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), time.Minute)
+	defer cancel()
+
+	ok, err := reserveStorage(ctx, currentUserID, file.Size, guest)
+	if err != nil {
+		log.Printf("Failed to reserve storage for user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to upload attachment",
+		})
+	}
+	if !ok {
+		usage, err := storageUsageOf(ctx, currentUserID)
+		if err != nil {
+			usage = &models.StorageUsage{UserID: currentUserID}
+		}
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "Storage quota exceeded, delete attachments to free up space",
+			"code":  models.ErrCodeStorageQuotaExceeded,
+			"usage": storageUsageView(usage, guest),
+		})
+	}
+
+	scanner := scan.Default()
+	attachment := models.Attachment{
+		ID:          primitive.NewObjectID(),
+		Filename:    attachmentFilename(file.Filename),
+		ContentType: file.Header.Get(fiber.HeaderContentType),
+		Size:        file.Size,
+		ScanStatus:  models.ScanStatusNotScanned,
+		CreatedAt:   time.Now(),
+	}
+	if attachment.ContentType == "" {
+		attachment.ContentType = "application/octet-stream"
+	}
+	if scanner != nil {
+		attachment.ScanStatus = models.ScanStatusPending
+	}
+	attachment.URL = attachmentURL(attachment.ID)
+	meta := models.AttachmentMeta{OwnerID: currentUserID, ContentType: attachment.ContentType, ScanStatus: attachment.ScanStatus}
+
+	err = func() error {
+		src, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		bucket, err := gridfs.NewBucket(config.DB)
+		if err != nil {
+			return err
+		}
+		if err := bucket.SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+			return err
+		}
+		return bucket.UploadFromStreamWithID(attachment.ID, attachment.Filename, src, options.GridFSUpload().SetMetadata(meta))
+	}()
+	if err != nil {
+		releaseStorage(context.Background(), currentUserID, file.Size)
+		log.Printf("Failed to store attachment of user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to upload attachment",
+		})
+	}
+
+	// A failed scan leaves the file quarantined for the retry worker
+	if scanner != nil {
+		stored := scannedFile{ID: attachment.ID, Length: attachment.Size, Filename: attachment.Filename, Metadata: meta}
+		status, err := scanAttachment(ctx, scanner, stored)
+		if err != nil {
+			log.Printf("Failed to scan attachment %s, left in quarantine: %v", attachment.ID.Hex(), err)
+		}
+		if status == models.ScanStatusInfected {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": "Attachment rejected, malware detected",
+				"code":  models.ErrCodeAttachmentInfected,
+			})
+		}
+		attachment.ScanStatus = status
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"attachment": attachment,
+	})
+}
+
+// GetAttachmentInfo returns an attachment's metadata, including its scan status,
+// to the same users who may download it
+func GetAttachmentInfo(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid attachment ID",
+		})
+	}
+
+	var file scannedFile
+	err = config.DB.Collection("fs.files").FindOne(c.UserContext(), bson.M{"_id": id}).Decode(&file)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load attachment",
+		})
+	}
+
+	contentType := file.Metadata.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return c.JSON(fiber.Map{
+		"attachment": models.Attachment{
+			ID:          file.ID,
+			Filename:    file.Filename,
+			ContentType: contentType,
+			Size:        file.Length,
+			URL:         attachmentURL(file.ID),
+			ScanStatus:  file.Metadata.Scan(),
+			CreatedAt:   file.UploadDate,
+		},
+	})
+}
+
+// GetAttachment streams an attachment. Like the image URLs messages carried before,
+// any logged-in user holding the URL can download it.
+func GetAttachment(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid attachment ID",
+		})
+	}
+
+	bucket, err := gridfs.NewBucket(config.DB)
+	if err == nil {
+		err = bucket.SetReadDeadline(time.Now().Add(5 * time.Minute))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load attachment",
+		})
+	}
+
+	stream, err := bucket.OpenDownloadStream(id)
+	if err == gridfs.ErrFileNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load attachment",
+		})
+	}
+
+	file := stream.GetFile()
+	var meta models.AttachmentMeta
+	if len(file.Metadata) > 0 {
+		bson.Unmarshal(file.Metadata, &meta)
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = "application/octet-stream"
+	}
+
+	// Quarantined files are not served until the scanner clears them
+	if meta.Scan() == models.ScanStatusPending {
+		stream.Close()
+		return c.Status(fiber.StatusLocked).JSON(fiber.Map{
+			"error": "Attachment is still being scanned",
+			"code":  models.ErrCodeAttachmentScanning,
+		})
+	}
+
+	// Uploads are user controlled: browsers must not guess a more dangerous type, and
+	// anything but plain media is downloaded instead of rendered on our origin
+	disposition := "attachment"
+	if inlineContentType(meta.ContentType) {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentType, meta.ContentType)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "sandbox; default-src 'none'")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("%s; filename=%q", disposition, file.Name))
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+
+	// The stream is closed once the body is sent
+	return c.SendStream(stream, int(file.Length))
+}
+
+// DeleteAttachment removes one of the caller's attachments and frees its space
+func DeleteAttachment(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid attachment ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 30*time.Second)
+	defer cancel()
+
+	var file attachmentFile
+	err = config.DB.Collection("fs.files").FindOne(ctx, bson.M{"_id": id, "metadata.owner_id": currentUserID}).Decode(&file)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	}
+
+	bucket, err := gridfs.NewBucket(config.DB)
+	if err == nil {
+		err = bucket.DeleteContext(ctx, id)
+	}
+	// A concurrent delete already gave the space back
+	if err == gridfs.ErrFileNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	} else if err != nil {
+		log.Printf("Failed to delete attachment %s: %v", id.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete attachment",
+		})
+	}
+	releaseStorage(ctx, currentUserID, file.Length)
+
+	return c.JSON(fiber.Map{
+		"message": "Attachment deleted",
+	})
+}
+
+// deleteUserAttachments removes every attachment of a deleted account
+func deleteUserAttachments(ctx context.Context, userID string) error {
+	bucket, err := gridfs.NewBucket(config.DB)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := bucket.FindContext(ctx, bson.M{"metadata.owner_id": userID})
+	if err != nil {
+		return err
+	}
+	var files []attachmentFile
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := bucket.DeleteContext(ctx, file.ID); err != nil && err != gridfs.ErrFileNotFound {
+			return err
+		}
+	}
+
+	_, err = config.DB.Collection("storage_usage").DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+// GetStorageUsage reports the caller's attachment usage and quota
+func GetStorageUsage(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	usage, err := storageUsageOf(ctx, currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load storage usage",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"usage": storageUsageView(usage, middleware.IsGuest(c)),
+	})
+}
+
+// GetUserStorageUsage lets admins look at an account's attachment usage
+func GetUserStorageUsage(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.Users().GetByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	usage, err := storageUsageOf(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load storage usage",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id": user.ID,
+		"usage":   storageUsageView(usage, user.IsGuest()),
+	})
+}
+
+// UpdateUserStorageQuota sets an account's quota, or restores the default with null.
+// Lowering it below the current usage only blocks new uploads.
+func UpdateUserStorageQuota(c *fiber.Ctx) error {
+	actorID := c.Locals("user_id").(string)
+
+	var input models.UpdateStorageQuotaRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+	if input.Quota != nil && *input.Quota < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "quota must not be negative",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.Users().GetByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"updated_at": time.Now()},
+		"$setOnInsert": bson.M{"bytes": int64(0), "files": 0},
+	}
+	if input.Quota != nil {
+		update["$set"].(bson.M)["quota"] = *input.Quota
+	} else {
+		update["$unset"] = bson.M{"quota": ""}
+	}
+	_, err = config.DB.Collection("storage_usage").UpdateOne(ctx, bson.M{"_id": user.ID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update quota",
+		})
+	}
+
+	usage, err := storageUsageOf(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load storage usage",
+		})
+	}
+
+	log.Printf("Storage quota of user %s set to %s by %s", user.ID, quotaLabel(input.Quota), actorID)
+
+	return c.JSON(fiber.Map{
+		"user_id": user.ID,
+		"usage":   storageUsageView(usage, user.IsGuest()),
+	})
+}
+
+func quotaLabel(quota *int64) string {
+	if quota == nil {
+		return "default"
+	}
+	return fmt.Sprintf("%d bytes", *quota)
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/scan"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// attachmentScanBatch caps how many quarantined files one retry pass scans
+const attachmentScanBatch = 100
+
+// scannedFile holds the fields of a GridFS files document a scan needs
+type scannedFile struct {
+	ID         primitive.ObjectID    `bson:"_id"`
+	Length     int64                 `bson:"length"`
+	Filename   string                `bson:"filename"`
+	UploadDate time.Time             `bson:"uploadDate"`
+	Metadata   models.AttachmentMeta `bson:"metadata"`
+}
+
+// scanAttachment runs the scanner over a stored file. Clean files leave quarantine,
+// infected ones are deleted, refunded and audited. On error the file stays pending.
+func scanAttachment(ctx context.Context, scanner scan.Scanner, file scannedFile) (string, error) {
+	bucket, err := gridfs.NewBucket(config.DB)
+	if err != nil {
+		return models.ScanStatusPending, err
+	}
+	stream, err := bucket.OpenDownloadStream(file.ID)
+	if err != nil {
+		return models.ScanStatusPending, err
+	}
+	result, err := scanner.Scan(ctx, stream)
+	stream.Close()
+	if err != nil {
+		return models.ScanStatusPending, err
+	}
+
+	if result.Infected {
+		// A file deleted meanwhile, by its owner or another instance, was refunded there
+		err := bucket.DeleteContext(ctx, file.ID)
+		switch {
+		case err == nil:
+			releaseStorage(ctx, file.Metadata.OwnerID, file.Length)
+		case err != gridfs.ErrFileNotFound:
+			return models.ScanStatusPending, err
+		}
+		writeScanAudit(file, scanner.Name(), result.Signature)
+		log.Printf("Attachment %s of user %s rejected by %s: %s", file.ID.Hex(), file.Metadata.OwnerID, scanner.Name(), result.Signature)
+		return models.ScanStatusInfected, nil
+	}
+
+	_, err = config.DB.Collection("fs.files").UpdateOne(ctx,
+		bson.M{"_id": file.ID},
+		bson.M{"$set": bson.M{"metadata.scan_status": models.ScanStatusClean, "metadata.scanned_at": time.Now()}},
+	)
+	if err != nil {
+		return models.ScanStatusPending, err
+	}
+	return models.ScanStatusClean, nil
+}
+
+func writeScanAudit(file scannedFile, scanner, signature string) {
+	audit := models.AttachmentScanAudit{
+		AttachmentID: file.ID,
+		OwnerID:      file.Metadata.OwnerID,
+		Filename:     file.Filename,
+		ContentType:  file.Metadata.ContentType,
+		Size:         file.Length,
+		Scanner:      scanner,
+		Signature:    signature,
+		CreatedAt:    time.Now(),
+	}
+	if _, err := config.DB.Collection("attachment_scan_audit").InsertOne(context.Background(), audit); err != nil {
+		log.Printf("Failed to write attachment scan audit entry: %v", err)
+	}
+}
+
+// StartAttachmentScanWorker retries the scans of quarantined files, left pending
+// when the scanner failed or timed out during the upload
+func StartAttachmentScanWorker() {
+	scanner := scan.Default()
+	if scanner == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.GetDurationEnv("ATTACHMENT_SCAN_RETRY_INTERVAL", time.Minute))
+		defer ticker.Stop()
+
+		for {
+			<-ticker.C
+			rescanPendingAttachments(scanner)
+		}
+	}()
+}
+
+func rescanPendingAttachments(scanner scan.Scanner) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Uploads still being scanned by their request are left to it
+	cursor, err := config.DB.Collection("fs.files").Find(ctx,
+		bson.M{
+			"metadata.scan_status": models.ScanStatusPending,
+			"uploadDate":           bson.M{"$lt": time.Now().Add(-time.Minute)},
+		},
+		options.Find().SetSort(bson.M{"uploadDate": 1}).SetLimit(attachmentScanBatch),
+	)
+	if err != nil {
+		log.Printf("Failed to find quarantined attachments: %v", err)
+		return
+	}
+	var files []scannedFile
+	if err := cursor.All(ctx, &files); err != nil {
+		log.Printf("Failed to decode quarantined attachments: %v", err)
+		return
+	}
+
+	for _, file := range files {
+		status, err := scanAttachment(ctx, scanner, file)
+		if err != nil {
+			// The scanner is likely down, the rest would fail too
+			log.Printf("Failed to scan attachment %s: %v", file.ID.Hex(), err)
+			return
+		}
+		hub.sendToUsers([]string{file.Metadata.OwnerID}, models.Event{
+			Event: models.EventAttachmentScanned,
+			Data: fiber.Map{
+				"attachment_id": file.ID,
+				"scan_status":   status,
+			},
+		})
+	}
+}
+
+// GetAttachmentScanAudit lists uploads rejected by the malware scanner, newest first
+func GetAttachmentScanAudit(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit > 200 {
+		limit = 200
+	}
+
+	filter := bson.M{}
+	if ownerID := c.Query("owner_id"); ownerID != "" {
+		filter["owner_id"] = ownerID
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(int64(limit))
+	cursor, err := config.DB.Collection("attachment_scan_audit").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Failed to fetch attachment scan audit: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch attachment scan audit",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AttachmentScanAudit{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode attachment scan audit",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"audit": entries,
+		"total": len(entries),
+	})
+}
@@ -7,11 +7,12 @@ import (
 	"time"
 
 	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
 	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -23,6 +24,10 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
+	// Display forms keep their case, uniqueness is checked on the canonical forms
+	input.Email = strings.TrimSpace(input.Email)
+	input.Username = strings.TrimSpace(input.Username)
+
 	// Validate input
 	if validationErrors := input.Validate(); len(validationErrors) > 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -31,34 +36,37 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Normalize email
-	input.Email = strings.ToLower(strings.TrimSpace(input.Email))
-	input.Username = strings.TrimSpace(input.Username)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
 
 	// Check if email or username already exists
-	var existingUser models.User
-	err := config.DB.Collection("users").FindOne(context.Background(), bson.M{
-		"$or": []bson.M{
-			{"email": input.Email},
-			{"username": input.Username},
-		},
-	}).Decode(&existingUser)
-
+	existingUser, err := store.Users().FindByEmailOrUsername(ctx, input.Email, input.Username)
 	if err == nil {
-		if existingUser.Email == input.Email {
+		if existingUser.EmailCanonical == models.CanonicalEmail(input.Email) {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 				"error": "Email already registered",
 			})
 		}
-		if existingUser.Username == input.Username {
+		if existingUser.UsernameCanonical == models.CanonicalUsername(input.Username) {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 				"error": "Username already taken",
 			})
 		}
-	} else if err != mongo.ErrNoDocuments {
+	} else if err != store.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	// Recently given up usernames stay with their previous owner for a while
+	if former, err := reservedUsername(ctx, input.Username); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Database error",
 		})
+	} else if former != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Username already taken",
+		})
 	}
 
 	// Hash password with higher cost for production
@@ -69,21 +77,33 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
+	userID, err := store.Users().NextID(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create user",
+		})
+	}
+
 	// Create user
 	user := models.User{
-		ID:        config.GetNextUserID(),
+		ID:        userID,
 		Username:  input.Username,
 		Email:     input.Email,
 		Password:  string(hashedPassword),
+		Status:    models.UserStatusActive,
 		Online:    false, // Set online via websocket
 		LastSeen:  time.Now(),
 		CreatedAt: time.Now(),
 		Bio:       "",
 		Avatar:    "",
+		Language:  i18n.Match(c.Get(fiber.HeaderAcceptLanguage)),
 	}
 
-	_, err = config.DB.Collection("users").InsertOne(context.Background(), user)
-	if err != nil {
+	if err := store.Users().Create(ctx, &user); err == store.ErrConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Username or email already taken",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
@@ -122,38 +142,41 @@ func Login(c *fiber.Ctx) error {
 	}
 
 	// Basic validation
-	if input.Email == "" || input.Password == "" {
+	identifier := input.Identifier()
+	if identifier == "" || input.Password == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Email and password are required",
+			"error": "Email or username and password are required",
 		})
 	}
 
-	// Normalize email
-	input.Email = strings.ToLower(strings.TrimSpace(input.Email))
-
-	// Find user
-	var user models.User
-	err := config.DB.Collection("users").FindOne(context.Background(),
-		bson.M{"email": input.Email}).Decode(&user)
+	// Find user by either identifier, the store compares canonical forms
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
 
+	var user *models.User
+	var err error
+	if models.IsEmailLogin(identifier) {
+		user, err = store.Users().GetByEmail(ctx, identifier)
+	} else {
+		user, err = store.Users().GetByUsername(ctx, identifier)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid email or password",
+			"error": "Invalid login or password",
 		})
 	}
 
 	// Compare password
 	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid email or password",
+			"error": "Invalid login or password",
 		})
 	}
 
-	// Update last seen
-	config.DB.Collection("users").UpdateOne(context.Background(),
-		bson.M{"_id": user.ID},
-		bson.M{"$set": bson.M{"last_seen": time.Now()}},
-	)
+	// Update last seen and reactivate deactivated accounts
+	status := models.UserStatusActive
+	store.Users().Update(ctx, user.ID, store.UserUpdate{Status: &status})
+	store.Presence().Touch(ctx, user.ID, time.Now())
 
 	// Generate JWT token
 	token, err := generateJWT(user.ID)
@@ -183,27 +206,14 @@ func Logout(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
 	// Set user offline
-	_, err := config.DB.Collection("users").UpdateOne(
-		context.Background(),
-		bson.M{"_id": userID},
-		bson.M{"$set": bson.M{"online": false, "last_seen": time.Now()}},
-	)
+	err := store.Presence().SetOnline(c.UserContext(), userID, false, time.Now())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to update user status",
 		})
 	}
 
-	// Clear cookie dengan cara overwrite dan expired
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    "",
-		Expires:  time.Now().Add(-time.Hour), // expired
-		HTTPOnly: true,
-		Secure:   true, // sesuaikan dengan waktu set cookie
-		SameSite: "Strict",
-		Path:     "/", // harus sama seperti saat set cookie
-	})
+	clearJWTCookie(c)
 
 	return c.JSON(fiber.Map{
 		"message": "Logged out successfully",
@@ -213,6 +223,13 @@ func Logout(c *fiber.Ctx) error {
 func RefreshToken(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
+	// Guest tokens expire with the guest account
+	if middleware.IsGuest(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Guest sessions cannot be refreshed, upgrade to a full account",
+		})
+	}
+
 	// Generate new token
 	token, err := generateJWT(userID)
 	if err != nil {
@@ -231,9 +248,14 @@ func RefreshToken(c *fiber.Ctx) error {
 
 // Helper functions
 func generateJWT(userID string) (string, error) {
+	return signJWT(userID, time.Now().Add(time.Hour*72))
+}
+
+// signJWT issues a session token valid until expiresAt
+func signJWT(userID string, expiresAt time.Time) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+		"exp":     expiresAt.Unix(),
 		"iat":     time.Now().Unix(),
 	}
 
@@ -242,15 +264,26 @@ func generateJWT(userID string) (string, error) {
 }
 
 func setJWTCookie(c *fiber.Ctx, token string) {
-	isSecure := os.Getenv("ENVIRONMENT") == "production"
+	c.Cookie(sessionCookie(token, time.Now().Add(time.Hour*72)))
+}
+
+func clearJWTCookie(c *fiber.Ctx) {
+	// Overwrite with an expired cookie, attributes must match the ones it was set with
+	c.Cookie(sessionCookie("", time.Now().Add(-time.Hour)))
+}
+
+// sessionCookie builds the jwt cookie with the configured SameSite, Secure and Domain
+func sessionCookie(value string, expires time.Time) *fiber.Cookie {
+	policy := config.Cookies()
 
-	c.Cookie(&fiber.Cookie{
+	return &fiber.Cookie{
 		Name:     "jwt",
-		Value:    token,
-		Expires:  time.Now().Add(time.Hour * 72),
+		Value:    value,
+		Expires:  expires,
 		HTTPOnly: true,
-		Secure:   isSecure,
-		SameSite: "Strict",
+		Secure:   policy.Secure,
+		SameSite: policy.SameSite,
+		Domain:   policy.Domain,
 		Path:     "/",
-	})
+	}
 }
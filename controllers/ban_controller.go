@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func writeBanAudit(action string, ban *models.Ban, adminID, reason string) {
+	audit := models.BanAudit{
+		Action:    action,
+		BanID:     ban.ID,
+		Type:      ban.Type,
+		Value:     ban.Value,
+		Reason:    reason,
+		AdminID:   adminID,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := config.DB.Collection("ban_audit").InsertOne(context.Background(), audit); err != nil {
+		log.Printf("Failed to write ban audit entry: %v", err)
+	}
+}
+
+func CreateBan(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var input models.CreateBanRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	if input.Type == models.BanTypeUser && input.Value == adminID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot ban yourself",
+		})
+	}
+
+	ban := models.Ban{
+		ID:        primitive.NewObjectID(),
+		Type:      input.Type,
+		Value:     input.Value,
+		Reason:    config.SanitizeString(input.Reason),
+		BannedBy:  adminID,
+		CreatedAt: time.Now(),
+	}
+
+	// Temporary bans are removed by the TTL index once expired
+	if input.Duration > 0 {
+		expiresAt := time.Now().Add(time.Duration(input.Duration) * time.Second)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	if _, err := config.DB.Collection("bans").InsertOne(c.UserContext(), ban); err != nil {
+		log.Printf("Failed to create ban: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create ban",
+		})
+	}
+
+	writeBanAudit(models.BanActionBan, &ban, adminID, ban.Reason)
+	middleware.RefreshBans()
+
+	// Kick live sessions of banned users
+	if ban.Type == models.BanTypeUser {
+		hub.Disconnect(ban.Value, models.DisconnectReasonBanned)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(ban)
+}
+
+func GetBans(c *fiber.Ctx) error {
+	banType := c.Query("type")
+
+	filter := bson.M{}
+	if banType != "" {
+		filter["type"] = banType
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := config.DB.Collection("bans").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Failed to fetch bans: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch bans",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	bans := []models.Ban{}
+	if err := cursor.All(ctx, &bans); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode bans",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"bans":  bans,
+		"total": len(bans),
+	})
+}
+
+func DeleteBan(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	banID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ban ID",
+		})
+	}
+
+	var ban models.Ban
+	err = config.DB.Collection("bans").FindOneAndDelete(c.UserContext(),
+		bson.M{"_id": banID}).Decode(&ban)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Ban not found",
+		})
+	}
+
+	writeBanAudit(models.BanActionUnban, &ban, adminID, c.Query("reason"))
+	middleware.RefreshBans()
+
+	return c.JSON(fiber.Map{
+		"message": "Ban removed",
+	})
+}
+
+func GetBanAudit(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit > 200 {
+		limit = 200
+	}
+
+	filter := bson.M{}
+	if value := c.Query("value"); value != "" {
+		filter["value"] = value
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(int64(limit))
+	cursor, err := config.DB.Collection("ban_audit").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Failed to fetch ban audit: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch ban audit",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.BanAudit{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode ban audit",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"audit": entries,
+		"total": len(entries),
+	})
+}
@@ -0,0 +1,436 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// channelFanoutChunkSize is how many subscribers are handed to the hub per lock acquisition
+const channelFanoutChunkSize = 500
+
+func findChannel(channelID string) (*models.Channel, error) {
+	objID, err := primitive.ObjectIDFromHex(channelID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid channel ID")
+	}
+
+	var channel models.Channel
+	err = config.DB.Collection("channels").FindOne(context.Background(),
+		bson.M{"_id": objID}).Decode(&channel)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Channel not found")
+	}
+
+	return &channel, nil
+}
+
+func isChannelSubscriber(channel *models.Channel, userID string) bool {
+	count, _ := config.DB.Collection("channel_subscriptions").CountDocuments(context.Background(),
+		bson.M{"channel_id": channel.ID, "user_id": userID})
+	return count > 0
+}
+
+// fanOutToChannel streams subscriber IDs and delivers the payload to connected ones in chunks,
+// without any per-subscriber database writes
+func fanOutToChannel(channel *models.Channel, payload interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	opts := options.Find().
+		SetProjection(bson.M{"user_id": 1}).
+		SetBatchSize(channelFanoutChunkSize)
+
+	cursor, err := config.DB.Collection("channel_subscriptions").Find(ctx,
+		bson.M{"channel_id": channel.ID}, opts)
+	if err != nil {
+		log.Printf("Failed to fetch subscribers of channel %s: %v", channel.ID.Hex(), err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// Publishers receive their own posts as confirmation
+	chunk := append(make([]string, 0, channelFanoutChunkSize), channel.Publishers...)
+	delivered := 0
+
+	for cursor.Next(ctx) {
+		var sub models.ChannelSubscription
+		if err := cursor.Decode(&sub); err != nil || channel.IsPublisher(sub.UserID) {
+			continue
+		}
+
+		chunk = append(chunk, sub.UserID)
+		if len(chunk) >= channelFanoutChunkSize {
+			hub.sendToUsers(chunk, payload)
+			delivered += len(chunk)
+			chunk = chunk[:0]
+		}
+	}
+
+	if len(chunk) > 0 {
+		hub.sendToUsers(chunk, payload)
+		delivered += len(chunk)
+	}
+
+	log.Printf("Channel %s broadcast fanned out to %d recipients", channel.ID.Hex(), delivered)
+}
+
+func CreateChannel(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	var input models.CreateChannelRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	channel := models.Channel{
+		ID:          primitive.NewObjectID(),
+		Name:        input.Name,
+		Description: config.SanitizeString(input.Description),
+		OwnerID:     currentUserID,
+		Publishers:  []string{currentUserID},
+		CreatedAt:   time.Now(),
+	}
+
+	if _, err := config.DB.Collection("channels").InsertOne(c.UserContext(), channel); err != nil {
+		log.Printf("Failed to create channel: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create channel",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(channel)
+}
+
+func GetChannel(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	channel, err := findChannel(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"channel":    channel,
+		"subscribed": isChannelSubscriber(channel, currentUserID),
+		"publisher":  channel.IsPublisher(currentUserID),
+	})
+}
+
+func GetSubscribedChannels(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("channel_subscriptions").Find(ctx, bson.M{"user_id": currentUserID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch channels",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	var subs []models.ChannelSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode channels",
+		})
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(subs))
+	for _, sub := range subs {
+		ids = append(ids, sub.ChannelID)
+	}
+
+	channels := []models.Channel{}
+	if len(ids) > 0 {
+		cursor, err := config.DB.Collection("channels").Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch channels",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		if err := cursor.All(ctx, &channels); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode channels",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"channels": channels,
+		"total":    len(channels),
+	})
+}
+
+func SubscribeChannel(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	channel, err := findChannel(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	result, err := config.DB.Collection("channel_subscriptions").UpdateOne(c.UserContext(),
+		bson.M{"channel_id": channel.ID, "user_id": currentUserID},
+		bson.M{"$setOnInsert": bson.M{"subscribed_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to subscribe",
+		})
+	}
+
+	if err == nil && result.UpsertedCount > 0 {
+		config.DB.Collection("channels").UpdateOne(context.Background(),
+			bson.M{"_id": channel.ID},
+			bson.M{"$inc": bson.M{"subscriber_count": 1}},
+		)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Subscribed to channel",
+	})
+}
+
+func UnsubscribeChannel(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	channel, err := findChannel(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	result, err := config.DB.Collection("channel_subscriptions").DeleteOne(c.UserContext(),
+		bson.M{"channel_id": channel.ID, "user_id": currentUserID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unsubscribe",
+		})
+	}
+
+	if result.DeletedCount > 0 {
+		config.DB.Collection("channels").UpdateOne(context.Background(),
+			bson.M{"_id": channel.ID},
+			bson.M{"$inc": bson.M{"subscriber_count": -1}},
+		)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Unsubscribed from channel",
+	})
+}
+
+func AddChannelPublisher(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	channel, err := findChannel(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	if channel.OwnerID != currentUserID {
+		return fiber.NewError(fiber.StatusForbidden, "Only the channel owner can manage publishers")
+	}
+
+	var input models.AddChannelPublisherRequest
+	if err := c.BodyParser(&input); err != nil || input.UserID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "user_id is required",
+		})
+	}
+
+	count, _ := config.DB.Collection("users").CountDocuments(c.UserContext(), bson.M{
+		"_id":        input.UserID,
+		"deleted_at": bson.M{"$exists": false},
+	})
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	_, err = config.DB.Collection("channels").UpdateOne(c.UserContext(),
+		bson.M{"_id": channel.ID},
+		bson.M{"$addToSet": bson.M{"publishers": input.UserID}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add publisher",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Publisher added",
+	})
+}
+
+func RemoveChannelPublisher(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	targetUserID := c.Params("user_id")
+
+	channel, err := findChannel(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	if channel.OwnerID != currentUserID {
+		return fiber.NewError(fiber.StatusForbidden, "Only the channel owner can manage publishers")
+	}
+
+	if targetUserID == channel.OwnerID {
+		return fiber.NewError(fiber.StatusForbidden, "The channel owner cannot be removed as publisher")
+	}
+
+	_, err = config.DB.Collection("channels").UpdateOne(c.UserContext(),
+		bson.M{"_id": channel.ID},
+		bson.M{"$pull": bson.M{"publishers": targetUserID}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to remove publisher",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Publisher removed",
+	})
+}
+
+func PublishChannelMessage(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	channel, err := findChannel(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	if !channel.IsPublisher(currentUserID) {
+		return fiber.NewError(fiber.StatusForbidden, "Only publishers can post in this channel")
+	}
+
+	var input models.PublishMessageRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	message := models.Message{
+		ID:        primitive.NewObjectID(),
+		SenderID:  currentUserID,
+		ChannelID: channel.ID.Hex(),
+		Content:   input.Content,
+		Type:      input.Type,
+		CreatedAt: time.Now(),
+	}
+	message.ParseFormatting()
+
+	if decision := moderateMessage(&message); decision.Blocked {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":   "Message rejected by moderation",
+			"reasons": decision.Reasons,
+		})
+	}
+
+	// A single insert regardless of subscriber count
+	if err := store.Messages().Insert(c.UserContext(), &message, models.MessageCreated(&message)); err != nil {
+		log.Printf("Failed to save channel message: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to publish message",
+		})
+	}
+
+	go fanOutToChannel(channel, message)
+
+	return c.Status(fiber.StatusCreated).JSON(message)
+}
+
+func GetChannelMessages(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	channel, err := findChannel(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	if !channel.IsPublisher(currentUserID) && !isChannelSubscriber(channel, currentUserID) {
+		return fiber.NewError(fiber.StatusForbidden, "Subscribe to this channel to read its messages")
+	}
+
+	p, err := parsePage(c, 50, 100)
+	if err != nil {
+		return err
+	}
+
+	opts := options.Find().
+		SetSort(newestFirst).
+		SetSkip(p.skip()).
+		SetLimit(int64(p.Limit) + 1)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"channel_id": channel.ID.Hex()}
+	if before := p.before(); before != nil {
+		filter["$and"] = []bson.M{olderThan(before)}
+	}
+	cursor, err := config.DB.Collection("messages").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Failed to fetch channel messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch messages",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		log.Printf("Failed to decode channel messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode messages",
+		})
+	}
+	messages, pagination := p.messageEnvelope(messages)
+	hydrateArchived(ctx, messages)
+
+	// Reverse to get chronological order
+	for i := len(messages)/2 - 1; i >= 0; i-- {
+		opp := len(messages) - 1 - i
+		messages[i], messages[opp] = messages[opp], messages[i]
+	}
+
+	return c.JSON(fiber.Map{
+		"messages":   messages,
+		"pagination": pagination,
+	})
+}
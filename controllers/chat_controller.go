@@ -4,133 +4,67 @@ import (
 	"context"
 	"log"
 	"os"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/flags"
 	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/Adisonsmn/ngobrolyuk/telemetry"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Client struct {
 	Conn   *websocket.Conn
 	UserID string
-	Send   chan models.Message
+	Send   chan interface{} // models.Message or models.Event
+
+	closeReason string        // Set under the shard lock before Send is closed by the server
+	resumeToken string        // Sent in hello, resumes this session after a drop
+	resumeFrom  string        // Token of the dropped session this connection resumes
+	hello       *models.Event // Queued first on registration
+	connectedAt time.Time     // Set on registration
+	ip          string        // Address the session connected from
+	lastActive  atomic.Int64  // Unix nanoseconds of the last frame the client sent
+	away        atomic.Bool   // Idle for longer than AWAY_AFTER, changed under the shard's presence lock
+	audience    []string      // Users told about the client's presence changes, set before registration
+
+	// focus is the conversation the client has in view, "" when none. Nil until the
+	// client reports focus, such clients get notification events as before.
+	focus atomic.Pointer[string]
+
+	guestExpiresAt *time.Time // Set for guest accounts, disconnected once it passes
+	guestInviters  []string   // Users a guest may send direct messages to
+
+	scope         string // Set for conversation tokens, the only room or direct conversation the session sees
+	integrationID string // Integration that minted the conversation token
 }
 
-type Hub struct {
-	Clients     map[string]*Client
-	Register    chan *Client
-	Unregister  chan *Client
-	Broadcast   chan models.Message
-	Connections int
-	mu          sync.RWMutex
-}
-
-var hub = &Hub{
-	Clients:     make(map[string]*Client),
-	Register:    make(chan *Client),
-	Unregister:  make(chan *Client),
-	Broadcast:   make(chan models.Message, 1000), // Buffer untuk broadcast
-	Connections: 0,
-}
+// setPresence records whether the user is connected and refreshes last seen
+func setPresence(userID string, online bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-func init() {
-	go hub.run()
+	return store.Presence().SetOnline(ctx, userID, online, time.Now())
 }
 
-func (h *Hub) run() {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Hub panic recovered: %v", r)
-			// Restart hub
-			go h.run()
-		}
-	}()
-
-	for {
-		select {
-		case client := <-h.Register:
-			h.mu.Lock()
-			h.Clients[client.UserID] = client
-			h.Connections++
-			h.mu.Unlock()
-
-			log.Printf("User %s connected. Total connections: %d", client.UserID, h.Connections)
-
-			// Set user online dengan error handling
-			go func(userID string) {
-				_, err := config.DB.Collection("users").UpdateOne(context.Background(),
-					bson.M{"_id": userID},
-					bson.M{"$set": bson.M{"online": true, "last_seen": time.Now()}},
-				)
-				if err != nil {
-					log.Printf("Failed to set user %s online: %v", userID, err)
-				}
-			}(client.UserID)
-
-		case client := <-h.Unregister:
-			h.mu.Lock()
-			if _, ok := h.Clients[client.UserID]; ok {
-				delete(h.Clients, client.UserID)
-				h.Connections--
-				close(client.Send)
-				log.Printf("User %s disconnected. Total connections: %d", client.UserID, h.Connections)
-			}
-			h.mu.Unlock()
-
-			// Set user offline dengan error handling
-			go func(userID string) {
-				_, err := config.DB.Collection("users").UpdateOne(context.Background(),
-					bson.M{"_id": userID},
-					bson.M{"$set": bson.M{"online": false, "last_seen": time.Now()}},
-				)
-				if err != nil {
-					log.Printf("Failed to set user %s offline: %v", userID, err)
-				}
-			}(client.UserID)
-
-		case message := <-h.Broadcast:
-			h.mu.Lock()
-			log.Printf("Processing broadcast message: %s -> %s", message.SenderID, message.ReceiverID)
-
-			// Send to receiver
-			if receiverClient, ok := h.Clients[message.ReceiverID]; ok {
-				select {
-				case receiverClient.Send <- message:
-					log.Printf("Message sent to receiver: %s", message.ReceiverID)
-				default:
-					// Handle full channel
-					delete(h.Clients, message.ReceiverID)
-					close(receiverClient.Send)
-					h.Connections--
-					log.Printf("Receiver channel full, disconnected user: %s", message.ReceiverID)
-				}
-			} else {
-				log.Printf("Receiver %s not connected", message.ReceiverID)
-			}
-
-			// Send to sender (for confirmation)
-			if senderClient, ok := h.Clients[message.SenderID]; ok {
-				select {
-				case senderClient.Send <- message:
-					log.Printf("Message confirmation sent to sender: %s", message.SenderID)
-				default:
-					delete(h.Clients, message.SenderID)
-					close(senderClient.Send)
-					h.Connections--
-					log.Printf("Sender channel full, disconnected user: %s", message.SenderID)
-				}
-			} else {
-				log.Printf("Sender %s not connected during broadcast", message.SenderID)
-			}
-			h.mu.Unlock()
-		}
+// closeCode maps a disconnect reason to the WebSocket close status code
+func closeCode(reason string) int {
+	switch reason {
+	case models.DisconnectReasonKicked, models.DisconnectReasonBanned, models.DisconnectReasonSlowConsumer,
+		models.DisconnectReasonSessionLimit:
+		return websocket.ClosePolicyViolation
+	case models.DisconnectReasonServerShutdown:
+		return websocket.CloseGoingAway
+	default:
+		return websocket.CloseNormalClosure
 	}
 }
 
@@ -168,56 +102,85 @@ func TestWebSocketChat(c *websocket.Conn) {
 		return
 	}
 
-	// Check if user already connected
-	hub.mu.RLock()
-	if existingClient, exists := hub.Clients[userID]; exists {
-		log.Printf("User %s already connected, closing previous connection", userID)
-		// Close previous connection
-		existingClient.Conn.Close()
-		close(existingClient.Send)
-		delete(hub.Clients, userID)
+	if !admitSession(c, userID) {
+		return
 	}
-	hub.mu.RUnlock()
 
 	// Create client dengan buffer yang lebih besar
 	client := &Client{
 		Conn:   c,
 		UserID: userID,
-		Send:   make(chan models.Message, 1024), // Increased buffer size
+		Send:   make(chan interface{}, 1024), // Increased buffer size
 	}
+	client.audience = presenceAudience(userID)
 
 	log.Printf("Registering user %s", userID)
 
 	// Register client
-	hub.Register <- client
+	hub.Register(client)
 
 	// Start goroutines
+	hub.writers.Add(1)
 	go client.writePump()
 	client.readPump() // readPump akan block sampai connection closed
 }
 
 func WebSocketChatWithAuth(c *websocket.Conn, userID string) {
-	// Check if user already connected
-	hub.mu.RLock()
-	if existingClient, exists := hub.Clients[userID]; exists {
-		log.Printf("User %s already connected, closing previous connection", userID)
-		existingClient.Conn.Close()
-		close(existingClient.Send)
-		delete(hub.Clients, userID)
+	// Reject accounts that are deactivated or scheduled for deletion
+	user, err := store.Users().GetByID(context.Background(), userID)
+	if err != nil || user.Status == models.UserStatusDeactivated || user.DeletionScheduledAt != nil {
+		log.Printf("WebSocket connection rejected: user %s is not active", userID)
+		c.Close()
+		return
+	}
+
+	// New sessions are refused while the server is going down
+	if hub.shuttingDown.Load() {
+		c.WriteJSON(goodbyeEvent(models.DisconnectReasonServerShutdown))
+		c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+			closeCode(models.DisconnectReasonServerShutdown), models.DisconnectReasonServerShutdown))
+		c.Close()
+		return
+	}
+
+	// Past the per-user session limit the new session is refused, or the hub evicts
+	// the oldest one on registration
+	if !admitSession(c, userID) {
+		return
+	}
+
+	resumeToken, err := config.GenerateToken(16)
+	if err != nil {
+		log.Printf("Failed to generate resume token for user %s: %v", userID, err)
+		c.Close()
+		return
 	}
-	hub.mu.RUnlock()
 
 	// Create client
 	client := &Client{
-		Conn:   c,
-		UserID: userID,
-		Send:   make(chan models.Message, 1024),
+		Conn:        c,
+		UserID:      userID,
+		Send:        make(chan interface{}, 1024),
+		resumeToken: resumeToken,
+		ip:          ipOf(c),
+
+		guestExpiresAt: user.GuestExpiresAt,
+		guestInviters:  user.GuestInviters,
 	}
+	client.scope, _ = c.Locals("conversation_scope").(string)
+	client.integrationID, _ = c.Locals("integration_id").(string)
+	client.audience = presenceAudience(userID)
+
+	// Queued by the hub on registration, followed by the events of a resumed session
+	hello := helloEvent(client, negotiateFeatures(userID, c.Query("features")))
+	client.hello = &hello
+	client.resumeFrom = c.Query("resume_token")
 
 	log.Printf("Registering user %s", userID)
-	hub.Register <- client
+	hub.Register(client)
 
 	// Start goroutines
+	hub.writers.Add(1)
 	go client.writePump()
 	client.readPump() // blocks until disconnect
 }
@@ -227,6 +190,7 @@ func (c *Client) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+		hub.writers.Done()
 		log.Printf("Write pump stopped for user %s", c.UserID)
 	}()
 
@@ -235,12 +199,23 @@ func (c *Client) writePump() {
 		case message, ok := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(15 * time.Second))
 			if !ok {
-				// Channel closed
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// Channel closed by the hub, tell the client why
+				c.Conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(closeCode(c.closeReason), c.closeReason))
 				return
 			}
 
-			if err := c.Conn.WriteJSON(message); err != nil {
+			// Embedded sessions only see their own conversation
+			if !c.accepts(message) {
+				continue
+			}
+
+			if msg, ok := message.(models.Message); ok {
+				if err := c.deliver(msg); err != nil {
+					log.Printf("Write error for user %s: %v", c.UserID, err)
+					return
+				}
+			} else if err := c.Conn.WriteJSON(message); err != nil {
 				log.Printf("Write error for user %s: %v", c.UserID, err)
 				return
 			}
@@ -258,10 +233,37 @@ func (c *Client) writePump() {
 	}
 }
 
+// deliver writes a chat message to the socket inside a span continuing the
+// message's trace, so the send can be followed from sender to receiver
+func (c *Client) deliver(msg models.Message) error {
+	ctx, span := telemetry.Tracer().Start(
+		telemetry.WithTraceParent(context.Background(), msg.TraceParent), "ws.deliver",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("user.id", c.UserID),
+			attribute.String("message.id", msg.ID.Hex()),
+		),
+	)
+	defer span.End()
+
+	// Receivers see the delivery span as the message's parent
+	msg.TraceParent = telemetry.TraceParent(ctx)
+	if err := c.Conn.WriteJSON(msg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "write failed")
+		return err
+	}
+
+	if msg.SenderID != c.UserID {
+		recordDelivery(time.Since(msg.CreatedAt))
+	}
+	return nil
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		log.Printf("Read pump stopping for user %s", c.UserID)
-		hub.Unregister <- c
+		hub.Unregister(c)
 		c.Conn.Close()
 	}()
 
@@ -284,72 +286,274 @@ func (c *Client) readPump() {
 			break
 		}
 
-		log.Printf("Message received from user %s: %s", c.UserID, msgReq.Content)
+		// Every frame counts as activity, pongs don't since browsers answer pings on their own
+		hub.markActive(c)
+
+		switch msgReq.Action {
+		case models.ClientActionActivity:
+		case models.ClientActionTyping:
+			c.handleTyping(msgReq)
+		case models.ClientActionFocus:
+			c.handleFocus(msgReq)
+		default:
+			c.handleMessage(msgReq)
+		}
+	}
+}
 
-		// Validate message
-		if validationErrors := msgReq.Validate(); len(validationErrors) > 0 {
-			log.Printf("Message validation failed for user %s: %v", c.UserID, validationErrors)
-			continue
+// handleMessage runs an incoming message through validation, spam and moderation
+// checks, persists it and fans it out. Its span is the root of the message's trace
+// unless the client sent a traceparent; deliveries to each socket nest under it.
+func (c *Client) handleMessage(msgReq models.SendMessageRequest) {
+	ctx, span := telemetry.Tracer().Start(
+		telemetry.WithTraceParent(context.Background(), msgReq.TraceParent), "ws.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("user.id", c.UserID),
+			attribute.String("message.receiver_id", msgReq.ReceiverID),
+			attribute.String("message.room_id", msgReq.RoomID),
+			attribute.String("message.type", msgReq.Type),
+		),
+	)
+	defer span.End()
+
+	log.Printf("Message received from user %s (%s, %d bytes)", c.UserID, msgReq.Type, len(msgReq.Content))
+
+	// Validate message
+	if validationErrors := msgReq.Validate(); len(validationErrors) > 0 {
+		log.Printf("Message validation failed for user %s: %v", c.UserID, validationErrors)
+		span.SetStatus(codes.Error, "validation failed")
+		return
+	}
+
+	// Conversation tokens only send to their own conversation
+	if !c.inScope(msgReq.RoomID, msgReq.ReceiverID) {
+		span.AddEvent("rejected", trace.WithAttributes(attribute.String("reason", "out_of_scope")))
+		hub.sendToUsers([]string{c.UserID}, models.Event{
+			Event: models.EventMessageRejected,
+			Data: fiber.Map{
+				"reasons":       []string{"out_of_scope"},
+				"client_msg_id": msgReq.ClientMsgID,
+			},
+		})
+		return
+	}
+
+	// Room messages require membership
+	var room *models.Room
+	if msgReq.RoomID != "" {
+		if !flags.Enabled(models.FeatureRooms, c.UserID) {
+			log.Printf("User %s cannot send to room %s: rooms are not rolled out to them", c.UserID, msgReq.RoomID)
+			return
+		}
+		r, err := findRoomForMember(msgReq.RoomID, c.UserID)
+		if err != nil {
+			log.Printf("User %s cannot send to room %s: %v", c.UserID, msgReq.RoomID, err)
+			return
 		}
+		room = r
+	}
 
-		// Prevent self-messaging
-		if msgReq.ReceiverID == c.UserID {
-			log.Printf("User %s attempted to send message to themselves", c.UserID)
-			continue
+	// Prevent self-messaging
+	if msgReq.ReceiverID == c.UserID {
+		log.Printf("User %s attempted to send message to themselves", c.UserID)
+		return
+	}
+
+	// Guests have a tighter send limit and only message the users who invited them
+	if c.guestExpiresAt != nil {
+		if ok, retryAfter := guestMessages.allow(c.UserID); !ok {
+			span.AddEvent("rejected", trace.WithAttributes(attribute.String("reason", "rate_limited")))
+			hub.sendToUsers([]string{c.UserID}, models.Event{
+				Event: models.EventMessageRejected,
+				Data: fiber.Map{
+					"reasons":     []string{"rate_limited"},
+					"retry_after": int(retryAfter.Seconds()) + 1,
+				},
+			})
+			return
 		}
+		if room == nil && !c.guestMayMessage(msgReq.ReceiverID) {
+			span.AddEvent("rejected", trace.WithAttributes(attribute.String("reason", "guest_not_invited")))
+			hub.sendToUsers([]string{c.UserID}, models.Event{
+				Event: models.EventMessageRejected,
+				Data:  fiber.Map{"reasons": []string{"guest_not_invited"}},
+			})
+			return
+		}
+	}
+
+	// Slash commands either answer privately or turn into the message they post,
+	// embedded sessions send them as plain text
+	if msgReq.Type == models.MessageTypeText && c.scope == "" && c.runCommand(ctx, &msgReq) {
+		span.AddEvent("command")
+		return
+	}
+
+	// Direct messages depend on the conversation's request and block state
+	var conversation *models.Conversation
+	if room == nil {
+		conv, err := findConversation(models.ConversationID(c.UserID, msgReq.ReceiverID), c.UserID)
+		if err != nil {
+			log.Printf("User %s cannot send to %s: %v", c.UserID, msgReq.ReceiverID, err)
+			return
+		}
+		if conv.Blocked(c.UserID) {
+			span.AddEvent("rejected", trace.WithAttributes(attribute.String("reason", "blocked")))
+			hub.sendToUsers([]string{c.UserID}, models.Event{
+				Event: models.EventMessageRejected,
+				Data:  fiber.Map{"reasons": []string{"blocked"}},
+			})
+			return
+		}
+		conversation = conv
+	}
+
+	// Create message
+	message := models.Message{
+		ID:         primitive.NewObjectID(),
+		SenderID:   c.UserID,
+		ReceiverID: msgReq.ReceiverID,
+		RoomID:     msgReq.RoomID,
+		Content:    msgReq.Content,
+		Type:       msgReq.Type,
+		Read:       false,
+		CreatedAt:  time.Now(),
+	}
+	applyExpiry(&message, &msgReq, room)
+	message.ParseFormatting()
+	message.TraceParent = telemetry.TraceParent(ctx)
+	message.ClientMsgID = msgReq.ClientMsgID
+	span.SetAttributes(attribute.String("message.id", message.ID.Hex()))
+
+	// Score spam heuristics, throttled senders are rejected
+	verdict := checkSpam(&message)
+	if !verdict.Allowed {
+		span.AddEvent("rejected", trace.WithAttributes(attribute.String("reason", "rate_limited")))
+		hub.sendToUsers([]string{c.UserID}, models.Event{
+			Event: models.EventMessageRejected,
+			Data: fiber.Map{
+				"reasons":     []string{"rate_limited"},
+				"retry_after": int(verdict.RetryAfter.Seconds()) + 1,
+			},
+		})
+		return
+	}
+	// Messages to someone who blocked the sender are hidden from them like shadowed ones
+	message.Shadowed = verdict.Shadow || (conversation != nil && conversation.Blocked(message.ReceiverID))
+
+	// Run moderation before persisting
+	if decision := moderateMessage(&message); decision.Blocked {
+		log.Printf("Message from user %s blocked by moderation", c.UserID)
+		span.AddEvent("rejected", trace.WithAttributes(attribute.StringSlice("reason", decision.Reasons)))
+		hub.sendToUsers([]string{c.UserID}, models.Event{
+			Event: models.EventMessageRejected,
+			Data:  fiber.Map{"reasons": decision.Reasons},
+		})
+		return
+	}
+
+	// Slow mode rooms take one message per member per interval, checked last so
+	// messages refused above do not count
+	if room != nil {
+		if ok, retryAfter := slowMode.take(room, c.UserID); !ok {
+			span.AddEvent("rejected", trace.WithAttributes(attribute.String("reason", "slow_mode")))
+			hub.sendToUsers([]string{c.UserID}, models.Event{
+				Event: models.EventMessageRejected,
+				Data: fiber.Map{
+					"reasons":       []string{"slow_mode"},
+					"room_id":       room.ID,
+					"client_msg_id": msgReq.ClientMsgID,
+					"slow_mode":     room.SlowMode,
+					"retry_after":   int(retryAfter.Seconds()) + 1,
+				},
+			})
+			return
+		}
+	}
 
-		// Create message
-		message := models.Message{
-			ID:         primitive.NewObjectID(),
-			SenderID:   c.UserID,
-			ReceiverID: msgReq.ReceiverID,
-			Content:    msgReq.Content,
-			Type:       msgReq.Type,
-			Read:       false,
-			CreatedAt:  time.Now(),
+	// Messages hidden by a shadow restriction are not announced to external systems
+	var events []models.OutboxEntry
+	if !message.Shadowed {
+		events = append(events, models.MessageCreated(&message))
+	}
+
+	if err := insertMessage(ctx, &message, events...); err != nil {
+		log.Printf("Failed to save message from user %s: %v", c.UserID, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "insert failed")
+		if room != nil {
+			slowMode.release(room, c.UserID)
 		}
+		// Tell the sender instead of dropping the message, they can send it again
+		hub.sendToUsers([]string{c.UserID}, models.Event{
+			Event: models.EventSendFailed,
+			Data: fiber.Map{
+				"client_msg_id": msgReq.ClientMsgID,
+				"reason":        "storage_unavailable",
+				"retryable":     true,
+			},
+		})
+		return
+	}
 
-		// Save to database dengan timeout
+	log.Printf("Message saved to database: %s -> %s", c.UserID, msgReq.ReceiverID)
+
+	// Update user's last seen
+	go func(userID string) {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		_, err := config.DB.Collection("messages").InsertOne(ctx, message)
-		if err != nil {
-			log.Printf("Failed to save message from user %s: %v", c.UserID, err)
-			continue
+		if err := store.Presence().Touch(ctx, userID, time.Now()); err != nil {
+			log.Printf("Failed to update last_seen for user %s: %v", userID, err)
 		}
+	}(c.UserID)
+
+	// Shadow-restricted senders only get their own echo
+	if message.Shadowed {
+		hub.sendToUsers([]string{c.UserID}, message)
+		return
+	}
 
-		log.Printf("Message saved to database: %s -> %s", c.UserID, msgReq.ReceiverID)
+	// Fan out room messages to all members, including the sender
+	if room != nil {
+		hub.sendToUsers(room.MemberIDs(), message)
+		go dispatchNotifications(message, room.MemberIDs())
+		log.Printf("Message from %s sent to room %s", message.SenderID, msgReq.RoomID)
+		return
+	}
 
-		// Update user's last seen
-		go func(userID string) {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
+	// Messages from strangers land in the receiver's message requests, without alerts
+	pending, err := settleRequest(ctx, c, conversation, &message)
+	if err != nil {
+		log.Printf("Failed to update message request %s: %v", conversation.ID, err)
+	}
+	if pending {
+		hub.sendToUsers([]string{c.UserID}, message)
+		hub.sendToUsers([]string{message.ReceiverID}, models.Event{
+			Event: models.EventMessageRequest,
+			Data: fiber.Map{
+				"conversation_id": conversation.ID,
+				"message":         message,
+			},
+		})
+		log.Printf("Message from %s to %s held as a message request", message.SenderID, message.ReceiverID)
+		return
+	}
 
-			_, err := config.DB.Collection("users").UpdateOne(ctx,
-				bson.M{"_id": userID},
-				bson.M{"$set": bson.M{"last_seen": time.Now()}},
-			)
-			if err != nil {
-				log.Printf("Failed to update last_seen for user %s: %v", userID, err)
-			}
-		}(c.UserID)
+	go dispatchNotifications(message, []string{message.ReceiverID})
 
-		// Broadcast message
-		select {
-		case hub.Broadcast <- message:
-			log.Printf("Message broadcast to hub: %s -> %s", message.SenderID, message.ReceiverID)
-		case <-time.After(5 * time.Second):
-			log.Printf("Broadcast channel full, message dropped: %s -> %s", message.SenderID, message.ReceiverID)
-		}
+	// Broadcast message
+	if hub.Broadcast(message, 5*time.Second) {
+		log.Printf("Message broadcast to hub: %s -> %s", message.SenderID, message.ReceiverID)
+	} else {
+		log.Printf("Broadcast channel full, message dropped: %s -> %s", message.SenderID, message.ReceiverID)
+		span.SetStatus(codes.Error, "broadcast channel full")
 	}
 }
 
 func GetMessages(c *fiber.Ctx) error {
-	currentUserID := c.Locals("user_id").(string)
 	otherUserID := c.Query("user_id")
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 50)
 
 	if otherUserID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -357,44 +561,30 @@ func GetMessages(c *fiber.Ctx) error {
 		})
 	}
 
-	if limit > 100 {
-		limit = 100
-	}
+	return directMessages(c, otherUserID)
+}
 
-	skip := (page - 1) * limit
+// directMessages answers a page of the current user's history with another user
+func directMessages(c *fiber.Ctx, otherUserID string) error {
+	currentUserID := c.Locals("user_id").(string)
 
-	// Find messages between users
-	filter := bson.M{
-		"$or": []bson.M{
-			{"sender_id": currentUserID, "receiver_id": otherUserID},
-			{"sender_id": otherUserID, "receiver_id": currentUserID},
-		},
+	p, err := parsePage(c, 50, 100)
+	if err != nil {
+		return err
 	}
 
-	opts := options.Find().
-		SetSort(bson.M{"created_at": -1}).
-		SetSkip(int64(skip)).
-		SetLimit(int64(limit))
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := config.DB.Collection("messages").Find(ctx, filter, opts)
+	// Find messages between users
+	messages, err := store.Messages().ListDirect(ctx, currentUserID, otherUserID, p.before(), p.skip(), int64(p.Limit)+1)
 	if err != nil {
 		log.Printf("Failed to fetch messages: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch messages",
 		})
 	}
-	defer cursor.Close(ctx)
-
-	var messages []models.Message
-	if err := cursor.All(ctx, &messages); err != nil {
-		log.Printf("Failed to decode messages: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to decode messages",
-		})
-	}
+	messages, pagination := p.messageEnvelope(messages)
 
 	// Reverse to get chronological order
 	for i := len(messages)/2 - 1; i >= 0; i-- {
@@ -402,122 +592,130 @@ func GetMessages(c *fiber.Ctx) error {
 		messages[i], messages[opp] = messages[opp], messages[i]
 	}
 
-	// Mark messages as read dengan goroutine
-	go func(currentUserID, otherUserID string) {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	hydrateArchived(ctx, messages)
 
-		result, err := config.DB.Collection("messages").UpdateMany(ctx,
-			bson.M{
-				"sender_id":   otherUserID,
-				"receiver_id": currentUserID,
-				"read":        false,
-			},
-			bson.M{"$set": bson.M{"read": true}},
-		)
+	if err := applyReadState(ctx, currentUserID, otherUserID, messages); err != nil {
+		log.Printf("Failed to load read cursors: %v", err)
+	}
 
-		if err != nil {
-			log.Printf("Failed to mark messages as read: %v", err)
-		} else {
-			log.Printf("Marked %d messages as read", result.ModifiedCount)
+	// The first page holds the newest messages, reading it moves the read cursor
+	// up to the latest one received
+	if p.first() {
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].SenderID != otherUserID {
+				continue
+			}
+
+			go func(messageID primitive.ObjectID, readAt time.Time) {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				if _, _, err := advanceReadCursor(ctx, currentUserID, otherUserID, messageID, readAt); err != nil {
+					log.Printf("Failed to update read cursor: %v", err)
+				}
+			}(messages[i].ID, messages[i].CreatedAt)
+			break
 		}
-	}(currentUserID, otherUserID)
+	}
 
 	return c.JSON(fiber.Map{
-		"messages": messages,
-		"pagination": fiber.Map{
-			"page":  page,
-			"limit": limit,
-			"total": len(messages),
-		},
+		"messages":   messages,
+		"pagination": pagination,
 	})
 }
 
 func GetConversations(c *fiber.Ctx) error {
 	currentUserID := c.Locals("user_id").(string)
 
-	// Aggregation pipeline to get latest message for each conversation
-	pipeline := []bson.M{
-		{
-			"$match": bson.M{
-				"$or": []bson.M{
-					{"sender_id": currentUserID},
-					{"receiver_id": currentUserID},
-				},
-			},
-		},
-		{
-			"$sort": bson.M{"created_at": -1},
-		},
-		{
-			"$group": bson.M{
-				"_id": bson.M{
-					"$cond": []interface{}{
-						bson.M{"$eq": []interface{}{"$sender_id", currentUserID}},
-						"$receiver_id",
-						"$sender_id",
-					},
-				},
-				"last_message": bson.M{"$first": "$$ROOT"},
-				"unread_count": bson.M{
-					"$sum": bson.M{
-						"$cond": []interface{}{
-							bson.M{
-								"$and": []bson.M{
-									{"$eq": []interface{}{"$receiver_id", currentUserID}},
-									{"$eq": []interface{}{"$read", false}},
-								},
-							},
-							1,
-							0,
-						},
-					},
-				},
-			},
-		},
-		{
-			"$sort": bson.M{"last_message.created_at": -1},
-		},
+	p, err := parsePage(c, 50, 100)
+	if err != nil {
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
 	defer cancel()
 
-	cursor, err := config.DB.Collection("messages").Aggregate(ctx, pipeline)
+	// Latest message for each conversation
+	summaries, err := store.Messages().DirectConversations(ctx, currentUserID)
 	if err != nil {
 		log.Printf("Failed to fetch conversations: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch conversations",
 		})
 	}
-	defer cursor.Close(ctx)
 
-	var conversations []fiber.Map
-	for cursor.Next(ctx) {
-		var result struct {
-			ID          string         `bson:"_id"`
-			LastMessage models.Message `bson:"last_message"`
-			UnreadCount int            `bson:"unread_count"`
+	// Message requests are listed separately
+	requested, _, err := requestSenders(ctx, currentUserID)
+	if err != nil {
+		log.Printf("Failed to load message requests of user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch conversations",
+		})
+	}
+	accepted := summaries[:0]
+	for _, summary := range summaries {
+		if !requested[summary.OtherUserID] {
+			accepted = append(accepted, summary)
 		}
+	}
+	summaries = accepted
 
-		if err := cursor.Decode(&result); err != nil {
-			log.Printf("Failed to decode conversation: %v", err)
-			continue
+	contacts := contactsOf(ctx, currentUserID)
+	appearances := appearancesOf(ctx, currentUserID)
+
+	labels, err := labelsOf(ctx, currentUserID)
+	if err != nil {
+		log.Printf("Failed to load labels of user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch conversations",
+		})
+	}
+
+	// Only conversations carrying the label, the caller's own
+	if labelID := c.Query("label"); labelID != "" {
+		if _, ok := labels.Find(labelID); !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Label not found",
+			})
+		}
+		filtered := summaries[:0]
+		for _, summary := range summaries {
+			if labels.Has(models.ConversationID(currentUserID, summary.OtherUserID), labelID) {
+				filtered = append(filtered, summary)
+			}
 		}
+		summaries = filtered
+	}
 
-		// Get user info
-		var user models.User
-		userCtx, userCancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer userCancel()
+	// Only the requested page is hydrated and decorated
+	summaries, pagination := pageOf(p, summaries)
 
-		err := config.DB.Collection("users").FindOne(userCtx,
-			bson.M{"_id": result.ID}).Decode(&user)
+	// Conversations quiet for long enough end with an archived message
+	lastMessages := make([]models.Message, len(summaries))
+	for i := range summaries {
+		lastMessages[i] = summaries[i].LastMessage
+	}
+	hydrateArchived(ctx, lastMessages)
+	for i := range summaries {
+		summaries[i].LastMessage = lastMessages[i]
+	}
+
+	var conversations []fiber.Map
+	for _, result := range summaries {
+		// Get user info
+		user, err := store.Users().GetByID(ctx, result.OtherUserID)
 		if err != nil {
-			log.Printf("Failed to find user %s: %v", result.ID, err)
+			log.Printf("Failed to find user %s: %v", result.OtherUserID, err)
 			continue
 		}
 
-		conversations = append(conversations, fiber.Map{
+		lastMessage := []models.Message{result.LastMessage}
+		if err := applyReadState(ctx, currentUserID, result.OtherUserID, lastMessage); err != nil {
+			log.Printf("Failed to load read cursors: %v", err)
+		}
+
+		conversation := fiber.Map{
+			"conversation_id": models.ConversationID(currentUserID, user.ID),
 			"user": fiber.Map{
 				"id":        user.ID,
 				"username":  user.Username,
@@ -531,22 +729,23 @@ func GetConversations(c *fiber.Ctx) error {
 				"type":       result.LastMessage.Type,
 				"created_at": result.LastMessage.CreatedAt,
 				"sender_id":  result.LastMessage.SenderID,
-				"read":       result.LastMessage.Read,
+				"read":       lastMessage[0].Read,
 			},
 			"unread_count": result.UnreadCount,
-		})
-	}
-
-	if err := cursor.Err(); err != nil {
-		log.Printf("Cursor error: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process conversations",
-		})
+			"labels":       labels.Of(models.ConversationID(currentUserID, user.ID)),
+		}
+		if contact, ok := contacts[user.ID]; ok {
+			conversation["contact"] = contact
+		}
+		if appearance, ok := appearances[models.ConversationID(currentUserID, user.ID)]; ok {
+			conversation["appearance"] = appearance
+		}
+		conversations = append(conversations, conversation)
 	}
 
 	return c.JSON(fiber.Map{
 		"conversations": conversations,
-		"total":         len(conversations),
+		"pagination":    pagination,
 	})
 }
 
@@ -560,19 +759,11 @@ func MarkMessagesRead(c *fiber.Ctx) error {
 		})
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
-	// Mark all messages from other user as read
-	result, err := config.DB.Collection("messages").UpdateMany(ctx,
-		bson.M{
-			"sender_id":   otherUserID,
-			"receiver_id": currentUserID,
-			"read":        false,
-		},
-		bson.M{"$set": bson.M{"read": true}},
-	)
-
+	// Everything received so far counts as read, see UpdateReadCursor for partial reads
+	cursor, _, err := advanceReadCursor(ctx, currentUserID, otherUserID, primitive.NilObjectID, time.Now())
 	if err != nil {
 		log.Printf("Failed to mark messages as read: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -580,27 +771,19 @@ func MarkMessagesRead(c *fiber.Ctx) error {
 		})
 	}
 
-	log.Printf("Marked %d messages as read from %s to %s", result.ModifiedCount, otherUserID, currentUserID)
-
 	return c.JSON(fiber.Map{
-		"message":          "Messages marked as read",
-		"messages_updated": result.ModifiedCount,
+		"message": "Messages marked as read",
+		"read_at": cursor.ReadAt,
 	})
 }
 
 func GetUnreadCount(c *fiber.Ctx) error {
 	currentUserID := c.Locals("user_id").(string)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
 	defer cancel()
 
-	count, err := config.DB.Collection("messages").CountDocuments(ctx,
-		bson.M{
-			"receiver_id": currentUserID,
-			"read":        false,
-		},
-	)
-
+	count, err := store.Messages().UnreadCount(ctx, currentUserID)
 	if err != nil {
 		log.Printf("Failed to get unread count: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -615,17 +798,9 @@ func GetUnreadCount(c *fiber.Ctx) error {
 
 // GetConnectionStatus untuk monitoring
 func GetConnectionStatus(c *fiber.Ctx) error {
-	hub.mu.RLock()
-	defer hub.mu.RUnlock()
-
-	connectedUsers := make([]string, 0, len(hub.Clients))
-	for userID := range hub.Clients {
-		connectedUsers = append(connectedUsers, userID)
-	}
-
 	return c.JSON(fiber.Map{
-		"total_connections": hub.Connections,
-		"connected_users":   connectedUsers,
+		"total_connections": hub.Connections(),
+		"connected_users":   hub.ConnectedUsers(),
 		"timestamp":         time.Now(),
 	})
 }
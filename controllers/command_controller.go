@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/commands"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func init() {
+	commands.UseResolver(botCommands{})
+}
+
+// botCommands resolves commands registered by bots from the bot_commands collection
+type botCommands struct{}
+
+func (botCommands) Resolve(ctx context.Context, name string) (commands.Handler, bool, error) {
+	// Bot commands are stored in MongoDB only, other backends have built-ins only
+	if config.DB == nil {
+		return nil, false, nil
+	}
+
+	var command models.BotCommand
+	err := config.DB.Collection("bot_commands").FindOne(ctx, bson.M{"_id": name}).Decode(&command)
+	if err == mongo.ErrNoDocuments {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return &commands.Webhook{
+		URL:     command.URL,
+		Secret:  command.Secret,
+		Timeout: config.GetDurationEnv("COMMAND_WEBHOOK_TIMEOUT", 5*time.Second),
+	}, true, nil
+}
+
+func (botCommands) List(ctx context.Context) ([]commands.Info, error) {
+	if config.DB == nil {
+		return nil, nil
+	}
+
+	cursor, err := config.DB.Collection("bot_commands").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var registered []models.BotCommand
+	if err := cursor.All(ctx, &registered); err != nil {
+		return nil, err
+	}
+
+	infos := make([]commands.Info, 0, len(registered))
+	for _, command := range registered {
+		infos = append(infos, commands.Info{Name: command.Name, Usage: command.Usage, Description: command.Description})
+	}
+	return infos, nil
+}
+
+// replyToCommand sends an ephemeral command response to the invoking user only
+func (c *Client) replyToCommand(msgReq *models.SendMessageRequest, name, text string) {
+	hub.sendToUsers([]string{c.UserID}, models.Event{
+		Event: models.EventCommandResponse,
+		Data: fiber.Map{
+			"command":     name,
+			"text":        text,
+			"room_id":     msgReq.RoomID,
+			"receiver_id": msgReq.ReceiverID,
+		},
+	})
+}
+
+// runCommand handles a text message starting with a slash. It reports true when the
+// command was answered privately and nothing is left to send, otherwise msgReq holds
+// the message the command posts on the user's behalf.
+func (c *Client) runCommand(ctx context.Context, msgReq *models.SendMessageRequest) bool {
+	command, ok := commands.Parse(msgReq.Content)
+	if !ok {
+		msgReq.Content = commands.Unescape(msgReq.Content)
+		return false
+	}
+
+	conversationID := msgReq.RoomID
+	if conversationID == "" {
+		conversationID = models.ConversationID(c.UserID, msgReq.ReceiverID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	response, err := commands.Dispatch(ctx, commands.Invocation{
+		Command:        command,
+		UserID:         c.UserID,
+		UserName:       systemName(ctx, i18n.Default, c.UserID),
+		ReceiverID:     msgReq.ReceiverID,
+		RoomID:         msgReq.RoomID,
+		ConversationID: conversationID,
+	})
+	if errors.Is(err, commands.ErrUnknownCommand) {
+		c.replyToCommand(msgReq, command.Name, "Unknown command /"+command.Name+", type /help for the list. Start with // to send it as text")
+		return true
+	} else if err != nil {
+		log.Printf("Command /%s from user %s failed: %v", command.Name, c.UserID, err)
+		c.replyToCommand(msgReq, command.Name, "/"+command.Name+" failed, please try again later")
+		return true
+	}
+
+	if response.Ephemeral {
+		c.replyToCommand(msgReq, command.Name, response.Content)
+		return true
+	}
+
+	msgReq.Content, msgReq.Type = response.Content, response.Type
+	if msgReq.Type == "" {
+		msgReq.Type = models.MessageTypeText
+	}
+	if validationErrors := msgReq.Validate(); len(validationErrors) > 0 {
+		c.replyToCommand(msgReq, command.Name, "/"+command.Name+" produced a message that cannot be sent: "+validationErrors[0])
+		return true
+	}
+	return false
+}
+
+// ListCommands returns the slash commands users can run, for autocompletion
+func ListCommands(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	infos, err := commands.List(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch commands",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"commands": infos,
+	})
+}
+
+// RegisterCommand adds a bot command answered by a webhook. The signing secret is
+// only returned here.
+func RegisterCommand(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	var input models.RegisterCommandRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	if commands.IsBuiltIn(input.Name) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Command name is taken by a built-in command",
+		})
+	}
+
+	secret, err := config.GenerateToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to register command",
+		})
+	}
+
+	command := models.BotCommand{
+		Name:        input.Name,
+		Usage:       input.Usage,
+		Description: input.Description,
+		URL:         input.URL,
+		Secret:      secret,
+		OwnerID:     currentUserID,
+		CreatedAt:   time.Now(),
+	}
+
+	_, err = config.DB.Collection("bot_commands").InsertOne(c.UserContext(), command)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Command already registered",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to register command",
+		})
+	}
+
+	log.Printf("Command /%s registered by %s, answered by %s", command.Name, currentUserID, command.URL)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"command": command,
+		"secret":  secret,
+	})
+}
+
+// DeleteCommand removes a bot command
+func DeleteCommand(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	result, err := config.DB.Collection("bot_commands").DeleteOne(c.UserContext(), bson.M{"_id": c.Params("name")})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete command",
+		})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Command not found",
+		})
+	}
+
+	log.Printf("Command /%s deleted by %s", c.Params("name"), currentUserID)
+
+	return c.JSON(fiber.Map{
+		"message": "Command deleted",
+	})
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// contactsOf returns the owner's annotations keyed by user ID, empty if there are none
+func contactsOf(ctx context.Context, ownerID string) map[string]models.Contact {
+	// Contacts are stored in MongoDB only, other backends have none
+	if config.DB == nil {
+		return nil
+	}
+
+	var contacts models.Contacts
+	err := config.DB.Collection("contacts").FindOne(ctx, bson.M{"_id": ownerID}).Decode(&contacts)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Failed to load contacts of user %s: %v", ownerID, err)
+		}
+		return nil
+	}
+	return contacts.Entries
+}
+
+// contactField is the path of a field of the contact entry for userID
+func contactField(userID, field string) string {
+	return "entries." + userID + "." + field
+}
+
+func GetContacts(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	favoritesOnly := c.QueryBool("favorites")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	contacts := []fiber.Map{}
+	for userID, contact := range contactsOf(ctx, currentUserID) {
+		if favoritesOnly && !contact.Favorite {
+			continue
+		}
+
+		// Annotations of deleted users are kept but not listed
+		user, err := store.Users().GetByID(ctx, userID)
+		if err != nil || user.DeletedAt != nil {
+			continue
+		}
+
+		contacts = append(contacts, fiber.Map{
+			"user": fiber.Map{
+				"id":       user.ID,
+				"username": user.Username,
+				"avatar":   user.Avatar,
+				"online":   user.Online,
+			},
+			"contact": contact,
+		})
+	}
+
+	// Favorites first, then by the name the owner sees
+	displayName := func(entry fiber.Map) string {
+		if nickname := entry["contact"].(models.Contact).Nickname; nickname != "" {
+			return strings.ToLower(nickname)
+		}
+		return strings.ToLower(entry["user"].(fiber.Map)["username"].(string))
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		fi := contacts[i]["contact"].(models.Contact).Favorite
+		fj := contacts[j]["contact"].(models.Contact).Favorite
+		if fi != fj {
+			return fi
+		}
+		return displayName(contacts[i]) < displayName(contacts[j])
+	})
+
+	return c.JSON(fiber.Map{
+		"contacts": contacts,
+		"total":    len(contacts),
+	})
+}
+
+// UpdateContact sets the favorite flag, nickname or note of a user, only for the caller
+func UpdateContact(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	targetID := c.Params("user_id")
+
+	if targetID == currentUserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot add yourself as a contact",
+		})
+	}
+
+	var input models.UpdateContactRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if _, err := store.Users().GetByID(ctx, targetID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	set := bson.M{contactField(targetID, "updated_at"): time.Now()}
+	unset := bson.M{}
+
+	// Cleared fields are removed rather than stored empty
+	if input.Favorite != nil {
+		if *input.Favorite {
+			set[contactField(targetID, "favorite")] = true
+		} else {
+			unset[contactField(targetID, "favorite")] = ""
+		}
+	}
+	for field, value := range map[string]*string{"nickname": input.Nickname, "note": input.Note} {
+		if value == nil {
+			continue
+		}
+		if v := config.SanitizeString(*value); v != "" {
+			set[contactField(targetID, field)] = v
+		} else {
+			unset[contactField(targetID, field)] = ""
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var contacts models.Contacts
+	err := config.DB.Collection("contacts").FindOneAndUpdate(ctx,
+		bson.M{"_id": currentUserID}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&contacts)
+	if err != nil {
+		log.Printf("Failed to update contact %s of user %s: %v", targetID, currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update contact",
+		})
+	}
+
+	contact := contacts.Entries[targetID]
+
+	// Nothing left to remember about this user
+	if contact.IsEmpty() {
+		if _, err := config.DB.Collection("contacts").UpdateOne(ctx,
+			bson.M{"_id": currentUserID},
+			bson.M{"$unset": bson.M{"entries." + targetID: ""}},
+		); err != nil {
+			log.Printf("Failed to remove empty contact %s of user %s: %v", targetID, currentUserID, err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id": targetID,
+		"contact": contact,
+	})
+}
+
+func DeleteContact(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	targetID := c.Params("user_id")
+
+	// The ID becomes part of a field path
+	if targetID == "" || strings.ContainsAny(targetID, ".$") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact not found",
+		})
+	}
+
+	result, err := config.DB.Collection("contacts").UpdateOne(c.UserContext(),
+		bson.M{"_id": currentUserID, "entries." + targetID: bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"entries." + targetID: ""}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete contact",
+		})
+	}
+	if result.ModifiedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Contact deleted",
+	})
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// findConversation loads a direct conversation the user takes part in.
+// Conversations without stored state yet are returned as an empty, unsaved document.
+func findConversation(conversationID, userID string) (*models.Conversation, error) {
+	participants, ok := models.ConversationParticipants(conversationID)
+	if !ok || (participants[0] != userID && participants[1] != userID) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conversation, err := store.Conversations().Get(ctx, conversationID)
+	if err == store.ErrNotFound {
+		return &models.Conversation{ID: conversationID, Participants: participants}, nil
+	} else if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return conversation, nil
+}
+
+// findConversationMessage loads a direct message exchanged between the participants
+// that the viewer can see
+func findConversationMessage(conversation *models.Conversation, viewerID, messageID string) (*models.Message, error) {
+	objID, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid message ID")
+	}
+
+	otherID := conversation.Participants[0]
+	if otherID == viewerID {
+		otherID = conversation.Participants[1]
+	}
+
+	message, err := store.Messages().GetDirect(context.Background(), objID, viewerID, otherID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Message not found")
+	}
+
+	return message, nil
+}
+
+// notifyConversation pushes an event to both participants of a direct conversation
+func notifyConversation(conversation *models.Conversation, event string, data fiber.Map) {
+	hub.sendToUsers(conversation.Participants, models.Event{Event: event, Data: data})
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"log"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sessions opened with a conversation token are limited to that conversation: they
+// only send and type there, and their write pump drops everything the hub queues
+// for the user that belongs elsewhere.
+
+// inScope reports whether the client may act in the room or the direct conversation
+// with the receiver. Full sessions may act anywhere.
+func (c *Client) inScope(roomID, receiverID string) bool {
+	if c.scope == "" {
+		return true
+	}
+	if roomID != "" {
+		return roomID == c.scope
+	}
+	return receiverID != "" && models.ConversationID(c.UserID, receiverID) == c.scope
+}
+
+// accepts reports whether a payload queued for the user may be written to this client
+func (c *Client) accepts(payload interface{}) bool {
+	if c.scope == "" {
+		return true
+	}
+
+	switch p := payload.(type) {
+	case models.Message:
+		return messageConversationID(&p) == c.scope
+	case models.Event:
+		switch p.Event {
+		case models.EventHello, models.EventGoodbye:
+			return true
+		}
+
+		data, ok := p.Data.(fiber.Map)
+		if !ok {
+			return false
+		}
+		if conversationID := eventConversationID(data); conversationID != "" {
+			return conversationID == c.scope
+		}
+
+		// Answers to the client's own sends don't always name the conversation
+		return p.Event == models.EventMessageRejected || p.Event == models.EventSendFailed
+	}
+	return false
+}
+
+// eventConversationID returns the room or direct conversation an event is about,
+// empty when it names none
+func eventConversationID(data fiber.Map) string {
+	for _, key := range []string{"conversation_id", "room_id"} {
+		switch id := data[key].(type) {
+		case string:
+			if id != "" {
+				return id
+			}
+		case primitive.ObjectID:
+			return id.Hex()
+		}
+	}
+
+	// Typing in a direct conversation names both participants
+	userID, _ := data["user_id"].(string)
+	receiverID, _ := data["receiver_id"].(string)
+	if userID != "" && receiverID != "" {
+		return models.ConversationID(userID, receiverID)
+	}
+	return ""
+}
+
+// disconnectIntegration closes the embedded sessions of an integration that was
+// revoked, or of users it no longer maps, and returns how many were closed
+func (h *Hub) disconnectIntegration(integration *models.Integration) int {
+	integrationID := integration.ID.Hex()
+
+	closed := 0
+	for _, shard := range h.shards {
+		shard.mu.Lock()
+		for _, sessions := range shard.clients {
+			// removeLocked replaces the slice, ranging over the current one stays valid
+			for _, client := range sessions {
+				if client.integrationID != integrationID {
+					continue
+				}
+				if integration.RevokedAt == nil && integration.Maps(client.UserID) {
+					continue
+				}
+				shard.removeLocked(client, models.DisconnectReasonSessionRevoked)
+				closed++
+			}
+		}
+		shard.mu.Unlock()
+	}
+
+	if closed > 0 {
+		log.Printf("Closed %d embedded sessions of integration %s", closed, integrationID)
+	}
+	return closed
+}
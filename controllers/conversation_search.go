@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limits of conversation search
+const (
+	searchRecentMessages = 1000 // Newest messages of the caller whose content is searched
+	minContentQuery      = 2    // Shorter queries only match names
+	snippetContext       = 30   // Characters kept before the match
+	snippetLength        = 120  // Characters in a snippet
+)
+
+// Scores of what a conversation matched on, the best name match counts once and
+// every matching message adds a little
+const (
+	scoreExactName    = 100
+	scoreNicknameHead = 80
+	scoreUsernameHead = 75
+	scoreNameHead     = 70
+	scoreNameContains = 50
+	scoreMessages     = 20
+	maxMessageBonus   = 10
+)
+
+// conversationHit collects what matched in one conversation
+type conversationHit struct {
+	summary  store.ConversationSummary
+	user     *models.User
+	contact  *models.Contact
+	matched  []string
+	score    int
+	messages int
+	snippet  fiber.Map // Newest matching message
+}
+
+// nameScore rates how well the query matches a name, 0 when it doesn't
+func nameScore(name, query string, head int) int {
+	name = strings.ToLower(name)
+	switch {
+	case name == "":
+		return 0
+	case name == query:
+		return scoreExactName
+	case strings.HasPrefix(name, query):
+		return head
+	}
+	for _, word := range strings.Fields(name) {
+		if strings.HasPrefix(word, query) {
+			return head
+		}
+	}
+	if strings.Contains(name, query) {
+		return scoreNameContains
+	}
+	return 0
+}
+
+// matchSnippet cuts the part of content around the first match of query, with the
+// match position in UTF-16 code units like formatting entities. Reports false when
+// content doesn't contain query.
+func matchSnippet(message models.Message, query string) (fiber.Map, bool) {
+	// ToLower maps rune by rune, so rune positions carry over to the original text
+	lower := strings.ToLower(message.Content)
+	i := strings.Index(lower, query)
+	if i < 0 {
+		return nil, false
+	}
+
+	runes := []rune(message.Content)
+	start := utf8.RuneCountInString(lower[:i])
+	length := utf8.RuneCountInString(query)
+
+	from := max(start-snippetContext, 0)
+	to := min(from+snippetLength, len(runes))
+	if to < start+length {
+		to = start + length
+	}
+
+	prefix := ""
+	if from > 0 {
+		prefix = "…"
+	}
+	suffix := ""
+	if to < len(runes) {
+		suffix = "…"
+	}
+
+	before := string(runes[from:start])
+	match := string(runes[start : start+length])
+	return fiber.Map{
+		"message_id": message.ID.Hex(),
+		"sender_id":  message.SenderID,
+		"created_at": message.CreatedAt,
+		"text":       prefix + before + match + string(runes[start+length:to]) + suffix,
+		"highlight": fiber.Map{
+			"offset": len(utf16.Encode([]rune(prefix + before))),
+			"length": len(utf16.Encode([]rune(match))),
+		},
+	}, true
+}
+
+// SearchConversations finds the caller's direct conversations by the partner's
+// username, display name or nickname and by the content of recent messages
+func SearchConversations(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	query := models.NormalizeSearch(c.Query("q"))
+	if query == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Search query is required",
+		})
+	}
+	p, err := parsePage(c, 20, 50)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	summaries, err := store.Messages().DirectConversations(ctx, currentUserID)
+	if err != nil {
+		log.Printf("Failed to fetch conversations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search conversations",
+		})
+	}
+
+	// Message requests stay out of the results, as they do out of the conversation list
+	requested, _, err := requestSenders(ctx, currentUserID)
+	if err != nil {
+		log.Printf("Failed to load message requests of user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search conversations",
+		})
+	}
+
+	contacts := contactsOf(ctx, currentUserID)
+
+	hits := make(map[string]*conversationHit, len(summaries))
+	for _, summary := range summaries {
+		if requested[summary.OtherUserID] {
+			continue
+		}
+		user, err := store.Users().GetByID(ctx, summary.OtherUserID)
+		if err != nil {
+			log.Printf("Failed to find user %s: %v", summary.OtherUserID, err)
+			continue
+		}
+
+		hit := &conversationHit{summary: summary, user: user}
+		if contact, ok := contacts[user.ID]; ok {
+			hit.contact = &contact
+			if score := nameScore(contact.Nickname, query, scoreNicknameHead); score > 0 {
+				hit.score = max(hit.score, score)
+				hit.matched = append(hit.matched, "nickname")
+			}
+		}
+		if score := nameScore(user.Username, query, scoreUsernameHead); score > 0 {
+			hit.score = max(hit.score, score)
+			hit.matched = append(hit.matched, "username")
+		}
+		if score := nameScore(user.DisplayName, query, scoreNameHead); score > 0 {
+			hit.score = max(hit.score, score)
+			hit.matched = append(hit.matched, "display_name")
+		}
+		hits[user.ID] = hit
+	}
+
+	// Content is decrypted when read, so it is matched here rather than in the database
+	if utf8.RuneCountInString(query) >= minContentQuery {
+		recent, err := store.Messages().RecentText(ctx, currentUserID, searchRecentMessages)
+		if err != nil {
+			log.Printf("Failed to fetch recent messages of user %s: %v", currentUserID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to search conversations",
+			})
+		}
+
+		for _, message := range recent {
+			otherID := message.ReceiverID
+			if otherID == currentUserID {
+				otherID = message.SenderID
+			}
+			hit, ok := hits[otherID]
+			if !ok {
+				continue
+			}
+
+			snippet, ok := matchSnippet(message, query)
+			if !ok {
+				continue
+			}
+			// Newest first, the first match is the one shown
+			if hit.messages == 0 {
+				hit.snippet = snippet
+				hit.matched = append(hit.matched, "messages")
+			}
+			hit.messages++
+		}
+	}
+
+	results := make([]*conversationHit, 0, len(hits))
+	for _, hit := range hits {
+		if hit.messages > 0 {
+			if hit.score == 0 {
+				hit.score = scoreMessages
+			}
+			hit.score += min(hit.messages, maxMessageBonus)
+		}
+		if hit.score > 0 {
+			results = append(results, hit)
+		}
+	}
+
+	// Best match first, recent conversations first among equals
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].summary.LastMessage.CreatedAt.After(results[j].summary.LastMessage.CreatedAt)
+	})
+	results, pagination := pageOf(p, results)
+
+	conversations := make([]fiber.Map, 0, len(results))
+	for _, hit := range results {
+		conversation := fiber.Map{
+			"conversation_id": models.ConversationID(currentUserID, hit.user.ID),
+			"user": fiber.Map{
+				"id":           hit.user.ID,
+				"username":     hit.user.Username,
+				"display_name": hit.user.DisplayName,
+				"avatar":       hit.user.Avatar,
+			},
+			"matched":         hit.matched,
+			"message_matches": hit.messages,
+			"last_message_at": hit.summary.LastMessage.CreatedAt,
+		}
+		if hit.contact != nil {
+			conversation["contact"] = hit.contact
+		}
+		if hit.snippet != nil {
+			conversation["snippet"] = hit.snippet
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	return c.JSON(fiber.Map{
+		"conversations": conversations,
+		"pagination":    pagination,
+	})
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSearchConversationsLeavesOutRequests(t *testing.T) {
+	useTestStore(t)
+	ctx := context.Background()
+
+	for _, u := range []models.User{
+		{ID: "001", Username: "owner"},
+		{ID: "002", Username: "budi_friend"},
+		{ID: "003", Username: "budi_stranger"},
+	} {
+		u.Email = u.Username + "@example.com"
+		u.Status = models.UserStatusActive
+		if err := store.Users().Create(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	insertDirect(t, models.Message{SenderID: "002", ReceiverID: "001", Content: "hi"})
+	insertDirect(t, models.Message{SenderID: "003", ReceiverID: "001", Content: "hi"})
+
+	conversation := &models.Conversation{ID: models.ConversationID("001", "003"), Participants: []string{"001", "003"}}
+	request := models.MessageRequest{SenderID: "003", RecipientID: "001", CreatedAt: time.Now()}
+	if err := store.Conversations().OpenRequest(ctx, conversation, request); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/conversations/search", asUser, SearchConversations)
+
+	var result struct {
+		Conversations []struct {
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"conversations"`
+	}
+	if status := call(t, app, http.MethodGet, "/conversations/search?q=budi", "001", "", &result); status != fiber.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(result.Conversations) != 1 || result.Conversations[0].User.ID != "002" {
+		t.Errorf("search returned %+v, want only the conversation with 002", result.Conversations)
+	}
+
+	// The sender still finds the conversation, it is only a request to the recipient
+	if status := call(t, app, http.MethodGet, "/conversations/search?q=owner", "003", "", &result); status != fiber.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(result.Conversations) != 1 {
+		t.Errorf("sender's search returned %+v, want the conversation with 001", result.Conversations)
+	}
+}
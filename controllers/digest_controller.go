@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/Adisonsmn/ngobrolyuk/mailer"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// digestMaxSenders caps how many sender names are listed in a digest
+const digestMaxSenders = 3
+
+// StartDigestWorker periodically emails users about direct messages left unread
+// for longer than DIGEST_UNREAD_AFTER while they were offline
+func StartDigestWorker() {
+	interval := config.GetDurationEnv("DIGEST_INTERVAL", time.Hour)
+	unreadAfter := config.GetDurationEnv("DIGEST_UNREAD_AFTER", 6*time.Hour)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			sendDigests(unreadAfter)
+		}
+	}()
+}
+
+type unreadDigest struct {
+	UserID    string
+	Count     int
+	SenderIDs []string // Latest first
+	Latest    time.Time
+}
+
+// unreadFrom counts the messages one sender left unread for a user
+type unreadFrom struct {
+	Key struct {
+		ReceiverID string `bson:"receiver_id"`
+		SenderID   string `bson:"sender_id"`
+	} `bson:"_id"`
+	Count  int       `bson:"count"`
+	Latest time.Time `bson:"latest"`
+}
+
+// digestFor sums up the user's unread messages, latest sender first. Senders whose
+// requests the user has not accepted are left out, requests arrive without alerts.
+// Returns false if nothing is left to tell.
+func digestFor(ctx context.Context, userID string, unread []unreadFrom) (unreadDigest, bool, error) {
+	requested, _, err := requestSenders(ctx, userID)
+	if err != nil {
+		return unreadDigest{}, false, err
+	}
+
+	digest := unreadDigest{UserID: userID}
+	for _, u := range unread {
+		if requested[u.Key.SenderID] {
+			continue
+		}
+		digest.Count += u.Count
+		digest.SenderIDs = append(digest.SenderIDs, u.Key.SenderID)
+		if u.Latest.After(digest.Latest) {
+			digest.Latest = u.Latest
+		}
+	}
+	return digest, digest.Count > 0, nil
+}
+
+func sendDigests(unreadAfter time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"read":        false,
+			"room_id":     bson.M{"$exists": false},
+			"channel_id":  bson.M{"$exists": false},
+			"shadowed":    bson.M{"$ne": true},
+			"type":        bson.M{"$ne": models.MessageTypeDeleted},
+			"created_at":  bson.M{"$lte": time.Now().Add(-unreadAfter)},
+			"receiver_id": bson.M{"$exists": true, "$ne": ""},
+		}},
+		// Drop messages the receiver's read cursor has passed, cursor IDs are "<user_id>:<other_id>"
+		{"$lookup": bson.M{
+			"from": "read_cursors",
+			"let":  bson.M{"cursor_id": bson.M{"$concat": []string{"$receiver_id", ":", "$sender_id"}}},
+			"pipeline": []bson.M{
+				{"$match": bson.M{"$expr": bson.M{"$eq": []string{"$_id", "$$cursor_id"}}}},
+			},
+			"as": "cursor",
+		}},
+		{"$match": bson.M{"$expr": bson.M{"$gt": []interface{}{
+			"$created_at", bson.M{"$ifNull": []interface{}{bson.M{"$max": "$cursor.read_at"}, time.Time{}}},
+		}}}},
+		{"$group": bson.M{
+			"_id":    bson.M{"receiver_id": "$receiver_id", "sender_id": "$sender_id"},
+			"count":  bson.M{"$sum": 1},
+			"latest": bson.M{"$max": "$created_at"},
+		}},
+		// Each user's senders arrive together, latest first
+		{"$sort": bson.D{{Key: "_id.receiver_id", Value: 1}, {Key: "latest", Value: -1}}},
+	}
+
+	cursor, err := config.DB.Collection("messages").Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Failed to aggregate unread messages for digests: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	sent := 0
+	var userID string
+	var unread []unreadFrom
+	flush := func() {
+		if len(unread) == 0 {
+			return
+		}
+		digest, ok, err := digestFor(ctx, userID, unread)
+		if err != nil {
+			log.Printf("Failed to build digest for user %s: %v", userID, err)
+		} else if ok && sendDigest(ctx, digest) {
+			sent++
+		}
+		unread = nil
+	}
+
+	for cursor.Next(ctx) {
+		var u unreadFrom
+		if err := cursor.Decode(&u); err != nil {
+			log.Printf("Failed to decode unread digest: %v", err)
+			continue
+		}
+		if u.Key.ReceiverID != userID {
+			flush()
+			userID = u.Key.ReceiverID
+		}
+		unread = append(unread, u)
+	}
+	flush()
+
+	if sent > 0 {
+		log.Printf("Sent %d digest emails", sent)
+	}
+}
+
+// sendDigest emails one user if they are eligible. Returns true if an email was sent.
+func sendDigest(ctx context.Context, digest unreadDigest) bool {
+	// Users with an active session already see their unread messages
+	if hub.Connected(digest.UserID) {
+		return false
+	}
+
+	var user models.User
+	err := config.DB.Collection("users").FindOne(ctx, bson.M{
+		"_id":                   digest.UserID,
+		"online":                bson.M{"$ne": true},
+		"status":                bson.M{"$ne": models.UserStatusDeactivated},
+		"deletion_scheduled_at": bson.M{"$exists": false},
+		"deleted_at":            bson.M{"$exists": false},
+		"email_digest_opt_out":  bson.M{"$ne": true},
+	}).Decode(&user)
+	if err != nil {
+		return false
+	}
+
+	// Nothing new since the last digest
+	if user.LastDigestAt != nil && !digest.Latest.After(*user.LastDigestAt) {
+		return false
+	}
+
+	subject, body, err := mailer.RenderDigest(mailer.DigestData{
+		Language:       i18n.Match(user.Language),
+		Username:       user.Username,
+		UnreadCount:    digest.Count,
+		SenderCount:    len(digest.SenderIDs),
+		Senders:        digestSenderNames(ctx, digest.SenderIDs),
+		AppURL:         appBaseURL(),
+		UnsubscribeURL: fmt.Sprintf("%s/api/v1/unsubscribe/digest?token=%s", appBaseURL(), url.QueryEscape(digestUnsubscribeToken(user.ID))),
+	})
+	if err != nil {
+		log.Printf("Failed to render digest for user %s: %v", user.ID, err)
+		return false
+	}
+
+	if err := mailer.Default().Send(user.Email, subject, body); err != nil {
+		log.Printf("Failed to send digest to user %s: %v", user.ID, err)
+		return false
+	}
+
+	_, err = config.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"last_digest_at": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Failed to record digest for user %s: %v", user.ID, err)
+	}
+
+	return true
+}
+
+func digestSenderNames(ctx context.Context, senderIDs []string) []string {
+	if len(senderIDs) > digestMaxSenders {
+		senderIDs = senderIDs[:digestMaxSenders]
+	}
+
+	cursor, err := config.DB.Collection("users").Find(ctx, bson.M{"_id": bson.M{"$in": senderIDs}})
+	if err != nil {
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var names []string
+	for cursor.Next(ctx) {
+		var sender models.User
+		if err := cursor.Decode(&sender); err == nil {
+			names = append(names, sender.Username)
+		}
+	}
+	return names
+}
+
+func appBaseURL() string {
+	return strings.TrimRight(config.GetEnvWithDefault("APP_BASE_URL", "http://localhost:8080"), "/")
+}
+
+// digestUnsubscribeToken signs the user ID so unsubscribe links work without logging in
+func digestUnsubscribeToken(userID string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte("digest-unsubscribe:" + userID))
+	return userID + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// UnsubscribeDigest turns off digest emails from the link in the email
+func UnsubscribeDigest(c *fiber.Ctx) error {
+	token := c.Query("token")
+
+	userID, _, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(token), []byte(digestUnsubscribeToken(userID))) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid unsubscribe link",
+		})
+	}
+
+	_, err := config.DB.Collection("users").UpdateOne(c.UserContext(),
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"email_digest_opt_out": true}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unsubscribe",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "You will no longer receive digest emails",
+	})
+}
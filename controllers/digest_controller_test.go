@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+func unreadFromSender(senderID string, count int, latest time.Time) unreadFrom {
+	var u unreadFrom
+	u.Key.ReceiverID, u.Key.SenderID = "001", senderID
+	u.Count, u.Latest = count, latest
+	return u
+}
+
+func TestDigestLeavesOutRequests(t *testing.T) {
+	useTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	// 003 has a pending request to 001, 004 had theirs dismissed
+	for _, senderID := range []string{"003", "004"} {
+		conversation := &models.Conversation{ID: models.ConversationID("001", senderID), Participants: []string{"001", senderID}}
+		request := models.MessageRequest{SenderID: senderID, RecipientID: "001", CreatedAt: now}
+		if err := store.Conversations().OpenRequest(ctx, conversation, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Conversations().DismissRequest(ctx, models.ConversationID("001", "004"), "001", now); err != nil {
+		t.Fatal(err)
+	}
+
+	unread := []unreadFrom{
+		unreadFromSender("003", 5, now),
+		unreadFromSender("002", 2, now.Add(-time.Hour)),
+		unreadFromSender("004", 1, now.Add(-2*time.Hour)),
+		unreadFromSender("005", 1, now.Add(-3*time.Hour)),
+	}
+
+	digest, ok, err := digestFor(ctx, "001", unread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no digest for messages from contacts")
+	}
+	if digest.Count != 3 {
+		t.Errorf("Count = %d, want 3", digest.Count)
+	}
+	if want := []string{"002", "005"}; !reflect.DeepEqual(digest.SenderIDs, want) {
+		t.Errorf("SenderIDs = %v, want %v", digest.SenderIDs, want)
+	}
+	if !digest.Latest.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Latest = %v, want the latest message from a contact", digest.Latest)
+	}
+
+	// Only requests unread, no email at all
+	if _, ok, _ := digestFor(ctx, "001", unread[:1]); ok {
+		t.Error("digest sent for a pending request alone")
+	}
+}
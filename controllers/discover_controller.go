@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Activity windows used by discovery sorting
+const (
+	trendingWindow = 24 * time.Hour
+	activeWindow   = 7 * 24 * time.Hour
+)
+
+type activityCount struct {
+	ID    string `bson:"_id"`
+	Count int    `bson:"count"`
+}
+
+// messageActivity counts recent messages grouped by field ("room_id" or "sender_id"), most active first
+func messageActivity(ctx context.Context, field string, since time.Time, limit int) ([]activityCount, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{field: bson.M{"$exists": true, "$ne": ""}, "created_at": bson.M{"$gte": since}}},
+		{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.M{"count": -1}},
+		{"$limit": limit},
+	}
+
+	cursor, err := config.DB.Collection("messages").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var counts []activityCount
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func discoverRoomItem(room models.Room, activity int) fiber.Map {
+	return fiber.Map{
+		"id":           room.ID,
+		"name":         room.Name,
+		"topic":        room.Topic,
+		"member_count": len(room.Members),
+		"activity":     activity,
+		"created_at":   room.CreatedAt,
+	}
+}
+
+// DiscoverRooms lists rooms that opted in to discovery.
+// sort: relevance (default with q), trending (24h), active (7d), newest (default)
+func DiscoverRooms(c *fiber.Ctx) error {
+	query := c.Query("q")
+	sort := c.Query("sort")
+	limit := c.QueryInt("limit", 20)
+
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+	if sort == "" {
+		sort = "newest"
+		if query != "" {
+			sort = "relevance"
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	filter := bson.M{"discoverable": true}
+	if query != "" {
+		filter["$text"] = bson.M{"$search": query}
+	}
+
+	rooms := []fiber.Map{}
+
+	if sort == "trending" || sort == "active" {
+		window := activeWindow
+		if sort == "trending" {
+			window = trendingWindow
+		}
+
+		counts, err := messageActivity(ctx, "room_id", time.Now().Add(-window), 500)
+		if err != nil {
+			log.Printf("Failed to aggregate room activity: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to discover rooms",
+			})
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(counts))
+		for _, count := range counts {
+			if id, err := primitive.ObjectIDFromHex(count.ID); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		filter["_id"] = bson.M{"$in": ids}
+
+		cursor, err := config.DB.Collection("rooms").Find(ctx, filter)
+		if err != nil {
+			log.Printf("Failed to fetch discoverable rooms: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to discover rooms",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		byID := map[string]models.Room{}
+		for cursor.Next(ctx) {
+			var room models.Room
+			if err := cursor.Decode(&room); err != nil {
+				continue
+			}
+			byID[room.ID.Hex()] = room
+		}
+
+		// Keep the activity ranking order
+		for _, count := range counts {
+			room, ok := byID[count.ID]
+			if !ok {
+				continue
+			}
+			rooms = append(rooms, discoverRoomItem(room, count.Count))
+			if len(rooms) >= limit {
+				break
+			}
+		}
+	} else {
+		opts := options.Find().SetLimit(int64(limit))
+		if sort == "relevance" && query != "" {
+			opts.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+				SetSort(bson.M{"score": bson.M{"$meta": "textScore"}})
+		} else {
+			opts.SetSort(bson.M{"created_at": -1})
+		}
+
+		cursor, err := config.DB.Collection("rooms").Find(ctx, filter, opts)
+		if err != nil {
+			log.Printf("Failed to fetch discoverable rooms: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to discover rooms",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var room models.Room
+			if err := cursor.Decode(&room); err != nil {
+				continue
+			}
+			rooms = append(rooms, discoverRoomItem(room, 0))
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"rooms": rooms,
+		"sort":  sort,
+		"total": len(rooms),
+	})
+}
+
+// DiscoverUsers searches users by username and bio via the text index.
+// sort: relevance (default with q), active (7d), recent (default, by last_seen)
+func DiscoverUsers(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	query := c.Query("q")
+	sort := c.Query("sort")
+	limit := c.QueryInt("limit", 20)
+
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+	if sort == "" {
+		sort = "recent"
+		if query != "" {
+			sort = "relevance"
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":                   bson.M{"$ne": currentUserID},
+		"hide_from_discovery":   bson.M{"$ne": true},
+		"status":                bson.M{"$ne": models.UserStatusDeactivated},
+		"deletion_scheduled_at": bson.M{"$exists": false},
+	}
+	if query != "" {
+		filter["$text"] = bson.M{"$search": query}
+	}
+
+	users := []fiber.Map{}
+	toItem := func(user models.User, activity int) fiber.Map {
+		return fiber.Map{
+			"id":        user.ID,
+			"username":  user.Username,
+			"bio":       user.Bio,
+			"avatar":    user.Avatar,
+			"online":    user.Online,
+			"last_seen": user.LastSeen,
+			"activity":  activity,
+		}
+	}
+
+	if sort == "active" {
+		counts, err := messageActivity(ctx, "sender_id", time.Now().Add(-activeWindow), 500)
+		if err != nil {
+			log.Printf("Failed to aggregate user activity: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to discover users",
+			})
+		}
+
+		ids := make([]string, 0, len(counts))
+		for _, count := range counts {
+			if count.ID != currentUserID {
+				ids = append(ids, count.ID)
+			}
+		}
+		filter["_id"] = bson.M{"$in": ids}
+
+		cursor, err := config.DB.Collection("users").Find(ctx, filter)
+		if err != nil {
+			log.Printf("Failed to fetch discoverable users: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to discover users",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		byID := map[string]models.User{}
+		for cursor.Next(ctx) {
+			var user models.User
+			if err := cursor.Decode(&user); err != nil {
+				continue
+			}
+			byID[user.ID] = user
+		}
+
+		for _, count := range counts {
+			user, ok := byID[count.ID]
+			if !ok {
+				continue
+			}
+			users = append(users, toItem(user, count.Count))
+			if len(users) >= limit {
+				break
+			}
+		}
+	} else {
+		opts := options.Find().SetLimit(int64(limit))
+		if sort == "relevance" && query != "" {
+			opts.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+				SetSort(bson.M{"score": bson.M{"$meta": "textScore"}})
+		} else {
+			opts.SetSort(bson.D{{Key: "online", Value: -1}, {Key: "last_seen", Value: -1}})
+		}
+
+		cursor, err := config.DB.Collection("users").Find(ctx, filter, opts)
+		if err != nil {
+			log.Printf("Failed to fetch discoverable users: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to discover users",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var user models.User
+			if err := cursor.Decode(&user); err != nil {
+				continue
+			}
+			users = append(users, toItem(user, 0))
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"users": users,
+		"sort":  sort,
+		"total": len(users),
+	})
+}
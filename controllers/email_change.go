@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/Adisonsmn/ngobrolyuk/mailer"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// emailChangeTTL is how long the confirmation link sent to a new address works
+func emailChangeTTL() time.Duration {
+	return config.GetDurationEnv("EMAIL_CHANGE_TTL", 24*time.Hour)
+}
+
+// emailChange is the pending change carried by a confirmation link. From pins the
+// address it replaces and Nonce the request, stored on the user, so a link stops
+// working once it was used, a newer one was requested, or the email changed some
+// other way.
+type emailChange struct {
+	UserID    string `json:"uid"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Nonce     string `json:"nonce"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// emailChangeSignature signs an encoded email change with JWT_SECRET
+func emailChangeSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte("email-change:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// emailChangeToken encodes and signs the change so nothing is stored until the new
+// address is confirmed
+func emailChangeToken(change emailChange) (string, error) {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + emailChangeSignature(payload), nil
+}
+
+// parseEmailChangeToken checks the signature and expiry of a confirmation token
+func parseEmailChangeToken(token string) (emailChange, bool) {
+	var change emailChange
+
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(emailChangeSignature(payload))) {
+		return change, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &change) != nil {
+		return change, false
+	}
+	return change, change.Nonce != "" && time.Now().Unix() < change.ExpiresAt
+}
+
+// RequestEmailChange sends a confirmation link to the new address and a notice to
+// the current one. The email only changes once the link is opened.
+func RequestEmailChange(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var input models.ChangeEmailRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	input.Email = strings.TrimSpace(input.Email)
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.Users().GetByID(ctx, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	// Require the current password, a stolen session alone can't take over the account
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid password",
+		})
+	}
+
+	if models.CanonicalEmail(input.Email) == user.EmailCanonical {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "This is already your email",
+		})
+	}
+
+	if _, err := store.Users().GetByEmail(ctx, input.Email); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Email already registered",
+		})
+	} else if err != store.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to request email change",
+		})
+	}
+
+	// A new request replaces the nonce, links sent earlier stop working
+	nonce, err := config.GenerateToken(16)
+	if err == nil {
+		err = store.Users().Update(ctx, user.ID, store.UserUpdate{EmailChangeNonce: &nonce})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to request email change",
+		})
+	}
+
+	expiresAt := time.Now().Add(emailChangeTTL())
+	token, err := emailChangeToken(emailChange{
+		UserID:    user.ID,
+		From:      user.Email,
+		To:        input.Email,
+		Nonce:     nonce,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to request email change",
+		})
+	}
+
+	data := mailer.EmailChangeData{
+		Language:   i18n.Match(user.Language),
+		Username:   user.Username,
+		NewEmail:   input.Email,
+		ConfirmURL: appBaseURL() + "/api/v1/email/confirm?token=" + url.QueryEscape(token),
+		ExpiresAt:  expiresAt,
+	}
+
+	subject, body, err := mailer.RenderEmailChangeConfirm(data)
+	if err == nil {
+		err = mailer.Default().Send(input.Email, subject, body)
+	}
+	if err != nil {
+		log.Printf("Failed to send email change confirmation for user %s: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send confirmation email",
+		})
+	}
+
+	// The current address is told either way, a failed notice doesn't stop the change
+	if subject, body, err := mailer.RenderEmailChangeNotice(data); err != nil {
+		log.Printf("Failed to render email change notice for user %s: %v", user.ID, err)
+	} else if err := mailer.Default().Send(user.Email, subject, body); err != nil {
+		log.Printf("Failed to send email change notice to user %s: %v", user.ID, err)
+	}
+
+	log.Printf("User %s requested an email change", user.ID)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":    "Confirmation link sent to the new email address",
+		"email":      input.Email,
+		"expires_at": expiresAt,
+	})
+}
+
+// ConfirmEmailChangePage answers the link sent to the new address with a page that
+// confirms the change by POST, so link scanners and prefetchers opening it change nothing
+func ConfirmEmailChangePage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	change, ok := parseEmailChangeToken(token)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired confirmation link",
+		})
+	}
+
+	lang := middleware.Language(c)
+	title := html.EscapeString(i18n.T(lang, "email.confirm_page.title"))
+
+	c.Set(fiber.HeaderContentType, "text/html; charset=utf-8")
+	return c.SendString(fmt.Sprintf(`<!DOCTYPE html>
+<html lang="%s"><head><meta charset="utf-8"><title>%s</title></head>
+<body><h1>%s</h1><p>%s</p>
+<form method="post" action="/api/v1/email/confirm"><input type="hidden" name="token" value="%s"><button type="submit">%s</button></form>
+</body></html>
+`, lang, title, title,
+		html.EscapeString(i18n.T(lang, "email.confirm_page.text", change.To)),
+		html.EscapeString(token),
+		html.EscapeString(i18n.T(lang, "email.confirm_page.button"))))
+}
+
+// ConfirmEmailChange swaps the email with the token from the link sent to the new
+// address, posted as a form field or JSON
+func ConfirmEmailChange(c *fiber.Ctx) error {
+	var input struct {
+		Token string `json:"token" form:"token"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	change, ok := parseEmailChangeToken(input.Token)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired confirmation link",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	err := store.Users().ChangeEmail(ctx, change.UserID, change.From, change.To, change.Nonce)
+	switch {
+	case err == store.ErrNotFound:
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "This confirmation link was already used or replaced",
+		})
+	case err == store.ErrConflict:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Email already registered",
+		})
+	case err != nil:
+		log.Printf("Failed to change email of user %s: %v", change.UserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to change email",
+		})
+	}
+
+	log.Printf("User %s confirmed an email change", change.UserID)
+
+	return c.JSON(fiber.Map{
+		"message": "Email changed",
+		"email":   change.To,
+	})
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store/mongostore"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportBatchSize is how many messages are read and flushed per chunk
+const exportBatchSize = 500
+
+// exportRow is one message as written to an export file
+type exportRow struct {
+	ID            string    `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	SenderID      string    `json:"sender_id"`
+	Sender        string    `json:"sender"`
+	Type          string    `json:"type"`
+	Content       string    `json:"content"`
+	AttachmentURL string    `json:"attachment_url,omitempty"`
+}
+
+// exportWriter streams rows in one output format
+type exportWriter interface {
+	begin(conversationID string) error
+	row(r exportRow) error
+	end() error
+}
+
+// ExportConversation streams the full history of a direct conversation as JSON, CSV or HTML
+func ExportConversation(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	conversation, err := findConversation(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	format := c.Query("format", "json")
+	var contentType string
+	switch format {
+	case "json":
+		contentType = "application/json"
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "html":
+		contentType = "text/html; charset=utf-8"
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be one of: json, csv, html",
+		})
+	}
+
+	usernames := make(map[string]string)
+	for _, id := range conversation.Participants {
+		var user models.User
+		if err := config.DB.Collection("users").FindOne(context.Background(),
+			bson.M{"_id": id}).Decode(&user); err == nil {
+			usernames[id] = user.Username
+		}
+	}
+
+	a, b := conversation.Participants[0], conversation.Participants[1]
+	filter := bson.M{
+		"room_id": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"sender_id": a, "receiver_id": b},
+			{"sender_id": b, "receiver_id": a},
+		},
+		// Ephemeral messages are never copied out of the conversation
+		"view_once":  bson.M{"$ne": true},
+		"expires_at": nil,
+		"$and":       []bson.M{mongostore.VisibleTo(currentUserID)},
+	}
+
+	lang := middleware.Language(c)
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="conversation-%s.%s"`, conversation.ID, format))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		var out exportWriter
+		switch format {
+		case "csv":
+			out = &csvExport{w: csv.NewWriter(w)}
+		case "html":
+			out = &htmlExport{w: w, lang: lang}
+		default:
+			out = &jsonExport{w: w}
+		}
+
+		if err := streamExport(ctx, w, out, conversation.ID, filter, usernames); err != nil {
+			log.Printf("Export of conversation %s for user %s failed: %v", conversation.ID, currentUserID, err)
+		}
+	})
+
+	return nil
+}
+
+func streamExport(ctx context.Context, w *bufio.Writer, out exportWriter, conversationID string, filter bson.M, usernames map[string]string) error {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetBatchSize(exportBatchSize)
+
+	cursor, err := config.DB.Collection("messages").Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	if err := out.begin(conversationID); err != nil {
+		return err
+	}
+
+	// Write in chunks so archived messages are fetched together and memory stays
+	// bounded regardless of history size
+	batch := make([]models.Message, 0, exportBatchSize)
+	writeBatch := func() error {
+		hydrateArchived(ctx, batch)
+		for _, message := range batch {
+			row := exportRow{
+				ID:        message.ID.Hex(),
+				CreatedAt: message.CreatedAt,
+				SenderID:  message.SenderID,
+				Sender:    usernames[message.SenderID],
+				Type:      message.Type,
+				Content:   message.Content,
+			}
+			if message.Type == models.MessageTypeImage {
+				row.AttachmentURL = message.Content
+			}
+
+			if err := out.row(row); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return w.Flush()
+	}
+
+	for cursor.Next(ctx) {
+		var message models.Message
+		if err := cursor.Decode(&message); err != nil {
+			continue
+		}
+
+		batch = append(batch, message)
+		if len(batch) == exportBatchSize {
+			if err := writeBatch(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writeBatch(); err != nil {
+		return err
+	}
+
+	if err := out.end(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+type jsonExport struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (e *jsonExport) begin(conversationID string) error {
+	header, _ := json.Marshal(conversationID)
+	_, err := fmt.Fprintf(e.w, `{"conversation_id":%s,"exported_at":"%s","messages":[`,
+		header, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (e *jsonExport) row(r exportRow) error {
+	if e.count > 0 {
+		if err := e.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	e.count++
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExport) end() error {
+	_, err := e.w.WriteString("]}")
+	return err
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+func (e *csvExport) begin(conversationID string) error {
+	return e.w.Write([]string{"id", "created_at", "sender_id", "sender", "type", "content", "attachment_url"})
+}
+
+func (e *csvExport) row(r exportRow) error {
+	return e.w.Write([]string{
+		r.ID, r.CreatedAt.UTC().Format(time.RFC3339), r.SenderID, r.Sender, r.Type, r.Content, r.AttachmentURL,
+	})
+}
+
+func (e *csvExport) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// htmlExport is meant for reading, so unlike JSON and CSV its headings and times
+// are in the language of the requester
+type htmlExport struct {
+	w    *bufio.Writer
+	lang string
+}
+
+func (e *htmlExport) begin(conversationID string) error {
+	title := html.EscapeString(i18n.T(e.lang, "export.title", conversationID))
+	_, err := fmt.Fprintf(e.w, `<!DOCTYPE html>
+<html lang="%s"><head><meta charset="utf-8"><title>%s</title>
+<style>body{font-family:sans-serif}td{padding:4px 8px;vertical-align:top}</style></head>
+<body><h1>%s</h1><p>%s</p><table>
+<tr><th>%s</th><th>%s</th><th>%s</th></tr>
+`, e.lang, title, title,
+		html.EscapeString(i18n.T(e.lang, "export.exported", i18n.FormatTime(e.lang, time.Now().UTC()))),
+		i18n.T(e.lang, "export.time"), i18n.T(e.lang, "export.sender"), i18n.T(e.lang, "export.message"))
+	return err
+}
+
+func (e *htmlExport) row(r exportRow) error {
+	content := html.EscapeString(r.Content)
+	if r.AttachmentURL != "" {
+		content = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(r.AttachmentURL), content)
+	}
+
+	_, err := fmt.Fprintf(e.w, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+		i18n.FormatTime(e.lang, r.CreatedAt.UTC()), html.EscapeString(r.Sender), content)
+	return err
+}
+
+func (e *htmlExport) end() error {
+	_, err := e.w.WriteString("</table></body></html>\n")
+	return err
+}
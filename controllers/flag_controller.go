@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/flags"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetMyFlags returns which feature flags are on for the current user
+func GetMyFlags(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	return c.JSON(fiber.Map{
+		"flags": flags.Evaluate(currentUserID),
+	})
+}
+
+// GetFlags lists the flags in effect, built-in defaults included
+func GetFlags(c *fiber.Ctx) error {
+	list := flags.List()
+
+	return c.JSON(fiber.Map{
+		"flags": list,
+		"total": len(list),
+	})
+}
+
+// UpdateFlag creates the flag or replaces its rollout. Other instances pick the
+// change up on their next refresh.
+func UpdateFlag(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+	name := c.Params("name")
+
+	if !models.IsValidFlagName(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Flag name must be 2-48 lowercase letters, digits, '_', '.' or '-'",
+		})
+	}
+
+	var input models.UpdateFlagRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	flag := models.FeatureFlag{
+		Name:        name,
+		Description: config.SanitizeString(input.Description),
+		Enabled:     input.Enabled,
+		Percentage:  input.Percentage,
+		Users:       dedupe(input.Users),
+		UpdatedBy:   adminID,
+		UpdatedAt:   time.Now(),
+	}
+
+	_, err := config.DB.Collection("feature_flags").ReplaceOne(c.UserContext(),
+		bson.M{"_id": name}, flag, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("Failed to save feature flag %s: %v", name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save flag",
+		})
+	}
+
+	flags.Refresh()
+	log.Printf("Feature flag %s set by %s: enabled=%t percentage=%d users=%d",
+		name, adminID, flag.Enabled, flag.Percentage, len(flag.Users))
+
+	return c.JSON(flag)
+}
+
+// DeleteFlag removes a saved flag, built-in flags fall back to their default
+func DeleteFlag(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+	name := c.Params("name")
+
+	result, err := config.DB.Collection("feature_flags").DeleteOne(c.UserContext(), bson.M{"_id": name})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete flag",
+		})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Flag not found",
+		})
+	}
+
+	flags.Refresh()
+	log.Printf("Feature flag %s deleted by %s", name, adminID)
+
+	message := "Flag deleted"
+	if flags.IsDefault(name) {
+		message = "Flag reset to its default"
+	}
+	return c.JSON(fiber.Map{
+		"message": message,
+	})
+}
@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// guestTTL is how long a guest account lasts unless it is upgraded
+func guestTTL() time.Duration {
+	return config.GetDurationEnv("GUEST_TTL", 24*time.Hour)
+}
+
+// guestInviteTTL is how long a guest invite can be redeemed
+func guestInviteTTL() time.Duration {
+	return config.GetDurationEnv("GUEST_INVITE_TTL", 7*24*time.Hour)
+}
+
+// guestInviteToken signs the inviter and expiry so invites need no storage
+func guestInviteToken(inviterID string, expiresAt time.Time) string {
+	payload := inviterID + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte("guest-invite:" + payload))
+	return payload + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseGuestInvite returns the inviter of a valid, unexpired guest invite
+func parseGuestInvite(token string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", false
+	}
+
+	expiresAt := time.Unix(expires, 0)
+	if !hmac.Equal([]byte(token), []byte(guestInviteToken(parts[0], expiresAt))) || time.Now().After(expiresAt) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// guestMessageQuota limits how many messages each guest sends per minute
+type guestMessageQuota struct {
+	mu      sync.Mutex
+	windows map[string]*guestWindow
+}
+
+type guestWindow struct {
+	start time.Time
+	count int
+}
+
+var guestMessages = &guestMessageQuota{windows: map[string]*guestWindow{}}
+
+// allow counts a message, reporting false with the wait when the guest is over GUEST_MESSAGE_LIMIT
+func (q *guestMessageQuota) allow(userID string) (bool, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop finished windows so the map only holds recently active guests
+	for id, w := range q.windows {
+		if now.Sub(w.start) >= time.Minute {
+			delete(q.windows, id)
+		}
+	}
+
+	w, ok := q.windows[userID]
+	if !ok {
+		w = &guestWindow{start: now}
+		q.windows[userID] = w
+	}
+	if w.count >= config.GetIntEnv("GUEST_MESSAGE_LIMIT", 20) {
+		return false, w.start.Add(time.Minute).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// sweepExpiredGuestsLocked disconnects guests whose account expired, callers hold s.mu
+func (s *hubShard) sweepExpiredGuestsLocked() {
+	now := time.Now()
+	for userID, sessions := range s.clients {
+		for _, client := range sessions {
+			if client.guestExpiresAt != nil && now.After(*client.guestExpiresAt) {
+				s.removeLocked(client, models.DisconnectReasonGuestExpired)
+				log.Printf("Guest %s disconnected, account expired", userID)
+			}
+		}
+	}
+}
+
+// guestMayMessage reports whether the client may send a direct message to the receiver,
+// guests only reach the users who invited them
+func (c *Client) guestMayMessage(receiverID string) bool {
+	if c.guestExpiresAt == nil {
+		return true
+	}
+	for _, id := range c.guestInviters {
+		if id == receiverID {
+			return true
+		}
+	}
+	return false
+}
+
+// guestView is what a guest sees about their own account
+func guestView(user *models.User) fiber.Map {
+	return fiber.Map{
+		"id":           user.ID,
+		"username":     user.Username,
+		"display_name": user.DisplayName,
+		"guest":        true,
+		"expires_at":   user.GuestExpiresAt,
+	}
+}
+
+// CreateGuestInvite returns a link token that lets a guest message the caller
+func CreateGuestInvite(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	expiresAt := time.Now().Add(guestInviteTTL())
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"invite":     guestInviteToken(currentUserID, expiresAt),
+		"expires_at": expiresAt,
+	})
+}
+
+// CreateGuest issues a short-lived guest identity. Guests can use rooms they join via
+// invite links and message the users whose guest invite they redeemed.
+func CreateGuest(c *fiber.Ctx) error {
+	var input models.GuestRequest
+	if err := c.BodyParser(&input); err != nil && len(c.Body()) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	displayName := config.SanitizeString(input.DisplayName)
+	if utf8.RuneCountInString(displayName) > 50 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Display name too long (max 50 characters)",
+		})
+	}
+	if displayName == "" {
+		displayName = "Guest"
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	var inviters []string
+	if input.Invite != "" {
+		inviterID, ok := parseGuestInvite(input.Invite)
+		if ok {
+			inviter, err := store.Users().GetByID(ctx, inviterID)
+			ok = err == nil && !inviter.IsGuest() && inviter.DeletedAt == nil
+		}
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired invite",
+			})
+		}
+		inviters = []string{inviterID}
+	}
+
+	userID, err := store.Users().NextID(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create guest",
+		})
+	}
+	suffix, err := config.GenerateToken(4)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create guest",
+		})
+	}
+
+	// Placeholder email keeps the unique index satisfied, guests have no password
+	now := time.Now()
+	expiresAt := now.Add(guestTTL())
+	user := models.User{
+		ID:             userID,
+		Username:       "guest_" + suffix,
+		DisplayName:    displayName,
+		Email:          fmt.Sprintf("guest_%s@guest.invalid", userID),
+		Status:         models.UserStatusActive,
+		LastSeen:       now,
+		CreatedAt:      now,
+		GuestExpiresAt: &expiresAt,
+		GuestInviters:  inviters,
+	}
+
+	if err := store.Users().Create(ctx, &user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create guest",
+		})
+	}
+
+	token, err := signJWT(user.ID, expiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+	c.Cookie(sessionCookie(token, expiresAt))
+
+	log.Printf("Guest %s created, invited by %v", user.ID, inviters)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Guest session started",
+		"user":    guestView(&user),
+	})
+}
+
+// UpgradeGuest turns the calling guest into a full account, keeping its ID and
+// therefore its messages and room memberships
+func UpgradeGuest(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	var input models.RegisterRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	input.Email = strings.TrimSpace(input.Email)
+	input.Username = strings.TrimSpace(input.Username)
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	existingUser, err := store.Users().FindByEmailOrUsername(ctx, input.Email, input.Username)
+	if err == nil && existingUser.ID != currentUserID {
+		if existingUser.EmailCanonical == models.CanonicalEmail(input.Email) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Email already registered",
+			})
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Username already taken",
+		})
+	} else if err != nil && err != store.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	if former, err := reservedUsername(ctx, input.Username); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	} else if former != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Username already taken",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), 14)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process password",
+		})
+	}
+
+	err = store.Users().UpgradeGuest(ctx, currentUserID, input.Username, input.Email, string(hashedPassword))
+	if err == store.ErrConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Username or email already taken",
+		})
+	} else if err != nil {
+		log.Printf("Failed to upgrade guest %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to upgrade account",
+		})
+	}
+
+	// The guest token expires with the guest account, hand out a regular one
+	token, err := generateJWT(currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+	setJWTCookie(c, token)
+
+	// Guest restrictions are decided when the socket connects, the session can be resumed
+	hub.Disconnect(currentUserID, models.DisconnectReasonAccountUpgraded)
+
+	user, err := store.Users().GetByID(ctx, currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to upgrade account",
+		})
+	}
+
+	log.Printf("Guest %s upgraded to a full account", currentUserID)
+
+	return c.JSON(fiber.Map{
+		"message": "Account upgraded successfully",
+		"user": fiber.Map{
+			"id":           user.ID,
+			"username":     user.Username,
+			"display_name": user.DisplayName,
+			"email":        user.Email,
+			"bio":          user.Bio,
+			"avatar":       user.Avatar,
+		},
+	})
+}
@@ -0,0 +1,433 @@
+package controllers
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/telemetry"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Hub tracks the WebSocket sessions of this process. Users are spread over shards by
+// a hash of their ID, each shard has its own lock, clients and event loop so that
+// connects, disconnects and deliveries of different users don't contend.
+type Hub struct {
+	shards      []*hubShard
+	connections atomic.Int64
+
+	writers      sync.WaitGroup // Running write pumps, awaited on shutdown
+	shuttingDown atomic.Bool
+}
+
+// hubShard owns the sessions of the users hashed to it
+type hubShard struct {
+	hub     *Hub
+	mu      sync.RWMutex
+	clients map[string][]*Client                 // Sessions by user ID, oldest first
+	parked  map[string]map[string]*parkedSession // Dropped sessions by user ID and resume token, see resume.go
+
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan models.Message
+
+	// presenceMu keeps the presence changes of this shard's users in order. It is
+	// taken before, never while holding, a shard's mu.
+	presenceMu sync.Mutex
+}
+
+var hub = &Hub{}
+
+// StartHub splits the hub into n shards and starts their event loops, it must run
+// before the WebSocket routes are served
+func StartHub(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	hub.shards = make([]*hubShard, n)
+	for i := range hub.shards {
+		shard := &hubShard{
+			hub:        hub,
+			clients:    make(map[string][]*Client),
+			parked:     make(map[string]map[string]*parkedSession),
+			register:   make(chan *Client),
+			unregister: make(chan *Client),
+			broadcast:  make(chan models.Message, 1000), // Buffer untuk broadcast
+		}
+		hub.shards[i] = shard
+		go shard.run()
+	}
+	log.Printf("WebSocket hub started with %d shards", n)
+}
+
+// DefaultHub returns the hub serving this process's WebSocket connections
+func DefaultHub() *Hub {
+	return hub
+}
+
+// shardFor returns the shard owning the user's sessions
+func (h *Hub) shardFor(userID string) *hubShard {
+	if len(h.shards) == 1 {
+		return h.shards[0]
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(userID))
+	return h.shards[hash.Sum32()%uint32(len(h.shards))]
+}
+
+// Register hands a new client to its shard
+func (h *Hub) Register(client *Client) {
+	h.shardFor(client.UserID).register <- client
+}
+
+// Unregister hands a closed client to its shard
+func (h *Hub) Unregister(client *Client) {
+	h.shardFor(client.UserID).unregister <- client
+}
+
+// Broadcast queues a direct message for its receiver and sender, reports false when
+// the queues stayed full for longer than timeout
+func (h *Hub) Broadcast(message models.Message, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	shards := []*hubShard{h.shardFor(message.ReceiverID)}
+	if sender := h.shardFor(message.SenderID); sender != shards[0] {
+		shards = append(shards, sender)
+	}
+
+	for _, shard := range shards {
+		select {
+		case shard.broadcast <- message:
+		case <-timer.C:
+			return false
+		}
+	}
+	return true
+}
+
+// Connections is the number of open sessions
+func (h *Hub) Connections() int {
+	return int(h.connections.Load())
+}
+
+// Connected reports whether the user has a session on this server
+func (h *Hub) Connected(userID string) bool {
+	return h.Sessions(userID) > 0
+}
+
+// Sessions is the number of open sessions of the user
+func (h *Hub) Sessions(userID string) int {
+	shard := h.shardFor(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	return len(shard.clients[userID])
+}
+
+// ConnectedUsers lists the users with a session on this server
+func (h *Hub) ConnectedUsers() []string {
+	userIDs := make([]string, 0, h.Connections())
+	for _, shard := range h.shards {
+		shard.mu.RLock()
+		for userID := range shard.clients {
+			userIDs = append(userIDs, userID)
+		}
+		shard.mu.RUnlock()
+	}
+	return userIDs
+}
+
+func (s *hubShard) run() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Hub panic recovered: %v", r)
+			// Restart shard
+			go s.run()
+		}
+	}()
+
+	sweep := time.NewTicker(time.Minute)
+	defer sweep.Stop()
+	idle := time.NewTicker(15 * time.Second)
+	defer idle.Stop()
+
+	for {
+		select {
+		case client := <-s.register:
+			s.presenceMu.Lock()
+			s.mu.Lock()
+			s.registerLocked(client)
+			s.mu.Unlock()
+			s.hub.broadcastPresence(client.UserID, client.audience, models.PresenceOnline, client.lastActiveAt())
+			s.presenceMu.Unlock()
+
+			log.Printf("User %s connected. Total connections: %d", client.UserID, s.hub.Connections())
+
+			// Set user online dengan error handling
+			go func(userID string) {
+				if err := setPresence(userID, true); err != nil {
+					log.Printf("Failed to set user %s online: %v", userID, err)
+				}
+			}(client.UserID)
+
+		case client := <-s.unregister:
+			s.presenceMu.Lock()
+			s.mu.Lock()
+			// The client may already be gone (force-disconnected or evicted)
+			before, _ := s.statusLocked(client.UserID)
+			if s.hasLocked(client) {
+				s.removeLocked(client, "")
+				log.Printf("User %s disconnected. Total connections: %d", client.UserID, s.hub.Connections())
+			}
+			status, lastActive := s.statusLocked(client.UserID)
+			stillConnected := status != models.PresenceOffline
+			s.mu.Unlock()
+			// Other sessions keep the user online, or away if they are all idle
+			if !stillConnected {
+				s.hub.broadcastPresence(client.UserID, client.audience, models.PresenceOffline, client.lastActiveAt())
+			} else if status != before {
+				s.hub.broadcastPresence(client.UserID, client.audience, status, lastActive)
+			}
+			s.presenceMu.Unlock()
+
+			if stillConnected {
+				continue
+			}
+
+			// Set user offline dengan error handling
+			go func(userID string) {
+				if err := setPresence(userID, false); err != nil {
+					log.Printf("Failed to set user %s offline: %v", userID, err)
+				}
+			}(client.UserID)
+
+		case <-sweep.C:
+			s.mu.Lock()
+			s.sweepParkedLocked()
+			s.sweepExpiredGuestsLocked()
+			s.mu.Unlock()
+
+		case <-idle.C:
+			s.sweepIdle()
+
+		case message := <-s.broadcast:
+			_, span := telemetry.Tracer().Start(
+				telemetry.WithTraceParent(context.Background(), message.TraceParent), "hub.broadcast",
+				trace.WithAttributes(attribute.String("message.id", message.ID.Hex())),
+			)
+			message.TraceParent = telemetry.TraceParent(trace.ContextWithSpan(context.Background(), span))
+
+			s.mu.Lock()
+			log.Printf("Processing broadcast message: %s -> %s", message.SenderID, message.ReceiverID)
+
+			// Send to receiver, and to the sender for confirmation, when this shard owns them
+			for _, userID := range []string{message.ReceiverID, message.SenderID} {
+				if s.hub.shardFor(userID) != s {
+					continue
+				}
+				if s.deliverLocked(userID, message) {
+					log.Printf("Message sent to user: %s", userID)
+				} else {
+					log.Printf("User %s not reached during broadcast", userID)
+				}
+			}
+			s.mu.Unlock()
+			span.End()
+		}
+	}
+}
+
+// deliverLocked queues a payload for every session of the user. A client that can't
+// keep up is disconnected, parked sessions of the user buffer the payload. Reports
+// whether any session got it. Callers hold s.mu.
+func (s *hubShard) deliverLocked(userID string, payload interface{}) bool {
+	sent := false
+	// removeLocked replaces the slice, ranging over the current one stays valid
+	for _, client := range s.clients[userID] {
+		select {
+		case client.Send <- payload:
+			sent = true
+		default:
+			s.removeLocked(client, models.DisconnectReasonSlowConsumer)
+			log.Printf("Send channel full, disconnected user: %s", userID)
+		}
+	}
+	s.bufferLocked(userID, payload)
+	return sent
+}
+
+// hasLocked reports whether the client is one of its user's open sessions, callers
+// hold s.mu
+func (s *hubShard) hasLocked(client *Client) bool {
+	for _, c := range s.clients[client.UserID] {
+		if c == client {
+			return true
+		}
+	}
+	return false
+}
+
+// sendToUsers pushes a payload to the connected clients of the given users
+func (h *Hub) sendToUsers(userIDs []string, payload interface{}) {
+	if len(h.shards) == 1 {
+		h.shards[0].deliverAll(userIDs, payload)
+		return
+	}
+
+	byShard := make(map[*hubShard][]string)
+	for _, userID := range userIDs {
+		shard := h.shardFor(userID)
+		byShard[shard] = append(byShard[shard], userID)
+	}
+	for shard, ids := range byShard {
+		shard.deliverAll(ids, payload)
+	}
+}
+
+// deliverAll queues a payload for users of this shard
+func (s *hubShard) deliverAll(userIDs []string, payload interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, userID := range userIDs {
+		s.deliverLocked(userID, payload)
+	}
+}
+
+// removeLocked drops the client and closes its send channel, which makes the write
+// pump send a close frame carrying the reason. Callers hold s.mu.
+func (s *hubShard) removeLocked(client *Client, reason string) {
+	sessions := s.clients[client.UserID]
+	remaining := make([]*Client, 0, len(sessions))
+	for _, c := range sessions {
+		if c != client {
+			remaining = append(remaining, c)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(s.clients, client.UserID)
+	} else {
+		s.clients[client.UserID] = remaining
+	}
+
+	// Say goodbye unless the buffer is full, the close frame carries the reason either way
+	if reason != "" {
+		select {
+		case client.Send <- goodbyeEvent(reason):
+		default:
+		}
+	}
+
+	client.closeReason = reason
+	close(client.Send)
+	s.hub.connections.Add(-1)
+
+	if resumable(reason) {
+		s.parkLocked(client)
+	}
+}
+
+// registerLocked adds the client after queueing its hello and, when it presents the
+// token of a parked session, the events buffered since that session dropped. Doing
+// both under s.mu means nothing sent meanwhile is lost or delivered out of order.
+// The user's oldest sessions are evicted to stay within maxSessionsPerUser.
+func (s *hubShard) registerLocked(client *Client) {
+	// A reconnect presenting the token of a session that still looks open replaces it
+	for _, c := range s.clients[client.UserID] {
+		if client.resumeFrom != "" && c.resumeToken == client.resumeFrom {
+			s.removeLocked(c, models.DisconnectReasonReplaced)
+		}
+	}
+	replay, resumed := s.takeParkedLocked(client.UserID, client.resumeFrom)
+
+	for limit := maxSessionsPerUser(); len(s.clients[client.UserID]) >= limit; {
+		oldest := s.clients[client.UserID][0]
+		s.removeLocked(oldest, models.DisconnectReasonReplaced)
+		log.Printf("User %s reached %d sessions, evicted the oldest", client.UserID, limit)
+	}
+
+	if client.hello != nil {
+		if data, ok := client.hello.Data.(fiber.Map); ok {
+			data["resumed"] = resumed
+		}
+		client.Send <- *client.hello
+	}
+	// The send buffer is empty and larger than maxResumeEvents, this can't block
+	for _, payload := range replay {
+		client.Send <- payload
+	}
+	if resumed {
+		log.Printf("User %s resumed session, replayed %d events", client.UserID, len(replay))
+	}
+
+	s.clients[client.UserID] = append(s.clients[client.UserID], client)
+	recordConnections(int(s.hub.connections.Add(1)))
+
+	client.connectedAt = time.Now()
+	client.lastActive.Store(client.connectedAt.UnixNano())
+}
+
+// Disconnect force-closes every WebSocket session of the user, the reason (one of the
+// models.DisconnectReason values) is sent in the close frame. Reports whether the
+// user was connected.
+func (h *Hub) Disconnect(userID, reason string) bool {
+	shard := h.shardFor(userID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	// Presence is updated when the read pumps unregister the closed connections
+	sessions := shard.clients[userID]
+	for _, client := range sessions {
+		shard.removeLocked(client, reason)
+	}
+	if len(sessions) > 0 {
+		log.Printf("User %s force-disconnected from %d sessions (%s). Total connections: %d",
+			userID, len(sessions), reason, h.Connections())
+	}
+	return len(sessions) > 0
+}
+
+// SendTo pushes an event to the user's sessions, reports whether the user is connected
+func (h *Hub) SendTo(userID string, event models.Event) bool {
+	shard := h.shardFor(userID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if len(shard.clients[userID]) == 0 {
+		return false
+	}
+	shard.deliverLocked(userID, event)
+	return true
+}
+
+// BroadcastAll pushes an event to every connected user and returns how many were reached
+func (h *Hub) BroadcastAll(event models.Event) int {
+	sent := 0
+	for _, shard := range h.shards {
+		shard.mu.Lock()
+		// Parked sessions get it on resume, they are not counted as reached
+		for userID := range shard.parked {
+			if len(shard.clients[userID]) == 0 {
+				shard.bufferLocked(userID, event)
+			}
+		}
+
+		// Clients dropped as slow consumers here are parked with the event buffered,
+		// as are parked sessions of connected users
+		for userID := range shard.clients {
+			if shard.deliverLocked(userID, event) {
+				sent++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return sent
+}
@@ -0,0 +1,392 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/flags"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// conversationTokenTTL is how long conversation tokens last unless the integrator
+// asks for less or more, up to models.MaxConversationTokenSeconds
+func conversationTokenTTL() time.Duration {
+	return config.GetDurationEnv("CONVERSATION_TOKEN_TTL", 15*time.Minute)
+}
+
+// findIntegration loads an integration by the ID in the route, revoked ones included
+func findIntegration(c *fiber.Ctx) (*models.Integration, error) {
+	integrationID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid integration ID")
+	}
+
+	var integration models.Integration
+	err = config.DB.Collection("integrations").FindOne(c.UserContext(), bson.M{"_id": integrationID}).Decode(&integration)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Integration not found")
+	}
+	return &integration, nil
+}
+
+// CreateIntegration registers an external product. The API key is only returned here.
+func CreateIntegration(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var input models.CreateIntegrationRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	secret, err := config.GenerateToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create integration",
+		})
+	}
+	key := "nyk_" + secret
+
+	if input.Users == nil {
+		input.Users = map[string]string{}
+	}
+	now := time.Now()
+	integration := models.Integration{
+		ID:        primitive.NewObjectID(),
+		Name:      input.Name,
+		KeyHash:   middleware.HashAPIKey(key),
+		KeyPrefix: key[:12],
+		Users:     input.Users,
+		CreatedBy: adminID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if _, err := config.DB.Collection("integrations").InsertOne(c.UserContext(), integration); err != nil {
+		log.Printf("Failed to create integration %q: %v", input.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create integration",
+		})
+	}
+
+	log.Printf("Integration %s (%s) created by %s with %d mapped users", integration.ID.Hex(), integration.Name, adminID, len(integration.Users))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"integration": integration,
+		"api_key":     key,
+	})
+}
+
+// GetIntegrations lists integrations, newest first, revoked ones included
+func GetIntegrations(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := config.DB.Collection("integrations").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		log.Printf("Failed to fetch integrations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch integrations",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	integrations := []models.Integration{}
+	if err := cursor.All(ctx, &integrations); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode integrations",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"integrations": integrations,
+		"total":        len(integrations),
+	})
+}
+
+// UpdateIntegration renames an integration or replaces its user mapping. Embedded
+// sessions of users no longer mapped are closed.
+func UpdateIntegration(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var input models.UpdateIntegrationRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	integration, err := findIntegration(c)
+	if err != nil {
+		return err
+	}
+	if integration.RevokedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Integration is revoked",
+		})
+	}
+
+	integration.UpdatedAt = time.Now()
+	update := bson.M{"updated_at": integration.UpdatedAt}
+	if input.Name != nil {
+		integration.Name = *input.Name
+		update["name"] = integration.Name
+	}
+	if input.Users != nil {
+		integration.Users = input.Users
+		update["users"] = integration.Users
+	}
+
+	if _, err := config.DB.Collection("integrations").UpdateByID(c.UserContext(), integration.ID, bson.M{"$set": update}); err != nil {
+		log.Printf("Failed to update integration %s: %v", integration.ID.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update integration",
+		})
+	}
+
+	closed := hub.disconnectIntegration(integration)
+	log.Printf("Integration %s updated by %s, closed %d embedded sessions", integration.ID.Hex(), adminID, closed)
+
+	return c.JSON(integration)
+}
+
+// RevokeIntegration disables an integration's API key and every conversation token
+// it minted, and closes their embedded sessions
+func RevokeIntegration(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	integration, err := findIntegration(c)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result, err := config.DB.Collection("integrations").UpdateOne(c.UserContext(),
+		bson.M{"_id": integration.ID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		log.Printf("Failed to revoke integration %s: %v", integration.ID.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke integration",
+		})
+	}
+	if result.ModifiedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Integration already revoked",
+		})
+	}
+
+	integration.RevokedAt = &now
+	integration.UpdatedAt = now
+	closed := hub.disconnectIntegration(integration)
+	log.Printf("Integration %s revoked by %s, closed %d embedded sessions", integration.ID.Hex(), adminID, closed)
+
+	return c.JSON(integration)
+}
+
+// CreateConversationToken lets an integrator, authenticated by its API key, mint a
+// short-lived token that reads and sends in one conversation as one of its mapped
+// users. The conversation is named by its ID or by a second mapped user.
+func CreateConversationToken(c *fiber.Ctx) error {
+	integration := c.Locals("integration").(*models.Integration)
+
+	var input models.ConversationTokenRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	userID, ok := integration.Users[input.ExternalUserID]
+	if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "External user is not mapped",
+		})
+	}
+
+	conversationID := input.ConversationID
+	if input.PeerExternalUserID != "" {
+		peerID, ok := integration.Users[input.PeerExternalUserID]
+		if !ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Peer external user is not mapped",
+			})
+		}
+		conversationID = models.ConversationID(userID, peerID)
+	}
+
+	if err := checkConversationAccess(c.UserContext(), conversationID, userID); err != nil {
+		return err
+	}
+
+	ttl := conversationTokenTTL()
+	if input.ExpiresIn > 0 {
+		ttl = time.Duration(input.ExpiresIn) * time.Second
+	}
+	if limit := time.Duration(models.MaxConversationTokenSeconds) * time.Second; ttl > limit {
+		ttl = limit
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	token, err := signConversationToken(userID, conversationID, integration.ID.Hex(), expiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create token",
+		})
+	}
+
+	log.Printf("Integration %s minted a token for user %s in conversation %s", integration.ID.Hex(), userID, conversationID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token":           token,
+		"expires_at":      expiresAt,
+		"conversation_id": conversationID,
+		"user_id":         userID,
+	})
+}
+
+// checkConversationAccess makes sure an active user takes part in the direct
+// conversation or room
+func checkConversationAccess(ctx context.Context, conversationID, userID string) error {
+	user, err := store.Users().GetByID(ctx, userID)
+	if err != nil || user.DeletedAt != nil || user.Status == models.UserStatusDeactivated {
+		return fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+
+	if peerID, ok := directPeer(conversationID, userID); ok {
+		if _, err := findConversation(conversationID, userID); err != nil {
+			return err
+		}
+		if _, err := store.Users().GetByID(ctx, peerID); err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+		}
+		return nil
+	}
+
+	if !flags.Enabled(models.FeatureRooms, userID) {
+		return fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+	}
+	_, err = findRoomForMember(conversationID, userID)
+	return err
+}
+
+// directPeer returns the other participant when the ID is a direct conversation
+func directPeer(conversationID, userID string) (string, bool) {
+	participants, ok := models.ConversationParticipants(conversationID)
+	if !ok {
+		return "", false
+	}
+	if participants[0] == userID {
+		return participants[1], true
+	}
+	return participants[0], true
+}
+
+// signConversationToken issues a token limited to one conversation, it is refused
+// everywhere but the routes guarded by middleware.ProtectConversation
+func signConversationToken(userID, conversationID, integrationID string, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id":         userID,
+		"conversation_id": conversationID,
+		"integration_id":  integrationID,
+		"exp":             expiresAt.Unix(),
+		"iat":             time.Now().Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// GetEmbedConversation describes the conversation a conversation token is limited to
+func GetEmbedConversation(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	scope := middleware.ConversationScope(c)
+
+	if peerID, ok := directPeer(scope, currentUserID); ok {
+
+		peer, err := store.Users().GetByID(c.UserContext(), peerID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Conversation not found",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"conversation_id": scope,
+			"type":            "direct",
+			"user_id":         currentUserID,
+			"peer": fiber.Map{
+				"id":           peer.ID,
+				"username":     peer.Username,
+				"display_name": peer.DisplayName,
+				"avatar":       peer.Avatar,
+				"online":       peer.Online,
+				"last_seen":    peer.LastSeen,
+			},
+		})
+	}
+
+	room, err := findRoomForMember(scope, currentUserID)
+	if err != nil {
+		return err
+	}
+	room.SlowModeUntil = slowMode.until(room, currentUserID)
+
+	return c.JSON(fiber.Map{
+		"conversation_id": scope,
+		"type":            "room",
+		"user_id":         currentUserID,
+		"room":            room,
+	})
+}
+
+// GetEmbedMessages pages through the history of the token's conversation, like
+// GET /messages and GET /rooms/:id/messages
+func GetEmbedMessages(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	scope := middleware.ConversationScope(c)
+
+	if peerID, ok := directPeer(scope, currentUserID); ok {
+		return directMessages(c, peerID)
+	}
+
+	room, err := findRoomForMember(scope, currentUserID)
+	if err != nil {
+		return err
+	}
+	return roomMessages(c, room)
+}
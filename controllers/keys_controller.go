@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UploadKeyBundle stores the caller's public identity key and signed prekey.
+// Uploading a new bundle replaces any remaining one-time prekeys.
+func UploadKeyBundle(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var input models.UploadKeyBundleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if errors := input.Validate(); len(errors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"details": errors,
+		})
+	}
+
+	if input.OneTimePreKeys == nil {
+		input.OneTimePreKeys = []models.PreKey{}
+	}
+
+	bundle := models.KeyBundle{
+		UserID:         userID,
+		IdentityKey:    input.IdentityKey,
+		SignedPreKey:   input.SignedPreKey,
+		OneTimePreKeys: input.OneTimePreKeys,
+		UpdatedAt:      time.Now(),
+	}
+
+	_, err := config.DB.Collection("key_bundles").ReplaceOne(c.UserContext(),
+		bson.M{"_id": userID}, bundle, options.Replace().SetUpsert(true))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store key bundle",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":           "Key bundle uploaded successfully",
+		"prekeys_available": len(bundle.OneTimePreKeys),
+	})
+}
+
+// UploadPreKeys appends one-time prekeys, keeping only the newest ones if the cap is exceeded
+func UploadPreKeys(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var input models.UploadPreKeysRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if errors := input.Validate(); len(errors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"details": errors,
+		})
+	}
+
+	result, err := config.DB.Collection("key_bundles").UpdateOne(c.UserContext(),
+		bson.M{"_id": userID},
+		bson.M{
+			"$push": bson.M{"one_time_prekeys": bson.M{
+				"$each":  input.OneTimePreKeys,
+				"$slice": -models.MaxOneTimePreKeys,
+			}},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store prekeys",
+		})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Upload a key bundle first",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Prekeys uploaded successfully",
+	})
+}
+
+// GetPreKeyCount lets clients know when to replenish their one-time prekeys
+func GetPreKeyCount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var bundle models.KeyBundle
+	err := config.DB.Collection("key_bundles").FindOne(c.UserContext(),
+		bson.M{"_id": userID}).Decode(&bundle)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No key bundle uploaded",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch key bundle",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"prekeys_available": len(bundle.OneTimePreKeys),
+		"updated_at":        bundle.UpdatedAt,
+	})
+}
+
+// GetUserKeyBundle returns a recipient's public keys for starting an encrypted session.
+// One one-time prekey is consumed atomically per fetch; once they run out only the
+// signed prekey is returned.
+func GetUserKeyBundle(c *fiber.Ctx) error {
+	targetID := c.Params("user_id")
+
+	var bundle models.KeyBundle
+	err := config.DB.Collection("key_bundles").FindOneAndUpdate(c.UserContext(),
+		bson.M{"_id": targetID},
+		bson.M{"$pop": bson.M{"one_time_prekeys": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&bundle)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User has no key bundle",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch key bundle",
+		})
+	}
+
+	var oneTimePreKey *models.PreKey
+	if len(bundle.OneTimePreKeys) > 0 {
+		oneTimePreKey = &bundle.OneTimePreKeys[0]
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id":         bundle.UserID,
+		"identity_key":    bundle.IdentityKey,
+		"signed_prekey":   bundle.SignedPreKey,
+		"one_time_prekey": oneTimePreKey,
+		"updated_at":      bundle.UpdatedAt,
+	})
+}
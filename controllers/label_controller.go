@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// labelsOf returns the owner's labels and assignments, empty if there are none
+func labelsOf(ctx context.Context, ownerID string) (*models.Labels, error) {
+	labels := &models.Labels{OwnerID: ownerID}
+
+	// Labels are stored in MongoDB only, other backends have none
+	if config.DB == nil {
+		return labels, nil
+	}
+
+	err := config.DB.Collection("labels").FindOne(ctx, bson.M{"_id": ownerID}).Decode(labels)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// labelView adds the conversations carrying the label, so clients can group rooms
+// and direct chats without asking per conversation
+func labelView(labels *models.Labels, label models.Label) fiber.Map {
+	conversations := []string{}
+	for conversationID := range labels.Assignments {
+		if labels.Has(conversationID, label.ID) {
+			conversations = append(conversations, conversationID)
+		}
+	}
+
+	return fiber.Map{
+		"id":            label.ID,
+		"name":          label.Name,
+		"color":         label.Color,
+		"created_at":    label.CreatedAt,
+		"conversations": conversations,
+		"count":         len(conversations),
+	}
+}
+
+func GetLabels(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	labels, err := labelsOf(ctx, currentUserID)
+	if err != nil {
+		log.Printf("Failed to load labels of user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch labels",
+		})
+	}
+
+	views := make([]fiber.Map, 0, len(labels.Labels))
+	for _, label := range labels.Labels {
+		views = append(views, labelView(labels, label))
+	}
+
+	return c.JSON(fiber.Map{
+		"labels": views,
+		"total":  len(views),
+	})
+}
+
+// parseLabelRequest reads and validates a label name and color
+func parseLabelRequest(c *fiber.Ctx) (*models.LabelRequest, error) {
+	var input models.LabelRequest
+	if err := c.BodyParser(&input); err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	input.Name = config.SanitizeString(input.Name)
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+	return &input, nil
+}
+
+func CreateLabel(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	input, err := parseLabelRequest(c)
+	if input == nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	labels, err := labelsOf(ctx, currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create label",
+		})
+	}
+	if labels.NameTaken(input.Name, "") {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You already have a label with this name",
+		})
+	}
+
+	label := models.Label{
+		ID:        primitive.NewObjectID().Hex(),
+		Name:      input.Name,
+		Color:     strings.ToLower(input.Color),
+		CreatedAt: time.Now(),
+	}
+
+	// The filter only matches while there is room for another label. When the list
+	// is full the upsert tries to insert a second document for the owner, which the
+	// _id index rejects.
+	_, err = config.DB.Collection("labels").UpdateOne(ctx,
+		bson.M{"_id": currentUserID, fmt.Sprintf("labels.%d", models.MaxLabels-1): bson.M{"$exists": false}},
+		bson.M{"$push": bson.M{"labels": label}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("You can have at most %d labels", models.MaxLabels),
+		})
+	} else if err != nil {
+		log.Printf("Failed to create label for user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create label",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(label)
+}
+
+// UpdateLabel renames or recolors a label
+func UpdateLabel(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	labelID := c.Params("id")
+
+	input, err := parseLabelRequest(c)
+	if input == nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	labels, err := labelsOf(ctx, currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update label",
+		})
+	}
+	label, ok := labels.Find(labelID)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Label not found",
+		})
+	}
+	if labels.NameTaken(input.Name, labelID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You already have a label with this name",
+		})
+	}
+
+	label.Name = input.Name
+	label.Color = strings.ToLower(input.Color)
+
+	result, err := config.DB.Collection("labels").UpdateOne(ctx,
+		bson.M{"_id": currentUserID, "labels.id": labelID},
+		bson.M{"$set": bson.M{"labels.$.name": label.Name, "labels.$.color": label.Color}},
+	)
+	if err != nil {
+		log.Printf("Failed to update label %s of user %s: %v", labelID, currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update label",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Label not found",
+		})
+	}
+
+	return c.JSON(label)
+}
+
+// DeleteLabel removes a label and takes it off every conversation, the
+// conversations themselves are untouched
+func DeleteLabel(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	labelID := c.Params("id")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	labels, err := labelsOf(ctx, currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete label",
+		})
+	}
+	if _, ok := labels.Find(labelID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Label not found",
+		})
+	}
+
+	pull := bson.M{"labels": bson.M{"id": labelID}}
+	unset := bson.M{}
+	for conversationID, ids := range labels.Assignments {
+		if !labels.Has(conversationID, labelID) {
+			continue
+		}
+		// Conversations left without labels are dropped rather than kept empty
+		if len(ids) == 1 {
+			unset[models.LabelAssignmentField(conversationID)] = ""
+		} else {
+			pull[models.LabelAssignmentField(conversationID)] = labelID
+		}
+	}
+
+	update := bson.M{"$pull": pull}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if _, err := config.DB.Collection("labels").UpdateOne(ctx, bson.M{"_id": currentUserID}, update); err != nil {
+		log.Printf("Failed to delete label %s of user %s: %v", labelID, currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete label",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Label deleted",
+	})
+}
+
+// setLabels replaces the caller's labels on a direct conversation or room
+func setLabels(c *fiber.Ctx, userID, conversationID string) error {
+	var input models.SetLabelsRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	input.Labels = dedupe(input.Labels)
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	labels, err := labelsOf(ctx, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update labels",
+		})
+	}
+	for _, id := range input.Labels {
+		if _, ok := labels.Find(id); !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown label: " + id,
+			})
+		}
+	}
+
+	field := models.LabelAssignmentField(conversationID)
+	update := bson.M{"$set": bson.M{field: input.Labels}}
+	if len(input.Labels) == 0 {
+		update = bson.M{"$unset": bson.M{field: ""}}
+	}
+
+	// Labels must exist, so the owner's document does too
+	if _, err := config.DB.Collection("labels").UpdateOne(ctx, bson.M{"_id": userID}, update); err != nil {
+		log.Printf("Failed to label conversation %s for user %s: %v", conversationID, userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update labels",
+		})
+	}
+
+	if labels.Assignments == nil {
+		labels.Assignments = map[string][]string{}
+	}
+	labels.Assignments[conversationID] = input.Labels
+
+	return c.JSON(fiber.Map{
+		"conversation_id": conversationID,
+		"labels":          labels.Of(conversationID),
+	})
+}
+
+// SetConversationLabels replaces the caller's labels on a direct conversation
+func SetConversationLabels(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	conversationID := c.Params("id")
+
+	// The ID becomes part of a field path
+	participants, ok := models.ConversationParticipants(conversationID)
+	if !ok || (participants[0] != currentUserID && participants[1] != currentUserID) ||
+		strings.ContainsAny(conversationID, ".$") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	return setLabels(c, currentUserID, conversationID)
+}
+
+// SetRoomLabels replaces the caller's labels on a room
+func SetRoomLabels(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	return setLabels(c, currentUserID, room.ID.Hex())
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+// languageOf is the language of text written for the user outside of their own
+// requests, such as notifications and emails
+func languageOf(ctx context.Context, userID string) string {
+	user, err := store.Users().GetByID(ctx, userID)
+	if err != nil {
+		return i18n.Default
+	}
+	return i18n.Match(user.Language)
+}
+
+// byLanguage groups users by languageOf
+func byLanguage(ctx context.Context, userIDs []string) map[string][]string {
+	groups := make(map[string][]string)
+	for _, userID := range userIDs {
+		lang := languageOf(ctx, userID)
+		groups[lang] = append(groups[lang], userID)
+	}
+	return groups
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/flags"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// supportedFeatures lists what this server offers the user with its storage
+// backend and the feature flags rolled out to them
+func supportedFeatures(userID string) []string {
+	features := []string{
+		models.FeatureDirectMessages,
+		models.FeatureRichText,
+		models.FeatureConversationPins,
+		models.FeatureServiceNotices,
+		models.FeatureTraceContext,
+		models.FeatureEphemeral,
+		models.FeatureSlashCommands,
+		models.FeatureFocus,
+	}
+	if config.DB != nil {
+		for _, f := range []string{models.FeatureRooms, models.FeatureChannels, models.FeatureE2EE} {
+			if flags.Enabled(f, userID) {
+				features = append(features, f)
+			}
+		}
+		features = append(features, models.FeatureAppearance)
+	}
+	return features
+}
+
+// negotiateFeatures intersects the features supported for the user with the comma
+// separated list the client asked for, an empty request gets everything
+func negotiateFeatures(userID, requested string) []string {
+	supported := supportedFeatures(userID)
+	if strings.TrimSpace(requested) == "" {
+		return supported
+	}
+
+	wanted := map[string]bool{}
+	for _, f := range strings.Split(requested, ",") {
+		wanted[strings.TrimSpace(f)] = true
+	}
+
+	features := []string{}
+	for _, f := range supported {
+		if wanted[f] {
+			features = append(features, f)
+		}
+	}
+	return features
+}
+
+// unreadSummary counts unread direct messages per conversation, nil if the lookup fails
+func unreadSummary(userID string) fiber.Map {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	summaries, err := store.Messages().DirectConversations(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load unread summary for user %s: %v", userID, err)
+		return nil
+	}
+
+	// Message requests are counted, not listed
+	senders, requests, err := requestSenders(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load message requests of user %s: %v", userID, err)
+	}
+
+	var total int
+	conversations := []fiber.Map{}
+	for _, s := range summaries {
+		if s.UnreadCount == 0 || senders[s.OtherUserID] {
+			continue
+		}
+		total += s.UnreadCount
+		conversations = append(conversations, fiber.Map{
+			"conversation_id": models.ConversationID(userID, s.OtherUserID),
+			"user_id":         s.OtherUserID,
+			"unread_count":    s.UnreadCount,
+			"last_message_at": s.LastMessage.CreatedAt,
+		})
+	}
+
+	return fiber.Map{
+		"total":         total,
+		"conversations": conversations,
+		"requests":      requests,
+	}
+}
+
+func helloEvent(client *Client, features []string) models.Event {
+	data := fiber.Map{
+		"user_id":       client.UserID,
+		"server_time":   time.Now(),
+		"features":      features,
+		"resume_token":  client.resumeToken,
+		"resume_window": int(resumeWindow().Seconds()),
+	}
+
+	// Embedded sessions learn nothing about the user's other conversations
+	if client.scope != "" {
+		data["conversation_id"] = client.scope
+	} else {
+		data["unread"] = unreadSummary(client.UserID)
+	}
+
+	for _, f := range features {
+		// Clients show the open incident as a banner from the start
+		if f == models.FeatureServiceNotices {
+			if incident := currentStatus().Incident; incident != nil {
+				data["incident"] = incident
+			}
+		}
+
+		// Conversation themes follow the user to every device they connect from
+		if f == models.FeatureAppearance && client.scope == "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			appearance := appearancesOf(ctx, client.UserID)
+			cancel()
+			if appearance == nil {
+				appearance = map[string]models.Appearance{}
+			}
+			data["appearance"] = appearance
+		}
+	}
+
+	return models.Event{
+		Event: models.EventHello,
+		Data:  data,
+	}
+}
+
+func goodbyeEvent(reason string) models.Event {
+	// Clients reconnect on their own only when the cause is on the server side
+	reconnect := reason == models.DisconnectReasonServerShutdown || reason == models.DisconnectReasonSlowConsumer ||
+		reason == models.DisconnectReasonAccountUpgraded
+
+	return models.Event{
+		Event: models.EventGoodbye,
+		Data: fiber.Map{
+			"reason":    reason,
+			"reconnect": reconnect,
+		},
+	}
+}
+
+// Shutdown sends goodbye to every connected client, closes their sessions and waits
+// until the write pumps have flushed or ctx expires. Later connections are refused.
+func (h *Hub) Shutdown(ctx context.Context) {
+	h.shuttingDown.Store(true)
+
+	count := 0
+	for _, shard := range h.shards {
+		shard.mu.Lock()
+		for _, sessions := range shard.clients {
+			count += len(sessions)
+			for _, client := range sessions {
+				shard.removeLocked(client, models.DisconnectReasonServerShutdown)
+			}
+		}
+		shard.mu.Unlock()
+	}
+
+	log.Printf("Closing %d WebSocket sessions", count)
+
+	done := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Timed out waiting for WebSocket sessions to close")
+	}
+}
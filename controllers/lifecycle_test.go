@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUnreadCountMatchesSummary(t *testing.T) {
+	useTestStore(t)
+	ctx := context.Background()
+
+	insertDirect(t, models.Message{SenderID: "002", ReceiverID: "001", Content: "from a contact"})
+	insertDirect(t, models.Message{SenderID: "002", ReceiverID: "001", Content: "again"})
+	insertDirect(t, models.Message{SenderID: "003", ReceiverID: "001", Content: "from a stranger"})
+
+	conversation := &models.Conversation{ID: models.ConversationID("001", "003"), Participants: []string{"001", "003"}}
+	request := models.MessageRequest{SenderID: "003", RecipientID: "001", CreatedAt: time.Now()}
+	if err := store.Conversations().OpenRequest(ctx, conversation, request); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/chat/unread", asUser, GetUnreadCount)
+
+	var unread struct {
+		UnreadCount int `json:"unread_count"`
+	}
+	if status := call(t, app, http.MethodGet, "/chat/unread", "001", "", &unread); status != fiber.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+
+	summary := unreadSummary("001")
+	if unread.UnreadCount != 2 || summary["total"] != 2 {
+		t.Errorf("unread count = %d, summary total = %v, want 2 for both", unread.UnreadCount, summary["total"])
+	}
+	if summary["requests"] != 1 {
+		t.Errorf("summary requests = %v, want 1", summary["requests"])
+	}
+
+	// Deleting the request keeps it out of the count
+	if _, err := store.Conversations().DismissRequest(ctx, conversation.ID, "001", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := store.Messages().UnreadCount(ctx, "001"); count != 2 {
+		t.Errorf("unread count after deleting the request = %d, want 2", count)
+	}
+
+	// Accepting it brings the stranger's messages in
+	if err := store.Conversations().Accept(ctx, conversation, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := store.Messages().UnreadCount(ctx, "001"); count != 3 {
+		t.Errorf("unread count after accepting = %d, want 3", count)
+	}
+}
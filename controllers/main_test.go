@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/Adisonsmn/ngobrolyuk/store/memstore"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMain(m *testing.M) {
+	StartHub(1)
+	os.Exit(m.Run())
+}
+
+// useTestStore installs an empty in-memory store
+func useTestStore(t *testing.T) {
+	t.Helper()
+	store.Use(memstore.New())
+}
+
+// asUser stands in for Protect, authenticating the user named in X-Test-User
+func asUser(c *fiber.Ctx) error {
+	c.Locals("user_id", c.Get("X-Test-User"))
+	return c.Next()
+}
+
+// call sends a request as the user and decodes the JSON response into out, if any
+func call(t *testing.T, app *fiber.App, method, path, userID string, body string, out interface{}) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Test-User", userID)
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		data, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, data, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// connect registers a fake WebSocket session for the user and returns its queue
+func connect(t *testing.T, userID string) chan interface{} {
+	t.Helper()
+
+	client := &Client{UserID: userID, Send: make(chan interface{}, 16)}
+	shard := hub.shardFor(userID)
+	shard.mu.Lock()
+	shard.clients[userID] = append(shard.clients[userID], client)
+	shard.mu.Unlock()
+
+	t.Cleanup(func() {
+		shard.mu.Lock()
+		delete(shard.clients, userID)
+		shard.mu.Unlock()
+	})
+	return client.Send
+}
+
+// receivedEvents drains the session queue and returns the names of its events
+func receivedEvents(send chan interface{}) []string {
+	var names []string
+	for {
+		select {
+		case payload := <-send:
+			if event, ok := payload.(models.Event); ok {
+				names = append(names, event.Event)
+			}
+		default:
+			return names
+		}
+	}
+}
+
+// insertDirect stores a direct message and returns its ID
+func insertDirect(t *testing.T, m models.Message) primitive.ObjectID {
+	t.Helper()
+
+	m.ID = primitive.NewObjectID()
+	if m.Type == "" {
+		m.Type = models.MessageTypeText
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	if err := store.Messages().Insert(context.Background(), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m.ID
+}
+
+func hasEvent(events []string, name string) bool {
+	for _, e := range events {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
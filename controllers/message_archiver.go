@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/coldstore"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+)
+
+// messageArchiveBatch is how many messages one archiver pass moves at most
+const messageArchiveBatch = 5000
+
+// messageArchiveAfter is the age at which messages move to cold storage, 0 keeps
+// everything in the messages collection
+func messageArchiveAfter() time.Duration {
+	return config.GetDurationEnv("MESSAGE_ARCHIVE_AFTER", 0)
+}
+
+// hydrateArchived puts back the content of archived messages in a page. A missing
+// archive leaves the stubs empty rather than failing the whole page.
+func hydrateArchived(ctx context.Context, messages []models.Message) {
+	if err := coldstore.Hydrate(ctx, messages); err != nil {
+		log.Printf("Failed to load archived messages: %v", err)
+	}
+}
+
+// StartMessageArchiver periodically moves messages older than MESSAGE_ARCHIVE_AFTER
+// to cold storage, leaving stubs in the messages collection
+func StartMessageArchiver() {
+	if messageArchiveAfter() <= 0 {
+		return
+	}
+	interval := config.GetDurationEnv("MESSAGE_ARCHIVE_INTERVAL", time.Hour)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			archiveMessages()
+			<-ticker.C
+		}
+	}()
+}
+
+func archiveMessages() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	cutoff := time.Now().Add(-messageArchiveAfter())
+	total := 0
+	for {
+		archived, err := coldstore.Archive(ctx, cutoff, messageArchiveBatch)
+		total += archived
+		if err != nil {
+			log.Printf("Failed to archive messages: %v", err)
+			break
+		}
+		// Fewer than a batch means nothing older is left
+		if archived < messageArchiveBatch {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Archived %d messages older than %s", total, cutoff.Format(time.RFC3339))
+	}
+}
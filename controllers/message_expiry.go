@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// messageExpiryBatch caps how many messages one sweep query expires
+const messageExpiryBatch = 500
+
+// Why a disappearing message's content was removed, sent with message_expired
+const (
+	expiredReasonViewed  = "viewed"
+	expiredReasonExpired = "expired"
+)
+
+// messageExpirySweepInterval is how often expired messages are looked for, an
+// expiring message outlives its expiry by at most this long
+func messageExpirySweepInterval() time.Duration {
+	return config.GetDurationEnv("MESSAGE_EXPIRY_SWEEP_INTERVAL", 15*time.Second)
+}
+
+// applyExpiry marks the message view-once or sets its expiry from the send request,
+// or from the room's message timer for room messages
+func applyExpiry(message *models.Message, msgReq *models.SendMessageRequest, room *models.Room) {
+	message.ViewOnce = msgReq.ViewOnce
+	expiresIn := msgReq.ExpiresIn
+	if room != nil {
+		expiresIn = room.MessageTTL
+	}
+	if expiresIn > 0 {
+		expiresAt := message.CreatedAt.Add(time.Duration(expiresIn) * time.Second)
+		message.ExpiresAt = &expiresAt
+	}
+}
+
+// notifyExpired tells the participants to remove the expired messages from view.
+// Recipients never saw messages of shadow-restricted senders, only the sender is told.
+func notifyExpired(messages []models.Message, reason string) {
+	for _, message := range messages {
+		if message.RoomID != "" {
+			notifyRoomExpired(message, reason)
+			continue
+		}
+
+		userIDs := []string{message.SenderID, message.ReceiverID}
+		if message.Shadowed {
+			userIDs = userIDs[:1]
+		}
+		hub.sendToUsers(userIDs, models.Event{
+			Event: models.EventMessageExpired,
+			Data: fiber.Map{
+				"message_id":      message.ID,
+				"conversation_id": models.ConversationID(message.SenderID, message.ReceiverID),
+				"reason":          reason,
+			},
+		})
+	}
+}
+
+// notifyRoomExpired tells the members of a room with a message timer to remove the message
+func notifyRoomExpired(message models.Message, reason string) {
+	userIDs := []string{message.SenderID}
+	if !message.Shadowed {
+		room, err := findRoom(message.RoomID)
+		if err != nil {
+			log.Printf("Failed to load room %s to notify expired message: %v", message.RoomID, err)
+			return
+		}
+		userIDs = room.MemberIDs()
+	}
+	hub.sendToUsers(userIDs, models.Event{
+		Event: models.EventMessageExpired,
+		Data: fiber.Map{
+			"message_id": message.ID,
+			"room_id":    message.RoomID,
+			"reason":     reason,
+		},
+	})
+}
+
+// expireViewed removes view-once messages the receiver read up to readAt
+func expireViewed(ctx context.Context, receiverID, senderID string, readAt time.Time) {
+	expired, err := store.Messages().ExpireViewed(ctx, receiverID, senderID, readAt)
+	if err != nil {
+		log.Printf("Failed to expire view-once messages read by user %s: %v", receiverID, err)
+	}
+	notifyExpired(expired, expiredReasonViewed)
+}
+
+// StartMessageExpiryWorker periodically removes the content of messages past their expiry
+func StartMessageExpiryWorker() {
+	go func() {
+		ticker := time.NewTicker(messageExpirySweepInterval())
+		defer ticker.Stop()
+
+		for {
+			sweepExpiredMessages()
+			<-ticker.C
+		}
+	}()
+}
+
+func sweepExpiredMessages() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for {
+		expired, err := store.Messages().ExpireDue(ctx, time.Now(), messageExpiryBatch)
+		notifyExpired(expired, expiredReasonExpired)
+		if err != nil {
+			log.Printf("Failed to expire messages: %v", err)
+			return
+		}
+		if len(expired) > 0 {
+			log.Printf("Expired %d messages", len(expired))
+		}
+		if len(expired) < messageExpiryBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+// Timeout of a single insert and the wait before the first retry, doubled after
+// every further failure
+const (
+	messageInsertTimeout = 5 * time.Second
+	messageInsertBackoff = 200 * time.Millisecond
+)
+
+// insertMessage stores a message, retrying failed inserts up to
+// MESSAGE_INSERT_ATTEMPTS times so a database failover or a brief network error
+// does not lose it. It runs on the sender's read loop, which holds back their
+// next messages until this one is stored or given up, keeping them in order.
+func insertMessage(ctx context.Context, message *models.Message, events ...models.OutboxEntry) error {
+	attempts := config.GetIntEnv("MESSAGE_INSERT_ATTEMPTS", 3)
+	backoff := messageInsertBackoff
+
+	for attempt := 1; ; attempt++ {
+		insertCtx, cancel := context.WithTimeout(ctx, messageInsertTimeout)
+		err := store.Messages().Insert(insertCtx, message, events...)
+		cancel()
+
+		switch {
+		case err == nil:
+			return nil
+		case err == store.ErrConflict && attempt > 1:
+			// An attempt that timed out was stored after all
+			return nil
+		case err == store.ErrConflict || attempt >= attempts:
+			return err
+		}
+
+		log.Printf("Failed to save message %s (attempt %d of %d), retrying in %s: %v", message.ID.Hex(), attempt, attempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
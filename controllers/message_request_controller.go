@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Outcomes of a message request, sent to the recipient's devices
+const (
+	requestAccepted = "accepted"
+	requestDeleted  = "deleted"
+	requestBlocked  = "blocked"
+)
+
+// knowsSender reports whether a direct message from sender may skip the receiver's
+// message requests: the receiver saved them as a contact, a guest relationship
+// links them, or the two already talked before requests existed
+func knowsSender(ctx context.Context, c *Client, message *models.Message) bool {
+	if c.guestExpiresAt != nil {
+		// Guests only reach the users who invited them
+		return true
+	}
+	if _, ok := contactsOf(ctx, message.ReceiverID)[message.SenderID]; ok {
+		return true
+	}
+
+	receiver, err := store.Users().GetByID(ctx, message.ReceiverID)
+	if err == nil && receiver.InvitedGuest(message.SenderID) {
+		return true
+	}
+
+	history, err := store.Messages().ListDirect(ctx, message.ReceiverID, message.SenderID, nil, 0, 2)
+	if err != nil {
+		log.Printf("Failed to load history of %s: %v", models.ConversationID(message.SenderID, message.ReceiverID), err)
+		return false
+	}
+	for _, m := range history {
+		if m.ID != message.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// settleRequest updates the request state of a direct conversation for a stored
+// message and reports whether the message belongs to a request still awaiting the
+// receiver. Replying to a request accepts it, the first message to a stranger
+// opens one.
+func settleRequest(ctx context.Context, c *Client, conversation *models.Conversation, message *models.Message) (bool, error) {
+	request := conversation.Request
+	switch {
+	case request != nil && request.RecipientID == message.SenderID:
+		if err := store.Conversations().Accept(ctx, conversation, message.CreatedAt); err != nil {
+			return false, err
+		}
+		notifyRequest(conversation.ID, message.SenderID, requestAccepted)
+		return false, nil
+
+	case request != nil:
+		if request.DismissedAt == nil {
+			return true, nil
+		}
+		// A new message brings a deleted request back
+
+	case conversation.AcceptedAt != nil:
+		return false, nil
+
+	case knowsSender(ctx, c, message):
+		return false, store.Conversations().Accept(ctx, conversation, message.CreatedAt)
+	}
+
+	err := store.Conversations().OpenRequest(ctx, conversation, models.MessageRequest{
+		SenderID:    message.SenderID,
+		RecipientID: message.ReceiverID,
+		CreatedAt:   message.CreatedAt,
+	})
+	return err == nil, err
+}
+
+// hidesReads reports whether reads by userID stay hidden from otherID, which is
+// the case while userID has not accepted otherID's message request
+func hidesReads(ctx context.Context, userID, otherID string) bool {
+	conversation, err := store.Conversations().Get(ctx, models.ConversationID(userID, otherID))
+	if err == store.ErrNotFound {
+		return false
+	} else if err != nil {
+		// Failing closed keeps a stranger from learning about reads
+		log.Printf("Failed to load conversation of %s and %s: %v", userID, otherID, err)
+		return true
+	}
+	return conversation.HiddenFrom(userID)
+}
+
+// requestSenders returns the users whose requests to userID stay out of userID's
+// conversations, pending or deleted, and how many of them are pending
+func requestSenders(ctx context.Context, userID string) (map[string]bool, int, error) {
+	requests, err := store.Conversations().Requests(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	senders := make(map[string]bool, len(requests))
+	pending := 0
+	for _, conversation := range requests {
+		senders[conversation.Request.SenderID] = true
+		if conversation.PendingFor(userID) {
+			pending++
+		}
+	}
+	return senders, pending, nil
+}
+
+// notifyRequest tells the recipient's devices what became of a request
+func notifyRequest(conversationID, userID, status string) {
+	hub.sendToUsers([]string{userID}, models.Event{
+		Event: models.EventMessageRequestUpdated,
+		Data: fiber.Map{
+			"conversation_id": conversationID,
+			"status":          status,
+		},
+	})
+}
+
+// GetMessageRequests lists first contacts waiting for the caller, newest first
+func GetMessageRequests(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	pending, err := store.Conversations().Requests(ctx, currentUserID)
+	if err != nil {
+		log.Printf("Failed to fetch message requests of user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch message requests",
+		})
+	}
+
+	requests := []fiber.Map{}
+	for _, conversation := range pending {
+		if !conversation.PendingFor(currentUserID) {
+			continue
+		}
+
+		user, err := store.Users().GetByID(ctx, conversation.Request.SenderID)
+		if err != nil {
+			log.Printf("Failed to find user %s: %v", conversation.Request.SenderID, err)
+			continue
+		}
+
+		request := fiber.Map{
+			"conversation_id": conversation.ID,
+			"user": fiber.Map{
+				"id":       user.ID,
+				"username": user.Username,
+				"avatar":   user.Avatar,
+			},
+			"created_at": conversation.Request.CreatedAt,
+		}
+
+		latest, err := store.Messages().ListDirect(ctx, currentUserID, user.ID, nil, 0, 1)
+		if err == nil && len(latest) > 0 {
+			hydrateArchived(ctx, latest)
+			request["last_message"] = fiber.Map{
+				"id":         latest[0].ID,
+				"content":    latest[0].Content,
+				"type":       latest[0].Type,
+				"created_at": latest[0].CreatedAt,
+				"sender_id":  latest[0].SenderID,
+			}
+		}
+		requests = append(requests, request)
+	}
+
+	return c.JSON(fiber.Map{
+		"requests": requests,
+		"total":    len(requests),
+	})
+}
+
+// findRequest loads a conversation holding a request to the user, pending or deleted
+func findRequest(c *fiber.Ctx, userID string) (*models.Conversation, error) {
+	conversation, err := findConversation(c.Params("id"), userID)
+	if err != nil {
+		return nil, err
+	}
+	if !conversation.HiddenFrom(userID) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Message request not found")
+	}
+	return conversation, nil
+}
+
+// AcceptMessageRequest moves a request into the caller's conversations, after which
+// the sender sees read receipts like in any other conversation
+func AcceptMessageRequest(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	conversation, err := findRequest(c, currentUserID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if err := store.Conversations().Accept(ctx, conversation, time.Now()); err != nil {
+		log.Printf("Failed to accept message request %s: %v", conversation.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to accept message request",
+		})
+	}
+	notifyRequest(conversation.ID, currentUserID, requestAccepted)
+
+	return c.JSON(fiber.Map{
+		"message": "Message request accepted",
+	})
+}
+
+// DeleteMessageRequest hides a request from the caller until the sender writes
+// again. The sender is not told.
+func DeleteMessageRequest(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	conversation, err := findRequest(c, currentUserID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if _, err := store.Conversations().DismissRequest(ctx, conversation.ID, currentUserID, time.Now()); err != nil {
+		log.Printf("Failed to delete message request %s: %v", conversation.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete message request",
+		})
+	}
+	notifyRequest(conversation.ID, currentUserID, requestDeleted)
+
+	return c.JSON(fiber.Map{
+		"message": "Message request deleted",
+	})
+}
+
+// BlockUser stops direct messages from the other participant of a conversation.
+// Their messages are still accepted and echoed back to them, so they cannot tell
+// they were blocked, but the caller never receives them. A pending request from
+// them is deleted.
+func BlockUser(c *fiber.Ctx) error {
+	return setBlocked(c, true)
+}
+
+// UnblockUser lets the other participant's direct messages through again
+func UnblockUser(c *fiber.Ctx) error {
+	return setBlocked(c, false)
+}
+
+func setBlocked(c *fiber.Ctx, blocked bool) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	conversation, err := findConversation(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if err := store.Conversations().SetBlocked(ctx, conversation, currentUserID, blocked); err != nil {
+		log.Printf("Failed to update block of %s in %s: %v", currentUserID, conversation.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update block",
+		})
+	}
+
+	if blocked && conversation.PendingFor(currentUserID) {
+		if _, err := store.Conversations().DismissRequest(ctx, conversation.ID, currentUserID, time.Now()); err != nil {
+			log.Printf("Failed to delete message request %s: %v", conversation.ID, err)
+		}
+		notifyRequest(conversation.ID, currentUserID, requestBlocked)
+	}
+
+	return c.JSON(fiber.Map{
+		"conversation_id": conversation.ID,
+		"blocked":         blocked,
+	})
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/moderation"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// moderateMessage runs the moderation pipeline on a message about to be persisted,
+// possibly masking its content. Returns the decision so callers can reject blocked messages.
+// Encrypted messages are skipped since the server cannot read them.
+func moderateMessage(message *models.Message) moderation.Decision {
+	// Encrypted payloads are opaque to the server
+	if message.Type == models.MessageTypeEncrypted {
+		return moderation.Decision{Content: message.Content}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	decision := moderation.Default().Moderate(ctx, message.Content)
+	message.Content = decision.Content
+
+	if decision.Report {
+		go fileSystemReport(message, decision.Reasons)
+	}
+
+	return decision
+}
+
+// fileSystemReport records an automatic report for a flagged message
+func fileSystemReport(message *models.Message, reasons []string) {
+	// Reports are stored in MongoDB only
+	if config.DB == nil {
+		log.Printf("Moderation flagged message from user %s: %v", message.SenderID, reasons)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	report := models.Report{
+		MessageID:  message.ID,
+		SenderID:   message.SenderID,
+		ReporterID: models.ReporterSystem,
+		Reasons:    reasons,
+		Status:     models.ReportStatusOpen,
+		CreatedAt:  time.Now(),
+	}
+
+	if _, err := config.DB.Collection("reports").InsertOne(ctx, report); err != nil {
+		log.Printf("Failed to file automatic report for message %s: %v", message.ID.Hex(), err)
+	}
+}
+
+// GetModerationStats returns the moderation counters since startup
+func GetModerationStats(c *fiber.Ctx) error {
+	pipeline := moderation.Default()
+
+	return c.JSON(fiber.Map{
+		"policy":     pipeline.Policy,
+		"moderators": len(pipeline.Moderators),
+		"actions":    pipeline.Metrics.Snapshot(),
+	})
+}
+
+func GetReports(c *fiber.Ctx) error {
+	status := c.Query("status", models.ReportStatusOpen)
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+
+	if limit > 100 {
+		limit = 100
+	}
+
+	skip := (page - 1) * limit
+
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("reports").Find(ctx, bson.M{"status": status}, opts)
+	if err != nil {
+		log.Printf("Failed to fetch reports: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch reports",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	reports := []models.Report{}
+	if err := cursor.All(ctx, &reports); err != nil {
+		log.Printf("Failed to decode reports: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode reports",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"reports": reports,
+		"pagination": fiber.Map{
+			"page":  page,
+			"limit": limit,
+			"total": len(reports),
+		},
+	})
+}
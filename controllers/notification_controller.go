@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/push"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notificationPreviewLength caps the message text included in notifications
+const notificationPreviewLength = 100
+
+// messageConversationID returns the key notification settings are stored under
+func messageConversationID(message *models.Message) string {
+	if message.RoomID != "" {
+		return message.RoomID
+	}
+	return models.ConversationID(message.SenderID, message.ReceiverID)
+}
+
+// notificationLevels returns each user's level for a conversation, defaulting to "all"
+func notificationLevels(ctx context.Context, userIDs []string, conversationID string) map[string]string {
+	levels := make(map[string]string, len(userIDs))
+	for _, id := range userIDs {
+		levels[id] = models.NotifyAll
+	}
+
+	// Settings are stored in MongoDB only, other backends notify everything
+	if config.DB == nil {
+		return levels
+	}
+
+	cursor, err := config.DB.Collection("notification_settings").Find(ctx, bson.M{
+		"conversation_id": conversationID,
+		"user_id":         bson.M{"$in": userIDs},
+	})
+	if err != nil {
+		log.Printf("Failed to load notification settings for %s: %v", conversationID, err)
+		return levels
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var setting models.NotificationSetting
+		if err := cursor.Decode(&setting); err == nil {
+			levels[setting.UserID] = setting.Level
+		}
+	}
+
+	return levels
+}
+
+// mentionedUsers returns which of the given users are @mentioned in the message
+func mentionedUsers(ctx context.Context, message *models.Message, userIDs []string) map[string]bool {
+	mentioned := make(map[string]bool)
+
+	// Encrypted content cannot be parsed for mentions
+	if message.Type == models.MessageTypeEncrypted || len(userIDs) == 0 {
+		return mentioned
+	}
+
+	mentions := models.ParseMentions(message.Content)
+	if len(mentions) == 0 {
+		return mentioned
+	}
+
+	cursor, err := config.DB.Collection("users").Find(ctx,
+		bson.M{"_id": bson.M{"$in": userIDs}},
+		options.Find().SetProjection(bson.M{"username": 1}))
+	if err != nil {
+		return mentioned
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err == nil && mentions[strings.ToLower(user.Username)] {
+			mentioned[user.ID] = true
+		}
+	}
+
+	return mentioned
+}
+
+// dispatchNotifications alerts recipients of a new message according to their
+// per-conversation preferences: connected users get a "notification" event over
+// WebSocket, everyone else gets a push notification. Recipients who have the
+// conversation in view are not alerted, the sender of a direct message is told it
+// was delivered instead.
+func dispatchNotifications(message models.Message, recipients []string) {
+	// Room events show up in history, they are not worth an alert
+	if message.Type == models.MessageTypeSystem {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conversationID := messageConversationID(&message)
+	levels := notificationLevels(ctx, recipients, conversationID)
+
+	var mentionOnly []string
+	for _, id := range recipients {
+		if levels[id] == models.NotifyMentions {
+			mentionOnly = append(mentionOnly, id)
+		}
+	}
+	mentioned := mentionedUsers(ctx, &message, mentionOnly)
+
+	// Previews without the content are written in each recipient's language
+	preview := func(lang string) string {
+		switch {
+		case message.Type == models.MessageTypeEncrypted:
+			return i18n.T(lang, "notification.encrypted")
+		case message.Disappears():
+			// Notifications would outlive the content
+			return i18n.T(lang, "notification.disappearing")
+		case utf8.RuneCountInString(message.Content) > notificationPreviewLength:
+			return string([]rune(message.Content)[:notificationPreviewLength]) + "..."
+		}
+		return message.Content
+	}
+
+	var online, offline []string
+	for _, id := range recipients {
+		if id == message.SenderID {
+			continue
+		}
+
+		// Recipients looking at the conversation need no alert
+		following := hub.attention(id, conversationID)
+		if following == attentionFocused {
+			if message.RoomID == "" {
+				hub.sendToUsers([]string{message.SenderID}, models.Event{
+					Event: models.EventMessageDelivered,
+					Data: fiber.Map{
+						"conversation_id": conversationID,
+						"message_id":      message.ID.Hex(),
+						"user_id":         id,
+						"delivered_at":    time.Now(),
+					},
+				})
+			}
+			continue
+		}
+
+		switch levels[id] {
+		case models.NotifyNone:
+			continue
+		case models.NotifyMentions:
+			if !mentioned[id] {
+				continue
+			}
+		}
+
+		if following == attentionConnected {
+			online = append(online, id)
+		} else {
+			offline = append(offline, id)
+		}
+	}
+
+	// Content previews read the same in every language
+	groups := map[string][]string{i18n.Default: online}
+	if len(online) > 0 && (message.Type == models.MessageTypeEncrypted || message.Disappears()) {
+		groups = byLanguage(ctx, online)
+	}
+	for lang, ids := range groups {
+		if len(ids) == 0 {
+			continue
+		}
+		hub.sendToUsers(ids, models.Event{
+			Event: models.EventNotification,
+			Data: fiber.Map{
+				"conversation_id": conversationID,
+				"message_id":      message.ID.Hex(),
+				"sender_id":       message.SenderID,
+				"preview":         preview(lang),
+				"mentioned":       len(mentioned) > 0,
+			},
+		})
+	}
+
+	for _, id := range offline {
+		lang := languageOf(ctx, id)
+		push.Default().Enqueue(push.Notification{
+			UserID:         id,
+			Title:          i18n.T(lang, "notification.title"),
+			Body:           preview(lang),
+			ConversationID: conversationID,
+			MessageID:      message.ID.Hex(),
+			CreatedAt:      message.CreatedAt,
+		})
+	}
+}
+
+func saveNotificationSetting(c *fiber.Ctx, userID, conversationID string) error {
+	var input models.UpdateNotificationSettingRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"details": validationErrors,
+		})
+	}
+
+	filter := bson.M{"user_id": userID, "conversation_id": conversationID}
+
+	var err error
+	if input.Level == models.NotifyAll {
+		// "all" is the default, no need to keep an override around
+		_, err = config.DB.Collection("notification_settings").DeleteOne(context.Background(), filter)
+	} else {
+		_, err = config.DB.Collection("notification_settings").UpdateOne(context.Background(),
+			filter,
+			bson.M{"$set": bson.M{"level": input.Level, "updated_at": time.Now()}},
+			options.Update().SetUpsert(true),
+		)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update notification settings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"conversation_id": conversationID,
+		"level":           input.Level,
+	})
+}
+
+// UpdateConversationNotifications sets the caller's notification level for a direct conversation
+func UpdateConversationNotifications(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	conversationID := c.Params("id")
+
+	participants, ok := models.ConversationParticipants(conversationID)
+	if !ok || (participants[0] != currentUserID && participants[1] != currentUserID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	return saveNotificationSetting(c, currentUserID, conversationID)
+}
+
+// UpdateRoomNotifications sets the caller's notification level for a room
+func UpdateRoomNotifications(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	return saveNotificationSetting(c, currentUserID, room.ID.Hex())
+}
+
+// GetNotificationSettings lists the caller's per-conversation overrides
+func GetNotificationSettings(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	cursor, err := config.DB.Collection("notification_settings").Find(c.UserContext(),
+		bson.M{"user_id": currentUserID},
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch notification settings",
+		})
+	}
+	defer cursor.Close(c.UserContext())
+
+	settings := []models.NotificationSetting{}
+	if err := cursor.All(c.UserContext(), &settings); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode notification settings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"default":  models.NotifyAll,
+		"settings": settings,
+	})
+}
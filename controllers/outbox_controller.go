@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/outbox"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOutboxStatus reports the backlog of events waiting for external systems
+// and this instance's publish counters
+func GetOutboxStatus(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	pending, oldest, err := store.Outbox().Pending(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch outbox status",
+		})
+	}
+
+	published, failed := outbox.Start().Stats()
+	status := fiber.Map{
+		"pending":   pending,
+		"published": published,
+		"failed":    failed,
+	}
+	if pending > 0 {
+		status["oldest_pending_at"] = oldest
+		status["lag_seconds"] = int(time.Since(oldest).Seconds())
+	}
+
+	return c.JSON(status)
+}
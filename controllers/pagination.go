@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pageCursor is where a next_cursor resumes, opaque to clients. Lists ranked in
+// memory or sorted on changing fields resume at an offset, message history
+// resumes after a message so new messages do not shift the pages.
+type pageCursor struct {
+	Offset   int64      `json:"o,omitempty"`
+	Before   *time.Time `json:"t,omitempty"`
+	BeforeID string     `json:"id,omitempty"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(value string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Offset < 0 {
+		return nil, fiber.ErrBadRequest
+	}
+	if cursor.BeforeID != "" {
+		if _, err := primitive.ObjectIDFromHex(cursor.BeforeID); err != nil {
+			return nil, err
+		}
+	}
+	return &cursor, nil
+}
+
+// pageRequest is how a list was asked for: by page number, or by the cursor of a
+// previous response. Following cursors skips the total count.
+type pageRequest struct {
+	Page   int
+	Limit  int
+	Cursor *pageCursor
+}
+
+// parsePage reads page, limit and cursor, clamping limit to maxLimit
+func parsePage(c *fiber.Ctx, defaultLimit, maxLimit int) (pageRequest, error) {
+	p := pageRequest{
+		Page:  max(c.QueryInt("page", 1), 1),
+		Limit: c.QueryInt("limit", defaultLimit),
+	}
+	if p.Limit < 1 {
+		p.Limit = defaultLimit
+	}
+	p.Limit = min(p.Limit, maxLimit)
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			return p, fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+		}
+		p.Cursor = cursor
+	}
+	return p, nil
+}
+
+// first reports whether the page starts at the top of the list
+func (p pageRequest) first() bool {
+	return p.Cursor == nil && p.Page == 1
+}
+
+func (p pageRequest) skip() int64 {
+	if p.Cursor != nil {
+		return p.Cursor.Offset
+	}
+	return int64(p.Page-1) * int64(p.Limit)
+}
+
+// before is the message a message history page starts after, nil at the newest
+func (p pageRequest) before() *store.MessageCursor {
+	if p.Cursor == nil || p.Cursor.Before == nil {
+		return nil
+	}
+	id, _ := primitive.ObjectIDFromHex(p.Cursor.BeforeID)
+	return &store.MessageCursor{CreatedAt: *p.Cursor.Before, ID: id}
+}
+
+// pageTotal is the length of the whole list. Estimated totals come from
+// collection statistics or a recent count rather than this request.
+type pageTotal struct {
+	Count     int64
+	Estimated bool
+}
+
+// envelope is the pagination object of list responses. next is where the
+// following page starts and is only used when hasMore.
+func (p pageRequest) envelope(hasMore bool, next pageCursor, total *pageTotal) fiber.Map {
+	pagination := fiber.Map{
+		"limit":    p.Limit,
+		"has_more": hasMore,
+	}
+	if p.Cursor == nil {
+		pagination["page"] = p.Page
+	}
+	if hasMore {
+		pagination["next_cursor"] = encodeCursor(next)
+	}
+	if total != nil {
+		pagination["total"] = total.Count
+		pagination["total_pages"] = (total.Count + int64(p.Limit) - 1) / int64(p.Limit)
+		pagination["total_estimated"] = total.Estimated
+	}
+	return pagination
+}
+
+// messageEnvelope pages message history fetched newest first with one message
+// more than the limit, which it drops
+func (p pageRequest) messageEnvelope(messages []models.Message) ([]models.Message, fiber.Map) {
+	if len(messages) <= p.Limit {
+		return messages, p.envelope(false, pageCursor{}, nil)
+	}
+	messages = messages[:p.Limit]
+	oldest := messages[len(messages)-1]
+	return messages, p.envelope(true, pageCursor{Before: &oldest.CreatedAt, BeforeID: oldest.ID.Hex()}, nil)
+}
+
+// pageOf returns the requested page of a list held in memory, whose length is
+// its exact total
+func pageOf[T any](p pageRequest, items []T) ([]T, fiber.Map) {
+	total := &pageTotal{Count: int64(len(items))}
+	skip := p.skip()
+	if skip >= int64(len(items)) {
+		return items[len(items):], p.envelope(false, pageCursor{}, total)
+	}
+	end := min(skip+int64(p.Limit), int64(len(items)))
+	return items[skip:end], p.envelope(end < int64(len(items)), pageCursor{Offset: end}, total)
+}
+
+// newestFirst orders message history paged with pageRequest.before
+var newestFirst = bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+
+// olderThan matches the messages after the cursor in a newest first listing
+func olderThan(before *store.MessageCursor) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"created_at": bson.M{"$lt": before.CreatedAt}},
+			{"created_at": before.CreatedAt, "_id": bson.M{"$lt": before.ID}},
+		},
+	}
+}
+
+// Totals counted recently, keyed by a fixed set of list names
+var pageTotals = struct {
+	sync.Mutex
+	entries map[string]cachedTotal
+}{entries: map[string]cachedTotal{}}
+
+type cachedTotal struct {
+	count int64
+	at    time.Time
+}
+
+// cachedCount returns the total of the list under key, running count at most
+// once per PAGE_TOTAL_CACHE_TTL (default 1m). Totals from the cache are
+// estimated, they may be behind by that long, and so are fresh ones when count
+// only approximates.
+func cachedCount(ctx context.Context, key string, estimated bool, count func(context.Context) (int64, error)) (*pageTotal, error) {
+	ttl := config.GetDurationEnv("PAGE_TOTAL_CACHE_TTL", time.Minute)
+
+	pageTotals.Lock()
+	entry, ok := pageTotals.entries[key]
+	pageTotals.Unlock()
+	if ok && time.Since(entry.at) < ttl {
+		return &pageTotal{Count: entry.count, Estimated: true}, nil
+	}
+
+	n, err := count(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pageTotals.Lock()
+	pageTotals.entries[key] = cachedTotal{count: n, at: time.Now()}
+	pageTotals.Unlock()
+	return &pageTotal{Count: n, Estimated: estimated}, nil
+}
@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// checkCanPin rejects pins that already exist or would exceed the cap
+func checkCanPin(pinned []models.PinnedMessage, messageID primitive.ObjectID) error {
+	if models.HasPin(pinned, messageID) {
+		return fiber.NewError(fiber.StatusConflict, "Message already pinned")
+	}
+	if len(pinned) >= models.MaxPinnedMessages {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Pin limit reached (max %d)", models.MaxPinnedMessages))
+	}
+	return nil
+}
+
+// pinFilter matches the document only if the message is not pinned and the list is not full,
+// so concurrent pins cannot exceed the cap
+func pinFilter(id interface{}, messageID primitive.ObjectID) bson.M {
+	return bson.M{
+		"_id":               id,
+		"pinned.message_id": bson.M{"$ne": messageID},
+		fmt.Sprintf("pinned.%d", models.MaxPinnedMessages-1): bson.M{"$exists": false},
+	}
+}
+
+// pinsWithMessages expands pinned references with the referenced messages, leaving out
+// pins of messages the viewer cannot see
+func pinsWithMessages(viewerID string, pinned []models.PinnedMessage) ([]fiber.Map, error) {
+	pins := []fiber.Map{}
+	if len(pinned) == 0 {
+		return pins, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(pinned))
+	for _, p := range pinned {
+		ids = append(ids, p.MessageID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	messages, err := store.Messages().GetByIDs(ctx, viewerID, ids)
+	if err != nil {
+		return nil, err
+	}
+	hydrateArchived(ctx, messages)
+
+	byID := make(map[primitive.ObjectID]models.Message, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+
+	for _, p := range pinned {
+		message, ok := byID[p.MessageID]
+		if !ok {
+			continue
+		}
+		pins = append(pins, fiber.Map{
+			"message_id": p.MessageID,
+			"pinned_by":  p.PinnedBy,
+			"pinned_at":  p.PinnedAt,
+			"message":    message,
+		})
+	}
+
+	return pins, nil
+}
+
+func PinConversationMessage(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	conversation, err := findConversation(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	// Like messages, pins never reach someone behind a block or a request they have
+	// not accepted
+	otherID := conversation.Participants[0]
+	if otherID == currentUserID {
+		otherID = conversation.Participants[1]
+	}
+	if conversation.Blocked(currentUserID) || conversation.Blocked(otherID) || conversation.HiddenFrom(otherID) {
+		return fiber.NewError(fiber.StatusForbidden, "You cannot pin messages in this conversation")
+	}
+
+	message, err := findConversationMessage(conversation, currentUserID, c.Params("message_id"))
+	if err != nil {
+		return err
+	}
+
+	if err := checkCanPin(conversation.Pinned, message.ID); err != nil {
+		return err
+	}
+
+	pin := models.PinnedMessage{MessageID: message.ID, PinnedBy: currentUserID, PinnedAt: time.Now()}
+
+	// Conversation state is created on first write
+	err = store.Conversations().AddPin(c.UserContext(), conversation, pin)
+	if err == store.ErrConflict {
+		return fiber.NewError(fiber.StatusConflict, "Message already pinned or pin limit reached")
+	} else if err != nil {
+		log.Printf("Failed to pin message: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to pin message",
+		})
+	}
+
+	// A shadow-restricted sender pinning their own message is the only one who sees it
+	recipients := conversation.Participants
+	if message.Shadowed {
+		recipients = []string{currentUserID}
+	}
+	hub.sendToUsers(recipients, models.Event{Event: models.EventMessagePinned, Data: fiber.Map{
+		"conversation_id": conversation.ID,
+		"message_id":      message.ID,
+		"pinned_by":       currentUserID,
+		"pinned_at":       pin.PinnedAt,
+	}})
+
+	return c.Status(fiber.StatusCreated).JSON(pin)
+}
+
+func UnpinConversationMessage(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	conversation, err := findConversation(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Params("message_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid message ID",
+		})
+	}
+
+	removed, err := store.Conversations().RemovePin(c.UserContext(), conversation.ID, messageID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unpin message",
+		})
+	}
+
+	if !removed {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Message is not pinned",
+		})
+	}
+
+	notifyConversation(conversation, models.EventMessageUnpinned, fiber.Map{
+		"conversation_id": conversation.ID,
+		"message_id":      messageID,
+		"unpinned_by":     currentUserID,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Message unpinned",
+	})
+}
+
+func GetConversationPins(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	conversation, err := findConversation(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	pins, err := pinsWithMessages(currentUserID, conversation.Pinned)
+	if err != nil {
+		log.Printf("Failed to fetch pinned messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch pinned messages",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"pins":  pins,
+		"total": len(pins),
+	})
+}
+
+func PinRoomMessage(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	if !room.Can(currentUserID, models.RoomPermPinMessages) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to pin messages")
+	}
+
+	message, err := findRoomMessage(room, c.Params("message_id"))
+	if err != nil {
+		return err
+	}
+
+	if err := checkCanPin(room.Pinned, message.ID); err != nil {
+		return err
+	}
+
+	pin := models.PinnedMessage{MessageID: message.ID, PinnedBy: currentUserID, PinnedAt: time.Now()}
+
+	result, err := config.DB.Collection("rooms").UpdateOne(c.UserContext(),
+		pinFilter(room.ID, message.ID),
+		bson.M{"$push": bson.M{"pinned": pin}},
+	)
+	if err != nil {
+		log.Printf("Failed to pin room message: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to pin message",
+		})
+	}
+
+	if result.MatchedCount == 0 {
+		return fiber.NewError(fiber.StatusConflict, "Message already pinned or pin limit reached")
+	}
+
+	notifyRoom(room, models.EventMessagePinned, fiber.Map{
+		"room_id":    room.ID,
+		"message_id": message.ID,
+		"pinned_by":  currentUserID,
+		"pinned_at":  pin.PinnedAt,
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(pin)
+}
+
+func UnpinRoomMessage(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	if !room.Can(currentUserID, models.RoomPermPinMessages) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to unpin messages")
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Params("message_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid message ID",
+		})
+	}
+
+	result, err := config.DB.Collection("rooms").UpdateOne(c.UserContext(),
+		bson.M{"_id": room.ID, "pinned.message_id": messageID},
+		bson.M{"$pull": bson.M{"pinned": bson.M{"message_id": messageID}}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unpin message",
+		})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Message is not pinned",
+		})
+	}
+
+	notifyRoom(room, models.EventMessageUnpinned, fiber.Map{
+		"room_id":     room.ID,
+		"message_id":  messageID,
+		"unpinned_by": currentUserID,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Message unpinned",
+	})
+}
+
+func GetRoomPins(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	pins, err := pinsWithMessages(currentUserID, room.Pinned)
+	if err != nil {
+		log.Printf("Failed to fetch pinned room messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch pinned messages",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"pins":  pins,
+		"total": len(pins),
+	})
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func pinApp() *fiber.App {
+	app := fiber.New()
+	app.Get("/conversations/:id/pins", asUser, GetConversationPins)
+	app.Post("/conversations/:id/pins/:message_id", asUser, PinConversationMessage)
+	return app
+}
+
+func TestPinShadowedMessage(t *testing.T) {
+	useTestStore(t)
+	app := pinApp()
+	conversationID := models.ConversationID("001", "002")
+
+	shadowed := insertDirect(t, models.Message{SenderID: "001", ReceiverID: "002", Content: "spam", Shadowed: true})
+	sender, recipient := connect(t, "001"), connect(t, "002")
+
+	// The recipient cannot pin, or even find, a message hidden from them
+	path := "/conversations/" + conversationID + "/pins/" + shadowed.Hex()
+	if status := call(t, app, http.MethodPost, path, "002", "", nil); status != fiber.StatusNotFound {
+		t.Errorf("recipient pinning: status = %d, want %d", status, fiber.StatusNotFound)
+	}
+
+	// The shadowed sender may pin it, but only they hear about it
+	if status := call(t, app, http.MethodPost, path, "001", "", nil); status != fiber.StatusCreated {
+		t.Fatalf("sender pinning: status = %d, want %d", status, fiber.StatusCreated)
+	}
+	if events := receivedEvents(recipient); hasEvent(events, models.EventMessagePinned) {
+		t.Errorf("recipient was told about the pin: %v", events)
+	}
+	if events := receivedEvents(sender); !hasEvent(events, models.EventMessagePinned) {
+		t.Errorf("sender was not told about the pin: %v", events)
+	}
+
+	var pins struct {
+		Total int `json:"total"`
+	}
+	if status := call(t, app, http.MethodGet, "/conversations/"+conversationID+"/pins", "002", "", &pins); status != fiber.StatusOK {
+		t.Fatalf("recipient listing pins: status = %d", status)
+	}
+	if pins.Total != 0 {
+		t.Errorf("recipient sees %d pins, want 0", pins.Total)
+	}
+
+	if status := call(t, app, http.MethodGet, "/conversations/"+conversationID+"/pins", "001", "", &pins); status != fiber.StatusOK {
+		t.Fatalf("sender listing pins: status = %d", status)
+	}
+	if pins.Total != 1 {
+		t.Errorf("sender sees %d pins, want 1", pins.Total)
+	}
+}
+
+func TestPinVisibleMessage(t *testing.T) {
+	useTestStore(t)
+	app := pinApp()
+	conversationID := models.ConversationID("001", "002")
+
+	message := insertDirect(t, models.Message{SenderID: "001", ReceiverID: "002", Content: "hello"})
+	recipient := connect(t, "002")
+
+	path := "/conversations/" + conversationID + "/pins/" + message.Hex()
+	if status := call(t, app, http.MethodPost, path, "002", "", nil); status != fiber.StatusCreated {
+		t.Fatalf("pinning: status = %d, want %d", status, fiber.StatusCreated)
+	}
+	if status := call(t, app, http.MethodPost, path, "001", "", nil); status != fiber.StatusConflict {
+		t.Errorf("pinning twice: status = %d, want %d", status, fiber.StatusConflict)
+	}
+	if events := receivedEvents(recipient); !hasEvent(events, models.EventMessagePinned) {
+		t.Errorf("participant was not told about the pin: %v", events)
+	}
+}
+
+func TestPinRefusedBehindBlocksAndRequests(t *testing.T) {
+	conversationID := models.ConversationID("001", "002")
+	conversation := func() *models.Conversation {
+		return &models.Conversation{ID: conversationID, Participants: []string{"001", "002"}}
+	}
+	request := models.MessageRequest{SenderID: "001", RecipientID: "002", CreatedAt: time.Now()}
+
+	tests := []struct {
+		name   string
+		setup  func(ctx context.Context)
+		pinner string
+	}{
+		{"pinner blocked the other", func(ctx context.Context) {
+			store.Conversations().SetBlocked(ctx, conversation(), "001", true)
+		}, "001"},
+		{"other blocked the pinner", func(ctx context.Context) {
+			store.Conversations().SetBlocked(ctx, conversation(), "002", true)
+		}, "001"},
+		{"pending request", func(ctx context.Context) {
+			store.Conversations().OpenRequest(ctx, conversation(), request)
+		}, "001"},
+		{"dismissed request", func(ctx context.Context) {
+			store.Conversations().OpenRequest(ctx, conversation(), request)
+			store.Conversations().DismissRequest(ctx, conversationID, "002", time.Now())
+		}, "001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStore(t)
+			app := pinApp()
+			tt.setup(context.Background())
+
+			message := insertDirect(t, models.Message{SenderID: "001", ReceiverID: "002", Content: "hello"})
+			recipient := connect(t, "002")
+
+			path := "/conversations/" + conversationID + "/pins/" + message.Hex()
+			if status := call(t, app, http.MethodPost, path, tt.pinner, "", nil); status != fiber.StatusForbidden {
+				t.Errorf("status = %d, want %d", status, fiber.StatusForbidden)
+			}
+			if events := receivedEvents(recipient); hasEvent(events, models.EventMessagePinned) {
+				t.Errorf("recipient was told about the pin: %v", events)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/moderation"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// awayAfter is how long a connected client can stay inactive before it shows as away
+func awayAfter() time.Duration {
+	return config.GetDurationEnv("AWAY_AFTER", 5*time.Minute)
+}
+
+// presenceEvent tells other users about a status change
+func presenceEvent(userID, status string, lastActive time.Time) models.Event {
+	return models.Event{
+		Event: models.EventPresence,
+		Data: fiber.Map{
+			"user_id":     userID,
+			"status":      status,
+			"last_active": lastActive,
+		},
+	}
+}
+
+// presenceAudience lists the users who see the user's presence: partners in direct
+// conversations and members of the same rooms
+func presenceAudience(userID string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	seen := map[string]bool{userID: true}
+	var audience []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			audience = append(audience, id)
+		}
+	}
+
+	conversations, err := store.Messages().DirectConversations(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load conversations for presence of user %s: %v", userID, err)
+	}
+	for _, conversation := range conversations {
+		add(conversation.OtherUserID)
+	}
+
+	// Rooms are stored in MongoDB only
+	if config.DB == nil {
+		return audience
+	}
+	cursor, err := config.DB.Collection("rooms").Find(ctx, bson.M{"members.user_id": userID},
+		options.Find().SetProjection(bson.M{"members.user_id": 1}))
+	if err != nil {
+		log.Printf("Failed to load rooms for presence of user %s: %v", userID, err)
+		return audience
+	}
+	var rooms []models.Room
+	if err := cursor.All(ctx, &rooms); err != nil {
+		log.Printf("Failed to load rooms for presence of user %s: %v", userID, err)
+	}
+	for _, room := range rooms {
+		for _, member := range room.Members {
+			add(member.UserID)
+		}
+	}
+	return audience
+}
+
+// broadcastPresence sends a status change to the connected users of the audience.
+// Presence is not buffered for parked sessions, a resumed client gets fresh state
+// from the online users list. Callers hold the presenceMu of the user's shard and
+// no shard's mu.
+func (h *Hub) broadcastPresence(userID string, audience []string, status string, lastActive time.Time) {
+	event := presenceEvent(userID, status, lastActive)
+
+	byShard := make(map[*hubShard][]string)
+	for _, id := range audience {
+		shard := h.shardFor(id)
+		byShard[shard] = append(byShard[shard], id)
+	}
+	for shard, ids := range byShard {
+		shard.mu.Lock()
+		for _, id := range ids {
+			// removeLocked replaces the slice, ranging over the current one stays valid
+			for _, client := range shard.clients[id] {
+				select {
+				case client.Send <- event:
+				default:
+					shard.removeLocked(client, models.DisconnectReasonSlowConsumer)
+					log.Printf("Send channel full, disconnected user: %s", id)
+				}
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// lastActiveAt is when the client last sent anything
+func (c *Client) lastActiveAt() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+// markActive records client activity and brings an away client back online
+func (h *Hub) markActive(client *Client) {
+	now := time.Now()
+	client.lastActive.Store(now.UnixNano())
+
+	if !client.away.Load() {
+		return
+	}
+
+	shard := h.shardFor(client.UserID)
+	shard.presenceMu.Lock()
+	defer shard.presenceMu.Unlock()
+
+	shard.mu.RLock()
+	registered := shard.hasLocked(client)
+	status, _ := shard.statusLocked(client.UserID)
+	shard.mu.RUnlock()
+
+	// Others only hear about it if no other session of the user was active
+	if registered && client.away.CompareAndSwap(true, false) && status == models.PresenceAway {
+		h.broadcastPresence(client.UserID, client.audience, models.PresenceOnline, now)
+	}
+}
+
+// sweepIdle marks clients of the shard that have been inactive too long as away, a
+// user shows as away once all of their sessions are
+func (s *hubShard) sweepIdle() {
+	s.presenceMu.Lock()
+	defer s.presenceMu.Unlock()
+
+	type idleUser struct {
+		userID     string
+		audience   []string
+		lastActive time.Time
+	}
+
+	cutoff := time.Now().Add(-awayAfter())
+	var idle []idleUser
+	s.mu.RLock()
+	for userID, sessions := range s.clients {
+		changed := false
+		for _, client := range sessions {
+			if client.lastActiveAt().Before(cutoff) && client.away.CompareAndSwap(false, true) {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if status, lastActive := s.statusLocked(userID); status == models.PresenceAway {
+			idle = append(idle, idleUser{userID, sessions[0].audience, lastActive})
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, user := range idle {
+		s.hub.broadcastPresence(user.userID, user.audience, models.PresenceAway, user.lastActive)
+	}
+}
+
+// statusLocked combines the user's sessions: online if any is active, away if all
+// are idle, with the latest activity of any session. Callers hold s.mu.
+func (s *hubShard) statusLocked(userID string) (string, time.Time) {
+	sessions := s.clients[userID]
+	if len(sessions) == 0 {
+		return models.PresenceOffline, time.Time{}
+	}
+
+	status := models.PresenceAway
+	var lastActive time.Time
+	for _, client := range sessions {
+		if !client.away.Load() {
+			status = models.PresenceOnline
+		}
+		if at := client.lastActiveAt(); at.After(lastActive) {
+			lastActive = at
+		}
+	}
+	return status, lastActive
+}
+
+// Status reports whether the user is online, away or offline on this server, with
+// the time of their last activity when connected
+func (h *Hub) Status(userID string) (string, time.Time) {
+	shard := h.shardFor(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	return shard.statusLocked(userID)
+}
+
+// GetPresence returns the status of up to MaxPresenceLookup users in one request, for
+// clients rendering a conversation list. Unknown user IDs are left out.
+func GetPresence(c *fiber.Ctx) error {
+	var input models.PresenceRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	stored, err := store.Presence().Get(ctx, input.UserIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch presence",
+		})
+	}
+	lastSeen := make(map[string]time.Time, len(stored))
+	for _, p := range stored {
+		lastSeen[p.UserID] = p.LastSeen
+	}
+
+	// The hub knows who is connected and who is away, the store when the others left
+	presence := []fiber.Map{}
+	seen := make(map[string]bool, len(input.UserIDs))
+	for _, userID := range input.UserIDs {
+		at, ok := lastSeen[userID]
+		if !ok || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		status, lastActive := hub.Status(userID)
+		if status != models.PresenceOffline {
+			at = lastActive
+		}
+		presence = append(presence, fiber.Map{
+			"user_id":   userID,
+			"status":    status,
+			"last_seen": at,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"presence": presence,
+	})
+}
+
+// handleFocus records which conversation the client has in view
+func (c *Client) handleFocus(msgReq models.SendMessageRequest) {
+	var focus string
+	switch {
+	case msgReq.RoomID != "":
+		focus = msgReq.RoomID
+	case msgReq.ReceiverID != "":
+		focus = models.ConversationID(c.UserID, msgReq.ReceiverID)
+	}
+	c.focus.Store(&focus)
+}
+
+// attention is how closely a user follows a conversation, it decides how they are
+// told about new messages
+type attention int
+
+const (
+	attentionOffline    attention = iota // Not connected, gets push notifications
+	attentionBackground                  // Connected with no conversation in view, gets push notifications
+	attentionConnected                   // Connected elsewhere in the app, gets notification events
+	attentionFocused                     // Has the conversation in view, needs no alert
+)
+
+// attention reports how the user follows the conversation on this server, the most
+// attentive of their sessions counts
+func (h *Hub) attention(userID, conversationID string) attention {
+	shard := h.shardFor(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	most := attentionOffline
+	for _, client := range shard.clients[userID] {
+		most = max(most, client.attention(conversationID))
+	}
+	return most
+}
+
+// attention reports how this session follows the conversation
+func (c *Client) attention(conversationID string) attention {
+	focus := c.focus.Load()
+	switch {
+	case focus == nil:
+		return attentionConnected
+	case *focus == conversationID:
+		return attentionFocused
+	case *focus == "":
+		return attentionBackground
+	default:
+		return attentionConnected
+	}
+}
+
+// handleTyping relays a typing indicator to the receiver or the room members, only
+// where a message from the client would be delivered
+func (c *Client) handleTyping(msgReq models.SendMessageRequest) {
+	if !c.inScope(msgReq.RoomID, msgReq.ReceiverID) {
+		return
+	}
+	if moderation.Spam().Shadowed(c.UserID) {
+		return
+	}
+
+	event := models.Event{
+		Event: models.EventTyping,
+		Data: fiber.Map{
+			"user_id":     c.UserID,
+			"receiver_id": msgReq.ReceiverID,
+			"room_id":     msgReq.RoomID,
+		},
+	}
+
+	switch {
+	case msgReq.RoomID != "":
+		room, err := findRoomForMember(msgReq.RoomID, c.UserID)
+		if err != nil {
+			return
+		}
+
+		members := []string{}
+		for _, id := range room.MemberIDs() {
+			if id != c.UserID {
+				members = append(members, id)
+			}
+		}
+		hub.sendToUsers(members, event)
+	case msgReq.ReceiverID != "" && msgReq.ReceiverID != c.UserID && c.guestMayMessage(msgReq.ReceiverID):
+		conv, err := findConversation(models.ConversationID(c.UserID, msgReq.ReceiverID), c.UserID)
+		if err != nil {
+			return
+		}
+		// Blocks hide the sender, and message requests arrive without alerts
+		if conv.Blocked(c.UserID) || conv.Blocked(msgReq.ReceiverID) || conv.HiddenFrom(msgReq.ReceiverID) {
+			return
+		}
+		hub.SendTo(msgReq.ReceiverID, event)
+	}
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+// presenceExpiryBatch caps how many users one query refreshes or marks offline
+const presenceExpiryBatch = 500
+
+// presenceHeartbeatInterval is how often this instance refreshes the online flag
+// of the users connected to it
+func presenceHeartbeatInterval() time.Duration {
+	return config.GetDurationEnv("PRESENCE_HEARTBEAT_INTERVAL", 30*time.Second)
+}
+
+// presenceStaleAfter is how long an online flag lives without a heartbeat, it
+// outlasts a few missed heartbeats so a slow instance does not flap its users
+func presenceStaleAfter() time.Duration {
+	return config.GetDurationEnv("PRESENCE_STALE_AFTER", 3*presenceHeartbeatInterval())
+}
+
+// StartPresenceReconciler keeps the stored online flags in line with the hub. The
+// flags are written on connect and disconnect, which leaves them wrong when an
+// instance crashes with users connected, when a user connected to two instances
+// leaves one of them, or when the writes of a quick reconnect land out of order.
+// Every instance heartbeats its connected users, and users no instance has
+// refreshed for PRESENCE_STALE_AFTER are marked offline.
+func StartPresenceReconciler() {
+	go func() {
+		ticker := time.NewTicker(presenceHeartbeatInterval())
+		defer ticker.Stop()
+
+		for {
+			<-ticker.C
+			reconcilePresence()
+		}
+	}()
+}
+
+func reconcilePresence() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Refreshing first keeps this instance's own users from looking stale
+	now := time.Now()
+	connected := hub.ConnectedUsers()
+	for start := 0; start < len(connected); start += presenceExpiryBatch {
+		batch := connected[start:min(start+presenceExpiryBatch, len(connected))]
+		if err := store.Presence().Heartbeat(ctx, batch, now); err != nil {
+			log.Printf("Failed to refresh presence of %d connected users: %v", len(batch), err)
+			return
+		}
+	}
+
+	before := now.Add(-presenceStaleAfter())
+	for {
+		expired, err := store.Presence().ExpireOnline(ctx, before, presenceExpiryBatch)
+		for _, p := range expired {
+			hub.correctPresence(p)
+		}
+		if err != nil {
+			log.Printf("Failed to expire stale presence: %v", err)
+			return
+		}
+		if len(expired) > 0 {
+			log.Printf("Marked %d users with stale presence offline", len(expired))
+		}
+		if len(expired) < presenceExpiryBatch {
+			return
+		}
+	}
+}
+
+// correctPresence tells the users connected here that a stale online user is
+// offline. A user who connected here since the heartbeat is put back online.
+func (h *Hub) correctPresence(p store.UserPresence) {
+	// The user's audience is looked up before taking the presence lock
+	audience := presenceAudience(p.UserID)
+
+	shard := h.shardFor(p.UserID)
+	shard.presenceMu.Lock()
+	defer shard.presenceMu.Unlock()
+
+	if status, _ := h.Status(p.UserID); status != models.PresenceOffline {
+		go func(userID string) {
+			if err := setPresence(userID, true); err != nil {
+				log.Printf("Failed to set user %s online: %v", userID, err)
+			}
+		}(p.UserID)
+		return
+	}
+	h.broadcastPresence(p.UserID, audience, models.PresenceOffline, p.LastSeen)
+}
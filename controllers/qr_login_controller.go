@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// qrLoginTTL is how long a desktop waits for a phone to approve its QR code
+func qrLoginTTL() time.Duration {
+	return config.GetDurationEnv("QR_LOGIN_TTL", 2*time.Minute)
+}
+
+// qrLoginPollInterval is how often a waiting desktop's stream checks the shared
+// store, the phone may answer through any instance
+const qrLoginPollInterval = time.Second
+
+// hashQRLoginSecret is what gets stored in place of the desktop's secret
+func hashQRLoginSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// findQRLogin returns the challenge if the desktop's secret matches it
+func findQRLogin(ctx context.Context, code, secret string) (*models.QRLogin, bool) {
+	if secret == "" {
+		return nil, false
+	}
+	login, err := store.QRLogins().Get(ctx, code)
+	if err != nil {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashQRLoginSecret(secret)), []byte(login.SecretHash)) != 1 {
+		return nil, false
+	}
+	return login, true
+}
+
+// qrLoginPayload is what the desktop renders as a QR code
+func qrLoginPayload(code string) string {
+	return "ngobrolyuk://qr-login?code=" + code
+}
+
+// CreateQRLogin starts a login on a new device, the desktop shows the QR payload
+// and waits on the events stream for a logged-in phone to approve it
+func CreateQRLogin(c *fiber.Ctx) error {
+	code, err := config.GenerateToken(16)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create login challenge",
+		})
+	}
+	secret, err := config.GenerateToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create login challenge",
+		})
+	}
+
+	now := time.Now()
+	login := &models.QRLogin{
+		Code:       code,
+		SecretHash: hashQRLoginSecret(secret),
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+		IP:         c.IP(),
+		Status:     models.QRLoginPending,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(qrLoginTTL()),
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	if err := store.QRLogins().Create(ctx, login); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create login challenge",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"code":       code,
+		"secret":     secret,
+		"qr_payload": qrLoginPayload(code),
+		"events_url": fmt.Sprintf("/api/v1/auth/qr/%s/events?secret=%s", code, secret),
+		"expires_at": login.ExpiresAt,
+	})
+}
+
+// writeQRLoginEvent writes one server-sent event named after the status
+func writeQRLoginEvent(w *bufio.Writer, status string) error {
+	data, _ := json.Marshal(fiber.Map{"status": status})
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", status, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// QRLoginEvents streams the challenge status to the waiting desktop as server-sent
+// events: pending first, then approved, rejected or expired, after which it ends
+func QRLoginEvents(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	login, ok := findQRLogin(ctx, c.Params("code"), c.Query("secret"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Login challenge not found",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+
+	code, expiresAt := login.Code, login.ExpiresAt
+	initial := login.StatusAt(time.Now())
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := writeQRLoginEvent(w, initial); err != nil || initial != models.QRLoginPending {
+			return
+		}
+
+		expired := time.NewTimer(time.Until(expiresAt))
+		defer expired.Stop()
+		poll := time.NewTicker(qrLoginPollInterval)
+		defer poll.Stop()
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-poll.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				login, err := store.QRLogins().Get(ctx, code)
+				cancel()
+				if err != nil {
+					continue // Try again on the next tick, the expiry timer still ends the stream
+				}
+				if status := login.StatusAt(time.Now()); status != models.QRLoginPending {
+					writeQRLoginEvent(w, status)
+					return
+				}
+			case <-expired.C:
+				writeQRLoginEvent(w, models.QRLoginExpired)
+				return
+			case <-keepAlive.C:
+				// Comment lines keep proxies from closing an idle stream, and tell us the desktop left
+				if _, err := w.WriteString(": keep-alive\n\n"); err != nil || w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// decideQRLogin applies the phone's answer and tells the phone what it answered for
+func decideQRLogin(c *fiber.Ctx, status string) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	var input models.QRLoginDecisionRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Accept the raw code or the whole scanned payload
+	code := strings.TrimPrefix(strings.TrimSpace(input.Code), qrLoginPayload(""))
+	if code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	if err := store.QRLogins().Decide(ctx, code, currentUserID, status, now); err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to answer login challenge",
+			})
+		}
+		// Either there is no such challenge or it was answered or expired already
+		login, err := store.QRLogins().Get(ctx, code)
+		if err != nil || login.StatusAt(now) == models.QRLoginExpired {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Login challenge not found or expired",
+			})
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "Login challenge already answered",
+			"status": login.Status,
+		})
+	}
+
+	login, err := store.QRLogins().Get(ctx, code)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to answer login challenge",
+		})
+	}
+
+	log.Printf("QR login %s %s by user %s (device %s, %s)", code[:8], status, currentUserID, login.IP, login.UserAgent)
+
+	return c.JSON(fiber.Map{
+		"status": status,
+		"device": fiber.Map{
+			"user_agent": login.UserAgent,
+			"ip":         login.IP,
+		},
+	})
+}
+
+// ApproveQRLogin lets a logged-in phone approve the desktop that shows the QR code
+func ApproveQRLogin(c *fiber.Ctx) error {
+	return decideQRLogin(c, models.QRLoginApproved)
+}
+
+// RejectQRLogin declines a login the user does not recognise
+func RejectQRLogin(c *fiber.Ctx) error {
+	return decideQRLogin(c, models.QRLoginRejected)
+}
+
+// CompleteQRLogin exchanges an approved challenge for a session on the desktop, once
+func CompleteQRLogin(c *fiber.Ctx) error {
+	var input models.QRLoginSessionRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	login, ok := findQRLogin(ctx, c.Params("code"), input.Secret)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Login challenge not found",
+		})
+	}
+
+	// Complete only succeeds for one caller, even across instances
+	approved, err := store.QRLogins().Complete(ctx, login.Code)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "Login challenge is not approved",
+			"status": login.StatusAt(time.Now()),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to complete login",
+		})
+	}
+
+	user, err := store.Users().GetByID(ctx, approved.UserID)
+	if err != nil || user.DeletedAt != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Account no longer exists",
+		})
+	}
+
+	// Same as a password login: reactivate and touch last seen
+	active := models.UserStatusActive
+	store.Users().Update(ctx, user.ID, store.UserUpdate{Status: &active})
+	store.Presence().Touch(ctx, user.ID, time.Now())
+
+	token, err := generateJWT(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+	setJWTCookie(c, token)
+
+	return c.JSON(fiber.Map{
+		"message": "Login successful",
+		"user": fiber.Map{
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+			"bio":      user.Bio,
+			"avatar":   user.Avatar,
+		},
+	})
+}
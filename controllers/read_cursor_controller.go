@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// advanceReadCursor moves the user's read position in the conversation with other up to
+// readAt, tells both participants and expires the view-once messages read. Reports false
+// if it already was that far.
+func advanceReadCursor(ctx context.Context, userID, otherID string, messageID primitive.ObjectID, readAt time.Time) (models.ReadCursor, bool, error) {
+	cursor := models.ReadCursor{
+		UserID:    userID,
+		OtherID:   otherID,
+		MessageID: messageID,
+		ReadAt:    readAt,
+		UpdatedAt: time.Now(),
+	}
+
+	moved, err := store.Conversations().AdvanceReadCursor(ctx, cursor)
+	if err != nil || !moved {
+		return cursor, false, err
+	}
+
+	data := fiber.Map{
+		"conversation_id": models.ConversationID(userID, otherID),
+		"user_id":         userID,
+		"read_at":         readAt,
+	}
+	if !messageID.IsZero() {
+		data["message_id"] = messageID
+	}
+	// Strangers waiting on a message request do not learn what was read
+	recipients := []string{userID, otherID}
+	if hidesReads(ctx, userID, otherID) {
+		recipients = recipients[:1]
+	}
+	hub.sendToUsers(recipients, models.Event{Event: models.EventReadCursorUpdated, Data: data})
+
+	// Reading is the receipt that ends view-once messages
+	expireViewed(ctx, userID, otherID, readAt)
+
+	return cursor, true, nil
+}
+
+// applyReadState sets the read flag of direct messages between user and other from
+// the receivers' read cursors
+func applyReadState(ctx context.Context, userID, otherID string, messages []models.Message) error {
+	mine, err := store.Conversations().ReadCursor(ctx, userID, otherID)
+	if err != nil {
+		return err
+	}
+	theirs, err := store.Conversations().ReadCursor(ctx, otherID, userID)
+	if err != nil {
+		return err
+	}
+	if hidesReads(ctx, otherID, userID) {
+		theirs = models.ReadCursor{UserID: otherID, OtherID: userID}
+	}
+
+	for i := range messages {
+		if messages[i].ReceiverID == userID {
+			messages[i].Read = mine.Covers(&messages[i])
+		} else {
+			messages[i].Read = theirs.Covers(&messages[i])
+		}
+	}
+	return nil
+}
+
+// UpdateReadCursor marks the conversation read up to a message or a timestamp.
+// The position only moves forward.
+func UpdateReadCursor(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	conversation, err := findConversation(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	var input models.UpdateReadCursorRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	otherID := conversation.Participants[0]
+	if otherID == currentUserID {
+		otherID = conversation.Participants[1]
+	}
+
+	var messageID primitive.ObjectID
+	var readAt time.Time
+	if input.MessageID != "" {
+		message, err := findConversationMessage(conversation, currentUserID, input.MessageID)
+		if err != nil {
+			return err
+		}
+		messageID, readAt = message.ID, message.CreatedAt
+	} else {
+		// Positions in the future would hide messages that have not arrived yet
+		readAt = *input.ReadAt
+		if now := time.Now(); readAt.After(now) {
+			readAt = now
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cursor, moved, err := advanceReadCursor(ctx, currentUserID, otherID, messageID, readAt)
+	if err != nil {
+		log.Printf("Failed to update read cursor of user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update read position",
+		})
+	}
+	if !moved {
+		if cursor, err = store.Conversations().ReadCursor(ctx, currentUserID, otherID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update read position",
+			})
+		}
+	}
+
+	unread, err := store.Messages().UnreadCount(ctx, currentUserID)
+	if err != nil {
+		log.Printf("Failed to get unread count: %v", err)
+	}
+
+	response := fiber.Map{
+		"conversation_id": conversation.ID,
+		"read_at":         cursor.ReadAt,
+		"moved":           moved,
+		"unread_count":    unread,
+	}
+	if !cursor.MessageID.IsZero() {
+		response["message_id"] = cursor.MessageID
+	}
+	return c.JSON(response)
+}
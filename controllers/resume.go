@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+)
+
+// maxResumeEvents caps the events buffered for a parked session, together with
+// hello they must fit the new connection's send buffer
+const maxResumeEvents = 1000
+
+// parkedSession keeps a dropped session's events so a reconnect presenting its
+// resume token gets them replayed instead of resyncing everything
+type parkedSession struct {
+	expiresAt time.Time
+	events    []interface{}
+	overflow  bool // Events were dropped, the session can't be resumed
+}
+
+// resumeWindow is how long a dropped session can be resumed
+func resumeWindow() time.Duration {
+	return config.GetDurationEnv("RESUME_WINDOW", 2*time.Minute)
+}
+
+// resumable reports whether a session closed for the reason may be resumed.
+// Sessions ended on purpose (bans, kicks, logouts) are not, nor are sessions
+// on a server that is shutting down since the buffer lives in memory.
+func resumable(reason string) bool {
+	switch reason {
+	case "", models.DisconnectReasonSlowConsumer, models.DisconnectReasonReplaced, models.DisconnectReasonAccountUpgraded:
+		return true
+	}
+	return false
+}
+
+// parkLocked starts buffering for a removed client. A user keeps at most
+// maxSessionsPerUser parked sessions, the one expiring first makes room. Callers
+// hold s.mu.
+func (s *hubShard) parkLocked(client *Client) {
+	if client.resumeToken == "" {
+		return
+	}
+
+	sessions, ok := s.parked[client.UserID]
+	if !ok {
+		sessions = make(map[string]*parkedSession)
+		s.parked[client.UserID] = sessions
+	}
+	for len(sessions) >= maxSessionsPerUser() {
+		var first string
+		for token, session := range sessions {
+			if first == "" || session.expiresAt.Before(sessions[first].expiresAt) {
+				first = token
+			}
+		}
+		delete(sessions, first)
+	}
+
+	sessions[client.resumeToken] = &parkedSession{expiresAt: time.Now().Add(resumeWindow())}
+}
+
+// bufferLocked keeps a payload for each parked session of the user, callers hold s.mu
+func (s *hubShard) bufferLocked(userID string, payload interface{}) {
+	sessions, ok := s.parked[userID]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	for token, session := range sessions {
+		if now.After(session.expiresAt) {
+			delete(sessions, token)
+			continue
+		}
+		if session.overflow {
+			continue
+		}
+
+		if len(session.events) >= maxResumeEvents {
+			session.overflow = true
+			session.events = nil
+			log.Printf("Resume buffer of user %s overflowed, a full resync will be needed", userID)
+			continue
+		}
+		session.events = append(session.events, payload)
+	}
+	if len(sessions) == 0 {
+		delete(s.parked, userID)
+	}
+}
+
+// takeParkedLocked ends the parked session with the token and returns its events if
+// the session is still complete, callers hold s.mu
+func (s *hubShard) takeParkedLocked(userID, token string) ([]interface{}, bool) {
+	if token == "" {
+		return nil, false
+	}
+	session, ok := s.parked[userID][token]
+	if !ok {
+		return nil, false
+	}
+	delete(s.parked[userID], token)
+	if len(s.parked[userID]) == 0 {
+		delete(s.parked, userID)
+	}
+
+	if session.overflow || time.Now().After(session.expiresAt) {
+		return nil, false
+	}
+	return session.events, true
+}
+
+// sweepParkedLocked forgets expired sessions, callers hold s.mu
+func (s *hubShard) sweepParkedLocked() {
+	now := time.Now()
+	for userID, sessions := range s.parked {
+		for token, session := range sessions {
+			if now.After(session.expiresAt) {
+				delete(sessions, token)
+			}
+		}
+		if len(sessions) == 0 {
+			delete(s.parked, userID)
+		}
+	}
+}
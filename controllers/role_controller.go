@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adminRole describes the built-in admin role, which is not stored
+func adminRole() models.Role {
+	permissions := make([]string, 0, len(models.Permissions))
+	for _, p := range models.Permissions {
+		permissions = append(permissions, p.Name)
+	}
+
+	return models.Role{
+		Name:        models.UserRoleAdmin,
+		Description: "Built-in, holds every permission",
+		Permissions: permissions,
+	}
+}
+
+// GetPermissions lists the permission registry
+func GetPermissions(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"permissions": models.Permissions,
+	})
+}
+
+func GetRoles(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("roles").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		log.Printf("Failed to fetch roles: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch roles",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	roles := []models.Role{adminRole()}
+	for cursor.Next(ctx) {
+		var role models.Role
+		if err := cursor.Decode(&role); err != nil {
+			continue
+		}
+		roles = append(roles, role)
+	}
+
+	return c.JSON(fiber.Map{
+		"roles": roles,
+		"total": len(roles),
+	})
+}
+
+// lackedPermissions returns the permissions the actor's role does not grant
+func lackedPermissions(actorRole string, permissions []string) []string {
+	var lacked []string
+	for _, p := range permissions {
+		if !middleware.RoleCan(actorRole, p) {
+			lacked = append(lacked, p)
+		}
+	}
+	return lacked
+}
+
+// storedRolePermissions returns the permissions a stored role grants, none when
+// the role does not exist yet
+func storedRolePermissions(ctx context.Context, name string) ([]string, error) {
+	var role models.Role
+	err := config.DB.Collection("roles").FindOne(ctx, bson.M{"_id": name}).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return role.Permissions, err
+}
+
+// UpdateRole creates the role or replaces its permissions. Only admins may edit
+// their own role or roles holding permissions they lack, or grant such permissions.
+func UpdateRole(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+	name := c.Params("name")
+
+	if name == models.UserRoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The admin role is built in and cannot be changed",
+		})
+	}
+	if !models.IsValidRoleName(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role name must be 2-32 lowercase letters, digits, '_' or '-'",
+		})
+	}
+
+	var input models.UpdateRoleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	actor, err := store.Users().GetByID(c.UserContext(), adminID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Permission denied",
+		})
+	}
+	if actor.Role != models.UserRoleAdmin {
+		if name == actor.Role {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You cannot change your own role",
+			})
+		}
+
+		current, err := storedRolePermissions(c.UserContext(), name)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save role",
+			})
+		}
+		if lacked := lackedPermissions(actor.Role, append(current, input.Permissions...)); len(lacked) > 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":       "You can only manage permissions you hold",
+				"permissions": dedupe(lacked),
+			})
+		}
+	}
+
+	role := models.Role{
+		Name:        name,
+		Description: config.SanitizeString(input.Description),
+		Permissions: dedupe(input.Permissions),
+		UpdatedBy:   adminID,
+		UpdatedAt:   time.Now(),
+	}
+
+	_, err = config.DB.Collection("roles").ReplaceOne(c.UserContext(),
+		bson.M{"_id": name}, role, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("Failed to save role %s: %v", name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save role",
+		})
+	}
+
+	middleware.RefreshRoles()
+	log.Printf("Role %s updated by %s: %v", name, adminID, role.Permissions)
+
+	return c.JSON(role)
+}
+
+// DeleteRole removes a role that no user holds anymore
+func DeleteRole(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	if name == models.UserRoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The admin role is built in and cannot be deleted",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	holders, err := config.DB.Collection("users").CountDocuments(ctx, bson.M{"role": name})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete role",
+		})
+	}
+	if holders > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Role is still assigned to users, reassign them first",
+			"users": holders,
+		})
+	}
+
+	result, err := config.DB.Collection("roles").DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete role",
+		})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Role not found",
+		})
+	}
+
+	middleware.RefreshRoles()
+
+	return c.JSON(fiber.Map{
+		"message": "Role deleted",
+	})
+}
+
+// AssignUserRole sets or clears a user's role. Granting or revoking admin, or a
+// role holding permissions the actor lacks, requires being an admin, so
+// roles.manage cannot be used to escalate.
+func AssignUserRole(c *fiber.Ctx) error {
+	actorID := c.Locals("user_id").(string)
+	targetID := c.Params("id")
+
+	var input models.AssignRoleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if targetID == actorID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot change your own role",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	actor, err := store.Users().GetByID(ctx, actorID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Permission denied",
+		})
+	}
+
+	target, err := store.Users().GetByID(ctx, targetID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	touchesAdmin := input.Role == models.UserRoleAdmin || target.Role == models.UserRoleAdmin
+	if touchesAdmin && actor.Role != models.UserRoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only admins can grant or revoke the admin role",
+		})
+	}
+
+	if input.Role != "" && input.Role != models.UserRoleAdmin {
+		count, err := config.DB.Collection("roles").CountDocuments(ctx, bson.M{"_id": input.Role})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to assign role",
+			})
+		}
+		if count == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown role",
+			})
+		}
+	}
+
+	// Neither the role given nor the one taken away may hold more than the actor
+	if actor.Role != models.UserRoleAdmin {
+		var involved []string
+		for _, name := range []string{input.Role, target.Role} {
+			if name == "" {
+				continue
+			}
+			permissions, err := storedRolePermissions(ctx, name)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to assign role",
+				})
+			}
+			involved = append(involved, permissions...)
+		}
+		if lacked := lackedPermissions(actor.Role, involved); len(lacked) > 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":       "You can only manage permissions you hold",
+				"permissions": dedupe(lacked),
+			})
+		}
+	}
+
+	update := bson.M{"$set": bson.M{"role": input.Role}}
+	if input.Role == "" {
+		update = bson.M{"$unset": bson.M{"role": ""}}
+	}
+	if _, err := config.DB.Collection("users").UpdateOne(ctx, bson.M{"_id": targetID}, update); err != nil {
+		log.Printf("Failed to assign role to user %s: %v", targetID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to assign role",
+		})
+	}
+
+	log.Printf("User %s role changed from %q to %q by %s", targetID, target.Role, input.Role, actorID)
+
+	return c.JSON(fiber.Map{
+		"message": "Role updated",
+		"user_id": targetID,
+		"role":    input.Role,
+	})
+}
+
+// dedupe drops repeated values, keeping the first occurrence
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
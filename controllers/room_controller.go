@@ -0,0 +1,787 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adisonsmn/ngobrolyuk/coldstore"
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store/mongostore"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// findRoomForMember loads a room only if the user is one of its members
+func findRoomForMember(roomID, userID string) (*models.Room, error) {
+	// Rooms are stored in MongoDB only
+	if config.DB == nil {
+		return nil, fiber.NewError(fiber.StatusNotImplemented, "Rooms are not available with the configured storage backend")
+	}
+
+	objID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid room ID")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var room models.Room
+	err = config.DB.Collection("rooms").FindOne(ctx, bson.M{
+		"_id":             objID,
+		"members.user_id": userID,
+	}).Decode(&room)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Room not found")
+	}
+
+	return &room, nil
+}
+
+// findRoom loads a room regardless of membership, for server side work
+func findRoom(roomID string) (*models.Room, error) {
+	objID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var room models.Room
+	if err := config.DB.Collection("rooms").FindOne(ctx, bson.M{"_id": objID}).Decode(&room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// notifyRoom pushes an event to every connected member of the room
+func notifyRoom(room *models.Room, event string, data fiber.Map) {
+	hub.sendToUsers(room.MemberIDs(), models.Event{Event: event, Data: data})
+}
+
+func CreateRoom(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	var input models.CreateRoomRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	now := time.Now()
+	members := []models.RoomMember{{UserID: currentUserID, Role: models.RoomRoleOwner, JoinedAt: now}}
+
+	// Deduplicate invited members
+	seen := map[string]bool{currentUserID: true}
+	var memberIDs []string
+	for _, id := range input.MemberIDs {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		memberIDs = append(memberIDs, id)
+	}
+
+	if len(memberIDs) > 0 {
+		count, err := config.DB.Collection("users").CountDocuments(context.Background(), bson.M{
+			"_id":        bson.M{"$in": memberIDs},
+			"deleted_at": bson.M{"$exists": false},
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Database error",
+			})
+		}
+		if count != int64(len(memberIDs)) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "One or more members not found",
+			})
+		}
+	}
+
+	for _, id := range memberIDs {
+		members = append(members, models.RoomMember{UserID: id, Role: models.RoomRoleMember, JoinedAt: now})
+	}
+
+	room := models.Room{
+		ID:        primitive.NewObjectID(),
+		Name:      input.Name,
+		Topic:     input.Topic,
+		OwnerID:   currentUserID,
+		Members:   members,
+		CreatedAt: now,
+		UpdatedAt: now,
+
+		Discoverable: input.Discoverable,
+	}
+
+	if _, err := config.DB.Collection("rooms").InsertOne(c.UserContext(), room); err != nil {
+		log.Printf("Failed to create room: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create room",
+		})
+	}
+
+	notifyRoom(&room, models.EventRoomUpdated, fiber.Map{"room": room})
+	postSystemMessage(&room, models.SystemEvent{Action: models.SystemRoomCreated, ActorID: currentUserID, Name: room.Name})
+
+	return c.Status(fiber.StatusCreated).JSON(room)
+}
+
+func GetRooms(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"members.user_id": currentUserID}
+
+	// Only rooms carrying one of the caller's labels
+	if labelID := c.Query("label"); labelID != "" {
+		labels, err := labelsOf(ctx, currentUserID)
+		if err != nil {
+			log.Printf("Failed to load labels of user %s: %v", currentUserID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch rooms",
+			})
+		}
+		if _, ok := labels.Find(labelID); !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Label not found",
+			})
+		}
+
+		ids := []primitive.ObjectID{}
+		for conversationID := range labels.Assignments {
+			if id, err := primitive.ObjectIDFromHex(conversationID); err == nil && labels.Has(conversationID, labelID) {
+				ids = append(ids, id)
+			}
+		}
+		filter["_id"] = bson.M{"$in": ids}
+	}
+
+	opts := options.Find().SetSort(bson.M{"updated_at": -1})
+	cursor, err := config.DB.Collection("rooms").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Failed to fetch rooms: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch rooms",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	rooms := []models.Room{}
+	if err := cursor.All(ctx, &rooms); err != nil {
+		log.Printf("Failed to decode rooms: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode rooms",
+		})
+	}
+
+	for i := range rooms {
+		rooms[i].SlowModeUntil = slowMode.until(&rooms[i], currentUserID)
+	}
+
+	return c.JSON(fiber.Map{
+		"rooms": rooms,
+		"total": len(rooms),
+	})
+}
+
+func GetRoom(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	room.SlowModeUntil = slowMode.until(room, currentUserID)
+	return c.JSON(room)
+}
+
+func UpdateRoom(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	if !room.Can(currentUserID, models.RoomPermRenameRoom) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to edit this room")
+	}
+
+	var input models.UpdateRoomRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Build update document
+	updateDoc := bson.M{}
+
+	if input.Name != "" {
+		input.Name = config.SanitizeString(input.Name)
+		if input.Name == "" || utf8.RuneCountInString(input.Name) > 100 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Room name must be 1-100 characters",
+			})
+		}
+		updateDoc["name"] = input.Name
+	}
+
+	if input.Topic != nil {
+		topic := config.SanitizeString(*input.Topic)
+		if utf8.RuneCountInString(topic) > 300 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Topic too long (max 300 characters)",
+			})
+		}
+		updateDoc["topic"] = topic
+	}
+
+	if input.Discoverable != nil {
+		updateDoc["discoverable"] = *input.Discoverable
+	}
+
+	if input.MessageTTL != nil {
+		ttl := *input.MessageTTL
+		if ttl != 0 && (ttl < models.MinMessageExpiry || ttl > models.MaxMessageExpiry) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "message_ttl must be 0 or between 5 seconds and 7 days",
+			})
+		}
+		updateDoc["message_ttl"] = ttl
+	}
+
+	if input.SlowMode != nil {
+		if *input.SlowMode < 0 || *input.SlowMode > models.MaxSlowMode {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "slow_mode must be between 0 and 6 hours",
+			})
+		}
+		updateDoc["slow_mode"] = *input.SlowMode
+	}
+
+	if len(updateDoc) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No fields to update",
+		})
+	}
+
+	updateDoc["updated_at"] = time.Now()
+
+	_, err = config.DB.Collection("rooms").UpdateOne(c.UserContext(),
+		bson.M{"_id": room.ID},
+		bson.M{"$set": updateDoc},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update room",
+		})
+	}
+
+	notifyRoom(room, models.EventRoomUpdated, fiber.Map{
+		"room_id":    room.ID,
+		"changes":    updateDoc,
+		"updated_by": currentUserID,
+	})
+
+	// Record what changed in the room's history
+	if name, ok := updateDoc["name"].(string); ok && name != room.Name {
+		postSystemMessage(room, models.SystemEvent{Action: models.SystemRoomRenamed, ActorID: currentUserID, Name: name})
+	}
+	if topic, ok := updateDoc["topic"].(string); ok && topic != room.Topic {
+		postSystemMessage(room, models.SystemEvent{Action: models.SystemTopicChanged, ActorID: currentUserID, Name: topic})
+	}
+	if ttl, ok := updateDoc["message_ttl"].(int); ok && ttl != room.MessageTTL {
+		if ttl > 0 {
+			postSystemMessage(room, models.SystemEvent{Action: models.SystemDisappearingEnabled, ActorID: currentUserID, TTL: ttl})
+		} else {
+			postSystemMessage(room, models.SystemEvent{Action: models.SystemDisappearingDisabled, ActorID: currentUserID})
+		}
+	}
+	if interval, ok := updateDoc["slow_mode"].(int); ok && interval != room.SlowMode {
+		if interval > 0 {
+			postSystemMessage(room, models.SystemEvent{Action: models.SystemSlowModeEnabled, ActorID: currentUserID, TTL: interval})
+		} else {
+			postSystemMessage(room, models.SystemEvent{Action: models.SystemSlowModeDisabled, ActorID: currentUserID})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Room updated successfully",
+	})
+}
+
+func AddRoomMember(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	if !room.Can(currentUserID, models.RoomPermAddMembers) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to add members")
+	}
+
+	var input models.AddRoomMemberRequest
+	if err := c.BodyParser(&input); err != nil || input.UserID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "user_id is required",
+		})
+	}
+
+	if room.Member(input.UserID) != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User is already a member",
+		})
+	}
+
+	count, _ := config.DB.Collection("users").CountDocuments(c.UserContext(), bson.M{
+		"_id":        input.UserID,
+		"deleted_at": bson.M{"$exists": false},
+	})
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := addRoomMember(room, input.UserID, models.RoomRoleMember); err == errAlreadyMember {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User is already a member",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add member",
+		})
+	}
+
+	notifyRoom(room, models.EventMemberAdded, fiber.Map{
+		"room_id":  room.ID,
+		"user_id":  input.UserID,
+		"role":     models.RoomRoleMember,
+		"added_by": currentUserID,
+	})
+	postSystemMessage(room, models.SystemEvent{Action: models.SystemMemberAdded, ActorID: currentUserID, TargetID: input.UserID})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Member added successfully",
+	})
+}
+
+// errAlreadyMember is returned by addRoomMember when the user joined meanwhile
+var errAlreadyMember = errors.New("already a member")
+
+// addRoomMember appends a member to the room and to the in-memory copy used for notifications
+func addRoomMember(room *models.Room, userID, role string) error {
+	member := models.RoomMember{UserID: userID, Role: role, JoinedAt: time.Now()}
+
+	result, err := config.DB.Collection("rooms").UpdateOne(context.Background(),
+		bson.M{"_id": room.ID, "members.user_id": bson.M{"$ne": userID}},
+		bson.M{
+			"$push": bson.M{"members": member},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errAlreadyMember
+	}
+
+	room.Members = append(room.Members, member)
+	return nil
+}
+
+func RemoveRoomMember(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	targetUserID := c.Params("user_id")
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	target := room.Member(targetUserID)
+	if target == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User is not a member of this room",
+		})
+	}
+
+	if target.Role == models.RoomRoleOwner {
+		return fiber.NewError(fiber.StatusForbidden, "The room owner cannot be removed")
+	}
+
+	// Members can always leave, removing others requires permission and a higher role
+	if targetUserID != currentUserID {
+		actor := room.Member(currentUserID)
+		if !models.RoomRoleCan(actor.Role, models.RoomPermRemoveMembers) ||
+			!models.RoomRoleOutranks(actor.Role, target.Role) {
+			return fiber.NewError(fiber.StatusForbidden, "You are not allowed to remove this member")
+		}
+	}
+
+	_, err = config.DB.Collection("rooms").UpdateOne(c.UserContext(),
+		bson.M{"_id": room.ID},
+		bson.M{
+			"$pull": bson.M{"members": bson.M{"user_id": targetUserID}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to remove member",
+		})
+	}
+
+	// Notify the previous member list so the removed user is informed too
+	notifyRoom(room, models.EventMemberRemoved, fiber.Map{
+		"room_id":    room.ID,
+		"user_id":    targetUserID,
+		"removed_by": currentUserID,
+	})
+	if targetUserID == currentUserID {
+		postSystemMessage(room, models.SystemEvent{Action: models.SystemMemberLeft, ActorID: currentUserID})
+	} else {
+		postSystemMessage(room, models.SystemEvent{Action: models.SystemMemberRemoved, ActorID: currentUserID, TargetID: targetUserID})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Member removed successfully",
+	})
+}
+
+func UpdateRoomMemberRole(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	targetUserID := c.Params("user_id")
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	if !room.Can(currentUserID, models.RoomPermManageRoles) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to manage roles")
+	}
+
+	var input models.UpdateRoomRoleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if input.Role != models.RoomRoleAdmin && input.Role != models.RoomRoleMember {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be admin or member",
+		})
+	}
+
+	target := room.Member(targetUserID)
+	if target == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User is not a member of this room",
+		})
+	}
+
+	if target.Role == models.RoomRoleOwner {
+		return fiber.NewError(fiber.StatusForbidden, "The owner's role cannot be changed")
+	}
+
+	_, err = config.DB.Collection("rooms").UpdateOne(c.UserContext(),
+		bson.M{"_id": room.ID, "members.user_id": targetUserID},
+		bson.M{"$set": bson.M{"members.$.role": input.Role, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update role",
+		})
+	}
+
+	notifyRoom(room, models.EventMemberRoleChanged, fiber.Map{
+		"room_id":    room.ID,
+		"user_id":    targetUserID,
+		"role":       input.Role,
+		"changed_by": currentUserID,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Role updated successfully",
+	})
+}
+
+func GetRoomMessages(c *fiber.Ctx) error {
+	room, err := findRoomForMember(c.Params("id"), c.Locals("user_id").(string))
+	if err != nil {
+		return err
+	}
+
+	return roomMessages(c, room)
+}
+
+// roomMessages answers a page of the room's history visible to the current user
+func roomMessages(c *fiber.Ctx, room *models.Room) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	p, err := parsePage(c, 50, 100)
+	if err != nil {
+		return err
+	}
+
+	opts := options.Find().
+		SetSort(newestFirst).
+		SetSkip(p.skip()).
+		SetLimit(int64(p.Limit) + 1)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	and := []bson.M{mongostore.VisibleTo(currentUserID)}
+	if before := p.before(); before != nil {
+		and = append(and, olderThan(before))
+	}
+	cursor, err := config.DB.Collection("messages").Find(ctx, bson.M{
+		"room_id": room.ID.Hex(),
+		"$and":    and,
+	}, opts)
+	if err != nil {
+		log.Printf("Failed to fetch room messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch messages",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		log.Printf("Failed to decode room messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode messages",
+		})
+	}
+	messages, pagination := p.messageEnvelope(messages)
+	hydrateArchived(ctx, messages)
+	localizeSystemMessages(ctx, middleware.Language(c), messages)
+
+	// Reverse to get chronological order
+	for i := len(messages)/2 - 1; i >= 0; i-- {
+		opp := len(messages) - 1 - i
+		messages[i], messages[opp] = messages[opp], messages[i]
+	}
+
+	return c.JSON(fiber.Map{
+		"messages":   messages,
+		"pagination": pagination,
+	})
+}
+
+func DeleteRoomMessage(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	message, err := findRoomMessage(room, c.Params("message_id"))
+	if err != nil {
+		return err
+	}
+
+	// Own messages can always be deleted, others' require permission
+	if message.SenderID != currentUserID && !room.Can(currentUserID, models.RoomPermDeleteMessages) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to delete this message")
+	}
+
+	_, err = config.DB.Collection("messages").UpdateOne(c.UserContext(),
+		bson.M{"_id": message.ID},
+		bson.M{"$set": bson.M{"content": "", "type": models.MessageTypeDeleted}, "$unset": bson.M{"entities": "", "sealed_content": "", "sealed_entities": ""}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete message",
+		})
+	}
+	if err := coldstore.Scrub(c.UserContext(), bson.M{"_id": message.ID}); err != nil {
+		log.Printf("Failed to scrub archived message %s: %v", message.ID.Hex(), err)
+	}
+
+	notifyRoom(room, models.EventMessageDeleted, fiber.Map{
+		"room_id":    room.ID,
+		"message_id": message.ID,
+		"deleted_by": currentUserID,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Message deleted successfully",
+	})
+}
+
+// findRoomMessage loads a message that belongs to the room
+func findRoomMessage(room *models.Room, messageID string) (*models.Message, error) {
+	objID, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid message ID")
+	}
+
+	var message models.Message
+	err = config.DB.Collection("messages").FindOne(context.Background(),
+		bson.M{"_id": objID, "room_id": room.ID.Hex()}).Decode(&message)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Message not found")
+	}
+
+	return &message, nil
+}
+
+func MarkRoomRead(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	var input models.MarkRoomReadRequest
+	if err := c.BodyParser(&input); err != nil || input.MessageID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "message_id is required",
+		})
+	}
+
+	message, err := findRoomMessage(room, input.MessageID)
+	if err != nil {
+		return err
+	}
+
+	member := room.Member(currentUserID)
+	previous := member.LastReadAt
+
+	// Watermark only moves forward
+	if !message.CreatedAt.After(previous) {
+		return c.JSON(fiber.Map{
+			"message":      "Already read",
+			"last_read_at": previous,
+		})
+	}
+
+	_, err = config.DB.Collection("rooms").UpdateOne(c.UserContext(),
+		bson.M{"_id": room.ID, "members.user_id": currentUserID},
+		bson.M{"$max": bson.M{"members.$.last_read_at": message.CreatedAt}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update read position",
+		})
+	}
+
+	member.LastReadAt = message.CreatedAt
+
+	go notifyReadCounts(room, currentUserID, previous, message.CreatedAt)
+
+	return c.JSON(fiber.Map{
+		"message":      "Room marked as read",
+		"last_read_at": message.CreatedAt,
+	})
+}
+
+// notifyReadCounts pushes updated read counts to senders of messages in the newly read range,
+// one event per sender for their latest message in that range
+func notifyReadCounts(room *models.Room, readerID string, from, to time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := []bson.M{
+		{
+			"$match": bson.M{
+				"room_id":    room.ID.Hex(),
+				"sender_id":  bson.M{"$ne": readerID},
+				"type":       bson.M{"$ne": models.MessageTypeSystem},
+				"created_at": bson.M{"$gt": from, "$lte": to},
+			},
+		},
+		{
+			"$sort": bson.M{"created_at": 1},
+		},
+		{
+			"$group": bson.M{
+				"_id":          "$sender_id",
+				"last_message": bson.M{"$last": "$$ROOT"},
+			},
+		},
+	}
+
+	cursor, err := config.DB.Collection("messages").Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Failed to aggregate read counts for room %s: %v", room.ID.Hex(), err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var result struct {
+			SenderID    string         `bson:"_id"`
+			LastMessage models.Message `bson:"last_message"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			log.Printf("Failed to decode read count: %v", err)
+			continue
+		}
+
+		hub.sendToUsers([]string{result.SenderID}, models.Event{
+			Event: models.EventReadCountUpdated,
+			Data: fiber.Map{
+				"room_id":      room.ID,
+				"message_id":   result.LastMessage.ID,
+				"read_count":   len(room.ReadBy(&result.LastMessage)),
+				"member_count": len(room.Members) - 1,
+			},
+		})
+	}
+}
+
+func GetRoomMessageReadBy(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	message, err := findRoomMessage(room, c.Params("message_id"))
+	if err != nil {
+		return err
+	}
+
+	readBy := room.ReadBy(message)
+
+	return c.JSON(fiber.Map{
+		"message_id":   message.ID,
+		"read_by":      readBy,
+		"read_count":   len(readBy),
+		"member_count": len(room.Members) - 1,
+	})
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// activeInviteFilter matches invites that can still be used to join
+func activeInviteFilter() bson.M {
+	return bson.M{
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+		"$or": []bson.M{
+			{"max_uses": 0},
+			{"$expr": bson.M{"$lt": []interface{}{"$uses", "$max_uses"}}},
+		},
+	}
+}
+
+func CreateRoomInvite(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	if !room.Can(currentUserID, models.RoomPermAddMembers) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to create invites")
+	}
+
+	var input models.CreateRoomInviteRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	token, err := config.GenerateToken(16)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate invite token",
+		})
+	}
+
+	now := time.Now()
+	invite := models.RoomInvite{
+		ID:        primitive.NewObjectID(),
+		Token:     token,
+		RoomID:    room.ID,
+		CreatedBy: currentUserID,
+		MaxUses:   input.MaxUses,
+		ExpiresAt: now.Add(time.Duration(input.ExpiresIn) * time.Second),
+		CreatedAt: now,
+	}
+
+	if _, err := config.DB.Collection("room_invites").InsertOne(c.UserContext(), invite); err != nil {
+		log.Printf("Failed to create room invite: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invite",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(invite)
+}
+
+func GetRoomInvites(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	if !room.Can(currentUserID, models.RoomPermAddMembers) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to view invites")
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	filter := activeInviteFilter()
+	filter["room_id"] = room.ID
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := config.DB.Collection("room_invites").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Failed to fetch room invites: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch invites",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	invites := []models.RoomInvite{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		log.Printf("Failed to decode room invites: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode invites",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"invites": invites,
+		"total":   len(invites),
+	})
+}
+
+func RevokeRoomInvite(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	room, err := findRoomForMember(c.Params("id"), currentUserID)
+	if err != nil {
+		return err
+	}
+
+	if !room.Can(currentUserID, models.RoomPermAddMembers) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to revoke invites")
+	}
+
+	inviteID, err := primitive.ObjectIDFromHex(c.Params("invite_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invite ID",
+		})
+	}
+
+	result, err := config.DB.Collection("room_invites").UpdateOne(c.UserContext(),
+		bson.M{"_id": inviteID, "room_id": room.ID},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke invite",
+		})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invite not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invite revoked",
+	})
+}
+
+func JoinRoomByInvite(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+	token := c.Params("token")
+
+	var invite models.RoomInvite
+	err := config.DB.Collection("room_invites").FindOne(c.UserContext(),
+		bson.M{"token": token}).Decode(&invite)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invite not found",
+		})
+	}
+
+	var room models.Room
+	err = config.DB.Collection("rooms").FindOne(c.UserContext(),
+		bson.M{"_id": invite.RoomID}).Decode(&room)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	// Joining a room you are already in does not consume a use
+	if room.Member(currentUserID) != nil {
+		return c.JSON(room)
+	}
+
+	// Consume one use atomically so concurrent joins respect max_uses
+	filter := activeInviteFilter()
+	filter["_id"] = invite.ID
+	err = config.DB.Collection("room_invites").FindOneAndUpdate(c.UserContext(),
+		filter,
+		bson.M{"$inc": bson.M{"uses": 1}},
+	).Err()
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "Invite expired, revoked, or fully used",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	// Give the use back when the join does not happen
+	if err := addRoomMember(&room, currentUserID, models.RoomRoleMember); err != nil {
+		releaseInviteUse(invite.ID)
+		if err == errAlreadyMember {
+			// Joined by another request meanwhile
+			if err := config.DB.Collection("rooms").FindOne(c.UserContext(),
+				bson.M{"_id": invite.RoomID}).Decode(&room); err == nil {
+				return c.JSON(room)
+			}
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to join room",
+		})
+	}
+
+	notifyRoom(&room, models.EventMemberAdded, fiber.Map{
+		"room_id":  room.ID,
+		"user_id":  currentUserID,
+		"role":     models.RoomRoleMember,
+		"added_by": invite.CreatedBy,
+		"invite":   true,
+	})
+	postSystemMessage(&room, models.SystemEvent{Action: models.SystemMemberJoined, ActorID: currentUserID})
+
+	return c.JSON(room)
+}
+
+// releaseInviteUse returns a use taken by a join that failed
+func releaseInviteUse(inviteID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := config.DB.Collection("room_invites").UpdateOne(ctx,
+		bson.M{"_id": inviteID, "uses": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"uses": -1}},
+	)
+	if err != nil {
+		log.Printf("Failed to release use of room invite %s: %v", inviteID.Hex(), err)
+	}
+}
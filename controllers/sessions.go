@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// What happens to a connection that would exceed the per-user session limit
+const (
+	SessionLimitEvictOldest = "evict_oldest" // The user's oldest session gets goodbye "replaced"
+	SessionLimitReject      = "reject"       // The new session gets goodbye "session_limit"
+)
+
+// maxSessionsPerUser is how many WebSocket sessions one user may keep open on this
+// server, across devices and tabs
+func maxSessionsPerUser() int {
+	return max(config.GetIntEnv("WS_MAX_SESSIONS_PER_USER", 5), 1)
+}
+
+// sessionLimitPolicy is SessionLimitEvictOldest unless WS_SESSION_LIMIT_POLICY says reject
+func sessionLimitPolicy() string {
+	if config.GetEnvWithDefault("WS_SESSION_LIMIT_POLICY", SessionLimitEvictOldest) == SessionLimitReject {
+		return SessionLimitReject
+	}
+	return SessionLimitEvictOldest
+}
+
+// admitSession refuses a new connection of a user at the session limit when the
+// policy is to reject, reports whether the connection may go on. Concurrent
+// connects may still overshoot, the hub then evicts the oldest session.
+func admitSession(c *websocket.Conn, userID string) bool {
+	if sessionLimitPolicy() != SessionLimitReject || hub.Sessions(userID) < maxSessionsPerUser() {
+		return true
+	}
+
+	log.Printf("WebSocket connection rejected: user %s is at the session limit", userID)
+	c.WriteJSON(goodbyeEvent(models.DisconnectReasonSessionLimit))
+	c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+		closeCode(models.DisconnectReasonSessionLimit), models.DisconnectReasonSessionLimit))
+	c.Close()
+	return false
+}
+
+// ipOf returns the client address recorded before the WebSocket upgrade
+func ipOf(c *websocket.Conn) string {
+	ip, _ := c.Locals("ip").(string)
+	return ip
+}
+
+// sessionView describes an open session for admins
+func sessionView(client *Client) fiber.Map {
+	status := models.PresenceOnline
+	if client.away.Load() {
+		status = models.PresenceAway
+	}
+	return fiber.Map{
+		"connected_at": client.connectedAt,
+		"last_active":  client.lastActiveAt(),
+		"status":       status,
+		"ip":           client.ip,
+		"guest":        client.guestExpiresAt != nil,
+	}
+}
+
+// UserSessions lists the open sessions of one user on this server
+func (h *Hub) UserSessions(userID string) []fiber.Map {
+	shard := h.shardFor(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	sessions := make([]fiber.Map, 0, len(shard.clients[userID]))
+	for _, client := range shard.clients[userID] {
+		sessions = append(sessions, sessionView(client))
+	}
+	return sessions
+}
+
+// SessionCounts returns how many sessions each connected user has open
+func (h *Hub) SessionCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, shard := range h.shards {
+		shard.mu.RLock()
+		for userID, sessions := range shard.clients {
+			counts[userID] = len(sessions)
+		}
+		shard.mu.RUnlock()
+	}
+	return counts
+}
+
+// GetSessionCounts returns the open sessions per user on this server, most first,
+// with the limit they are held to
+func GetSessionCounts(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	counts := hub.SessionCounts()
+	users := make([]fiber.Map, 0, len(counts))
+	for userID, count := range counts {
+		users = append(users, fiber.Map{"user_id": userID, "sessions": count})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i]["sessions"].(int), users[j]["sessions"].(int)
+		if a != b {
+			return a > b
+		}
+		return users[i]["user_id"].(string) < users[j]["user_id"].(string)
+	})
+
+	return c.JSON(fiber.Map{
+		"total_connections":     hub.Connections(),
+		"connected_users":       len(counts),
+		"max_sessions_per_user": maxSessionsPerUser(),
+		"limit_policy":          sessionLimitPolicy(),
+		"users":                 users[:min(limit, len(users))],
+		"timestamp":             time.Now(),
+	})
+}
+
+// GetUserSessions lists a user's open sessions on this server
+func GetUserSessions(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	return c.JSON(fiber.Map{
+		"user_id":               userID,
+		"sessions":              hub.UserSessions(userID),
+		"max_sessions_per_user": maxSessionsPerUser(),
+	})
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+)
+
+// slowModeGate remembers when each member of a slow mode room may send again. It
+// is kept in memory, so a member whose sockets are spread over several instances
+// is limited per instance.
+type slowModeGate struct {
+	mu   sync.Mutex
+	next map[slowModeKey]time.Time
+}
+
+type slowModeKey struct {
+	roomID string
+	userID string
+}
+
+var slowMode = &slowModeGate{next: map[slowModeKey]time.Time{}}
+
+// take counts a message to the room, reporting false with the wait when the member
+// sent one less than the room's slow mode interval ago
+func (g *slowModeGate) take(room *models.Room, userID string) (bool, time.Duration) {
+	interval := room.SlowModeFor(userID)
+	if interval == 0 {
+		return true, 0
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop passed waits so the map only holds members still waiting
+	for key, next := range g.next {
+		if !now.Before(next) {
+			delete(g.next, key)
+		}
+	}
+
+	key := slowModeKey{room.ID.Hex(), userID}
+	if next, ok := g.next[key]; ok {
+		return false, next.Sub(now)
+	}
+	g.next[key] = now.Add(interval)
+	return true, 0
+}
+
+// release gives back the message counted by take, for messages that were not sent
+func (g *slowModeGate) release(room *models.Room, userID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.next, slowModeKey{room.ID.Hex(), userID})
+}
+
+// until is when the member may send to the room again, nil when they may now
+func (g *slowModeGate) until(room *models.Room, userID string) *time.Time {
+	if room.SlowModeFor(userID) == 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	next, ok := g.next[slowModeKey{room.ID.Hex(), userID}]
+	if !ok || !time.Now().Before(next) {
+		return nil
+	}
+	return &next
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/moderation"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// isStranger reports whether the recipient has never written to the sender
+func isStranger(senderID, recipientID string) bool {
+	detector := moderation.Spam()
+	if detector.IsKnownContact(senderID, recipientID) {
+		return false
+	}
+
+	// Message history for the stranger check is only queried on MongoDB
+	if config.DB == nil {
+		return false
+	}
+
+	count, err := config.DB.Collection("messages").CountDocuments(context.Background(),
+		bson.M{"sender_id": recipientID, "receiver_id": senderID},
+		options.Count().SetLimit(1))
+	if err != nil {
+		return false
+	}
+	if count == 0 {
+		return true
+	}
+
+	detector.RememberContact(senderID, recipientID)
+	return false
+}
+
+// checkSpam scores a message in the send path and persists new restrictions
+func checkSpam(message *models.Message) moderation.SpamVerdict {
+	recipient := message.ReceiverID
+	stranger := false
+	if message.RoomID != "" {
+		recipient = "room:" + message.RoomID
+	} else {
+		stranger = isStranger(message.SenderID, message.ReceiverID)
+	}
+
+	verdict := moderation.Spam().Check(message.SenderID, recipient, message.Content, stranger)
+
+	if verdict.NewFlag != nil {
+		log.Printf("User %s flagged for spam (%s): %v", message.SenderID, verdict.NewFlag.Action, verdict.NewFlag.Reasons)
+
+		go func(userID string, r moderation.Restriction) {
+			// Without MongoDB the restriction lives in memory only
+			if config.DB == nil {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			flag := models.SpamFlag{
+				UserID:    userID,
+				Action:    r.Action,
+				Reasons:   r.Reasons,
+				Score:     r.Score,
+				ExpiresAt: r.Until,
+				CreatedAt: time.Now(),
+			}
+			if _, err := config.DB.Collection("spam_flags").InsertOne(ctx, flag); err != nil {
+				log.Printf("Failed to save spam flag for user %s: %v", userID, err)
+			}
+		}(message.SenderID, *verdict.NewFlag)
+	}
+
+	return verdict
+}
+
+// RestoreSpamRestrictions reloads active spam restrictions after a restart
+func RestoreSpamRestrictions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("spam_flags").Find(ctx, bson.M{
+		"lifted":     false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		log.Printf("Failed to restore spam restrictions: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	restored := 0
+	for cursor.Next(ctx) {
+		var flag models.SpamFlag
+		if err := cursor.Decode(&flag); err != nil {
+			continue
+		}
+		moderation.Spam().Restrict(flag.UserID, moderation.Restriction{
+			Action:  flag.Action,
+			Reasons: flag.Reasons,
+			Score:   flag.Score,
+			Until:   flag.ExpiresAt,
+		})
+		restored++
+	}
+
+	log.Printf("Restored %d active spam restrictions", restored)
+}
+
+func GetSpamFlags(c *fiber.Ctx) error {
+	activeOnly := c.Query("active", "true") == "true"
+	limit := c.QueryInt("limit", 50)
+
+	if limit > 100 {
+		limit = 100
+	}
+
+	filter := bson.M{}
+	if activeOnly {
+		filter["lifted"] = false
+		filter["expires_at"] = bson.M{"$gt": time.Now()}
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(int64(limit))
+	cursor, err := config.DB.Collection("spam_flags").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Failed to fetch spam flags: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch spam flags",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	flags := []models.SpamFlag{}
+	if err := cursor.All(ctx, &flags); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode spam flags",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"flags": flags,
+		"total": len(flags),
+	})
+}
+
+func LiftSpamFlag(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+	userID := c.Params("user_id")
+
+	_, err := config.DB.Collection("spam_flags").UpdateMany(c.UserContext(),
+		bson.M{"user_id": userID, "lifted": false},
+		bson.M{"$set": bson.M{"lifted": true, "lifted_by": adminID}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to lift restriction",
+		})
+	}
+
+	moderation.Spam().Lift(userID)
+
+	// Messages sent while shadow-restricted stay hidden, lifting only affects new messages
+	return c.JSON(fiber.Map{
+		"message": "Restriction lifted",
+	})
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// liveStats accumulates in-memory metrics between rollup runs
+type liveStats struct {
+	mu              sync.Mutex
+	peakConnections int
+	latencyTotal    time.Duration
+	latencySamples  int64
+}
+
+var live = &liveStats{}
+
+// recordConnections tracks the peak number of concurrent WebSocket connections
+func recordConnections(n int) {
+	live.mu.Lock()
+	if n > live.peakConnections {
+		live.peakConnections = n
+	}
+	live.mu.Unlock()
+}
+
+// recordDelivery tracks how long a message took to reach a recipient's socket
+func recordDelivery(latency time.Duration) {
+	live.mu.Lock()
+	live.latencyTotal += latency
+	live.latencySamples++
+	live.mu.Unlock()
+}
+
+// drain returns the accumulated metrics and starts a new window
+func (s *liveStats) drain(currentConnections int) (int, int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	peak, total, samples := s.peakConnections, s.latencyTotal.Milliseconds(), s.latencySamples
+	s.peakConnections = currentConnections
+	s.latencyTotal = 0
+	s.latencySamples = 0
+	return peak, total, samples
+}
+
+// StartStatsRollupWorker keeps the stats_daily and daily_active_users rollups up to date
+func StartStatsRollupWorker() {
+	interval := config.GetDurationEnv("STATS_ROLLUP_INTERVAL", 5*time.Minute)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			rollupStats()
+		}
+	}()
+}
+
+func rollupStats() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+
+	connections := hub.Connections()
+	online := hub.ConnectedUsers()
+
+	peak, latencyMs, samples := live.drain(connections)
+
+	// Recompute yesterday as well so late writes around midnight are counted
+	if err := rollupDay(ctx, today.Add(-24*time.Hour), nil, 0, 0, 0); err != nil {
+		log.Printf("Failed to roll up stats for %s: %v", today.Add(-24*time.Hour).Format(models.StatsDayLayout), err)
+	}
+	if err := rollupDay(ctx, today, online, peak, latencyMs, samples); err != nil {
+		log.Printf("Failed to roll up stats for %s: %v", today.Format(models.StatsDayLayout), err)
+	}
+}
+
+func rollupDay(ctx context.Context, start time.Time, online []string, peak int, latencyMs, samples int64) error {
+	day := start.Format(models.StatsDayLayout)
+	dayRange := bson.M{"$gte": start, "$lt": start.Add(24 * time.Hour)}
+
+	messages, err := config.DB.Collection("messages").CountDocuments(ctx, bson.M{"created_at": dayRange})
+	if err != nil {
+		return err
+	}
+
+	registrations, err := config.DB.Collection("users").CountDocuments(ctx, bson.M{"created_at": dayRange})
+	if err != nil {
+		return err
+	}
+
+	// Senders of the day plus anyone connected right now count as active
+	_, err = config.DB.Collection("messages").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"created_at": dayRange}},
+		{"$group": bson.M{"_id": "$sender_id"}},
+		{"$project": bson.M{
+			"_id":     bson.M{"$concat": []interface{}{day, ":", "$_id"}},
+			"day":     day,
+			"user_id": "$_id",
+		}},
+		{"$merge": bson.M{"into": "daily_active_users", "whenMatched": "keepExisting"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(online) > 0 {
+		writes := make([]mongo.WriteModel, 0, len(online))
+		for _, userID := range online {
+			doc := models.DailyActiveUser{ID: day + ":" + userID, Day: day, UserID: userID}
+			writes = append(writes, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": doc.ID}).SetReplacement(doc).SetUpsert(true))
+		}
+		if _, err := config.DB.Collection("daily_active_users").BulkWrite(ctx, writes,
+			options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+
+	activeUsers, err := config.DB.Collection("daily_active_users").CountDocuments(ctx, bson.M{"day": day})
+	if err != nil {
+		return err
+	}
+
+	_, err = config.DB.Collection("stats_daily").UpdateOne(ctx,
+		bson.M{"_id": day},
+		bson.M{
+			"$set": bson.M{
+				"messages":          messages,
+				"new_registrations": registrations,
+				"active_users":      activeUsers,
+				"updated_at":        time.Now(),
+			},
+			"$max": bson.M{"peak_connections": peak},
+			"$inc": bson.M{"latency_total_ms": latencyMs, "latency_samples": samples},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// distinctActiveUsers counts users active on any day in [from, to]
+func distinctActiveUsers(ctx context.Context, from, to string) (int64, error) {
+	cursor, err := config.DB.Collection("daily_active_users").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"day": bson.M{"$gte": from, "$lte": to}}},
+		{"$group": bson.M{"_id": "$user_id"}},
+		{"$count": "count"},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Count int64 `bson:"count"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.Count, nil
+}
+
+// GetAdminStats returns usage metrics from the daily rollups
+func GetAdminStats(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 30)
+	if days < 1 || days > 365 {
+		days = 30
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -(days - 1)).Format(models.StatsDayLayout)
+	to := today.Format(models.StatsDayLayout)
+
+	cursor, err := config.DB.Collection("stats_daily").Find(ctx,
+		bson.M{"_id": bson.M{"$gte": from, "$lte": to}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch stats",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	daily := []fiber.Map{}
+	for cursor.Next(ctx) {
+		var s models.DailyStats
+		if err := cursor.Decode(&s); err != nil {
+			continue
+		}
+		daily = append(daily, fiber.Map{
+			"day":                     s.Day,
+			"messages":                s.Messages,
+			"new_registrations":       s.NewRegistrations,
+			"active_users":            s.ActiveUsers,
+			"peak_connections":        s.PeakConnections,
+			"avg_delivery_latency_ms": s.AvgDeliveryLatencyMs(),
+		})
+	}
+
+	weekly, err := distinctActiveUsers(ctx, today.AddDate(0, 0, -6).Format(models.StatsDayLayout), to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute weekly active users",
+		})
+	}
+
+	var dailyActive int64
+	if len(daily) > 0 && daily[len(daily)-1]["day"] == to {
+		dailyActive = daily[len(daily)-1]["active_users"].(int64)
+	}
+
+	connections := hub.Connections()
+
+	return c.JSON(fiber.Map{
+		"daily_active_users":  dailyActive,
+		"weekly_active_users": weekly,
+		"current_connections": connections,
+		"daily":               daily,
+	})
+}
@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/push"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var startedAt = time.Now()
+
+// Thresholds past which a subsystem counts as degraded
+const (
+	statusCacheTTL       = 10 * time.Second
+	pushFailureThreshold = 3   // Consecutive failed sends
+	pushBacklogThreshold = 0.8 // Share of the queue in use
+	outboxLagThreshold   = 5 * time.Minute
+)
+
+// statusSnapshot is the last health check, shared by every GET /status and hello
+// within statusCacheTTL so polling clients never reach the database directly
+type statusSnapshot struct {
+	Status     string            `json:"status"`
+	Subsystems map[string]string `json:"subsystems"`
+	Incident   *models.Incident  `json:"incident,omitempty"`
+	CheckedAt  time.Time         `json:"checked_at"`
+}
+
+var statusCache struct {
+	mu       sync.Mutex
+	snapshot *statusSnapshot
+}
+
+// currentStatus returns the cached health check, running a new one once it is stale
+func currentStatus() statusSnapshot {
+	statusCache.mu.Lock()
+	defer statusCache.mu.Unlock()
+
+	if statusCache.snapshot == nil || time.Since(statusCache.snapshot.CheckedAt) > statusCacheTTL {
+		snapshot := checkStatus()
+		statusCache.snapshot = &snapshot
+	}
+	return *statusCache.snapshot
+}
+
+// invalidateStatus makes the next currentStatus run a fresh check
+func invalidateStatus() {
+	statusCache.mu.Lock()
+	statusCache.snapshot = nil
+	statusCache.mu.Unlock()
+}
+
+func checkStatus() statusSnapshot {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	subsystems := map[string]string{
+		"database": models.SubsystemOK,
+		"storage":  models.SubsystemDisabled,
+		"push":     models.SubsystemDisabled,
+		"outbox":   models.SubsystemOK,
+	}
+
+	if err := store.Ping(ctx); err != nil {
+		log.Printf("Status check: database unreachable: %v", err)
+		subsystems["database"] = models.SubsystemDown
+	}
+
+	// Attachments live in GridFS
+	if config.DB != nil {
+		subsystems["storage"] = models.SubsystemOK
+		if err := config.DB.Client().Ping(ctx, nil); err != nil {
+			subsystems["storage"] = models.SubsystemDown
+		}
+	}
+
+	if worker := push.Default(); worker.Configured() {
+		subsystems["push"] = models.SubsystemOK
+		if failures, backlog := worker.Health(); failures >= pushFailureThreshold || backlog >= pushBacklogThreshold {
+			subsystems["push"] = models.SubsystemDegraded
+		}
+	}
+
+	if subsystems["database"] == models.SubsystemDown {
+		subsystems["outbox"] = models.SubsystemDown
+	} else if pending, oldest, err := store.Outbox().Pending(ctx); err != nil {
+		subsystems["outbox"] = models.SubsystemDegraded
+	} else if pending > 0 && time.Since(oldest) > outboxLagThreshold {
+		subsystems["outbox"] = models.SubsystemDegraded
+	}
+
+	status := models.SubsystemOK
+	for _, state := range subsystems {
+		if state == models.SubsystemDegraded || state == models.SubsystemDown {
+			status = models.SubsystemDegraded
+		}
+	}
+	if subsystems["database"] == models.SubsystemDown {
+		status = models.SubsystemDown
+	}
+
+	return statusSnapshot{
+		Status:     status,
+		Subsystems: subsystems,
+		Incident:   openIncident(ctx),
+		CheckedAt:  time.Now(),
+	}
+}
+
+// openIncident returns the incident operators have not resolved yet, if any
+func openIncident(ctx context.Context) *models.Incident {
+	// Incidents are stored in MongoDB only
+	if config.DB == nil {
+		return nil
+	}
+
+	var incident models.Incident
+	err := config.DB.Collection("incidents").FindOne(ctx,
+		bson.M{"resolved_at": bson.M{"$exists": false}},
+		options.FindOne().SetSort(bson.M{"started_at": -1}),
+	).Decode(&incident)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Failed to load open incident: %v", err)
+		}
+		return nil
+	}
+	return &incident
+}
+
+// GetStatus is the public status page: overall state, uptime, the state of each
+// subsystem and the open incident
+func GetStatus(c *fiber.Ctx) error {
+	snapshot := currentStatus()
+
+	code := fiber.StatusOK
+	if snapshot.Status == models.SubsystemDown {
+		code = fiber.StatusServiceUnavailable
+	}
+
+	return c.Status(code).JSON(fiber.Map{
+		"status":         snapshot.Status,
+		"started_at":     startedAt,
+		"uptime_seconds": int(time.Since(startedAt).Seconds()),
+		"subsystems":     snapshot.Subsystems,
+		"incident":       snapshot.Incident,
+		"checked_at":     snapshot.CheckedAt,
+	})
+}
+
+// incidentEvent is the service notice announcing a change to an incident
+func incidentEvent(incident *models.Incident) models.Event {
+	return models.Event{
+		Event: models.EventServiceNotice,
+		Data: fiber.Map{
+			"message":  incident.Message,
+			"level":    incident.Level,
+			"sent_at":  incident.UpdatedAt,
+			"incident": incident,
+		},
+	}
+}
+
+// SetIncident opens an incident, or updates the open one, and pushes it to every
+// connected client as a service notice. Clients keep showing it as a banner until
+// it is resolved, and clients connecting later get it in hello.
+func SetIncident(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var input models.ServiceNoticeRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var incident models.Incident
+	err := config.DB.Collection("incidents").FindOneAndUpdate(ctx,
+		bson.M{"resolved_at": bson.M{"$exists": false}},
+		bson.M{
+			"$set": bson.M{"message": input.Message, "level": input.Level, "updated_at": now},
+			"$setOnInsert": bson.M{
+				"_id":        primitive.NewObjectID(),
+				"created_by": adminID,
+				"started_at": now,
+			},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&incident)
+	if err != nil {
+		log.Printf("Failed to save incident: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save incident",
+		})
+	}
+	invalidateStatus()
+
+	sent := hub.BroadcastAll(incidentEvent(&incident))
+	log.Printf("Incident (%s) set by %s, sent to %d users: %s", incident.Level, adminID, sent, incident.Message)
+
+	return c.JSON(fiber.Map{
+		"incident":   incident,
+		"recipients": sent,
+	})
+}
+
+// ResolveIncident closes the open incident, clients drop the banner on the
+// service notice carrying resolved_at
+func ResolveIncident(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var incident models.Incident
+	err := config.DB.Collection("incidents").FindOneAndUpdate(ctx,
+		bson.M{"resolved_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"resolved_at": now, "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&incident)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No open incident",
+		})
+	} else if err != nil {
+		log.Printf("Failed to resolve incident: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resolve incident",
+		})
+	}
+	invalidateStatus()
+
+	sent := hub.BroadcastAll(incidentEvent(&incident))
+	log.Printf("Incident %s resolved by %s, sent to %d users", incident.ID.Hex(), adminID, sent)
+
+	return c.JSON(fiber.Map{
+		"incident":   incident,
+		"recipients": sent,
+	})
+}
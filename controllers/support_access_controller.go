@@ -0,0 +1,451 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func writeSupportAudit(access *models.SupportAccess, action, actorID, messageID string) {
+	audit := models.SupportAudit{
+		AccessID:  access.ID,
+		Action:    action,
+		UserID:    access.UserID,
+		AgentID:   access.AgentID,
+		ActorID:   actorID,
+		MessageID: messageID,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := config.DB.Collection("support_audit").InsertOne(context.Background(), audit); err != nil {
+		log.Printf("Failed to write support audit entry: %v", err)
+	}
+}
+
+// notifySupportAccess tells the affected user's devices what support asked for or did
+func notifySupportAccess(access *models.SupportAccess, action, messageID string) {
+	data := fiber.Map{
+		"id":       access.ID,
+		"action":   action,
+		"status":   access.Status,
+		"agent_id": access.AgentID,
+		"reason":   access.Reason,
+		"minutes":  access.Minutes,
+	}
+	if access.ExpiresAt != nil {
+		data["expires_at"] = access.ExpiresAt
+	}
+	if messageID != "" {
+		data["message_id"] = messageID
+	}
+	hub.sendToUsers([]string{access.UserID}, models.Event{Event: models.EventSupportAccess, Data: data})
+}
+
+// findSupportAccess loads a support access by its ID in the route
+func findSupportAccess(c *fiber.Ctx, filter bson.M) (*models.SupportAccess, error) {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid support access ID")
+	}
+	filter["_id"] = objID
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	var access models.SupportAccess
+	if err := config.DB.Collection("support_access").FindOne(ctx, filter).Decode(&access); err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Support access not found")
+	}
+	return &access, nil
+}
+
+// setSupportAccessStatus moves the access out of one of the from statuses, reports
+// false if another request changed it first
+func setSupportAccessStatus(ctx context.Context, access *models.SupportAccess, from []string, set bson.M) (bool, error) {
+	result, err := config.DB.Collection("support_access").UpdateOne(ctx,
+		bson.M{"_id": access.ID, "status": bson.M{"$in": from}},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// RequestSupportAccess asks a user to let the calling agent inspect their message
+// metadata. Nothing is accessible until the user approves.
+func RequestSupportAccess(c *fiber.Ctx) error {
+	agentID := c.Locals("user_id").(string)
+	userID := c.Params("id")
+
+	var input models.SupportAccessRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"errors": validationErrors,
+		})
+	}
+
+	if userID == agentID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot request access to your own account",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if _, err := store.Users().GetByID(ctx, userID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	access := models.SupportAccess{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		AgentID:   agentID,
+		Reason:    config.SanitizeString(input.Reason),
+		Minutes:   input.Minutes,
+		Status:    models.SupportAccessPending,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := config.DB.Collection("support_access").InsertOne(ctx, access); err != nil {
+		log.Printf("Failed to create support access: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to request support access",
+		})
+	}
+
+	writeSupportAudit(&access, models.SupportActionRequested, agentID, "")
+	notifySupportAccess(&access, models.SupportActionRequested, "")
+
+	return c.Status(fiber.StatusCreated).JSON(access)
+}
+
+// RevokeSupportAccess ends the calling agent's access or request early
+func RevokeSupportAccess(c *fiber.Ctx) error {
+	agentID := c.Locals("user_id").(string)
+
+	access, err := findSupportAccess(c, bson.M{"agent_id": agentID})
+	if err != nil {
+		return err
+	}
+	return revokeSupportAccess(c, access, agentID)
+}
+
+func revokeSupportAccess(c *fiber.Ctx, access *models.SupportAccess, actorID string) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	revoked, err := setSupportAccessStatus(ctx, access,
+		[]string{models.SupportAccessPending, models.SupportAccessApproved},
+		bson.M{"status": models.SupportAccessRevoked, "expires_at": now},
+	)
+	if err != nil {
+		log.Printf("Failed to revoke support access %s: %v", access.ID.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke support access",
+		})
+	}
+	if !revoked {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Support access already ended",
+		})
+	}
+
+	access.Status = models.SupportAccessRevoked
+	access.ExpiresAt = &now
+	writeSupportAudit(access, models.SupportActionRevoked, actorID, "")
+	notifySupportAccess(access, models.SupportActionRevoked, "")
+
+	return c.JSON(access)
+}
+
+// InspectSupportMessage shows an approved agent the metadata and delivery status of
+// one of the user's messages, never its content. Every call is audited and the
+// user is told which message was looked at.
+func InspectSupportMessage(c *fiber.Ctx) error {
+	agentID := c.Locals("user_id").(string)
+
+	access, err := findSupportAccess(c, bson.M{"agent_id": agentID})
+	if err != nil {
+		return err
+	}
+	if !access.Active(time.Now()) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Support access is not approved or has expired",
+		})
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Params("message_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid message ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	messages, err := store.Messages().GetByIDs(ctx, access.UserID, []primitive.ObjectID{messageID})
+	if err != nil || len(messages) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Message not found",
+		})
+	}
+	message := messages[0]
+
+	var conversation, delivery fiber.Map
+	switch {
+	case message.RoomID != "":
+		room, err := findRoomForMember(message.RoomID, access.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Message not found",
+			})
+		}
+		conversation, delivery = roomSupportView(room, &message)
+
+	case message.SenderID == access.UserID || (message.ReceiverID == access.UserID && !message.Shadowed):
+		conversation, delivery = directSupportView(ctx, &message)
+
+	default:
+		// Messages the user cannot see are out of scope, channels included
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Message not found",
+		})
+	}
+
+	writeSupportAudit(access, models.SupportActionViewed, agentID, message.ID.Hex())
+	notifySupportAccess(access, models.SupportActionViewed, message.ID.Hex())
+
+	return c.JSON(fiber.Map{
+		"access": access,
+		"message": fiber.Map{
+			"id":          message.ID,
+			"sender_id":   message.SenderID,
+			"receiver_id": message.ReceiverID,
+			"room_id":     message.RoomID,
+			"type":        message.Type,
+			"created_at":  message.CreatedAt,
+			"view_once":   message.ViewOnce,
+			"expires_at":  message.ExpiresAt,
+			"archived":    message.Archived,
+			"shadowed":    message.Shadowed,
+		},
+		"conversation": conversation,
+		"delivery":     delivery,
+	})
+}
+
+func directSupportView(ctx context.Context, message *models.Message) (fiber.Map, fiber.Map) {
+	conversationID := models.ConversationID(message.SenderID, message.ReceiverID)
+	conversation := fiber.Map{"id": conversationID}
+
+	state, err := store.Conversations().Get(ctx, conversationID)
+	if err == nil {
+		conversation["created_at"] = state.CreatedAt
+		conversation["accepted_at"] = state.AcceptedAt
+		conversation["pinned_count"] = len(state.Pinned)
+		conversation["blocked_by"] = state.BlockedBy
+		if state.Request != nil {
+			conversation["request"] = state.Request
+		}
+	} else if err != store.ErrNotFound {
+		log.Printf("Failed to load conversation %s: %v", conversationID, err)
+	}
+
+	delivery := fiber.Map{
+		"receiver_connected": hub.Connected(message.ReceiverID),
+		"receiver_sessions":  hub.Sessions(message.ReceiverID),
+		"read":               message.Read,
+	}
+	if cursor, err := store.Conversations().ReadCursor(ctx, message.ReceiverID, message.SenderID); err == nil {
+		delivery["read"] = cursor.Covers(message)
+		delivery["receiver_read_at"] = cursor.ReadAt
+	}
+	if receiver, err := store.Users().GetByID(ctx, message.ReceiverID); err == nil {
+		delivery["receiver_last_seen"] = receiver.LastSeen
+	}
+	return conversation, delivery
+}
+
+func roomSupportView(room *models.Room, message *models.Message) (fiber.Map, fiber.Map) {
+	connected := 0
+	for _, id := range room.MemberIDs() {
+		if id != message.SenderID && hub.Connected(id) {
+			connected++
+		}
+	}
+
+	conversation := fiber.Map{
+		"id":           room.ID,
+		"member_count": len(room.Members),
+	}
+	delivery := fiber.Map{
+		"read_count":        len(room.ReadBy(message)),
+		"members_connected": connected,
+	}
+	return conversation, delivery
+}
+
+// GetSupportAudit lists support access steps, newest first
+func GetSupportAudit(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit > 200 {
+		limit = 200
+	}
+
+	filter := bson.M{}
+	if userID := c.Query("user_id"); userID != "" {
+		filter["user_id"] = userID
+	}
+	if agentID := c.Query("agent_id"); agentID != "" {
+		filter["agent_id"] = agentID
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(int64(limit))
+	cursor, err := config.DB.Collection("support_audit").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Failed to fetch support audit: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch support audit",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.SupportAudit{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode support audit",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"audit": entries,
+		"total": len(entries),
+	})
+}
+
+// GetMySupportAccess lists support access requested on the caller's account, so
+// requests made while they were offline can still be answered
+func GetMySupportAccess(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(50)
+	cursor, err := config.DB.Collection("support_access").Find(ctx, bson.M{"user_id": currentUserID}, opts)
+	if err != nil {
+		log.Printf("Failed to fetch support access of user %s: %v", currentUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch support access",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.SupportAccess{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode support access",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"access": entries,
+		"total":  len(entries),
+	})
+}
+
+// ApproveSupportAccess starts the agent's time box
+func ApproveSupportAccess(c *fiber.Ctx) error {
+	return answerSupportAccess(c, true)
+}
+
+// DenySupportAccess refuses the request, the agent never gets access
+func DenySupportAccess(c *fiber.Ctx) error {
+	return answerSupportAccess(c, false)
+}
+
+func answerSupportAccess(c *fiber.Ctx, approve bool) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	access, err := findSupportAccess(c, bson.M{"user_id": currentUserID})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if !access.Answerable(now) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Support access is no longer waiting for an answer",
+		})
+	}
+
+	status, action := models.SupportAccessDenied, models.SupportActionDenied
+	set := bson.M{"responded_at": now}
+	if approve {
+		status, action = models.SupportAccessApproved, models.SupportActionApproved
+		expiresAt := now.Add(time.Duration(access.Minutes) * time.Minute)
+		set["expires_at"] = expiresAt
+		access.ExpiresAt = &expiresAt
+	}
+	set["status"] = status
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	answered, err := setSupportAccessStatus(ctx, access, []string{models.SupportAccessPending}, set)
+	if err != nil {
+		log.Printf("Failed to answer support access %s: %v", access.ID.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to answer support access",
+		})
+	}
+	if !answered {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Support access is no longer waiting for an answer",
+		})
+	}
+
+	access.Status = status
+	access.RespondedAt = &now
+	writeSupportAudit(access, action, currentUserID, "")
+	// The user's other devices drop the prompt
+	notifySupportAccess(access, action, "")
+
+	return c.JSON(access)
+}
+
+// EndSupportAccess lets the user take back access they approved, or withdraw a
+// request before answering it
+func EndSupportAccess(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(string)
+
+	access, err := findSupportAccess(c, bson.M{"user_id": currentUserID})
+	if err != nil {
+		return err
+	}
+	return revokeSupportAccess(c, access, currentUserID)
+}
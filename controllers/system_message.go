@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// systemName is how a user is called in system message text
+func systemName(ctx context.Context, lang, userID string) string {
+	user, err := store.Users().GetByID(ctx, userID)
+	if err != nil {
+		return i18n.T(lang, "system.someone")
+	}
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
+
+// formatTTL writes a message timer the way people say it, e.g. "1 day" or "90 minutes"
+func formatTTL(lang string, seconds int) string {
+	unit, size := "second", 1
+	for _, u := range []struct {
+		name string
+		size int
+	}{{"week", 7 * 24 * 3600}, {"day", 24 * 3600}, {"hour", 3600}, {"minute", 60}} {
+		if seconds%u.size == 0 {
+			unit, size = u.name, u.size
+			break
+		}
+	}
+	return i18n.N(lang, "duration."+unit, seconds/size)
+}
+
+// systemMessageText is the readable fallback for clients that don't render the event
+func systemMessageText(ctx context.Context, lang string, event *models.SystemEvent) string {
+	actor := systemName(ctx, lang, event.ActorID)
+	switch event.Action {
+	case models.SystemRoomCreated:
+		return i18n.T(lang, "system.room_created", actor, event.Name)
+	case models.SystemMemberJoined:
+		return i18n.T(lang, "system.member_joined", actor)
+	case models.SystemMemberAdded:
+		return i18n.T(lang, "system.member_added", actor, systemName(ctx, lang, event.TargetID))
+	case models.SystemMemberLeft:
+		return i18n.T(lang, "system.member_left", actor)
+	case models.SystemMemberRemoved:
+		return i18n.T(lang, "system.member_removed", actor, systemName(ctx, lang, event.TargetID))
+	case models.SystemRoomRenamed:
+		return i18n.T(lang, "system.room_renamed", actor, event.Name)
+	case models.SystemTopicChanged:
+		if event.Name == "" {
+			return i18n.T(lang, "system.topic_removed", actor)
+		}
+		return i18n.T(lang, "system.topic_changed", actor, event.Name)
+	case models.SystemDisappearingEnabled:
+		return i18n.T(lang, "system.disappearing_enabled", actor, formatTTL(lang, event.TTL))
+	case models.SystemDisappearingDisabled:
+		return i18n.T(lang, "system.disappearing_disabled", actor)
+	case models.SystemSlowModeEnabled:
+		return i18n.T(lang, "system.slow_mode_enabled", actor, formatTTL(lang, event.TTL))
+	case models.SystemSlowModeDisabled:
+		return i18n.T(lang, "system.slow_mode_disabled", actor)
+	}
+	return ""
+}
+
+// localizeSystemMessages rewrites the text of system messages in lang, they are
+// stored in the default language
+func localizeSystemMessages(ctx context.Context, lang string, messages []models.Message) {
+	if lang == i18n.Default {
+		return
+	}
+	for i := range messages {
+		if messages[i].Type == models.MessageTypeSystem && messages[i].System != nil {
+			messages[i].Content = systemMessageText(ctx, lang, messages[i].System)
+		}
+	}
+}
+
+// postSystemMessage records a room event inline in the room's history and delivers it
+// to the members like a message. System messages skip moderation, spam scoring and
+// notifications, and do not count toward read receipts.
+func postSystemMessage(room *models.Room, event models.SystemEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message := models.Message{
+		ID:        primitive.NewObjectID(),
+		SenderID:  event.ActorID,
+		RoomID:    room.ID.Hex(),
+		Content:   systemMessageText(ctx, i18n.Default, &event),
+		Type:      models.MessageTypeSystem,
+		System:    &event,
+		CreatedAt: time.Now(),
+	}
+
+	if err := store.Messages().Insert(ctx, &message, models.MessageCreated(&message)); err != nil {
+		log.Printf("Failed to save %s system message in room %s: %v", event.Action, message.RoomID, err)
+		return
+	}
+
+	// Each member gets the text in their own language
+	for lang, members := range byLanguage(ctx, room.MemberIDs()) {
+		localized := message
+		localized.Content = systemMessageText(ctx, lang, &event)
+		hub.sendToUsers(members, localized)
+	}
+}
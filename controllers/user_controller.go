@@ -3,23 +3,20 @@ package controllers
 
 import (
 	"context"
-	"time"
+	"log"
+	"unicode/utf8"
 
 	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
 	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func GetProfile(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
-	var user models.User
-	err := config.DB.Collection("users").FindOne(context.Background(),
-		bson.M{"_id": userID}).Decode(&user)
-
+	user, err := store.Users().GetByID(c.UserContext(), userID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
@@ -27,14 +24,21 @@ func GetProfile(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"id":         user.ID,
-		"username":   user.Username,
-		"email":      user.Email,
-		"bio":        user.Bio,
-		"avatar":     user.Avatar,
-		"online":     user.Online,
-		"last_seen":  user.LastSeen,
-		"created_at": user.CreatedAt,
+		"id":                  user.ID,
+		"username":            user.Username,
+		"display_name":        user.DisplayName,
+		"email":               user.Email,
+		"bio":                 user.Bio,
+		"avatar":              user.Avatar,
+		"status":              user.Status,
+		"online":              user.Online,
+		"last_seen":           user.LastSeen,
+		"created_at":          user.CreatedAt,
+		"hide_from_discovery": user.HideFromDiscovery,
+		"email_digest":        !user.EmailDigestOptOut,
+		"username_changed_at": user.UsernameChangedAt,
+		"former_usernames":    user.UsernameHistory,
+		"language":            user.Language,
 	})
 }
 
@@ -48,24 +52,17 @@ func UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	// Build update document
-	updateDoc := bson.M{}
-
-	if input.Username != "" {
-		// Check if username is already taken by another user
-		count, _ := config.DB.Collection("users").CountDocuments(context.Background(),
-			bson.M{
-				"username": input.Username,
-				"_id":      bson.M{"$ne": userID},
-			})
+	// Build update
+	var update store.UserUpdate
 
-		if count > 0 {
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-				"error": "Username already taken",
+	if input.DisplayName != nil {
+		displayName := config.SanitizeString(*input.DisplayName)
+		if utf8.RuneCountInString(displayName) > 50 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Display name too long (max 50 characters)",
 			})
 		}
-
-		updateDoc["username"] = input.Username
+		update.DisplayName = &displayName
 	}
 
 	if input.Bio != "" {
@@ -74,29 +71,52 @@ func UpdateProfile(c *fiber.Ctx) error {
 				"error": "Bio too long (max 500 characters)",
 			})
 		}
-		updateDoc["bio"] = input.Bio
+		update.Bio = &input.Bio
 	}
 
 	if input.Avatar != "" {
-		updateDoc["avatar"] = input.Avatar
+		update.Avatar = &input.Avatar
+	}
+
+	if input.HideFromDiscovery != nil {
+		update.HideFromDiscovery = input.HideFromDiscovery
+	}
+
+	if input.EmailDigest != nil {
+		optOut := !*input.EmailDigest
+		update.EmailDigestOptOut = &optOut
+	}
+
+	// An empty language goes back to following Accept-Language
+	if input.Language != nil {
+		if *input.Language != "" && !i18n.Supported(*input.Language) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unsupported language",
+			})
+		}
+		update.Language = input.Language
 	}
 
-	if len(updateDoc) == 0 {
+	if update.IsEmpty() && input.Username == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "No fields to update",
 		})
 	}
 
-	// Update user
-	_, err := config.DB.Collection("users").UpdateOne(context.Background(),
-		bson.M{"_id": userID},
-		bson.M{"$set": updateDoc},
-	)
+	// Renaming is checked first so a refused username leaves the profile untouched
+	if input.Username != "" {
+		if status, body := changeUsername(c.UserContext(), userID, input.Username); status != 0 {
+			return c.Status(status).JSON(body)
+		}
+	}
 
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update profile",
-		})
+	// Update user
+	if !update.IsEmpty() {
+		if err := store.Users().Update(c.UserContext(), userID, update); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update profile",
+			})
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -113,99 +133,98 @@ func ListUsers(c *fiber.Ctx) error {
 
 	// Query parameters
 	online := c.Query("online")
-	search := c.Query("search")
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 20)
-
-	if limit > 100 {
-		limit = 100 // Prevent large queries
+	search := models.NormalizeSearch(c.Query("search"))
+	fuzzy := c.QueryBool("fuzzy")
+	p, err := parsePage(c, 20, 100)
+	if err != nil {
+		return err
 	}
-	skip := (page - 1) * limit
-
-	// Build filter
-	filter := bson.M{}
 
-	// Exclude current user
-	if objID, err := primitive.ObjectIDFromHex(userID); err == nil {
-		filter["_id"] = bson.M{"$ne": objID}
-	} else {
-		filter["_id"] = bson.M{"$ne": userID}
+	// Exclude current user, deactivated and deleted accounts are always hidden
+	filter := store.UserFilter{
+		ExcludeID:  userID,
+		OnlineOnly: online == "true",
+		Search:     search,
+		Fuzzy:      fuzzy,
+		Skip:       p.skip(),
+		Limit:      int64(p.Limit) + 1, // One more tells whether another page follows
 	}
 
-	if online == "true" {
-		filter["online"] = true
-	}
+	var list []models.User
+	var pagination fiber.Map
 	if search != "" {
-		filter["$or"] = []bson.M{
-			{"username": bson.M{"$regex": search, "$options": "i"}},
-			{"email": bson.M{"$regex": search, "$options": "i"}},
+		// Searches are ranked for the caller, so paging happens after ranking
+		list, err = searchUsers(c.UserContext(), userID, filter)
+		list, pagination = pageOf(p, list)
+	} else {
+		list, err = store.Users().List(c.UserContext(), filter)
+		hasMore := len(list) > p.Limit
+		if hasMore {
+			list = list[:p.Limit]
 		}
+		pagination = p.envelope(hasMore, pageCursor{Offset: p.skip() + int64(p.Limit)}, userTotal(c.UserContext(), filter, p))
 	}
-
-	// ✅ Use bson.D for sorting (ordered)
-	opts := options.Find().
-		SetSkip(int64(skip)).
-		SetLimit(int64(limit)).
-		SetSort(bson.D{
-			{Key: "online", Value: -1},
-			{Key: "last_seen", Value: -1},
-		})
-
-	cursor, err := config.DB.Collection("users").Find(context.Background(), filter, opts)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   "Failed to fetch users",
 			"details": err.Error(),
 		})
 	}
-	defer cursor.Close(context.Background())
+
+	contacts := contactsOf(c.UserContext(), userID)
 
 	var users []fiber.Map
-	for cursor.Next(context.Background()) {
-		var raw bson.M
-		if err := cursor.Decode(&raw); err != nil {
-			continue
+	for _, user := range list {
+		item := fiber.Map{
+			"id":           user.ID,
+			"username":     user.Username,
+			"display_name": user.DisplayName,
+			"bio":          user.Bio,
+			"avatar":       user.Avatar,
+			"online":       user.Online,
+			"last_seen":    user.LastSeen,
 		}
-
-		// Convert _id ke string
-		id := ""
-		if oid, ok := raw["_id"].(primitive.ObjectID); ok {
-			id = oid.Hex()
-		} else if str, ok := raw["_id"].(string); ok {
-			id = str
+		// The caller's private favorite flag, nickname and note
+		if contact, ok := contacts[user.ID]; ok {
+			item["contact"] = contact
 		}
-
-		users = append(users, fiber.Map{
-			"id":        id,
-			"username":  raw["username"],
-			"bio":       raw["bio"],
-			"avatar":    raw["avatar"],
-			"online":    raw["online"],
-			"last_seen": raw["last_seen"],
-		})
+		users = append(users, item)
 	}
 
-	// Total count
-	total, _ := config.DB.Collection("users").CountDocuments(context.Background(), filter)
-
 	return c.JSON(fiber.Map{
-		"users": users,
-		"pagination": fiber.Map{
-			"page":        page,
-			"limit":       limit,
-			"total":       total,
-			"total_pages": (total + int64(limit) - 1) / int64(limit),
-		},
+		"users":      users,
+		"pagination": pagination,
 	})
 }
 
+// userTotal is the size of the user directory for page mode. The full directory
+// uses the estimated collection size, the online list a recent count; pages
+// reached by cursor skip the total.
+func userTotal(ctx context.Context, filter store.UserFilter, p pageRequest) *pageTotal {
+	if p.Cursor != nil {
+		return nil
+	}
+
+	var total *pageTotal
+	var err error
+	if filter.OnlineOnly {
+		total, err = cachedCount(ctx, "users:online", false, func(ctx context.Context) (int64, error) {
+			return store.Users().Count(ctx, filter)
+		})
+	} else {
+		total, err = cachedCount(ctx, "users:all", true, store.Users().EstimatedCount)
+	}
+	if err != nil {
+		log.Printf("Failed to count users: %v", err)
+		return nil
+	}
+	return total
+}
+
 func GetUserProfile(c *fiber.Ctx) error {
 	userID := c.Params("id")
 
-	var user models.User
-	err := config.DB.Collection("users").FindOne(context.Background(),
-		bson.M{"_id": userID}).Decode(&user)
-
+	user, err := store.Users().GetByID(c.UserContext(), userID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
@@ -213,46 +232,45 @@ func GetUserProfile(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"id":        user.ID,
-		"username":  user.Username,
-		"bio":       user.Bio,
-		"avatar":    user.Avatar,
-		"online":    user.Online,
-		"last_seen": user.LastSeen,
+		"id":           user.ID,
+		"username":     user.Username,
+		"display_name": user.DisplayName,
+		"bio":          user.Bio,
+		"avatar":       user.Avatar,
+		"online":       user.Online,
+		"last_seen":    user.LastSeen,
 	})
 }
 
 func GetOnlineUsers(c *fiber.Ctx) error {
 	currentUserID := c.Locals("user_id").(string)
 
-	// Get users that are online and active within last 5 minutes
-	filter := bson.M{
-		"_id":    bson.M{"$ne": currentUserID},
-		"online": true,
-		"last_seen": bson.M{
-			"$gte": time.Now().Add(-5 * time.Minute),
-		},
-	}
-
-	cursor, err := config.DB.Collection("users").Find(context.Background(), filter)
+	// The stored flag lists candidates, the hub knows who is connected and who is away
+	online, err := store.Users().List(c.UserContext(), store.UserFilter{
+		ExcludeID:  currentUserID,
+		OnlineOnly: true,
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch online users",
 		})
 	}
-	defer cursor.Close(context.Background())
 
-	var users []fiber.Map
-	for cursor.Next(context.Background()) {
-		var user models.User
-		if err := cursor.Decode(&user); err != nil {
+	includeAway := c.QueryBool("include_away", true)
+
+	users := []fiber.Map{}
+	for _, user := range online {
+		status, lastActive := hub.Status(user.ID)
+		if status == models.PresenceOffline || (status == models.PresenceAway && !includeAway) {
 			continue
 		}
 
 		users = append(users, fiber.Map{
-			"id":       user.ID,
-			"username": user.Username,
-			"avatar":   user.Avatar,
+			"id":          user.ID,
+			"username":    user.Username,
+			"avatar":      user.Avatar,
+			"status":      status,
+			"last_active": lastActive,
 		})
 	}
 
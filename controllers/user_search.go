@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// searchCandidates caps how many matches are ranked, pages past it are empty
+const searchCandidates = 200
+
+// Ranking boosts on top of the match score
+const (
+	boostConnection = 30 // A contact of the viewer or someone they talked to
+	boostMutual     = 5  // Per mutual contact
+	maxMutualBoost  = 25
+)
+
+// connectionsOf returns the users the viewer saved as contacts or has a direct conversation with
+func connectionsOf(ctx context.Context, viewerID string) map[string]bool {
+	connections := map[string]bool{}
+	for userID := range contactsOf(ctx, viewerID) {
+		connections[userID] = true
+	}
+
+	summaries, err := store.Messages().DirectConversations(ctx, viewerID)
+	if err != nil {
+		log.Printf("Failed to load conversations of user %s for search: %v", viewerID, err)
+	}
+	for _, summary := range summaries {
+		connections[summary.OtherUserID] = true
+	}
+	return connections
+}
+
+// mutualContacts counts, per candidate, the viewer's connections the candidate saved as contacts
+func mutualContacts(ctx context.Context, connections map[string]bool, candidateIDs []string) map[string]int {
+	// Contacts are stored in MongoDB only, other backends have none
+	if config.DB == nil || len(connections) == 0 || len(candidateIDs) == 0 {
+		return nil
+	}
+
+	cursor, err := config.DB.Collection("contacts").Find(ctx, bson.M{"_id": bson.M{"$in": candidateIDs}})
+	if err != nil {
+		log.Printf("Failed to load contacts for search ranking: %v", err)
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var lists []models.Contacts
+	if err := cursor.All(ctx, &lists); err != nil {
+		log.Printf("Failed to load contacts for search ranking: %v", err)
+		return nil
+	}
+
+	mutual := make(map[string]int, len(lists))
+	for _, list := range lists {
+		for userID := range list.Entries {
+			if connections[userID] {
+				mutual[list.OwnerID]++
+			}
+		}
+	}
+	return mutual
+}
+
+// searchUsers returns the users matching filter.Search ranked for the viewer: by how
+// well the name matches, connections and mutual contacts first, then most recently seen
+func searchUsers(ctx context.Context, viewerID string, filter store.UserFilter) ([]models.User, error) {
+	filter.Skip, filter.Limit = 0, searchCandidates
+	candidates, err := store.Users().List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]int, len(candidates))
+	matches := make([]models.User, 0, len(candidates))
+	ids := make([]string, 0, len(candidates))
+	for i := range candidates {
+		// Backends return typo candidates loosely, the match score decides
+		score, ok := models.MatchUser(&candidates[i], filter.Search, filter.Fuzzy)
+		if !ok {
+			continue
+		}
+		scores[candidates[i].ID] = score
+		matches = append(matches, candidates[i])
+		ids = append(ids, candidates[i].ID)
+	}
+
+	connections := connectionsOf(ctx, viewerID)
+	mutual := mutualContacts(ctx, connections, ids)
+	for _, id := range ids {
+		if connections[id] {
+			scores[id] += boostConnection
+		}
+		scores[id] += min(mutual[id]*boostMutual, maxMutualBoost)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		si, sj := scores[matches[i].ID], scores[matches[j].ID]
+		if si != sj {
+			return si > sj
+		}
+		return matches[i].LastSeen.After(matches[j].LastSeen)
+	})
+	return matches, nil
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,20}$`)
+
+// usernameChangeCooldown is the minimum time between two username changes
+func usernameChangeCooldown() time.Duration {
+	return config.GetDurationEnv("USERNAME_CHANGE_COOLDOWN", 30*24*time.Hour)
+}
+
+// usernameReservation is how long a given up username stays reserved for its
+// previous owner, so nobody else can take it to impersonate them
+func usernameReservation() time.Duration {
+	return config.GetDurationEnv("USERNAME_RESERVATION", 14*24*time.Hour)
+}
+
+// releasedAt returns when the user last gave up the username
+func releasedAt(user *models.User, username string) time.Time {
+	username = models.CanonicalUsername(username)
+
+	var at time.Time
+	for _, change := range user.UsernameHistory {
+		if change.Canonical == username && change.ChangedAt.After(at) {
+			at = change.ChangedAt
+		}
+	}
+	return at
+}
+
+// reservedUsername returns the user the username is reserved for, nil if anyone
+// may take it
+func reservedUsername(ctx context.Context, username string) (*models.User, error) {
+	former, err := store.Users().FindByFormerUsername(ctx, username, time.Now().Add(-usernameReservation()))
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	return former, err
+}
+
+// changeUsername applies the cooldown and reservation rules and renames the user.
+// Returns a non-zero status with the response body when the change is refused.
+func changeUsername(ctx context.Context, userID, username string) (int, fiber.Map) {
+	if !usernamePattern.MatchString(username) {
+		return fiber.StatusBadRequest, fiber.Map{
+			"error": "Username must be 3-20 letters, numbers or underscores",
+		}
+	}
+
+	user, err := store.Users().GetByID(ctx, userID)
+	if err != nil {
+		return fiber.StatusNotFound, fiber.Map{"error": "User not found"}
+	}
+	if user.Username == username {
+		return 0, nil
+	}
+
+	if user.UsernameChangedAt != nil {
+		if next := user.UsernameChangedAt.Add(usernameChangeCooldown()); time.Now().Before(next) {
+			return fiber.StatusTooManyRequests, fiber.Map{
+				"error":          "Username was changed recently",
+				"next_change_at": next,
+			}
+		}
+	}
+
+	taken, err := store.Users().UsernameTaken(ctx, username, userID)
+	if err != nil {
+		return fiber.StatusInternalServerError, fiber.Map{"error": "Failed to update profile"}
+	}
+	if taken {
+		return fiber.StatusConflict, fiber.Map{"error": "Username already taken"}
+	}
+
+	// Taking back your own former username is fine
+	former, err := reservedUsername(ctx, username)
+	if err != nil {
+		return fiber.StatusInternalServerError, fiber.Map{"error": "Failed to update profile"}
+	}
+	if former != nil && former.ID != userID {
+		return fiber.StatusConflict, fiber.Map{
+			"error":        "Username was recently used by another account",
+			"available_at": releasedAt(former, username).Add(usernameReservation()),
+		}
+	}
+
+	err = store.Users().ChangeUsername(ctx, userID, username, time.Now())
+	if err == store.ErrConflict {
+		return fiber.StatusConflict, fiber.Map{"error": "Username already taken"}
+	} else if err != nil {
+		log.Printf("Failed to change username of user %s: %v", userID, err)
+		return fiber.StatusInternalServerError, fiber.Map{"error": "Failed to update profile"}
+	}
+
+	log.Printf("User %s changed username from %s to %s", userID, user.Username, username)
+	return 0, nil
+}
+
+// ResolveUsername finds a user by current username or, so old links and mentions
+// keep working, by a username they gave up within the reservation period
+func ResolveUsername(c *fiber.Ctx) error {
+	username := strings.TrimPrefix(strings.TrimSpace(c.Query("username")), "@")
+	if username == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "username parameter is required",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	userView := func(user *models.User) fiber.Map {
+		return fiber.Map{
+			"id":           user.ID,
+			"username":     user.Username,
+			"display_name": user.DisplayName,
+			"bio":          user.Bio,
+			"avatar":       user.Avatar,
+		}
+	}
+	visible := func(user *models.User) bool {
+		return user.Status != models.UserStatusDeactivated && user.DeletionScheduledAt == nil && user.DeletedAt == nil
+	}
+
+	if user, err := store.Users().GetByUsername(ctx, username); err == nil && visible(user) {
+		return c.JSON(fiber.Map{
+			"user":    userView(user),
+			"matched": "current",
+		})
+	}
+
+	former, err := reservedUsername(ctx, username)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resolve username",
+		})
+	}
+	if former == nil || !visible(former) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"user":            userView(former),
+		"matched":         "former",
+		"former_username": username,
+		"changed_at":      releasedAt(former, username),
+	})
+}
@@ -0,0 +1,163 @@
+// Package flags evaluates feature flags from an in-memory copy of the
+// feature_flags collection, so checks on hot paths like the hub never wait on
+// the database.
+package flags
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// flagTable holds the saved flags merged over the defaults
+type flagTable struct {
+	mu    sync.RWMutex
+	flags map[string]flag
+}
+
+// flag is a FeatureFlag with its allowlist indexed
+type flag struct {
+	models.FeatureFlag
+	users map[string]bool
+}
+
+func compile(f models.FeatureFlag) flag {
+	users := make(map[string]bool, len(f.Users))
+	for _, id := range f.Users {
+		users[id] = true
+	}
+	return flag{FeatureFlag: f, users: users}
+}
+
+func defaults() map[string]flag {
+	table := make(map[string]flag, len(models.DefaultFlags))
+	for _, f := range models.DefaultFlags {
+		table[f.Name] = compile(f)
+	}
+	return table
+}
+
+var table = &flagTable{flags: defaults()}
+
+// Refresh reloads the flags from the database, keeping the current copy if that fails
+func Refresh() {
+	// Flags are stored in MongoDB only, other backends run on the defaults
+	if config.DB == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("feature_flags").Find(ctx, bson.M{})
+	if err != nil {
+		log.Printf("Failed to load feature flags: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	flags := defaults()
+	for cursor.Next(ctx) {
+		var f models.FeatureFlag
+		if err := cursor.Decode(&f); err != nil {
+			continue
+		}
+		flags[f.Name] = compile(f)
+	}
+
+	table.mu.Lock()
+	table.flags = flags
+	table.mu.Unlock()
+}
+
+// Start loads the flags and keeps reloading them every FEATURE_FLAG_REFRESH,
+// so changes made on other instances take effect without a restart
+func Start() {
+	if config.DB == nil {
+		return
+	}
+	Refresh()
+
+	interval := config.GetDurationEnv("FEATURE_FLAG_REFRESH", 30*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			Refresh()
+		}
+	}()
+}
+
+// bucket places a user in 0-99 for a flag. Hashing the name along with the user
+// ID rolls different flags out to different users.
+func bucket(name, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + userID))
+	return int(h.Sum32() % 100)
+}
+
+// Enabled reports whether the flag is on for the user. Unknown flags are off.
+func Enabled(name, userID string) bool {
+	table.mu.RLock()
+	f, ok := table.flags[name]
+	table.mu.RUnlock()
+
+	switch {
+	case !ok || !f.Enabled:
+		return false
+	case f.users[userID]:
+		return true
+	case f.Percentage >= 100:
+		return true
+	case userID == "":
+		return false
+	}
+	return bucket(name, userID) < f.Percentage
+}
+
+// Evaluate returns every known flag for the user
+func Evaluate(userID string) map[string]bool {
+	table.mu.RLock()
+	names := make([]string, 0, len(table.flags))
+	for name := range table.flags {
+		names = append(names, name)
+	}
+	table.mu.RUnlock()
+
+	result := make(map[string]bool, len(names))
+	for _, name := range names {
+		result[name] = Enabled(name, userID)
+	}
+	return result
+}
+
+// List returns the flags in effect sorted by name, defaults included
+func List() []models.FeatureFlag {
+	table.mu.RLock()
+	list := make([]models.FeatureFlag, 0, len(table.flags))
+	for _, f := range table.flags {
+		list = append(list, f.FeatureFlag)
+	}
+	table.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// IsDefault reports whether name has a built-in default
+func IsDefault(name string) bool {
+	for _, f := range models.DefaultFlags {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package i18n
+
+// en is the default bundle and holds every key. Error messages are written in
+// English, so it needs no error translations.
+var en = bundle{
+	timeLayout: "2 Jan 2006 15:04 MST",
+	messages: map[string]string{
+		// System messages in rooms
+		"system.someone":               "Someone",
+		"system.room_created":          "%s created the room %q",
+		"system.member_joined":         "%s joined the room",
+		"system.member_added":          "%s added %s",
+		"system.member_left":           "%s left the room",
+		"system.member_removed":        "%s removed %s",
+		"system.room_renamed":          "%s renamed the room to %q",
+		"system.topic_changed":         "%s changed the topic to %q",
+		"system.topic_removed":         "%s removed the topic",
+		"system.disappearing_enabled":  "%s turned on disappearing messages. New messages disappear after %s",
+		"system.disappearing_disabled": "%s turned off disappearing messages",
+		"system.slow_mode_enabled":     "%s turned on slow mode. Members can send one message every %s",
+		"system.slow_mode_disabled":    "%s turned off slow mode",
+
+		// Durations
+		"duration.week.one":     "%d week",
+		"duration.week.other":   "%d weeks",
+		"duration.day.one":      "%d day",
+		"duration.day.other":    "%d days",
+		"duration.hour.one":     "%d hour",
+		"duration.hour.other":   "%d hours",
+		"duration.minute.one":   "%d minute",
+		"duration.minute.other": "%d minutes",
+		"duration.second.one":   "%d second",
+		"duration.second.other": "%d seconds",
+
+		// Notifications
+		"notification.title":        "New message",
+		"notification.encrypted":    "New encrypted message",
+		"notification.disappearing": "New disappearing message",
+
+		// Emails
+		"email.digest.subject":         "You have unread messages on NgobrolYuk",
+		"email.change_confirm.subject": "Confirm your new NgobrolYuk email address",
+		"email.change_notice.subject":  "Email change requested on your NgobrolYuk account",
+		"email.confirm_page.title":     "Confirm your new email address",
+		"email.confirm_page.text":      "Use %s as the email address of your NgobrolYuk account?",
+		"email.confirm_page.button":    "Confirm",
+
+		// Conversation export
+		"export.title":    "Conversation %s",
+		"export.exported": "Exported %s",
+		"export.time":     "Time",
+		"export.sender":   "Sender",
+		"export.message":  "Message",
+	},
+}
@@ -0,0 +1,124 @@
+// Package i18n translates text the server writes for people: system messages,
+// error messages, emails and push notifications.
+//
+// Text is looked up by key in the bundle of the reader's language. Keys missing
+// from that bundle fall back to English, which has every key, and error messages
+// are keyed by their English text so untranslated ones pass through unchanged.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// Supported languages, as ISO 639-1 codes
+const (
+	English    = "en"
+	Indonesian = "id"
+
+	// Default ends every fallback chain
+	Default = English
+)
+
+// bundle is the text of one language
+type bundle struct {
+	// Messages are fmt formats keyed by name, counted ones have ".one" and ".other" forms
+	messages map[string]string
+	// Errors translate API error messages, keyed by their English text
+	errors map[string]string
+	// Months replace English month names in formatted times
+	months *strings.Replacer
+	// TimeLayout formats times for this language
+	timeLayout string
+}
+
+var bundles = map[string]*bundle{
+	English:    &en,
+	Indonesian: &id,
+}
+
+// Languages lists the supported languages
+func Languages() []string {
+	return []string{English, Indonesian}
+}
+
+// Supported reports whether lang has its own bundle
+func Supported(lang string) bool {
+	_, ok := bundles[lang]
+	return ok
+}
+
+// Match returns the first supported language among the given preferences, each
+// a language tag like "id" or "en-US" or a whole Accept-Language header. Empty
+// preferences are skipped, Default is returned when none is supported.
+func Match(preferences ...string) string {
+	for _, preference := range preferences {
+		if preference == "" {
+			continue
+		}
+		tags, _, err := language.ParseAcceptLanguage(preference)
+		if err != nil {
+			continue
+		}
+		for _, tag := range tags {
+			base, _ := tag.Base()
+			if Supported(base.String()) {
+				return base.String()
+			}
+		}
+	}
+	return Default
+}
+
+func lookup(lang string) *bundle {
+	if b, ok := bundles[lang]; ok {
+		return b
+	}
+	return bundles[Default]
+}
+
+// T returns the text of key in lang formatted with args
+func T(lang, key string, args ...any) string {
+	format, ok := lookup(lang).messages[key]
+	if !ok {
+		if format, ok = bundles[Default].messages[key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// N returns the singular or plural text of key for n, n is the first argument
+// of the format
+func N(lang, key string, n int, args ...any) string {
+	form := ".other"
+	if n == 1 {
+		form = ".one"
+	}
+	return T(lang, key+form, append([]any{n}, args...)...)
+}
+
+// Error translates an API error message, returning it unchanged when lang has no
+// translation for it
+func Error(lang, message string) string {
+	if translated, ok := lookup(lang).errors[message]; ok {
+		return translated
+	}
+	return message
+}
+
+// FormatTime writes t as a date and time the way readers of lang expect
+func FormatTime(lang string, t time.Time) string {
+	b := lookup(lang)
+	formatted := t.Format(b.timeLayout)
+	if b.months != nil {
+		formatted = b.months.Replace(formatted)
+	}
+	return formatted
+}
@@ -0,0 +1,134 @@
+package i18n
+
+import "strings"
+
+// id is Indonesian. Nouns do not change with count, so counted keys use the same
+// text for both forms.
+var id = bundle{
+	timeLayout: "2 January 2006 15.04 MST",
+	months: strings.NewReplacer(
+		"January", "Januari", "February", "Februari", "March", "Maret", "May", "Mei",
+		"June", "Juni", "July", "Juli", "August", "Agustus", "October", "Oktober",
+		"December", "Desember",
+	),
+	messages: map[string]string{
+		// System messages in rooms
+		"system.someone":               "Seseorang",
+		"system.room_created":          "%s membuat room %q",
+		"system.member_joined":         "%s bergabung ke room",
+		"system.member_added":          "%s menambahkan %s",
+		"system.member_left":           "%s keluar dari room",
+		"system.member_removed":        "%s mengeluarkan %s",
+		"system.room_renamed":          "%s mengganti nama room menjadi %q",
+		"system.topic_changed":         "%s mengganti topik menjadi %q",
+		"system.topic_removed":         "%s menghapus topik",
+		"system.disappearing_enabled":  "%s mengaktifkan pesan sementara. Pesan baru hilang setelah %s",
+		"system.disappearing_disabled": "%s menonaktifkan pesan sementara",
+		"system.slow_mode_enabled":     "%s mengaktifkan slow mode. Member bisa mengirim satu pesan setiap %s",
+		"system.slow_mode_disabled":    "%s menonaktifkan slow mode",
+
+		// Durations
+		"duration.week.one":     "%d minggu",
+		"duration.week.other":   "%d minggu",
+		"duration.day.one":      "%d hari",
+		"duration.day.other":    "%d hari",
+		"duration.hour.one":     "%d jam",
+		"duration.hour.other":   "%d jam",
+		"duration.minute.one":   "%d menit",
+		"duration.minute.other": "%d menit",
+		"duration.second.one":   "%d detik",
+		"duration.second.other": "%d detik",
+
+		// Notifications
+		"notification.title":        "Pesan baru",
+		"notification.encrypted":    "Pesan terenkripsi baru",
+		"notification.disappearing": "Pesan sementara baru",
+
+		// Emails
+		"email.digest.subject":         "Ada pesan yang belum kamu baca di NgobrolYuk",
+		"email.change_confirm.subject": "Konfirmasi alamat email baru akun NgobrolYuk kamu",
+		"email.change_notice.subject":  "Permintaan ganti email di akun NgobrolYuk kamu",
+		"email.confirm_page.title":     "Konfirmasi alamat email baru",
+		"email.confirm_page.text":      "Pakai %s sebagai alamat email akun NgobrolYuk kamu?",
+		"email.confirm_page.button":    "Konfirmasi",
+
+		// Conversation export
+		"export.title":    "Percakapan %s",
+		"export.exported": "Diekspor %s",
+		"export.time":     "Waktu",
+		"export.sender":   "Pengirim",
+		"export.message":  "Pesan",
+	},
+	errors: map[string]string{
+		"Internal Server Error":                     "Terjadi kesalahan pada server",
+		"Invalid request format":                    "Format request tidak valid",
+		"Validation failed":                         "Validasi gagal",
+		"Invalid token":                             "Token tidak valid",
+		"Token expired":                             "Token sudah kedaluwarsa",
+		"Missing authentication token":              "Token autentikasi tidak ada",
+		"Origin not allowed":                        "Origin tidak diizinkan",
+		"Guest session expired":                     "Sesi guest sudah berakhir",
+		"Permission denied":                         "Akses ditolak",
+		"Too many requests, please try again later": "Terlalu banyak request, coba lagi nanti",
+		"Database error":                            "Kesalahan database",
+		"No fields to update":                       "Tidak ada field yang diubah",
+		"Invalid cursor":                            "Cursor tidak valid",
+
+		// Accounts
+		"User not found":                                              "User tidak ditemukan",
+		"Username already taken":                                      "Username sudah dipakai",
+		"Username or email already taken":                             "Username atau email sudah dipakai",
+		"Email already registered":                                    "Email sudah terdaftar",
+		"Invalid login or password":                                   "Login atau password salah",
+		"Invalid password":                                            "Password salah",
+		"Account no longer exists":                                    "Akun sudah tidak ada",
+		"Account deactivated":                                         "Akun dinonaktifkan",
+		"Failed to update profile":                                    "Gagal memperbarui profil",
+		"Failed to create user":                                       "Gagal membuat user",
+		"Failed to generate token":                                    "Gagal membuat token",
+		"Display name too long (max 50 characters)":                   "Display name terlalu panjang (maks 50 karakter)",
+		"Bio too long (max 500 characters)":                           "Bio terlalu panjang (maks 500 karakter)",
+		"Unsupported language":                                        "Bahasa tidak didukung",
+		"Username must be 3-20 characters":                            "Username harus 3-20 karakter",
+		"Invalid email format":                                        "Format email tidak valid",
+		"Password must be at least 6 characters":                      "Password minimal 6 karakter",
+		"Password is required":                                        "Password wajib diisi",
+		"Username can only contain letters, numbers, and underscores": "Username hanya boleh berisi huruf, angka, dan garis bawah",
+
+		// Chat
+		"user_id parameter is required":               "Parameter user_id wajib diisi",
+		"Message not found":                           "Pesan tidak ditemukan",
+		"Invalid message ID":                          "ID pesan tidak valid",
+		"Conversation not found":                      "Percakapan tidak ditemukan",
+		"Failed to fetch messages":                    "Gagal mengambil pesan",
+		"Failed to fetch conversations":               "Gagal mengambil percakapan",
+		"Failed to search conversations":              "Gagal mencari percakapan",
+		"Search query is required":                    "Kata pencarian wajib diisi",
+		"Failed to update read position":              "Gagal memperbarui posisi baca",
+		"Message is not pinned":                       "Pesan tidak di-pin",
+		"Message already pinned or pin limit reached": "Pesan sudah di-pin atau batas pin tercapai",
+		"Message request not found":                   "Permintaan pesan tidak ditemukan",
+
+		// Rooms, labels and contacts
+		"Room not found":                          "Room tidak ditemukan",
+		"User is not a member of this room":       "User bukan anggota room ini",
+		"Invite not found":                        "Undangan tidak ditemukan",
+		"Label not found":                         "Label tidak ditemukan",
+		"You already have a label with this name": "Kamu sudah punya label dengan nama ini",
+		"Contact not found":                       "Kontak tidak ditemukan",
+		"Attachment not found":                    "Lampiran tidak ditemukan",
+		"slow_mode must be between 0 and 6 hours": "slow_mode harus antara 0 dan 6 jam",
+		"Invalid attachment ID":                   "ID lampiran tidak valid",
+		"Attachment rejected, malware detected":   "Lampiran ditolak, terdeteksi malware",
+		"Attachment is still being scanned":       "Lampiran masih diperiksa",
+
+		// Integrations
+		"Missing API key":                   "API key tidak ada",
+		"Invalid API key":                   "API key tidak valid",
+		"Integration revoked":               "Integrasi sudah dicabut",
+		"Token limited to one conversation": "Token hanya berlaku untuk satu percakapan",
+		"A conversation token is required":  "Butuh conversation token",
+		"External user is not mapped":       "User eksternal belum di-mapping",
+		"Peer external user is not mapped":  "User eksternal lawan bicara belum di-mapping",
+	},
+}
@@ -0,0 +1,66 @@
+// Package importer migrates chat history exported from other chat apps.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Supported export formats
+const (
+	FormatWhatsApp = "whatsapp" // "Export chat" .txt file
+	FormatTelegram = "telegram" // Telegram Desktop result.json
+)
+
+// ImportedMessage is one message from an export, before senders are mapped to users
+type ImportedMessage struct {
+	SourceID   string // Stable ID within the export, so re-imports skip the message
+	Sender     string // Display name as it appears in the export
+	Timestamp  time.Time
+	Content    string
+	Attachment string // Attached file name, if any
+}
+
+// Chat is a parsed export of a single conversation
+type Chat struct {
+	Format   string
+	SourceID string // Stable ID of the chat in the other app, empty if the export has none
+	Name     string
+	Messages []ImportedMessage
+}
+
+// Senders returns the distinct sender names in order of first appearance
+func (c *Chat) Senders() []string {
+	seen := make(map[string]bool)
+	var senders []string
+	for _, m := range c.Messages {
+		if !seen[m.Sender] {
+			seen[m.Sender] = true
+			senders = append(senders, m.Sender)
+		}
+	}
+	return senders
+}
+
+// ParseOptions tune format-specific parsing
+type ParseOptions struct {
+	DayFirst bool           // WhatsApp dates are DD/MM instead of MM/DD
+	Location *time.Location // Time zone of export timestamps, defaults to local
+}
+
+// Parse reads an export file in the given format
+func Parse(format string, r io.Reader, opts ParseOptions) (*Chat, error) {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+
+	switch format {
+	case FormatWhatsApp:
+		return parseWhatsApp(r, opts)
+	case FormatTelegram:
+		return parseTelegram(r, opts)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type telegramExport struct {
+	ID       int64             `json:"id"`
+	Name     string            `json:"name"`
+	Messages []telegramMessage `json:"messages"`
+}
+
+type telegramMessage struct {
+	ID    int64           `json:"id"`
+	Type  string          `json:"type"`
+	Date  string          `json:"date"`
+	From  string          `json:"from"`
+	Text  json.RawMessage `json:"text"`
+	Photo string          `json:"photo"`
+	File  string          `json:"file"`
+}
+
+func parseTelegram(r io.Reader, opts ParseOptions) (*Chat, error) {
+	var export telegramExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid Telegram export: %w", err)
+	}
+
+	chat := &Chat{Format: FormatTelegram, Name: export.Name}
+	if export.ID != 0 {
+		chat.SourceID = strconv.FormatInt(export.ID, 10)
+	}
+	if chat.Name == "" {
+		chat.Name = "Telegram import"
+	}
+
+	for _, m := range export.Messages {
+		// Service messages (joins, pins, calls) have no sender
+		if m.Type != "message" || m.From == "" {
+			continue
+		}
+
+		timestamp, err := time.ParseInLocation("2006-01-02T15:04:05", m.Date, opts.Location)
+		if err != nil {
+			return nil, fmt.Errorf("message dated %q: %w", m.Date, err)
+		}
+
+		msg := ImportedMessage{
+			SourceID:  strconv.FormatInt(m.ID, 10),
+			Sender:    m.From,
+			Timestamp: timestamp,
+			Content:   telegramText(m.Text),
+		}
+		if m.Photo != "" {
+			msg.Attachment = path.Base(m.Photo)
+		} else if m.File != "" {
+			msg.Attachment = path.Base(m.File)
+		}
+
+		chat.Messages = append(chat.Messages, msg)
+	}
+
+	return chat, nil
+}
+
+// telegramText flattens "text", which is either a string or a list of strings and formatted spans
+func telegramText(raw json.RawMessage) string {
+	var plain string
+	if err := json.Unmarshal(raw, &plain); err == nil {
+		return plain
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, part := range parts {
+		var s string
+		if err := json.Unmarshal(part, &s); err == nil {
+			b.WriteString(s)
+			continue
+		}
+
+		var span struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(part, &span); err == nil {
+			b.WriteString(span.Text)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,116 @@
+package importer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Matches both Android ("31/12/21, 22:15 - ") and iOS ("[31/12/21, 22:15:30] ") line prefixes
+var whatsAppLine = regexp.MustCompile(
+	`^\[?(\d{1,2})[/.-](\d{1,2})[/.-](\d{2,4}),?\s+(\d{1,2})[:.](\d{2})(?:[:.](\d{2}))?\s?([AaPp]\.?[Mm]\.?)?\]?(?:\s+-)?\s+(.*)$`)
+
+var whatsAppAttachment = regexp.MustCompile(`^<attached: (.+)>$|^(.+\.\w+) \(file attached\)$`)
+
+func parseWhatsApp(r io.Reader, opts ParseOptions) (*Chat, error) {
+	chat := &Chat{Format: FormatWhatsApp, Name: "WhatsApp import"}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var current *ImportedMessage
+	flush := func() {
+		if current != nil {
+			chat.Messages = append(chat.Messages, *current)
+			current = nil
+		}
+	}
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimLeft(scanner.Text(), "\u200e\ufeff")
+
+		match := whatsAppLine.FindStringSubmatch(line)
+		if match == nil {
+			// Continuation of a multi-line message
+			if current != nil {
+				current.Content += "\n" + line
+			}
+			continue
+		}
+
+		flush()
+
+		timestamp, err := whatsAppTime(match, opts)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		// System notices ("Messages are end-to-end encrypted") have no sender
+		sender, content, ok := strings.Cut(match[8], ": ")
+		if !ok {
+			continue
+		}
+
+		current = &ImportedMessage{Sender: strings.TrimSpace(sender), Timestamp: timestamp, Content: content}
+		if att := whatsAppAttachment.FindStringSubmatch(strings.TrimLeft(content, "\u200e")); att != nil {
+			current.Attachment = att[1] + att[2]
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// WhatsApp exports carry no message IDs, identify messages by what they say
+	// and count repeats so identical messages sent in the same minute stay apart
+	seen := make(map[string]int)
+	for i := range chat.Messages {
+		m := &chat.Messages[i]
+		sum := sha256.Sum256([]byte(m.Timestamp.UTC().Format(time.RFC3339) + "\x00" + m.Sender + "\x00" + m.Content))
+		key := hex.EncodeToString(sum[:16])
+		m.SourceID = fmt.Sprintf("%s-%d", key, seen[key])
+		seen[key]++
+	}
+
+	return chat, nil
+}
+
+func whatsAppTime(match []string, opts ParseOptions) (time.Time, error) {
+	a, _ := strconv.Atoi(match[1])
+	b, _ := strconv.Atoi(match[2])
+	year, _ := strconv.Atoi(match[3])
+	hour, _ := strconv.Atoi(match[4])
+	minute, _ := strconv.Atoi(match[5])
+	second, _ := strconv.Atoi(match[6])
+
+	month, day := a, b
+	if opts.DayFirst {
+		month, day = b, a
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	if meridiem := strings.ToLower(strings.ReplaceAll(match[7], ".", "")); meridiem != "" {
+		if hour == 12 {
+			hour = 0
+		}
+		if meridiem == "pm" {
+			hour += 12
+		}
+	}
+
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("invalid date %s/%s (try the other day/month order)", match[1], match[2])
+	}
+
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, opts.Location), nil
+}
@@ -0,0 +1,326 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultBatchSize is how many messages are written per bulk write
+const DefaultBatchSize = 1000
+
+// Importer writes a parsed chat into the database
+type Importer struct {
+	DB *mongo.Database
+
+	// UserMap maps export display names to existing user IDs. Unmapped senders
+	// are matched by username, then created as placeholder users.
+	UserMap map[string]string
+
+	// Participants are added to the conversation even if they never wrote in it
+	Participants []string
+
+	BatchSize int
+	DryRun    bool
+}
+
+// Stats summarizes an import run
+type Stats struct {
+	Messages         int
+	AlreadyImported  int // Messages skipped because an earlier run imported them
+	PlaceholderUsers int
+	ConversationID   string // Direct conversation ID or room ID
+	IsRoom           bool
+	Senders          map[string]string // Display name -> user ID
+}
+
+// Run maps senders, creates the conversation or room, and bulk inserts the messages.
+// Messages and rooms are keyed by their ID in the export, so running it again for
+// the same export only adds what is new.
+func (im *Importer) Run(ctx context.Context, chat *Chat) (*Stats, error) {
+	if len(chat.Messages) == 0 {
+		return nil, fmt.Errorf("export contains no messages")
+	}
+
+	stats := &Stats{Senders: make(map[string]string)}
+
+	for _, name := range chat.Senders() {
+		userID, created, err := im.resolveSender(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("sender %q: %w", name, err)
+		}
+		stats.Senders[name] = userID
+		if created {
+			stats.PlaceholderUsers++
+		}
+	}
+
+	participants := im.participants(chat, stats.Senders)
+	if len(participants) < 2 {
+		return nil, fmt.Errorf("need at least two participants, map the other user with -participants")
+	}
+
+	chatKey := importChatKey(chat)
+
+	var roomID string
+	if len(participants) == 2 {
+		stats.ConversationID = models.ConversationID(participants[0], participants[1])
+	} else {
+		var err error
+		if roomID, err = im.ensureRoom(ctx, chatKey, chat, participants); err != nil {
+			return nil, err
+		}
+		stats.IsRoom = true
+		stats.ConversationID = roomID
+	}
+
+	messages := make([]models.Message, 0, len(chat.Messages))
+	for _, m := range chat.Messages {
+		senderID := stats.Senders[m.Sender]
+
+		content := m.Content
+		if m.Attachment != "" {
+			content = strings.TrimSpace(fmt.Sprintf("[attachment: %s] %s", m.Attachment, stripAttachmentMarker(m.Content)))
+		}
+		if content == "" {
+			continue
+		}
+
+		message := models.Message{
+			ID:        primitive.NewObjectID(),
+			SenderID:  senderID,
+			RoomID:    roomID,
+			Content:   content,
+			Type:      models.MessageTypeText,
+			Read:      true, // Historical messages never show up as unread
+			CreatedAt: m.Timestamp,
+			ImportKey: chatKey + ":" + m.SourceID,
+		}
+		if !stats.IsRoom {
+			message.ReceiverID = otherParticipant(participants, senderID)
+		}
+
+		messages = append(messages, message)
+	}
+	if im.DryRun {
+		stats.Messages = len(messages)
+		return stats, nil
+	}
+
+	if !stats.IsRoom {
+		if err := im.ensureConversation(ctx, stats.ConversationID, participants, chat.Messages[0].Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	for start := 0; start < len(messages); start += batchSize {
+		end := start + batchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		writes := make([]mongo.WriteModel, 0, end-start)
+		for _, message := range messages[start:end] {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"import_key": message.ImportKey}).
+				SetUpdate(bson.M{"$setOnInsert": message}).
+				SetUpsert(true))
+		}
+
+		result, err := im.DB.Collection("messages").BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return nil, fmt.Errorf("inserting messages %d-%d: %w", start, end, err)
+		}
+		stats.Messages += int(result.UpsertedCount)
+		stats.AlreadyImported += int(result.MatchedCount)
+	}
+
+	return stats, nil
+}
+
+func (im *Importer) participants(chat *Chat, senders map[string]string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for _, name := range chat.Senders() {
+		add(senders[name])
+	}
+	for _, id := range im.Participants {
+		add(id)
+	}
+	return ids
+}
+
+// resolveSender returns the user ID for a display name, creating a placeholder user if needed
+func (im *Importer) resolveSender(ctx context.Context, name string) (string, bool, error) {
+	if id, ok := im.UserMap[name]; ok {
+		count, err := im.DB.Collection("users").CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return "", false, err
+		}
+		if count == 0 {
+			return "", false, fmt.Errorf("mapped user %s not found", id)
+		}
+		return id, false, nil
+	}
+
+	var existing models.User
+	err := im.DB.Collection("users").FindOne(ctx, bson.M{
+		"username_canonical": models.CanonicalUsername(name),
+		"deleted_at":         bson.M{"$exists": false},
+	}).Decode(&existing)
+	if err == nil {
+		return existing.ID, false, nil
+	} else if err != mongo.ErrNoDocuments {
+		return "", false, err
+	}
+
+	if im.DryRun {
+		return "placeholder:" + name, true, nil
+	}
+
+	// Placeholder users cannot log in (no password) and stay hidden from user lists
+	id := config.GetNextUserID()
+	now := time.Now()
+	placeholder := models.User{
+		ID:                id,
+		Username:          fmt.Sprintf("imported_%s", id),
+		Email:             fmt.Sprintf("imported_%s@imported.invalid", id),
+		Bio:               fmt.Sprintf("Imported from chat export as %q", name),
+		Status:            models.UserStatusDeactivated,
+		HideFromDiscovery: true,
+		LastSeen:          now,
+		CreatedAt:         now,
+	}
+	placeholder.Canonicalize()
+
+	if _, err := im.DB.Collection("users").InsertOne(ctx, placeholder); err != nil {
+		return "", false, err
+	}
+
+	return id, true, nil
+}
+
+func (im *Importer) ensureConversation(ctx context.Context, conversationID string, participants []string, createdAt time.Time) error {
+	_, err := im.DB.Collection("conversations").UpdateOne(ctx,
+		bson.M{"_id": conversationID},
+		bson.M{"$setOnInsert": bson.M{"participants": participants, "created_at": createdAt}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// importChatKey identifies the exported chat, WhatsApp exports have no chat ID so
+// their first message stands in for it
+func importChatKey(chat *Chat) string {
+	if chat.SourceID != "" {
+		return chat.Format + ":" + chat.SourceID
+	}
+	return chat.Format + ":" + chat.Messages[0].SourceID
+}
+
+// ensureRoom returns the room an earlier run created for the chat, adding senders
+// that were not members yet, or creates it
+func (im *Importer) ensureRoom(ctx context.Context, chatKey string, chat *Chat, participants []string) (string, error) {
+	var existing models.Room
+	err := im.DB.Collection("rooms").FindOne(ctx, bson.M{"import_key": chatKey}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		if im.DryRun {
+			return primitive.NewObjectID().Hex(), nil
+		}
+		return im.createRoom(ctx, chatKey, chat, participants)
+	} else if err != nil {
+		return "", err
+	}
+
+	if im.DryRun {
+		return existing.ID.Hex(), nil
+	}
+
+	joinedAt := chat.Messages[0].Timestamp
+	for _, id := range participants {
+		if existing.Member(id) != nil {
+			continue
+		}
+		member := models.RoomMember{UserID: id, Role: models.RoomRoleMember, JoinedAt: joinedAt, LastReadAt: time.Now()}
+		_, err := im.DB.Collection("rooms").UpdateOne(ctx,
+			bson.M{"_id": existing.ID, "members.user_id": bson.M{"$ne": id}},
+			bson.M{"$push": bson.M{"members": member}},
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return existing.ID.Hex(), nil
+}
+
+func (im *Importer) createRoom(ctx context.Context, chatKey string, chat *Chat, participants []string) (string, error) {
+	createdAt := chat.Messages[0].Timestamp
+	updatedAt := chat.Messages[len(chat.Messages)-1].Timestamp
+
+	members := make([]models.RoomMember, 0, len(participants))
+	for i, id := range participants {
+		role := models.RoomRoleMember
+		if i == 0 {
+			role = models.RoomRoleOwner
+		}
+		members = append(members, models.RoomMember{UserID: id, Role: role, JoinedAt: createdAt, LastReadAt: updatedAt})
+	}
+
+	name := chat.Name
+	if utf8.RuneCountInString(name) > 100 {
+		name = string([]rune(name)[:100])
+	}
+
+	room := models.Room{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Topic:     "Imported chat history",
+		OwnerID:   participants[0],
+		Members:   members,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+		ImportKey: chatKey,
+	}
+
+	if _, err := im.DB.Collection("rooms").InsertOne(ctx, room); err != nil {
+		return "", err
+	}
+	return room.ID.Hex(), nil
+}
+
+func otherParticipant(participants []string, senderID string) string {
+	if participants[0] == senderID {
+		return participants[1]
+	}
+	return participants[0]
+}
+
+func stripAttachmentMarker(content string) string {
+	content = strings.TrimLeft(content, "\u200e")
+	if whatsAppAttachment.MatchString(content) {
+		return ""
+	}
+	return content
+}
@@ -0,0 +1,78 @@
+// Package mailer sends transactional emails over SMTP.
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+	"sync"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+)
+
+// Mailer sends a plain-text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends through an SMTP relay with PLAIN auth
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(fmt.Sprintf("%s:%s", m.Host, m.Port), auth, m.From, []string{to}, []byte(msg))
+}
+
+// logMailer is used when SMTP is not configured
+type logMailer struct{}
+
+func (logMailer) Send(to, subject, body string) error {
+	log.Printf("Email (SMTP not configured) to %s: %s", to, subject)
+	return nil
+}
+
+var (
+	defaultMailer Mailer
+	defaultOnce   sync.Once
+)
+
+// Default returns the mailer configured from SMTP_* env vars
+func Default() Mailer {
+	defaultOnce.Do(func() {
+		host := config.GetEnvWithDefault("SMTP_HOST", "")
+		if host == "" {
+			defaultMailer = logMailer{}
+			return
+		}
+
+		defaultMailer = &SMTPMailer{
+			Host:     host,
+			Port:     config.GetEnvWithDefault("SMTP_PORT", "587"),
+			Username: config.GetEnvWithDefault("SMTP_USERNAME", ""),
+			Password: config.GetEnvWithDefault("SMTP_PASSWORD", ""),
+			From:     config.GetEnvWithDefault("SMTP_FROM", "NgobrolYuk <no-reply@ngobrolyuk.local>"),
+		}
+	})
+	return defaultMailer
+}
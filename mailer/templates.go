@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+)
+
+// localized parses one template per language. formatTime writes times the way
+// readers of that language expect.
+func localized(name string, texts map[string]string) map[string]*template.Template {
+	templates := make(map[string]*template.Template, len(texts))
+	for lang, text := range texts {
+		funcs := template.FuncMap{
+			"formatTime": func(t time.Time) string { return i18n.FormatTime(lang, t) },
+		}
+		templates[lang] = template.Must(template.New(name + "_" + lang).Funcs(funcs).Parse(text))
+	}
+	return templates
+}
+
+// render executes the template of lang, or of i18n.Default when lang has none
+func render(templates map[string]*template.Template, lang string, data any) (string, error) {
+	tmpl, ok := templates[lang]
+	if !ok {
+		tmpl = templates[i18n.Default]
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
+
+// DigestData fills the missed-messages digest template
+type DigestData struct {
+	Language       string
+	Username       string
+	UnreadCount    int
+	SenderCount    int
+	Senders        []string
+	AppURL         string
+	UnsubscribeURL string
+}
+
+var digestTemplates = localized("digest", map[string]string{
+	i18n.English: `Hi {{.Username}},
+
+You have {{.UnreadCount}} unread {{if eq .UnreadCount 1}}message{{else}}messages{{end}} from {{.SenderCount}} {{if eq .SenderCount 1}}person{{else}}people{{end}}{{if .Senders}} ({{range $i, $s := .Senders}}{{if $i}}, {{end}}{{$s}}{{end}}){{end}}.
+
+Open NgobrolYuk to catch up: {{.AppURL}}
+
+--
+You are receiving this because email digests are enabled for your account.
+Unsubscribe: {{.UnsubscribeURL}}
+`,
+	i18n.Indonesian: `Hai {{.Username}},
+
+Ada {{.UnreadCount}} pesan yang belum kamu baca dari {{.SenderCount}} orang{{if .Senders}} ({{range $i, $s := .Senders}}{{if $i}}, {{end}}{{$s}}{{end}}){{end}}.
+
+Buka NgobrolYuk untuk membacanya: {{.AppURL}}
+
+--
+Kamu menerima email ini karena ringkasan email aktif di akunmu.
+Berhenti berlangganan: {{.UnsubscribeURL}}
+`,
+})
+
+// RenderDigest returns the subject and body of a digest email
+func RenderDigest(data DigestData) (string, string, error) {
+	body, err := render(digestTemplates, data.Language, data)
+	if err != nil {
+		return "", "", err
+	}
+	return i18n.T(data.Language, "email.digest.subject"), body, nil
+}
+
+// EmailChangeData fills the email change templates
+type EmailChangeData struct {
+	Language   string
+	Username   string
+	NewEmail   string
+	ConfirmURL string
+	ExpiresAt  time.Time
+}
+
+var emailChangeConfirmTemplates = localized("email_change_confirm", map[string]string{
+	i18n.English: `Hi {{.Username}},
+
+Confirm {{.NewEmail}} as the new email address of your NgobrolYuk account by opening this link:
+
+{{.ConfirmURL}}
+
+The link expires on {{formatTime .ExpiresAt}}. Your current address stays in use until then.
+
+--
+If you didn't ask for this, ignore this email and nothing will change.
+`,
+	i18n.Indonesian: `Hai {{.Username}},
+
+Konfirmasi {{.NewEmail}} sebagai alamat email baru akun NgobrolYuk kamu dengan membuka link ini:
+
+{{.ConfirmURL}}
+
+Link berlaku sampai {{formatTime .ExpiresAt}}. Sampai saat itu alamat yang sekarang tetap dipakai.
+
+--
+Jika kamu tidak memintanya, abaikan email ini dan tidak ada yang berubah.
+`,
+})
+
+var emailChangeNoticeTemplates = localized("email_change_notice", map[string]string{
+	i18n.English: `Hi {{.Username}},
+
+Someone asked to change the email address of your NgobrolYuk account to {{.NewEmail}}.
+
+Nothing changes until the new address is confirmed. If this wasn't you, change your password now, the request was made with it.
+`,
+	i18n.Indonesian: `Hai {{.Username}},
+
+Seseorang meminta alamat email akun NgobrolYuk kamu diganti menjadi {{.NewEmail}}.
+
+Tidak ada yang berubah sampai alamat baru dikonfirmasi. Jika ini bukan kamu, segera ganti password, permintaan ini dibuat dengan password tersebut.
+`,
+})
+
+// RenderEmailChangeConfirm returns the subject and body of the email asking the new
+// address to confirm an email change
+func RenderEmailChangeConfirm(data EmailChangeData) (string, string, error) {
+	body, err := render(emailChangeConfirmTemplates, data.Language, data)
+	if err != nil {
+		return "", "", err
+	}
+	return i18n.T(data.Language, "email.change_confirm.subject"), body, nil
+}
+
+// RenderEmailChangeNotice returns the subject and body of the email telling the
+// current address about a requested change
+func RenderEmailChangeNotice(data EmailChangeData) (string, string, error) {
+	body, err := render(emailChangeNoticeTemplates, data.Language, data)
+	if err != nil {
+		return "", "", err
+	}
+	return i18n.T(data.Language, "email.change_notice.subject"), body, nil
+}
@@ -1,23 +1,75 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
+	"runtime"
 	"syscall"
+	"time"
 
+	"github.com/Adisonsmn/ngobrolyuk/atrest"
+	"github.com/Adisonsmn/ngobrolyuk/coldstore"
 	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/controllers"
+	"github.com/Adisonsmn/ngobrolyuk/flags"
+	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/migrations"
+	"github.com/Adisonsmn/ngobrolyuk/outbox"
 	"github.com/Adisonsmn/ngobrolyuk/routes"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/Adisonsmn/ngobrolyuk/store/memstore"
+	"github.com/Adisonsmn/ngobrolyuk/store/mongostore"
+	"github.com/Adisonsmn/ngobrolyuk/store/pgstore"
+	"github.com/Adisonsmn/ngobrolyuk/telemetry"
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
-	// Connect to database
-	config.ConnectDB()
-	defer config.DisconnectDB()
+	config.LoadEnv()
+
+	// Refuse CORS and cookie settings browsers would reject or silently drop
+	if err := config.CORS().Validate(); err != nil {
+		log.Fatalf("Invalid CORS configuration: %v", err)
+	}
+	if err := config.Cookies().Validate(); err != nil {
+		log.Fatalf("Invalid cookie configuration: %v", err)
+	}
+
+	// Tracing is a no-op unless an OTLP endpoint is configured
+	shutdownTracing, err := telemetry.Init(context.Background())
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
+	// Connect to the configured storage backend
+	switch backend := config.GetEnvWithDefault("STORAGE", "mongo"); backend {
+	case "mongo":
+		connectMongo()
+		defer config.DisconnectDB()
+	case "postgres":
+		db := connectPostgres()
+		defer db.Close(context.Background())
+	case "memory":
+		// Nothing is persisted, for local demos and tests
+		store.Use(memstore.New())
+		log.Println("Using in-memory storage, data is lost on restart")
+	default:
+		log.Fatalf("Unknown STORAGE %q (expected mongo, postgres or memory)", backend)
+	}
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
+		// Room for the largest attachment plus the multipart envelope
+		BodyLimit: controllers.AttachmentMaxSize() + 1<<20,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			message := "Internal Server Error"
@@ -39,6 +91,31 @@ func main() {
 		AppName:      "NgobrolYuk v1.0",
 	})
 
+	// WebSocket sessions are split over shards, one event loop per CPU by default
+	controllers.StartHub(config.GetIntEnv("HUB_SHARDS", runtime.GOMAXPROCS(0)))
+	controllers.StartMessageExpiryWorker()
+	controllers.StartPresenceReconciler()
+
+	// Feature flags are read from memory, reloaded in the background
+	flags.Start()
+
+	// Bans and roles are checked against in-memory copies, reloaded in the background
+	middleware.StartBanRefresh()
+	middleware.StartRoleRefresh()
+
+	// Publish outbox events to external systems, safe to run on every instance
+	outbox.Start()
+
+	// Start background jobs (they work on MongoDB-only collections)
+	if config.DB != nil {
+		controllers.StartAccountDeletionWorker()
+		controllers.RestoreSpamRestrictions()
+		controllers.StartDigestWorker()
+		controllers.StartStatsRollupWorker()
+		controllers.StartMessageArchiver()
+		controllers.StartAttachmentScanWorker()
+	}
+
 	// Setup routes
 	routes.SetupRoutes(app)
 
@@ -52,6 +129,12 @@ func main() {
 	go func() {
 		<-c
 		log.Println("Shutting down server...")
+
+		// Let WebSocket clients know before their connections drop
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		controllers.DefaultHub().Shutdown(ctx)
+		cancel()
+
 		app.Shutdown()
 	}()
 
@@ -61,3 +144,59 @@ func main() {
 		log.Fatal("Server failed to start:", err)
 	}
 }
+
+// migrateOnStart reports whether pending schema migrations are applied at startup
+// (disable when running `migrate up` as a deploy step)
+func migrateOnStart() bool {
+	return config.GetEnvWithDefault("MIGRATE_ON_START", "true") == "true"
+}
+
+func connectMongo() {
+	config.ConnectDB()
+	store.Use(mongostore.New(config.DB))
+
+	if _, err := atrest.Setup(config.DB); err != nil {
+		log.Fatal("Failed to set up message encryption:", err)
+	}
+
+	if err := coldstore.Setup(config.DB, config.GetEnvWithDefault("MESSAGE_ARCHIVE_TARGET", "mongo")); err != nil {
+		log.Fatal("Failed to set up message archive:", err)
+	}
+
+	if migrateOnStart() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		// Waits for another instance that is still migrating, serving traffic
+		// against a half-migrated schema is worse than failing to start
+		if _, err := migrations.Up(ctx, config.DB, 0); err != nil {
+			log.Fatal("Failed to apply migrations:", err)
+		}
+	}
+}
+
+// connectPostgres serves users, direct messages and conversations from PostgreSQL,
+// MongoDB-only features are disabled
+func connectPostgres() *pgstore.Store {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		log.Fatal("POSTGRES_URL environment variable is required when STORAGE=postgres")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	db, err := pgstore.Open(ctx, url)
+	if err != nil {
+		log.Fatal("Failed to connect to PostgreSQL:", err)
+	}
+	log.Println("Successfully connected to PostgreSQL")
+
+	if migrateOnStart() {
+		if _, err := db.Migrate(ctx); err != nil {
+			log.Fatal("Failed to apply migrations:", err)
+		}
+	}
+
+	store.Use(db)
+	return db
+}
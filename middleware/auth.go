@@ -6,13 +6,38 @@ import (
 	"os"
 	"time"
 
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Protect accepts full sessions only, conversation tokens are rejected
 func Protect(c *fiber.Ctx) error {
+	return authenticate(c, false)
+}
+
+// ProtectConversation also accepts conversation tokens minted by an integration,
+// which are limited to the conversation in ConversationScope
+func ProtectConversation(c *fiber.Ctx) error {
+	return authenticate(c, true)
+}
+
+func authenticate(c *fiber.Ctx, allowScoped bool) error {
+	// Embedded widgets cannot set headers on a WebSocket, so conversation tokens
+	// may also come in the query string. It wins over a session cookie the browser
+	// may hold, the widget must not end up with the full session.
+	fromQuery := false
+	tokenStr := ""
+	if allowScoped {
+		tokenStr = c.Query("token")
+		fromQuery = tokenStr != ""
+	}
+
 	// Get token from cookie
-	tokenStr := c.Cookies("jwt")
+	if tokenStr == "" {
+		tokenStr = c.Cookies("jwt")
+	}
 
 	// If no cookie, try Authorization header
 	if tokenStr == "" {
@@ -77,9 +102,63 @@ func Protect(c *fiber.Ctx) error {
 		})
 	}
 
+	// Conversation tokens only work where the route allows them, and only while the
+	// integration that minted them is active and still maps the user
+	scope, _ := claims["conversation_id"].(string)
+	integrationID, _ := claims["integration_id"].(string)
+	if scope != "" {
+		if !allowScoped {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Token limited to one conversation",
+			})
+		}
+		if !checkConversationToken(c.UserContext(), integrationID, userID) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Integration revoked",
+			})
+		}
+	} else if fromQuery {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Only conversation tokens are accepted in the query string",
+		})
+	}
+
+	// Reject banned users, IPs, and devices
+	if reason, banned := CheckBan(c.IP(), userID, deviceFingerprint(c)); banned {
+		return bannedResponse(c, reason)
+	}
+
+	// Reject tokens of accounts that have been deleted
+	user, err := store.Users().GetByID(c.UserContext(), userID)
+	if err != nil || user.DeletedAt != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Account no longer exists",
+		})
+	}
+
+	// Deactivated accounts sign in again to reactivate, their other sessions end
+	if user.Status == models.UserStatusDeactivated {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Account deactivated",
+		})
+	}
+
+	// Guest sessions end when the guest account expires
+	if user.GuestExpiresAt != nil && time.Now().After(*user.GuestExpiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Guest session expired",
+		})
+	}
+
 	// Store user info in context
 	c.Locals("user_id", userID)
 	c.Locals("jwt_exp", exp)
+	c.Locals("guest", user.IsGuest())
+	c.Locals("language_setting", user.Language)
+	if scope != "" {
+		c.Locals("conversation_scope", scope)
+		c.Locals("integration_id", integrationID)
+	}
 
 	return c.Next()
 }
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/Adisonsmn/ngobrolyuk/store/memstore"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+// useTestStore installs an empty in-memory store holding the given users
+func useTestStore(t *testing.T, users ...*models.User) {
+	t.Helper()
+	os.Setenv("JWT_SECRET", testSecret)
+
+	store.Use(memstore.New())
+	for _, user := range users {
+		if user.Email == "" {
+			user.Email = user.ID + "@example.com"
+		}
+		if user.Username == "" {
+			user.Username = "user" + user.ID
+		}
+		if err := store.Users().Create(context.Background(), user); err != nil {
+			t.Fatalf("creating user %s: %v", user.ID, err)
+		}
+	}
+}
+
+func signToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func sessionToken(t *testing.T, userID string) string {
+	return signToken(t, testSecret, jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+}
+
+// protectedApp serves GET /me behind Protect and GET /scoped behind ProtectConversation
+func protectedApp() *fiber.App {
+	app := fiber.New()
+	me := func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("user_id").(string))
+	}
+	app.Get("/me", Protect, me)
+	app.Get("/scoped", ProtectConversation, me)
+	return app
+}
+
+func do(t *testing.T, app *fiber.App, req *http.Request) int {
+	t.Helper()
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func bearer(path, token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestProtect(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	useTestStore(t,
+		&models.User{ID: "001", Status: models.UserStatusActive},
+		&models.User{ID: "002", Status: models.UserStatusDeactivated},
+		&models.User{ID: "003", Status: models.UserStatusActive, DeletedAt: &past},
+		&models.User{ID: "004", Status: models.UserStatusActive, GuestExpiresAt: &past},
+		&models.User{ID: "005", Status: models.UserStatusActive, DeletionScheduledAt: &future},
+	)
+	app := protectedApp()
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"valid session", sessionToken(t, "001"), fiber.StatusOK},
+		{"missing token", "", fiber.StatusUnauthorized},
+		{"malformed token", "not-a-jwt", fiber.StatusUnauthorized},
+		{"wrong secret", signToken(t, "other-secret", jwt.MapClaims{"user_id": "001", "exp": future.Unix()}), fiber.StatusUnauthorized},
+		{"expired", signToken(t, testSecret, jwt.MapClaims{"user_id": "001", "exp": past.Unix()}), fiber.StatusUnauthorized},
+		{"no expiry", signToken(t, testSecret, jwt.MapClaims{"user_id": "001"}), fiber.StatusUnauthorized},
+		{"no user ID", signToken(t, testSecret, jwt.MapClaims{"exp": future.Unix()}), fiber.StatusUnauthorized},
+		{"unknown user", sessionToken(t, "999"), fiber.StatusUnauthorized},
+		{"deactivated account", sessionToken(t, "002"), fiber.StatusUnauthorized},
+		{"deleted account", sessionToken(t, "003"), fiber.StatusUnauthorized},
+		{"expired guest", sessionToken(t, "004"), fiber.StatusUnauthorized},
+		// Accounts in their deletion grace period can still sign in to cancel it
+		{"deletion scheduled", sessionToken(t, "005"), fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := do(t, app, bearer("/me", tt.token)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtectRejectsNoneAlgorithm(t *testing.T) {
+	useTestStore(t, &models.User{ID: "001", Status: models.UserStatusActive})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"user_id": "001",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := do(t, protectedApp(), bearer("/me", token)); got != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", got, fiber.StatusUnauthorized)
+	}
+}
+
+func TestProtectCookie(t *testing.T) {
+	useTestStore(t, &models.User{ID: "001", Status: models.UserStatusActive})
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(&http.Cookie{Name: "jwt", Value: sessionToken(t, "001")})
+
+	if got := do(t, protectedApp(), req); got != fiber.StatusOK {
+		t.Errorf("status = %d, want %d", got, fiber.StatusOK)
+	}
+}
+
+func TestProtectConversationTokens(t *testing.T) {
+	useTestStore(t, &models.User{ID: "001", Status: models.UserStatusActive})
+	app := protectedApp()
+
+	scoped := signToken(t, testSecret, jwt.MapClaims{
+		"user_id":         "001",
+		"exp":             time.Now().Add(time.Hour).Unix(),
+		"conversation_id": "001_002",
+		"integration_id":  "integration",
+	})
+
+	// Conversation tokens never reach routes that need a full session
+	if got := do(t, app, bearer("/me", scoped)); got != fiber.StatusForbidden {
+		t.Errorf("scoped token on Protect: status = %d, want %d", got, fiber.StatusForbidden)
+	}
+
+	// A full session must not travel in the query string
+	req := httptest.NewRequest(http.MethodGet, "/scoped?token="+sessionToken(t, "001"), nil)
+	if got := do(t, app, req); got != fiber.StatusUnauthorized {
+		t.Errorf("session token in query: status = %d, want %d", got, fiber.StatusUnauthorized)
+	}
+
+	// But it works as usual in the header
+	if got := do(t, app, bearer("/scoped", sessionToken(t, "001"))); got != fiber.StatusOK {
+		t.Errorf("session token in header: status = %d, want %d", got, fiber.StatusOK)
+	}
+}
+
+func TestProtectBannedUser(t *testing.T) {
+	useTestStore(t, &models.User{ID: "001", Status: models.UserStatusActive})
+
+	expired := time.Now().Add(-time.Minute)
+	bans.mu.Lock()
+	bans.users = map[string]banEntry{"001": {reason: "spam"}}
+	bans.devices = map[string]banEntry{"old-device": {reason: "spam", expiresAt: &expired}}
+	bans.mu.Unlock()
+	t.Cleanup(func() {
+		bans.mu.Lock()
+		bans.users, bans.devices = nil, nil
+		bans.mu.Unlock()
+	})
+	app := protectedApp()
+
+	if got := do(t, app, bearer("/me", sessionToken(t, "001"))); got != fiber.StatusForbidden {
+		t.Errorf("banned user: status = %d, want %d", got, fiber.StatusForbidden)
+	}
+
+	bans.mu.Lock()
+	delete(bans.users, "001")
+	bans.mu.Unlock()
+
+	// Expired bans no longer apply
+	req := bearer("/me", sessionToken(t, "001"))
+	req.Header.Set(DeviceFingerprintHeader, "old-device")
+	if got := do(t, app, req); got != fiber.StatusOK {
+		t.Errorf("expired device ban: status = %d, want %d", got, fiber.StatusOK)
+	}
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DeviceFingerprintHeader carries the client's device fingerprint
+const DeviceFingerprintHeader = "X-Device-Fingerprint"
+
+type banEntry struct {
+	reason    string
+	expiresAt *time.Time
+}
+
+func (e banEntry) active(now time.Time) bool {
+	return e.expiresAt == nil || now.Before(*e.expiresAt)
+}
+
+type ipBan struct {
+	network *net.IPNet
+	banEntry
+}
+
+// banList is an in-memory copy of the active bans, refreshed in the background
+// and immediately after admin changes
+type banList struct {
+	mu      sync.RWMutex
+	ips     []ipBan
+	users   map[string]banEntry
+	devices map[string]banEntry
+}
+
+var bans = &banList{}
+
+// RefreshBans reloads the ban list from the database
+func RefreshBans() {
+	// Bans are stored in MongoDB only
+	if config.DB == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Expired bans stay in the collection for the audit trail
+	cursor, err := config.DB.Collection("bans").Find(ctx, bson.M{
+		"$or": []bson.M{
+			{"expires_at": nil},
+			{"expires_at": bson.M{"$gt": time.Now()}},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to load bans: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var ips []ipBan
+	users := map[string]banEntry{}
+	devices := map[string]banEntry{}
+
+	for cursor.Next(ctx) {
+		var ban models.Ban
+		if err := cursor.Decode(&ban); err != nil {
+			continue
+		}
+
+		entry := banEntry{reason: ban.Reason, expiresAt: ban.ExpiresAt}
+		switch ban.Type {
+		case models.BanTypeIP:
+			if network := parseNetwork(ban.Value); network != nil {
+				ips = append(ips, ipBan{network: network, banEntry: entry})
+			}
+		case models.BanTypeUser:
+			users[ban.Value] = entry
+		case models.BanTypeDevice:
+			devices[ban.Value] = entry
+		}
+	}
+
+	bans.mu.Lock()
+	bans.ips, bans.users, bans.devices = ips, users, devices
+	bans.mu.Unlock()
+}
+
+// StartBanRefresh loads the ban list and reloads it every BAN_REFRESH (default
+// 30s), so requests never wait on the database to check bans
+func StartBanRefresh() {
+	if config.DB == nil {
+		return
+	}
+	RefreshBans()
+
+	interval := config.GetDurationEnv("BAN_REFRESH", 30*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			RefreshBans()
+		}
+	}()
+}
+
+// parseNetwork accepts a single IP or a CIDR range
+func parseNetwork(value string) *net.IPNet {
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil
+	}
+	if ip.To4() != nil {
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// CheckBan returns the ban reason if the IP, user, or device is banned.
+// Empty values are skipped.
+func CheckBan(ip, userID, device string) (string, bool) {
+	now := time.Now()
+
+	bans.mu.RLock()
+	defer bans.mu.RUnlock()
+
+	if userID != "" {
+		if entry, ok := bans.users[userID]; ok && entry.active(now) {
+			return entry.reason, true
+		}
+	}
+
+	if device != "" {
+		if entry, ok := bans.devices[device]; ok && entry.active(now) {
+			return entry.reason, true
+		}
+	}
+
+	if parsed := net.ParseIP(strings.TrimSpace(ip)); parsed != nil {
+		for _, b := range bans.ips {
+			if b.active(now) && b.network.Contains(parsed) {
+				return b.reason, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// deviceFingerprint reads the fingerprint from the header, or from the query string
+// for WebSocket upgrades where browsers cannot set custom headers
+func deviceFingerprint(c *fiber.Ctx) string {
+	if device := c.Get(DeviceFingerprintHeader); device != "" {
+		return device
+	}
+	return c.Query("device_fingerprint")
+}
+
+func bannedResponse(c *fiber.Ctx, reason string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":  "Access denied: banned",
+		"reason": reason,
+	})
+}
+
+// RejectBanned blocks banned IPs and devices on unauthenticated routes such as registration
+func RejectBanned(c *fiber.Ctx) error {
+	if reason, banned := CheckBan(c.IP(), "", deviceFingerprint(c)); banned {
+		return bannedResponse(c, reason)
+	}
+	return c.Next()
+}
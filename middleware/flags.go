@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/Adisonsmn/ngobrolyuk/flags"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireFlag hides a feature from users it is not rolled out to yet,
+// must run after Protect
+func RequireFlag(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+
+		if !flags.Enabled(name, userID) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   "Feature not available",
+				"feature": name,
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// IsGuest reports whether Protect authenticated a guest account
+func IsGuest(c *fiber.Ctx) bool {
+	guest, _ := c.Locals("guest").(bool)
+	return guest
+}
+
+// DenyGuests rejects features that need a full account, runs after Protect
+func DenyGuests(c *fiber.Ctx) error {
+	if IsGuest(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Not available for guest accounts, upgrade to a full account first",
+		})
+	}
+
+	return c.Next()
+}
+
+// RequireGuest only lets guest accounts through, runs after Protect
+func RequireGuest(c *fiber.Ctx) error {
+	if !IsGuest(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only guest accounts can do this",
+		})
+	}
+
+	return c.Next()
+}
+
+// GuestRateLimit limits requests of guest accounts per minute (GUEST_REQUEST_LIMIT),
+// full accounts pass through untouched
+func GuestRateLimit() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        config.GetIntEnv("GUEST_REQUEST_LIMIT", 60),
+		Expiration: time.Minute,
+		Next: func(c *fiber.Ctx) bool {
+			return !IsGuest(c)
+		},
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.Locals("user_id").(string)
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many requests, please try again later",
+			})
+		},
+	})
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Adisonsmn/ngobrolyuk/i18n"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Language is the language of text written for the caller of a request: their
+// profile setting when signed in, then Accept-Language, then English
+func Language(c *fiber.Ctx) string {
+	if lang, ok := c.Locals("language").(string); ok {
+		return lang
+	}
+	setting, _ := c.Locals("language_setting").(string)
+	lang := i18n.Match(setting, c.Get(fiber.HeaderAcceptLanguage))
+	c.Locals("language", lang)
+	return lang
+}
+
+// Localize translates the error messages of failed requests into the caller's
+// Language. Handlers keep writing English, messages without a translation stay
+// in English.
+func Localize(c *fiber.Ctx) error {
+	err := c.Next()
+
+	if e, ok := err.(*fiber.Error); ok {
+		return fiber.NewError(e.Code, i18n.Error(Language(c), e.Message))
+	}
+	if err != nil || c.Response().StatusCode() < fiber.StatusBadRequest {
+		return err
+	}
+	if !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return nil
+	}
+
+	lang := Language(c)
+	if lang == i18n.Default {
+		return nil
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(c.Response().Body(), &body); err != nil {
+		return nil
+	}
+	if message, ok := body["error"].(string); ok {
+		body["error"] = i18n.Error(lang, message)
+	}
+	if messages, ok := body["errors"].([]any); ok {
+		for i, message := range messages {
+			if message, ok := message.(string); ok {
+				messages[i] = i18n.Error(lang, message)
+			}
+		}
+	}
+
+	translated, err := json.Marshal(body)
+	if err != nil {
+		return nil
+	}
+	c.Response().SetBodyRaw(translated)
+	return nil
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HashAPIKey returns the form integration API keys are stored and looked up in
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// activeIntegration loads an integration that has not been revoked
+func activeIntegration(ctx context.Context, filter bson.M) (*models.Integration, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter["revoked_at"] = bson.M{"$exists": false}
+
+	var integration models.Integration
+	if err := config.DB.Collection("integrations").FindOne(ctx, filter).Decode(&integration); err != nil {
+		return nil, err
+	}
+	return &integration, nil
+}
+
+// RequireIntegration authenticates an integrator by the API key in the
+// Authorization header and stores the integration in Locals("integration")
+func RequireIntegration(c *fiber.Ctx) error {
+	var key string
+	if authHeader := c.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		key = authHeader[7:]
+	}
+	if key == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Missing API key",
+		})
+	}
+
+	integration, err := activeIntegration(c.UserContext(), bson.M{"key_hash": HashAPIKey(key)})
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid API key",
+		})
+	}
+
+	c.Locals("integration", integration)
+	return c.Next()
+}
+
+// ConversationScope returns the conversation a token is limited to, empty for
+// full sessions. Only set on routes guarded by ProtectConversation.
+func ConversationScope(c *fiber.Ctx) string {
+	scope, _ := c.Locals("conversation_scope").(string)
+	return scope
+}
+
+// RequireConversationScope only lets conversation tokens through, runs after ProtectConversation
+func RequireConversationScope(c *fiber.Ctx) error {
+	if ConversationScope(c) == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "A conversation token is required",
+		})
+	}
+
+	return c.Next()
+}
+
+// checkConversationToken verifies that the integration that minted a scoped token
+// is still active and still maps the user
+func checkConversationToken(ctx context.Context, integrationID, userID string) bool {
+	// Integrations are stored in MongoDB only
+	if config.DB == nil {
+		return false
+	}
+
+	id, err := primitive.ObjectIDFromHex(integrationID)
+	if err != nil {
+		return false
+	}
+
+	integration, err := activeIntegration(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false
+	}
+	return integration.Maps(userID)
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// roleTable is an in-memory copy of the roles collection, refreshed in the
+// background and immediately after admin changes
+type roleTable struct {
+	mu          sync.RWMutex
+	permissions map[string]map[string]bool // Role -> granted permissions
+}
+
+var roles = &roleTable{}
+
+// RefreshRoles reloads the role to permission mappings from the database
+func RefreshRoles() {
+	// Roles are stored in MongoDB only
+	if config.DB == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("roles").Find(ctx, bson.M{})
+	if err != nil {
+		log.Printf("Failed to load roles: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	permissions := map[string]map[string]bool{}
+	for cursor.Next(ctx) {
+		var role models.Role
+		if err := cursor.Decode(&role); err != nil {
+			continue
+		}
+
+		granted := make(map[string]bool, len(role.Permissions))
+		for _, p := range role.Permissions {
+			granted[p] = true
+		}
+		permissions[role.Name] = granted
+	}
+
+	roles.mu.Lock()
+	roles.permissions = permissions
+	roles.mu.Unlock()
+}
+
+// StartRoleRefresh loads the roles and reloads them every ROLE_REFRESH (default
+// 30s), so permission checks never wait on the database
+func StartRoleRefresh() {
+	if config.DB == nil {
+		return
+	}
+	RefreshRoles()
+
+	interval := config.GetDurationEnv("ROLE_REFRESH", 30*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			RefreshRoles()
+		}
+	}()
+}
+
+// RoleCan reports whether the role grants the permission. Admins hold every permission.
+func RoleCan(role, permission string) bool {
+	if role == models.UserRoleAdmin {
+		return true
+	}
+	if role == "" {
+		return false
+	}
+
+	roles.mu.RLock()
+	defer roles.mu.RUnlock()
+
+	return roles.permissions[role][permission]
+}
+
+// RequirePermission allows only users whose role grants all of the permissions,
+// must run after Protect
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+
+		user, err := store.Users().GetByID(c.UserContext(), userID)
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Permission denied",
+			})
+		}
+
+		for _, permission := range permissions {
+			if !RoleCan(user.Role, permission) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":      "Permission denied",
+					"permission": permission,
+				})
+			}
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// useRoles replaces the loaded role table for the duration of the test
+func useRoles(t *testing.T, permissions map[string]map[string]bool) {
+	roles.mu.Lock()
+	previous := roles.permissions
+	roles.permissions = permissions
+	roles.mu.Unlock()
+
+	t.Cleanup(func() {
+		roles.mu.Lock()
+		roles.permissions = previous
+		roles.mu.Unlock()
+	})
+}
+
+func TestRoleCan(t *testing.T) {
+	useRoles(t, map[string]map[string]bool{
+		"moderator": {"messages.delete": true},
+	})
+
+	tests := []struct {
+		role, permission string
+		want             bool
+	}{
+		{models.UserRoleAdmin, "anything", true},
+		{"moderator", "messages.delete", true},
+		{"moderator", "users.ban", false},
+		{"unknown", "messages.delete", false},
+		{"", "messages.delete", false},
+	}
+	for _, tt := range tests {
+		if got := RoleCan(tt.role, tt.permission); got != tt.want {
+			t.Errorf("RoleCan(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	useTestStore(t,
+		&models.User{ID: "001", Status: models.UserStatusActive, Role: models.UserRoleAdmin},
+		&models.User{ID: "002", Status: models.UserStatusActive, Role: "moderator"},
+		&models.User{ID: "003", Status: models.UserStatusActive},
+	)
+	useRoles(t, map[string]map[string]bool{
+		"moderator": {"messages.delete": true},
+	})
+
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Get("/delete", Protect, RequirePermission("messages.delete"), ok)
+	app.Get("/delete-and-ban", Protect, RequirePermission("messages.delete", "users.ban"), ok)
+
+	tests := []struct {
+		name, path, userID string
+		want               int
+	}{
+		{"admin", "/delete-and-ban", "001", fiber.StatusNoContent},
+		{"granted role", "/delete", "002", fiber.StatusNoContent},
+		{"role missing one permission", "/delete-and-ban", "002", fiber.StatusForbidden},
+		{"no role", "/delete", "003", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := do(t, app, bearer(tt.path, sessionToken(t, tt.userID))); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuestRestrictions(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	useTestStore(t,
+		&models.User{ID: "001", Status: models.UserStatusActive},
+		&models.User{ID: "002", Status: models.UserStatusActive, GuestExpiresAt: &expires},
+	)
+
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Get("/full", Protect, DenyGuests, ok)
+	app.Get("/upgrade", Protect, RequireGuest, ok)
+
+	tests := []struct {
+		name, path, userID string
+		want               int
+	}{
+		{"full account on full route", "/full", "001", fiber.StatusNoContent},
+		{"guest on full route", "/full", "002", fiber.StatusForbidden},
+		{"guest upgrades", "/upgrade", "002", fiber.StatusNoContent},
+		{"full account cannot upgrade", "/upgrade", "001", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := do(t, app, bearer(tt.path, sessionToken(t, tt.userID))); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
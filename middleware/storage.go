@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireMongo rejects features that are only implemented on MongoDB
+// when the core store runs on another backend (STORAGE=postgres or memory)
+func RequireMongo(c *fiber.Ctx) error {
+	if config.DB == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
+			"error": "Not available with the configured storage backend",
+		})
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Adisonsmn/ngobrolyuk/telemetry"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span per request, continuing the caller's trace from the
+// traceparent header. Handlers pass c.UserContext() down so database spans nest under it.
+func Tracing(c *fiber.Ctx) error {
+	header := propagation.HeaderCarrier(http.Header{})
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		header.Set(string(key), string(value))
+	})
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), header)
+
+	ctx, span := telemetry.Tracer().Start(ctx, c.Method()+" "+c.Path(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(c.Path()),
+			semconv.ClientAddress(c.IP()),
+		),
+	)
+	defer span.End()
+
+	c.SetUserContext(ctx)
+	err := c.Next()
+
+	// Name the span after the matched route so IDs don't explode cardinality
+	route := c.Route().Path
+	span.SetName(c.Method() + " " + route)
+	span.SetAttributes(semconv.HTTPRoute(route))
+
+	status := c.Response().StatusCode()
+	if e, ok := err.(*fiber.Error); ok {
+		status = e.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if userID, ok := c.Locals("user_id").(string); ok {
+		span.SetAttributes(attribute.String("user.id", userID))
+	}
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+		if err != nil {
+			span.RecordError(err)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,207 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Indexes that used to be created at every startup. CreateMany is a no-op for
+// existing identical indexes, so this is safe on databases that already have them.
+func init() {
+	Register(Migration{
+		Version: 1,
+		Name:    "baseline_indexes",
+		Up:      baselineIndexes,
+	})
+}
+
+func baselineIndexes(ctx context.Context, db *mongo.Database) error {
+	userCollection := db.Collection("users")
+	messageCollection := db.Collection("messages")
+
+	// ✅ Indexes untuk users
+	userIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "online", Value: 1}, {Key: "last_seen", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: "text"}, {Key: "bio", Value: "text"}},
+			Options: options.Index().SetName("users_text").
+				SetWeights(bson.D{{Key: "username", Value: 5}, {Key: "bio", Value: 1}}),
+		},
+	}
+	if _, err := userCollection.Indexes().CreateMany(ctx, userIndexes); err != nil {
+		log.Printf("Failed to create user indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk messages
+	messageIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "sender_id", Value: 1},
+				{Key: "receiver_id", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "receiver_id", Value: 1},
+				{Key: "read", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{{Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "room_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "channel_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	}
+	if _, err := messageCollection.Indexes().CreateMany(ctx, messageIndexes); err != nil {
+		log.Printf("Failed to create message indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk rooms
+	roomIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "members.user_id", Value: 1}, {Key: "updated_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "topic", Value: "text"}},
+			Options: options.Index().SetName("rooms_text").
+				SetWeights(bson.D{{Key: "name", Value: 5}, {Key: "topic", Value: 1}}),
+		},
+	}
+	if _, err := db.Collection("rooms").Indexes().CreateMany(ctx, roomIndexes); err != nil {
+		log.Printf("Failed to create room indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk room invites (expired invites dihapus otomatis)
+	inviteIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "room_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	if _, err := db.Collection("room_invites").Indexes().CreateMany(ctx, inviteIndexes); err != nil {
+		log.Printf("Failed to create room invite indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk channel subscriptions
+	subscriptionIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "channel_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	}
+	if _, err := db.Collection("channel_subscriptions").Indexes().CreateMany(ctx, subscriptionIndexes); err != nil {
+		log.Printf("Failed to create channel subscription indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk reports
+	reportIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	}
+	if _, err := db.Collection("reports").Indexes().CreateMany(ctx, reportIndexes); err != nil {
+		log.Printf("Failed to create report indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk spam flags
+	spamIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "lifted", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "expires_at", Value: -1}},
+		},
+	}
+	if _, err := db.Collection("spam_flags").Indexes().CreateMany(ctx, spamIndexes); err != nil {
+		log.Printf("Failed to create spam flag indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk bans (temporary bans dihapus otomatis setelah expires_at)
+	banIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "type", Value: 1}, {Key: "value", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	if _, err := db.Collection("bans").Indexes().CreateMany(ctx, banIndexes); err != nil {
+		log.Printf("Failed to create ban indexes: %v", err)
+		return err
+	}
+
+	auditIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "value", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	}
+	if _, err := db.Collection("ban_audit").Indexes().CreateMany(ctx, auditIndexes); err != nil {
+		log.Printf("Failed to create ban audit indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk notification_settings
+	notificationIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "conversation_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "conversation_id", Value: 1}},
+		},
+	}
+	if _, err := db.Collection("notification_settings").Indexes().CreateMany(ctx, notificationIndexes); err != nil {
+		log.Printf("Failed to create notification settings indexes: %v", err)
+		return err
+	}
+
+	// ✅ Indexes untuk daily_active_users (rollup statistik admin)
+	activeUserIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "day", Value: 1}, {Key: "user_id", Value: 1}},
+		},
+	}
+	if _, err := db.Collection("daily_active_users").Indexes().CreateMany(ctx, activeUserIndexes); err != nil {
+		log.Printf("Failed to create daily active user indexes: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Seeds the moderator role, left alone if an admin already defined one
+func init() {
+	Register(Migration{
+		Version: 3,
+		Name:    "seed_moderator_role",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("roles").UpdateOne(ctx,
+				bson.M{"_id": models.UserRoleModerator},
+				bson.M{"$setOnInsert": bson.M{
+					"description": "Reviews reports, handles spam and bans",
+					"permissions": models.DefaultModeratorPermissions,
+					"updated_at":  time.Now(),
+				}},
+				options.Update().SetUpsert(true),
+			)
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("roles").DeleteOne(ctx, bson.M{"_id": models.UserRoleModerator})
+			return err
+		},
+	})
+}
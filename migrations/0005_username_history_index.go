@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Registration and resolve look up users by a username they gave up
+func init() {
+	Register(Migration{
+		Version: 5,
+		Name:    "username_history_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "username_history.username", Value: 1}},
+				Options: options.Index().SetName("users_username_history"),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().DropOne(ctx, "users_username_history")
+			return err
+		},
+	})
+}
@@ -0,0 +1,74 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// User search looks up prefixes and trigrams of the username and display name
+// instead of scanning with $regex, existing users get their index built here
+func init() {
+	Register(Migration{
+		Version: 6,
+		Name:    "user_search_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+
+			cursor, err := users.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{
+				"username":     1,
+				"display_name": 1,
+			}))
+			if err != nil {
+				return err
+			}
+			defer cursor.Close(ctx)
+
+			for cursor.Next(ctx) {
+				var user models.User
+				if err := cursor.Decode(&user); err != nil {
+					return err
+				}
+
+				user.IndexSearch()
+				if _, err := users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+					"search_prefixes": user.SearchPrefixes,
+					"search_trigrams": user.SearchTrigrams,
+				}}); err != nil {
+					return err
+				}
+			}
+			if err := cursor.Err(); err != nil {
+				return err
+			}
+
+			_, err = users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "search_prefixes", Value: 1}},
+					Options: options.Index().SetName("users_search_prefixes"),
+				},
+				{
+					Keys:    bson.D{{Key: "search_trigrams", Value: 1}},
+					Options: options.Index().SetName("users_search_trigrams"),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+			for _, name := range []string{"users_search_prefixes", "users_search_trigrams"} {
+				if _, err := users.Indexes().DropOne(ctx, name); err != nil {
+					return err
+				}
+			}
+			_, err := users.UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{
+				"search_prefixes": "",
+				"search_trigrams": "",
+			}})
+			return err
+		},
+	})
+}
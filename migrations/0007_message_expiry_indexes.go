@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The expiry sweeper looks up due messages and read receipts look up unread view-once
+// messages, both only ever match a few documents
+func init() {
+	Register(Migration{
+		Version: 7,
+		Name:    "message_expiry_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("messages").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys: bson.D{{Key: "expires_at", Value: 1}},
+					Options: options.Index().SetName("messages_expires_at").
+						SetPartialFilterExpression(bson.M{"expires_at": bson.M{"$exists": true}}),
+				},
+				{
+					Keys: bson.D{{Key: "receiver_id", Value: 1}, {Key: "sender_id", Value: 1}, {Key: "created_at", Value: 1}},
+					Options: options.Index().SetName("messages_view_once").
+						SetPartialFilterExpression(bson.M{"view_once": true}),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"messages_expires_at", "messages_view_once"} {
+				if _, err := db.Collection("messages").Indexes().DropOne(ctx, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Attachments are GridFS files, deleting an account looks up its files by owner
+func init() {
+	Register(Migration{
+		Version: 8,
+		Name:    "attachment_owner_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("fs.files").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "metadata.owner_id", Value: 1}},
+				Options: options.Index().SetName("fs_files_owner"),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("fs.files").Indexes().DropOne(ctx, "fs_files_owner")
+			return err
+		},
+	})
+}
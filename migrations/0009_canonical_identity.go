@@ -0,0 +1,141 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Usernames and emails are unique and looked up by their canonical form so that
+// case differences can't create look-alike accounts. Creating the unique indexes
+// fails if existing accounts only differ by case, so the migration stops first with
+// a list of them to rename.
+func init() {
+	Register(Migration{
+		Version: 9,
+		Name:    "canonical_identity",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+
+			cursor, err := users.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{
+				"username":         1,
+				"email":            1,
+				"username_history": 1,
+			}))
+			if err != nil {
+				return err
+			}
+			defer cursor.Close(ctx)
+
+			for cursor.Next(ctx) {
+				var user models.User
+				if err := cursor.Decode(&user); err != nil {
+					return err
+				}
+
+				user.Canonicalize()
+				set := bson.M{
+					"username_canonical": user.UsernameCanonical,
+					"email_canonical":    user.EmailCanonical,
+				}
+				if len(user.UsernameHistory) > 0 {
+					for i := range user.UsernameHistory {
+						user.UsernameHistory[i].Canonical = models.CanonicalUsername(user.UsernameHistory[i].Username)
+					}
+					set["username_history"] = user.UsernameHistory
+				}
+				if _, err := users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": set}); err != nil {
+					return err
+				}
+			}
+			if err := cursor.Err(); err != nil {
+				return err
+			}
+
+			var conflicts []string
+			for _, field := range []string{"username_canonical", "email_canonical"} {
+				found, err := canonicalDuplicates(ctx, users, field)
+				if err != nil {
+					return err
+				}
+				conflicts = append(conflicts, found...)
+			}
+			if len(conflicts) > 0 {
+				return fmt.Errorf("accounts that only differ by case must be renamed first:\n  %s",
+					strings.Join(conflicts, "\n  "))
+			}
+
+			_, err = users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "username_canonical", Value: 1}},
+					Options: options.Index().SetName("users_username_canonical").SetUnique(true),
+				},
+				{
+					Keys:    bson.D{{Key: "email_canonical", Value: 1}},
+					Options: options.Index().SetName("users_email_canonical").SetUnique(true),
+				},
+				{
+					Keys:    bson.D{{Key: "username_history.canonical", Value: 1}},
+					Options: options.Index().SetName("users_username_history_canonical"),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+			for _, name := range []string{"users_username_canonical", "users_email_canonical", "users_username_history_canonical"} {
+				if _, err := users.Indexes().DropOne(ctx, name); err != nil {
+					return err
+				}
+			}
+			_, err := users.UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{
+				"username_canonical": "",
+				"email_canonical":    "",
+			}})
+			return err
+		},
+	})
+}
+
+// maxListedDuplicates keeps the migration error readable on large databases
+const maxListedDuplicates = 50
+
+// canonicalDuplicates lists the canonical values of field shared by several users,
+// with the IDs of those users
+func canonicalDuplicates(ctx context.Context, users *mongo.Collection, field string) ([]string, error) {
+	cursor, err := users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$" + field,
+			"users": bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		Value string   `bson:"_id"`
+		Users []string `bson:"users"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	var found []string
+	for i, group := range groups {
+		if i == maxListedDuplicates {
+			found = append(found, fmt.Sprintf("... and %d more %s values", len(groups)-i, field))
+			break
+		}
+		found = append(found, fmt.Sprintf("%s %q: users %s", field, group.Value, strings.Join(group.Users, ", ")))
+	}
+	return found, nil
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The outbox relay claims unpublished entries that are due and purges old
+// published ones. The collection is created up front because servers before
+// 4.4 cannot create collections inside the message insert transaction.
+func init() {
+	Register(Migration{
+		Version: 10,
+		Name:    "outbox",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			names, err := db.ListCollectionNames(ctx, bson.M{"name": "outbox"})
+			if err != nil {
+				return err
+			}
+			if len(names) == 0 {
+				if err := db.CreateCollection(ctx, "outbox"); err != nil {
+					return err
+				}
+			}
+
+			_, err = db.Collection("outbox").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys: bson.D{{Key: "next_attempt_at", Value: 1}},
+					Options: options.Index().SetName("outbox_due").
+						SetPartialFilterExpression(bson.M{"published_at": bson.M{"$exists": false}}),
+				},
+				{
+					Keys: bson.D{{Key: "published_at", Value: 1}},
+					Options: options.Index().SetName("outbox_published").
+						SetPartialFilterExpression(bson.M{"published_at": bson.M{"$exists": true}}),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("outbox").Drop(ctx)
+		},
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The conversation list and the requests inbox load the requests sent to the user
+func init() {
+	Register(Migration{
+		Version: 11,
+		Name:    "message_request_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("conversations").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "request.recipient_id", Value: 1}},
+				Options: options.Index().SetName("conversations_request_recipient").
+					SetPartialFilterExpression(bson.M{"request": bson.M{"$exists": true}}),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("conversations").Indexes().DropOne(ctx, "conversations_request_recipient")
+			return err
+		},
+	})
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Users list the support access requested on their account, the audit trail is
+// read per user or per agent
+func init() {
+	Register(Migration{
+		Version: 12,
+		Name:    "support_access_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("support_access").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("support_access_user"),
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = db.Collection("support_audit").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("support_audit_user"),
+				},
+				{
+					Keys:    bson.D{{Key: "agent_id", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("support_audit_agent"),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("support_access").Indexes().DropOne(ctx, "support_access_user"); err != nil {
+				return err
+			}
+			_, err := db.Collection("support_audit").Indexes().DropAll(ctx)
+			return err
+		},
+	})
+}
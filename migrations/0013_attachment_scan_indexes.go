@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The scan retry worker looks for quarantined files, oldest first, and the scan
+// audit is read per uploader. Only pending files are indexed, they are few.
+func init() {
+	Register(Migration{
+		Version: 13,
+		Name:    "attachment_scan_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("fs.files").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "uploadDate", Value: 1}},
+				Options: options.Index().SetName("fs_files_scan_pending").
+					SetPartialFilterExpression(bson.M{"metadata.scan_status": "pending"}),
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = db.Collection("attachment_scan_audit").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "owner_id", Value: 1}, {Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("attachment_scan_audit_owner"),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("fs.files").Indexes().DropOne(ctx, "fs_files_scan_pending"); err != nil {
+				return err
+			}
+			_, err := db.Collection("attachment_scan_audit").Indexes().DropOne(ctx, "attachment_scan_audit_owner")
+			return err
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Integrations are looked up by the hash of the API key on every token request
+func init() {
+	Register(Migration{
+		Version: 14,
+		Name:    "integration_key_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("integrations").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "key_hash", Value: 1}},
+				Options: options.Index().SetName("integrations_key_hash").SetUnique(true),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("integrations").Indexes().DropOne(ctx, "integrations_key_hash")
+			return err
+		},
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Room discovery is opt-in. Rooms created while every room was listed unless it
+// opted out stay hidden until they are made discoverable again.
+func init() {
+	Register(Migration{
+		Version: 15,
+		Name:    "room_discovery_opt_in",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("rooms").UpdateMany(ctx, bson.M{}, bson.M{
+				"$set":   bson.M{"discoverable": false},
+				"$unset": bson.M{"hide_from_discovery": ""},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("rooms").UpdateMany(ctx, bson.M{}, []bson.M{
+				{"$set": bson.M{"hide_from_discovery": bson.M{"$ne": []interface{}{"$discoverable", true}}}},
+				{"$unset": "discoverable"},
+			})
+			return err
+		},
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// QR login challenges live in qr_logins so any instance can answer them, MongoDB
+// removes them once they expired
+func init() {
+	Register(Migration{
+		Version: 16,
+		Name:    "qr_login_expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("qr_logins").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("qr_logins_expires_at").SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("qr_logins").Indexes().DropOne(ctx, "qr_logins_expires_at")
+			return err
+		},
+	})
+}
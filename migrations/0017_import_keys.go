@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The importer upserts messages and rooms by the ID they had in the exporting app,
+// so importing the same export twice does not duplicate them
+func init() {
+	Register(Migration{
+		Version: 17,
+		Name:    "import_keys",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, collection := range []string{"messages", "rooms"} {
+				_, err := db.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys: bson.D{{Key: "import_key", Value: 1}},
+					Options: options.Index().SetName(collection + "_import_key").SetUnique(true).
+						SetPartialFilterExpression(bson.M{"import_key": bson.M{"$exists": true}}),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, collection := range []string{"messages", "rooms"} {
+				if _, err := db.Collection(collection).Indexes().DropOne(ctx, collection+"_import_key"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,293 @@
+// Package migrations applies versioned schema changes (indexes, backfills, new
+// fields) and records them in the schema_migrations collection.
+//
+// Each migration lives in its own NNNN_name.go file and registers itself from
+// init(). Versions must be unique and are applied in ascending order.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	migrationsCollection = "schema_migrations"
+	lockCollection       = "schema_migrations_lock"
+
+	// staleLockAfter lets a crashed run's lock be taken over. A live run renews
+	// its lock every lockHeartbeatInterval, so it never goes stale while held.
+	staleLockAfter        = 2 * time.Minute
+	lockHeartbeatInterval = 30 * time.Second
+
+	// lockPollInterval is how often a waiting run retries the lock
+	lockPollInterval = time.Second
+)
+
+// ErrLocked is returned when another run still holds the lock once ctx is done
+var ErrLocked = errors.New("another migration run is in progress")
+
+// Migration is a single versioned schema change. Down is optional; migrations
+// without it cannot be rolled back.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is a row of schema_migrations
+type Record struct {
+	Version   int64     `bson:"_id" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	AppliedAt time.Time `bson:"applied_at" json:"applied_at"`
+}
+
+// Status describes one registered migration
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var registry = map[int64]Migration{}
+
+// Register adds a migration, panicking on duplicate versions so mistakes fail at startup
+func Register(m Migration) {
+	if _, exists := registry[m.Version]; exists {
+		panic(fmt.Sprintf("migrations: duplicate version %d (%s)", m.Version, m.Name))
+	}
+	if m.Up == nil {
+		panic(fmt.Sprintf("migrations: version %d (%s) has no Up", m.Version, m.Name))
+	}
+	registry[m.Version] = m
+}
+
+// All returns registered migrations sorted by version
+func All() []Migration {
+	all := make([]Migration, 0, len(registry))
+	for _, m := range registry {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all
+}
+
+func applied(ctx context.Context, db *mongo.Database) (map[int64]Record, error) {
+	cursor, err := db.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	records := make(map[int64]Record)
+	for cursor.Next(ctx) {
+		var r Record
+		if err := cursor.Decode(&r); err != nil {
+			return nil, err
+		}
+		records[r.Version] = r
+	}
+	return records, cursor.Err()
+}
+
+// GetStatus lists every registered migration and whether it has been applied
+func GetStatus(ctx context.Context, db *mongo.Database) ([]Status, error) {
+	records, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, m := range All() {
+		r, ok := records[m.Version]
+		statuses = append(statuses, Status{Migration: m, Applied: ok, AppliedAt: r.AppliedAt})
+	}
+	return statuses, nil
+}
+
+// Up applies pending migrations up to and including target (0 = all). Returns how many ran.
+func Up(ctx context.Context, db *mongo.Database, target int64) (int, error) {
+	release, err := lock(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	records, err := applied(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range All() {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, done := records[m.Version]; done {
+			continue
+		}
+
+		log.Printf("Applying migration %04d_%s", m.Version, m.Name)
+		if err := m.Up(ctx, db); err != nil {
+			return count, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+
+		_, err := db.Collection(migrationsCollection).InsertOne(ctx,
+			Record{Version: m.Version, Name: m.Name, AppliedAt: time.Now()})
+		if err != nil {
+			return count, fmt.Errorf("recording migration %04d: %w", m.Version, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Down rolls back the most recently applied migrations, newest first
+func Down(ctx context.Context, db *mongo.Database, steps int) (int, error) {
+	release, err := lock(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	records, err := applied(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	all := All()
+	count := 0
+	for i := len(all) - 1; i >= 0 && count < steps; i-- {
+		m := all[i]
+		if _, done := records[m.Version]; !done {
+			continue
+		}
+		if m.Down == nil {
+			return count, fmt.Errorf("migration %04d_%s is irreversible", m.Version, m.Name)
+		}
+
+		log.Printf("Rolling back migration %04d_%s", m.Version, m.Name)
+		if err := m.Down(ctx, db); err != nil {
+			return count, fmt.Errorf("rollback of %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+
+		if _, err := db.Collection(migrationsCollection).DeleteOne(ctx, bson.M{"_id": m.Version}); err != nil {
+			return count, fmt.Errorf("unrecording migration %04d: %w", m.Version, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// lock keeps concurrent instances from migrating at the same time. It waits for a
+// run in progress to finish, callers read the applied versions after taking it.
+func lock(ctx context.Context, db *mongo.Database) (func(), error) {
+	release, err := tryLock(ctx, db)
+	if !errors.Is(err, ErrLocked) {
+		return release, err
+	}
+
+	log.Printf("Waiting for another migration run to finish")
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ErrLocked
+		case <-ticker.C:
+		}
+
+		release, err := tryLock(ctx, db)
+		if !errors.Is(err, ErrLocked) {
+			return release, err
+		}
+	}
+}
+
+func tryLock(ctx context.Context, db *mongo.Database) (func(), error) {
+	locks := db.Collection(lockCollection)
+	owner := primitive.NewObjectID()
+	doc := bson.M{"_id": "lock", "owner": owner, "locked_at": time.Now()}
+
+	_, err := locks.InsertOne(ctx, doc)
+	if mongo.IsDuplicateKeyError(err) {
+		// Take over a lock left behind by a crashed run
+		result, delErr := locks.DeleteOne(ctx, bson.M{
+			"_id":       "lock",
+			"locked_at": bson.M{"$lt": time.Now().Add(-staleLockAfter)},
+		})
+		if delErr != nil || result.DeletedCount == 0 {
+			return nil, ErrLocked
+		}
+		_, err = locks.InsertOne(ctx, doc)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrLocked
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("acquiring migration lock: %w", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		heartbeat(locks, owner, stop)
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := locks.DeleteOne(ctx, bson.M{"_id": "lock", "owner": owner}); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}, nil
+}
+
+// heartbeat renews the lock until stop is closed so long migrations are not
+// mistaken for a crashed run and taken over
+func heartbeat(locks *mongo.Collection, owner primitive.ObjectID, stop <-chan struct{}) {
+	ticker := time.NewTicker(lockHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		result, err := locks.UpdateOne(ctx,
+			bson.M{"_id": "lock", "owner": owner},
+			bson.M{"$set": bson.M{"locked_at": time.Now()}})
+		cancel()
+		if err != nil {
+			log.Printf("Failed to renew migration lock: %v", err)
+		} else if result.MatchedCount == 0 {
+			log.Printf("Migration lock was taken over by another run")
+			return
+		}
+	}
+}
+
+// Latest returns the highest registered version
+func Latest() int64 {
+	all := All()
+	if len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// Appearances holds one user's client theme settings per conversation, stored as
+// a single document per owner in the appearances collection so every device of
+// the user shows a conversation the same way. Nobody else sees them.
+type Appearances struct {
+	OwnerID       string                `bson:"_id" json:"-"`
+	Conversations map[string]Appearance `bson:"conversations" json:"conversations"` // Keyed by conversation or room ID
+}
+
+// Appearance is how one conversation looks for its owner. Values are opaque to the
+// server, clients agree on what a wallpaper ID means.
+type Appearance struct {
+	Wallpaper   string    `bson:"wallpaper,omitempty" json:"wallpaper,omitempty"`
+	AccentColor string    `bson:"accent_color,omitempty" json:"accent_color,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// IsEmpty reports whether the conversation uses the default appearance
+func (a Appearance) IsEmpty() bool {
+	return a.Wallpaper == "" && a.AccentColor == ""
+}
+
+var (
+	wallpaperIDRegex = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,64}$`)
+	accentColorRegex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`) // Also used for label colors
+)
+
+// UpdateAppearanceRequest changes only the fields that are present, empty strings
+// go back to the default
+type UpdateAppearanceRequest struct {
+	Wallpaper   *string `json:"wallpaper"`    // e.g. "builtin:forest" or an attachment ID
+	AccentColor *string `json:"accent_color"` // "#RRGGBB"
+}
+
+func (r *UpdateAppearanceRequest) Validate() []string {
+	var errors []string
+
+	if r.Wallpaper == nil && r.AccentColor == nil {
+		errors = append(errors, "Nothing to update")
+	}
+	if r.Wallpaper != nil && *r.Wallpaper != "" && !wallpaperIDRegex.MatchString(*r.Wallpaper) {
+		errors = append(errors, "Wallpaper must be an ID of 1-64 letters, digits, '_', '.', ':' or '-'")
+	}
+	if r.AccentColor != nil && *r.AccentColor != "" && !accentColorRegex.MatchString(*r.AccentColor) {
+		errors = append(errors, "Accent color must be a hex color like #4caf50")
+	}
+
+	return errors
+}
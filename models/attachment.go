@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Error codes returned with attachment upload errors, so clients can tell a file
+// that can never be sent from one that fits after freeing space
+const (
+	ErrCodeAttachmentTooLarge   = "attachment_too_large"
+	ErrCodeStorageQuotaExceeded = "storage_quota_exceeded"
+	ErrCodeAttachmentInfected   = "attachment_infected"
+	ErrCodeAttachmentScanning   = "attachment_pending_scan"
+)
+
+// Attachment scan statuses. Pending files are quarantined, infected ones are
+// deleted as soon as they are found.
+const (
+	ScanStatusPending    = "pending"
+	ScanStatusClean      = "clean"
+	ScanStatusInfected   = "infected"
+	ScanStatusNotScanned = "not_scanned" // Uploaded while no scanner was configured
+)
+
+// AttachmentMeta is stored as the metadata of an attachment's GridFS file
+type AttachmentMeta struct {
+	OwnerID     string     `bson:"owner_id" json:"owner_id"`
+	ContentType string     `bson:"content_type" json:"content_type"`
+	ScanStatus  string     `bson:"scan_status,omitempty" json:"scan_status,omitempty"`
+	ScannedAt   *time.Time `bson:"scanned_at,omitempty" json:"scanned_at,omitempty"`
+}
+
+// Scan returns the scan status, files stored before scanning existed were never scanned
+func (m AttachmentMeta) Scan() string {
+	if m.ScanStatus == "" {
+		return ScanStatusNotScanned
+	}
+	return m.ScanStatus
+}
+
+// Attachment is an uploaded file as returned to clients
+type Attachment struct {
+	ID          primitive.ObjectID `json:"id"`
+	Filename    string             `json:"filename"`
+	ContentType string             `json:"content_type"`
+	Size        int64              `json:"size"`
+	URL         string             `json:"url"`
+	ScanStatus  string             `json:"scan_status"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// AttachmentScanAudit records an upload rejected by the malware scanner, in the
+// attachment_scan_audit collection
+type AttachmentScanAudit struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AttachmentID primitive.ObjectID `bson:"attachment_id" json:"attachment_id"`
+	OwnerID      string             `bson:"owner_id" json:"owner_id"`
+	Filename     string             `bson:"filename" json:"filename"`
+	ContentType  string             `bson:"content_type" json:"content_type"`
+	Size         int64              `bson:"size" json:"size"`
+	Scanner      string             `bson:"scanner" json:"scanner"`
+	Signature    string             `bson:"signature" json:"signature"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// StorageUsage tracks the attachment bytes a user stores, in the storage_usage collection.
+// Quota overrides the default quota for the account when set by an admin.
+type StorageUsage struct {
+	UserID    string    `bson:"_id" json:"user_id"`
+	Bytes     int64     `bson:"bytes" json:"bytes"`
+	Files     int       `bson:"files" json:"files"`
+	Quota     *int64    `bson:"quota,omitempty" json:"quota,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// UpdateStorageQuotaRequest sets an account's quota in bytes, null restores the default
+type UpdateStorageQuotaRequest struct {
+	Quota *int64 `json:"quota"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"net"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ban types
+const (
+	BanTypeIP     = "ip"     // Single IP or CIDR range
+	BanTypeUser   = "user"   // User ID
+	BanTypeDevice = "device" // Device fingerprint sent in the X-Device-Fingerprint header
+)
+
+// Ban audit actions
+const (
+	BanActionBan   = "ban"
+	BanActionUnban = "unban"
+)
+
+type Ban struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type      string             `bson:"type" json:"type"`
+	Value     string             `bson:"value" json:"value"`
+	Reason    string             `bson:"reason" json:"reason"`
+	BannedBy  string             `bson:"banned_by" json:"banned_by"`
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // Nil for permanent bans
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type BanAudit struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Action    string             `bson:"action" json:"action"`
+	BanID     primitive.ObjectID `bson:"ban_id" json:"ban_id"`
+	Type      string             `bson:"type" json:"type"`
+	Value     string             `bson:"value" json:"value"`
+	Reason    string             `bson:"reason" json:"reason"`
+	AdminID   string             `bson:"admin_id" json:"admin_id"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type CreateBanRequest struct {
+	Type     string `json:"type" validate:"oneof=ip user device"`
+	Value    string `json:"value" validate:"required"`
+	Reason   string `json:"reason" validate:"required,max=500"`
+	Duration int    `json:"duration"` // Seconds, 0 means permanent
+}
+
+func (r *CreateBanRequest) Validate() []string {
+	var errors []string
+
+	switch r.Type {
+	case BanTypeIP:
+		if _, _, err := net.ParseCIDR(r.Value); err != nil && net.ParseIP(r.Value) == nil {
+			errors = append(errors, "Value must be an IP address or CIDR range")
+		}
+	case BanTypeUser, BanTypeDevice:
+		if r.Value == "" {
+			errors = append(errors, "Value is required")
+		}
+	default:
+		errors = append(errors, "Type must be ip, user, or device")
+	}
+
+	if r.Reason == "" || len(r.Reason) > 500 {
+		errors = append(errors, "Reason must be 1-500 characters")
+	}
+
+	if r.Duration < 0 {
+		errors = append(errors, "Duration cannot be negative")
+	}
+
+	return errors
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Channel is a broadcast room: only publishers post, any number of users subscribe.
+// Subscribers live in the channel_subscriptions collection to keep the document small.
+type Channel struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name            string             `bson:"name" json:"name"`
+	Description     string             `bson:"description" json:"description"`
+	OwnerID         string             `bson:"owner_id" json:"owner_id"`
+	Publishers      []string           `bson:"publishers" json:"publishers"`
+	SubscriberCount int64              `bson:"subscriber_count" json:"subscriber_count"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type ChannelSubscription struct {
+	ChannelID    primitive.ObjectID `bson:"channel_id" json:"channel_id"`
+	UserID       string             `bson:"user_id" json:"user_id"`
+	SubscribedAt time.Time          `bson:"subscribed_at" json:"subscribed_at"`
+}
+
+func (ch *Channel) IsPublisher(userID string) bool {
+	for _, id := range ch.Publishers {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateChannelRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+}
+
+type AddChannelPublisherRequest struct {
+	UserID string `json:"user_id" validate:"required"`
+}
+
+type PublishMessageRequest struct {
+	Content string `json:"content" validate:"required,max=1000"`
+	Type    string `json:"type" validate:"oneof=text image"`
+}
+
+func (r *CreateChannelRequest) Validate() []string {
+	var errors []string
+
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > 100 {
+		errors = append(errors, "Channel name must be 1-100 characters")
+	}
+
+	if len(r.Description) > 500 {
+		errors = append(errors, "Description too long (max 500 characters)")
+	}
+
+	return errors
+}
+
+func (r *PublishMessageRequest) Validate() []string {
+	var errors []string
+
+	if r.Content == "" {
+		errors = append(errors, "Message content is required")
+	}
+
+	if len(r.Content) > 1000 {
+		errors = append(errors, "Message too long (max 1000 characters)")
+	}
+
+	// Channels carry plain posts, system and deleted types are set by the server
+	switch r.Type {
+	case "":
+		r.Type = MessageTypeText
+	case MessageTypeText, MessageTypeImage:
+	default:
+		errors = append(errors, "Invalid message type")
+	}
+
+	return errors
+}
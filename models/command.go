@@ -0,0 +1,48 @@
+package models
+
+import (
+	"net/url"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// BotCommand is a slash command registered by a bot, stored in the bot_commands
+// collection. Invocations are posted to URL, signed with Secret.
+type BotCommand struct {
+	Name        string    `bson:"_id" json:"name"`
+	Usage       string    `bson:"usage,omitempty" json:"usage,omitempty"`
+	Description string    `bson:"description" json:"description"`
+	URL         string    `bson:"url" json:"url"`
+	Secret      string    `bson:"secret" json:"-"`
+	OwnerID     string    `bson:"owner_id" json:"owner_id"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+}
+
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+type RegisterCommandRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Usage       string `json:"usage" validate:"max=100"`
+	Description string `json:"description" validate:"required,max=100"`
+	URL         string `json:"url" validate:"required,url"`
+}
+
+func (r *RegisterCommandRequest) Validate() []string {
+	var errors []string
+
+	if !commandNamePattern.MatchString(r.Name) {
+		errors = append(errors, "Name must be 1-32 lowercase letters, numbers or underscores")
+	}
+	if r.Description == "" || utf8.RuneCountInString(r.Description) > 100 {
+		errors = append(errors, "Description must be 1-100 characters")
+	}
+	if utf8.RuneCountInString(r.Usage) > 100 {
+		errors = append(errors, "Usage must be at most 100 characters")
+	}
+	if u, err := url.Parse(r.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		errors = append(errors, "URL must be an http or https URL")
+	}
+
+	return errors
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// Contacts holds one user's private annotations of other users, stored as a single
+// document per owner in the contacts collection. Nobody else can see them.
+type Contacts struct {
+	OwnerID string             `bson:"_id" json:"-"`
+	Entries map[string]Contact `bson:"entries" json:"entries"` // Keyed by the annotated user's ID
+}
+
+type Contact struct {
+	Favorite  bool      `bson:"favorite,omitempty" json:"favorite"`
+	Nickname  string    `bson:"nickname,omitempty" json:"nickname,omitempty"`
+	Note      string    `bson:"note,omitempty" json:"note,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// IsEmpty reports whether the contact carries no annotation and can be dropped
+func (c Contact) IsEmpty() bool {
+	return !c.Favorite && c.Nickname == "" && c.Note == ""
+}
+
+// UpdateContactRequest changes only the fields that are present, empty strings clear them
+type UpdateContactRequest struct {
+	Favorite *bool   `json:"favorite"`
+	Nickname *string `json:"nickname" validate:"max=32"`
+	Note     *string `json:"note" validate:"max=500"`
+}
+
+func (r *UpdateContactRequest) Validate() []string {
+	var errors []string
+
+	if r.Favorite == nil && r.Nickname == nil && r.Note == nil {
+		errors = append(errors, "Nothing to update")
+	}
+	if r.Nickname != nil && utf8.RuneCountInString(*r.Nickname) > 32 {
+		errors = append(errors, "Nickname must be at most 32 characters")
+	}
+	if r.Note != nil && utf8.RuneCountInString(*r.Note) > 500 {
+		errors = append(errors, "Note must be at most 500 characters")
+	}
+
+	return errors
+}
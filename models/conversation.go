@@ -0,0 +1,119 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxPinnedMessages caps the pinned list of a conversation or room
+const MaxPinnedMessages = 10
+
+// Conversation holds shared state of a direct conversation between two users
+type Conversation struct {
+	ID           string          `bson:"_id" json:"id"`
+	Participants []string        `bson:"participants" json:"participants"`
+	Pinned       []PinnedMessage `bson:"pinned,omitempty" json:"pinned"`
+	Request      *MessageRequest `bson:"request,omitempty" json:"request,omitempty"` // Set while the recipient has not accepted a first contact
+	AcceptedAt   *time.Time      `bson:"accepted_at,omitempty" json:"accepted_at,omitempty"`
+	BlockedBy    []string        `bson:"blocked_by,omitempty" json:"-"` // Participants who blocked the other one
+	CreatedAt    time.Time       `bson:"created_at" json:"created_at"`
+}
+
+// MessageRequest is a first contact from someone the recipient does not know. Until
+// it is accepted the conversation sits in the recipient's requests list, and the
+// sender learns nothing about whether their messages were read.
+type MessageRequest struct {
+	SenderID    string     `bson:"sender_id" json:"sender_id"`
+	RecipientID string     `bson:"recipient_id" json:"recipient_id"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	DismissedAt *time.Time `bson:"dismissed_at,omitempty" json:"dismissed_at,omitempty"` // Deleted by the recipient, hidden until the next message
+}
+
+// PendingFor reports whether the conversation is an open request awaiting the user
+func (c *Conversation) PendingFor(userID string) bool {
+	return c.Request != nil && c.Request.RecipientID == userID && c.Request.DismissedAt == nil
+}
+
+// HiddenFrom reports whether the conversation stays out of the user's conversation
+// list, as a request to them that is pending or was deleted
+func (c *Conversation) HiddenFrom(userID string) bool {
+	return c.Request != nil && c.Request.RecipientID == userID
+}
+
+// Blocked reports whether the user blocked the other participant
+func (c *Conversation) Blocked(by string) bool {
+	for _, id := range c.BlockedBy {
+		if id == by {
+			return true
+		}
+	}
+	return false
+}
+
+type PinnedMessage struct {
+	MessageID primitive.ObjectID `bson:"message_id" json:"message_id"`
+	PinnedBy  string             `bson:"pinned_by" json:"pinned_by"`
+	PinnedAt  time.Time          `bson:"pinned_at" json:"pinned_at"`
+}
+
+// ReadCursor is a user's read position in a direct conversation. Messages from the
+// other participant created at or before ReadAt count as read, so moving it is a
+// single write however many messages it covers.
+type ReadCursor struct {
+	UserID    string             `bson:"user_id" json:"user_id"`
+	OtherID   string             `bson:"other_id" json:"-"`
+	MessageID primitive.ObjectID `bson:"message_id,omitempty" json:"message_id,omitempty"` // Zero when set by timestamp
+	ReadAt    time.Time          `bson:"read_at" json:"read_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Covers reports whether the message counts as read. Messages marked read before
+// cursors existed keep their flag.
+func (c ReadCursor) Covers(m *Message) bool {
+	return m.Read || !m.CreatedAt.After(c.ReadAt)
+}
+
+// UpdateReadCursorRequest moves the read position up to a message or a timestamp
+type UpdateReadCursorRequest struct {
+	MessageID string     `json:"message_id"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+func (r *UpdateReadCursorRequest) Validate() []string {
+	var errors []string
+
+	if (r.MessageID == "") == (r.ReadAt == nil) {
+		errors = append(errors, "Specify either message_id or read_at")
+	}
+
+	return errors
+}
+
+// ConversationID returns the deterministic ID of the direct conversation between two users
+func ConversationID(userA, userB string) string {
+	ids := []string{userA, userB}
+	sort.Strings(ids)
+	return ids[0] + "_" + ids[1]
+}
+
+// ConversationParticipants splits a conversation ID back into its two user IDs
+func ConversationParticipants(conversationID string) ([]string, bool) {
+	ids := strings.Split(conversationID, "_")
+	if len(ids) != 2 || ids[0] == "" || ids[1] == "" || ids[0] == ids[1] {
+		return nil, false
+	}
+	return ids, true
+}
+
+// HasPin reports whether the message is in the pinned list
+func HasPin(pinned []PinnedMessage, messageID primitive.ObjectID) bool {
+	for _, p := range pinned {
+		if p.MessageID == messageID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ContentCipher encrypts message content before it is written to MongoDB, see
+// package atrest. Scope names the conversation whose data key is used.
+type ContentCipher interface {
+	Seal(scope string, plaintext []byte) ([]byte, error)
+	Open(scope string, sealed []byte) ([]byte, error)
+}
+
+var contentCipher ContentCipher
+
+// UseContentCipher turns on encryption of message content at rest, called once at startup
+func UseContentCipher(c ContentCipher) {
+	contentCipher = c
+}
+
+// ErrContentSealed is returned when reading encrypted content without a key configured
+var ErrContentSealed = errors.New("message content is encrypted at rest but no key is configured")
+
+// ConversationKey is a conversation's data key, wrapped by a key encryption key.
+// Room and channel messages use their room's or channel's key.
+type ConversationKey struct {
+	Scope      string    `bson:"_id"`
+	KeyID      string    `bson:"key_id"` // Key encryption key that wrapped it
+	WrappedKey []byte    `bson:"wrapped_key"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+// EncryptionScope names the conversation whose data key encrypts the message
+func (m *Message) EncryptionScope() string {
+	switch {
+	case m.RoomID != "":
+		return "room:" + m.RoomID
+	case m.ChannelID != "":
+		return "channel:" + m.ChannelID
+	default:
+		return "direct:" + ConversationID(m.SenderID, m.ReceiverID)
+	}
+}
+
+// messageFields is Message without its BSON hooks
+type messageFields Message
+
+// storedMessage is a message as written to MongoDB. With encryption at rest the
+// content and its formatting entities, which hold link URLs, are moved to
+// SealedContent and SealedEntities and the plain fields are left empty, so code
+// that clears content must unset sealed_content and sealed_entities as well.
+type storedMessage struct {
+	Fields         messageFields `bson:",inline"`
+	SealedContent  []byte        `bson:"sealed_content,omitempty"`
+	SealedEntities []byte        `bson:"sealed_entities,omitempty"`
+}
+
+// MarshalBSON encrypts the content when encryption at rest is enabled
+func (m Message) MarshalBSON() ([]byte, error) {
+	stored := storedMessage{Fields: messageFields(m)}
+	if contentCipher != nil && m.Content != "" {
+		sealed, err := contentCipher.Seal(m.EncryptionScope(), []byte(m.Content))
+		if err != nil {
+			return nil, err
+		}
+		stored.Fields.Content, stored.SealedContent = "", sealed
+	}
+	if contentCipher != nil && len(m.Entities) > 0 {
+		entities, err := json.Marshal(m.Entities)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := contentCipher.Seal(m.EncryptionScope(), entities)
+		if err != nil {
+			return nil, err
+		}
+		stored.Fields.Entities, stored.SealedEntities = nil, sealed
+	}
+	return bson.Marshal(stored)
+}
+
+// UnmarshalBSON decrypts content encrypted at rest, plaintext written before
+// encryption was enabled is read as is
+func (m *Message) UnmarshalBSON(data []byte) error {
+	var stored storedMessage
+	if err := bson.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*m = Message(stored.Fields)
+
+	if len(stored.SealedContent) == 0 && len(stored.SealedEntities) == 0 {
+		return nil
+	}
+	if contentCipher == nil {
+		return ErrContentSealed
+	}
+
+	if len(stored.SealedContent) > 0 {
+		content, err := contentCipher.Open(m.EncryptionScope(), stored.SealedContent)
+		if err != nil {
+			return err
+		}
+		m.Content = string(content)
+	}
+	if len(stored.SealedEntities) > 0 {
+		entities, err := contentCipher.Open(m.EncryptionScope(), stored.SealedEntities)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(entities, &m.Entities); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import "strings"
+
+// Event is a server-pushed WebSocket payload that is not a chat message
+type Event struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// WebSocket event names
+const (
+	EventRoomUpdated           = "room_updated"
+	EventMemberAdded           = "member_added"
+	EventMemberRemoved         = "member_removed"
+	EventMemberRoleChanged     = "member_role_changed"
+	EventMessageDeleted        = "message_deleted"
+	EventMessageExpired        = "message_expired" // A disappearing message's content was removed
+	EventReadCountUpdated      = "read_count_updated"
+	EventReadCursorUpdated     = "read_cursor_updated" // A direct conversation participant read up to a point
+	EventMessagePinned         = "message_pinned"
+	EventMessageUnpinned       = "message_unpinned"
+	EventMessageRejected       = "message_rejected"
+	EventSendFailed            = "send_failed"             // A message could not be stored, the client may send it again
+	EventMessageRequest        = "message_request"         // A direct message from a stranger, for the requests list
+	EventMessageRequestUpdated = "message_request_updated" // The recipient accepted, deleted or blocked a request
+	EventNotification          = "notification"
+	EventServiceNotice         = "service_notice"
+	EventPresence              = "presence" // A user came online, went away or went offline
+	EventTyping                = "typing"
+	EventCommandResponse       = "command_response"   // Ephemeral slash command answer, only the invoking user gets it
+	EventMessageDelivered      = "message_delivered"  // The receiver has the conversation in view
+	EventAppearanceUpdated     = "appearance_updated" // The user changed a conversation's theme on another device
+	EventSupportAccess         = "support_access"     // Support asked for, used or lost access to the user's message metadata
+	EventAttachmentScanned     = "attachment_scanned" // A quarantined upload of the user was found clean or infected
+	EventHello                 = "hello"              // First event on every connection
+	EventGoodbye               = "goodbye"            // Last event before the server closes the connection
+)
+
+// Presence statuses carried by presence events and the online users list
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away" // Connected but idle, see AWAY_AFTER
+	PresenceOffline = "offline"
+)
+
+// Features advertised in the hello event, clients may request a subset with
+// ?features=a,b when connecting
+const (
+	FeatureDirectMessages   = "direct_messages"
+	FeatureRichText         = "rich_text"          // Messages carry formatting entities
+	FeatureConversationPins = "conversation_pins"  // message_pinned / message_unpinned events
+	FeatureServiceNotices   = "service_notices"    // service_notice events
+	FeatureTraceContext     = "trace_context"      // traceparent on messages
+	FeatureEphemeral        = "ephemeral"          // view_once / expires_in, message_expired events
+	FeatureSlashCommands    = "slash_commands"     // Messages starting with / run commands, command_response events
+	FeatureFocus            = "conversation_focus" // conversation_focus frames, message_delivered events
+	FeatureRooms            = "rooms"              // MongoDB storage only
+	FeatureChannels         = "channels"           // MongoDB storage only
+	FeatureE2EE             = "e2ee"               // MongoDB storage only
+	FeatureAppearance       = "appearance"         // appearance in hello, appearance_updated events, MongoDB storage only
+)
+
+// Reasons a user's WebSocket session is closed by the server, sent as the close frame text
+const (
+	DisconnectReasonKicked             = "kicked"              // Admin ended the session
+	DisconnectReasonBanned             = "banned"              // User was banned
+	DisconnectReasonAccountDeactivated = "account_deactivated" // User deactivated their account
+	DisconnectReasonAccountDeleted     = "account_deleted"     // Account scheduled for deletion
+	DisconnectReasonPasswordChanged    = "password_changed"    // Credentials changed, log in again
+	DisconnectReasonSessionRevoked     = "session_revoked"     // Token revoked
+	DisconnectReasonReplaced           = "replaced"            // Oldest session evicted by a newer one past the per-user limit
+	DisconnectReasonSessionLimit       = "session_limit"       // New session refused, the user has too many open
+	DisconnectReasonSlowConsumer       = "slow_consumer"       // Client did not keep up with its send buffer
+	DisconnectReasonServerShutdown     = "server_shutdown"     // Server is restarting, reconnect shortly
+	DisconnectReasonAccountUpgraded    = "account_upgraded"    // Guest became a full account, reconnect
+	DisconnectReasonGuestExpired       = "guest_expired"       // Guest account expired without an upgrade
+)
+
+// Service notice levels
+const (
+	NoticeLevelInfo     = "info"
+	NoticeLevelWarning  = "warning"
+	NoticeLevelCritical = "critical"
+)
+
+type ServiceNoticeRequest struct {
+	Message string `json:"message" validate:"required,max=500"`
+	Level   string `json:"level" validate:"oneof=info warning critical"`
+}
+
+func (r *ServiceNoticeRequest) Validate() []string {
+	var errors []string
+
+	r.Message = strings.TrimSpace(r.Message)
+	if r.Message == "" {
+		errors = append(errors, "Message is required")
+	} else if len(r.Message) > 500 {
+		errors = append(errors, "Message must be at most 500 characters")
+	}
+
+	switch r.Level {
+	case "":
+		r.Level = NoticeLevelInfo
+	case NoticeLevelInfo, NoticeLevelWarning, NoticeLevelCritical:
+	default:
+		errors = append(errors, "Level must be info, warning or critical")
+	}
+
+	return errors
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// canonical folds an identifier so that forms a person would consider the same
+// compare equal: surrounding space trimmed, compatibility characters (full-width
+// letters, ligatures) normalized and case ignored
+func canonical(s string) string {
+	return strings.ToLower(norm.NFKC.String(strings.TrimSpace(s)))
+}
+
+// CanonicalUsername returns the form usernames are unique and looked up by, the
+// username itself keeps the case the user chose
+func CanonicalUsername(username string) string {
+	return canonical(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+}
+
+// CanonicalEmail returns the form emails are unique and looked up by
+func CanonicalEmail(email string) string {
+	return canonical(email)
+}
+
+// IsEmailLogin reports whether a login identifier is an email rather than a
+// username, usernames can't contain @
+func IsEmailLogin(identifier string) bool {
+	return strings.Contains(identifier, "@")
+}
+
+// Canonicalize refreshes the canonical forms after the username or email changed
+func (u *User) Canonicalize() {
+	u.UsernameCanonical = CanonicalUsername(u.Username)
+	u.EmailCanonical = CanonicalEmail(u.Email)
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limits of integrations and the conversation tokens they mint
+const (
+	MaxIntegrationUsers         = 10000
+	MaxConversationTokenSeconds = 60 * 60
+)
+
+// Integration is an external product that embeds chat through conversation tokens,
+// stored in the integrations collection. Only a hash of its API key is kept, and
+// Users maps the integrator's own user IDs to the accounts they may act as.
+type Integration struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	KeyHash   string             `bson:"key_hash" json:"-"`
+	KeyPrefix string             `bson:"key_prefix" json:"key_prefix"` // Lets admins tell keys apart
+	Users     map[string]string  `bson:"users" json:"users"`           // External user ID to user ID
+	CreatedBy string             `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// Maps reports whether the integration may act as the user
+func (i *Integration) Maps(userID string) bool {
+	for _, id := range i.Users {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// External IDs become map keys in MongoDB, so dots and dollar signs are not allowed
+var externalUserIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_:@-]{1,64}$`)
+
+// IsValidExternalUserID accepts the integrator's user IDs, such as "cust-1042"
+func IsValidExternalUserID(id string) bool {
+	return externalUserIDRegex.MatchString(id)
+}
+
+func validateIntegrationUsers(users map[string]string) []string {
+	var errors []string
+
+	if len(users) > MaxIntegrationUsers {
+		errors = append(errors, "At most 10000 users can be mapped")
+	}
+	for external, userID := range users {
+		if !IsValidExternalUserID(external) {
+			errors = append(errors, "Invalid external user ID: "+external)
+		}
+		if userID == "" {
+			errors = append(errors, "Missing user ID for "+external)
+		}
+	}
+
+	return errors
+}
+
+type CreateIntegrationRequest struct {
+	Name  string            `json:"name" validate:"required,max=100"`
+	Users map[string]string `json:"users"`
+}
+
+func (r *CreateIntegrationRequest) Validate() []string {
+	var errors []string
+
+	if r.Name == "" || len(r.Name) > 100 {
+		errors = append(errors, "Name must be 1-100 characters")
+	}
+	errors = append(errors, validateIntegrationUsers(r.Users)...)
+
+	return errors
+}
+
+// UpdateIntegrationRequest renames an integration or replaces its user mapping
+type UpdateIntegrationRequest struct {
+	Name  *string           `json:"name,omitempty"`
+	Users map[string]string `json:"users,omitempty"`
+}
+
+func (r *UpdateIntegrationRequest) Validate() []string {
+	var errors []string
+
+	if r.Name != nil && (*r.Name == "" || len(*r.Name) > 100) {
+		errors = append(errors, "Name must be 1-100 characters")
+	}
+	errors = append(errors, validateIntegrationUsers(r.Users)...)
+
+	return errors
+}
+
+// ConversationTokenRequest mints a token for one conversation of a mapped user, named
+// either by its ID or, for a direct conversation, by the other mapped user
+type ConversationTokenRequest struct {
+	ExternalUserID     string `json:"external_user_id"`
+	ConversationID     string `json:"conversation_id,omitempty"`       // Room ID or direct conversation ID
+	PeerExternalUserID string `json:"peer_external_user_id,omitempty"` // Direct conversation with another mapped user
+	ExpiresIn          int    `json:"expires_in,omitempty"`            // Seconds, defaults to CONVERSATION_TOKEN_TTL
+}
+
+func (r *ConversationTokenRequest) Validate() []string {
+	var errors []string
+
+	if !IsValidExternalUserID(r.ExternalUserID) {
+		errors = append(errors, "Invalid external user ID")
+	}
+	if (r.ConversationID == "") == (r.PeerExternalUserID == "") {
+		errors = append(errors, "Exactly one of conversation_id and peer_external_user_id is required")
+	}
+	if r.PeerExternalUserID != "" && !IsValidExternalUserID(r.PeerExternalUserID) {
+		errors = append(errors, "Invalid peer external user ID")
+	}
+	if r.ExpiresIn < 0 || r.ExpiresIn > MaxConversationTokenSeconds {
+		errors = append(errors, "Expires in must be between 1 and 3600 seconds")
+	}
+
+	return errors
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/base64"
+	"time"
+)
+
+// MaxOneTimePreKeys caps how many unused one-time prekeys a user can store
+const MaxOneTimePreKeys = 100
+
+// PreKey is a public key uploaded by a client. The server never sees private keys.
+type PreKey struct {
+	KeyID     int    `bson:"key_id" json:"key_id"`
+	PublicKey string `bson:"public_key" json:"public_key"` // Base64
+}
+
+type SignedPreKey struct {
+	KeyID     int    `bson:"key_id" json:"key_id"`
+	PublicKey string `bson:"public_key" json:"public_key"` // Base64
+	Signature string `bson:"signature" json:"signature"`   // Base64, signed by the identity key
+}
+
+// KeyBundle holds a user's public E2EE keys, keyed by user ID
+type KeyBundle struct {
+	UserID         string       `bson:"_id" json:"user_id"`
+	IdentityKey    string       `bson:"identity_key" json:"identity_key"` // Base64
+	SignedPreKey   SignedPreKey `bson:"signed_prekey" json:"signed_prekey"`
+	OneTimePreKeys []PreKey     `bson:"one_time_prekeys" json:"-"`
+	UpdatedAt      time.Time    `bson:"updated_at" json:"updated_at"`
+}
+
+type UploadKeyBundleRequest struct {
+	IdentityKey    string       `json:"identity_key" validate:"required,base64"`
+	SignedPreKey   SignedPreKey `json:"signed_prekey" validate:"required"`
+	OneTimePreKeys []PreKey     `json:"one_time_prekeys"`
+}
+
+type UploadPreKeysRequest struct {
+	OneTimePreKeys []PreKey `json:"one_time_prekeys" validate:"required"`
+}
+
+func isBase64(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := base64.StdEncoding.DecodeString(s)
+	return err == nil
+}
+
+func validatePreKeys(keys []PreKey) []string {
+	var errors []string
+
+	if len(keys) > MaxOneTimePreKeys {
+		errors = append(errors, "Too many one-time prekeys (max 100)")
+	}
+
+	for _, k := range keys {
+		if !isBase64(k.PublicKey) {
+			errors = append(errors, "One-time prekeys must be base64 encoded")
+			break
+		}
+	}
+
+	return errors
+}
+
+func (r *UploadKeyBundleRequest) Validate() []string {
+	var errors []string
+
+	if !isBase64(r.IdentityKey) {
+		errors = append(errors, "Identity key must be base64 encoded")
+	}
+
+	if !isBase64(r.SignedPreKey.PublicKey) || !isBase64(r.SignedPreKey.Signature) {
+		errors = append(errors, "Signed prekey and signature must be base64 encoded")
+	}
+
+	return append(errors, validatePreKeys(r.OneTimePreKeys)...)
+}
+
+func (r *UploadPreKeysRequest) Validate() []string {
+	if len(r.OneTimePreKeys) == 0 {
+		return []string{"At least one prekey is required"}
+	}
+	return validatePreKeys(r.OneTimePreKeys)
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of conversation labels
+const (
+	MaxLabels          = 50 // Per user
+	MaxLabelsPerChat   = 10 // On one conversation
+	MaxLabelNameLength = 32
+)
+
+// Labels holds one user's conversation labels ("Work", "Family") and which of the
+// user's conversations carry them, stored as a single document per owner in the
+// labels collection. Like contacts, the other participants never see them.
+type Labels struct {
+	OwnerID     string              `bson:"_id" json:"-"`
+	Labels      []Label             `bson:"labels" json:"labels"`
+	Assignments map[string][]string `bson:"assignments,omitempty" json:"-"` // Conversation or room ID -> label IDs
+}
+
+type Label struct {
+	ID        string    `bson:"id" json:"id"`
+	Name      string    `bson:"name" json:"name"`
+	Color     string    `bson:"color,omitempty" json:"color,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Find returns the label with the ID
+func (l *Labels) Find(id string) (Label, bool) {
+	for _, label := range l.Labels {
+		if label.ID == id {
+			return label, true
+		}
+	}
+	return Label{}, false
+}
+
+// NameTaken reports whether another label already has the name, ignoring case
+func (l *Labels) NameTaken(name, exceptID string) bool {
+	for _, label := range l.Labels {
+		if label.ID != exceptID && strings.EqualFold(label.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Of returns the labels on a conversation in the owner's label order, skipping
+// IDs of deleted labels
+func (l *Labels) Of(conversationID string) []Label {
+	assigned := map[string]bool{}
+	for _, id := range l.Assignments[conversationID] {
+		assigned[id] = true
+	}
+
+	labels := []Label{}
+	for _, label := range l.Labels {
+		if assigned[label.ID] {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// Has reports whether the conversation carries the label
+func (l *Labels) Has(conversationID, labelID string) bool {
+	for _, id := range l.Assignments[conversationID] {
+		if id == labelID {
+			return true
+		}
+	}
+	return false
+}
+
+// LabelAssignmentField is the path of a conversation's label IDs in the labels document
+func LabelAssignmentField(conversationID string) string {
+	return "assignments." + conversationID
+}
+
+type LabelRequest struct {
+	Name  string `json:"name" validate:"required,max=32"`
+	Color string `json:"color"` // "#RRGGBB", empty for the client's default
+}
+
+func (r *LabelRequest) Validate() []string {
+	var errors []string
+
+	if r.Name == "" || utf8.RuneCountInString(r.Name) > MaxLabelNameLength {
+		errors = append(errors, "Name must be 1-32 characters")
+	}
+	if r.Color != "" && !accentColorRegex.MatchString(r.Color) {
+		errors = append(errors, "Color must be a hex color like #4caf50")
+	}
+
+	return errors
+}
+
+// SetLabelsRequest replaces the labels on a conversation, an empty list removes them all
+type SetLabelsRequest struct {
+	Labels []string `json:"labels"`
+}
+
+func (r *SetLabelsRequest) Validate() []string {
+	var errors []string
+
+	if len(r.Labels) > MaxLabelsPerChat {
+		errors = append(errors, "A conversation can have at most 10 labels")
+	}
+
+	return errors
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Adisonsmn/ngobrolyuk/richtext"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -10,35 +11,172 @@ type Message struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	SenderID   string             `bson:"sender_id" json:"sender_id"`
 	ReceiverID string             `bson:"receiver_id" json:"receiver_id"`
+	RoomID     string             `bson:"room_id,omitempty" json:"room_id,omitempty"`
+	ChannelID  string             `bson:"channel_id,omitempty" json:"channel_id,omitempty"`
 	Content    string             `bson:"content" json:"content"`
-	Type       string             `bson:"type" json:"type"` // "text", "image", etc
+	Entities   []richtext.Entity  `bson:"entities,omitempty" json:"entities,omitempty"` // Formatting spans within Content
+	Type       string             `bson:"type" json:"type"`                             // "text", "image", "encrypted", "deleted", "expired", "system"
 	Read       bool               `bson:"read" json:"read"`
+	Shadowed   bool               `bson:"shadowed,omitempty" json:"-"` // Sender was shadow-restricted, hidden from recipients
 	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+
+	// System describes the event behind a system message, Content holds a readable fallback
+	System *SystemEvent `bson:"system,omitempty" json:"system,omitempty"`
+
+	// Disappearing messages: view-once content is removed once the receiver has read it,
+	// content with an expiry is removed when it passes, whichever comes first
+	ViewOnce  bool       `bson:"view_once,omitempty" json:"view_once,omitempty"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+
+	// Archived messages keep only this stub in the messages collection, the content
+	// lives in cold storage at ArchiveRef, see package coldstore
+	Archived   bool   `bson:"archived,omitempty" json:"-"`
+	ArchiveRef string `bson:"archive_ref,omitempty" json:"-"`
+
+	// ImportKey identifies messages imported from another chat app, so importing the
+	// same export again does not duplicate them
+	ImportKey string `bson:"import_key,omitempty" json:"-"`
+
+	// TraceParent carries the W3C trace context of the send from the sender's socket
+	// to the receivers' sockets, it is never stored
+	TraceParent string `bson:"-" json:"traceparent,omitempty"`
+	// ClientMsgID echoes the sender's own ID for the message back to them, it is
+	// never stored
+	ClientMsgID string `bson:"-" json:"client_msg_id,omitempty"`
+}
+
+// ParseFormatting strips supported markdown from text messages and records it as entities.
+// Other message types are stored as sent.
+func (m *Message) ParseFormatting() {
+	if m.Type == MessageTypeText {
+		m.Content, m.Entities = richtext.Parse(m.Content)
+	}
 }
 
 type SendMessageRequest struct {
-	ReceiverID string `json:"receiver_id" validate:"required"`
+	// Action is empty for messages, see the ClientAction values for other frames
+	Action     string `json:"action,omitempty"`
+	ReceiverID string `json:"receiver_id"`
+	RoomID     string `json:"room_id"`
 	Content    string `json:"content" validate:"required,max=1000"`
-	Type       string `json:"type" validate:"oneof=text image"`
+	Type       string `json:"type" validate:"oneof=text image encrypted"`
+	// ViewOnce removes the content after the receiver reads it
+	ViewOnce bool `json:"view_once,omitempty"`
+	// ExpiresIn removes the content this many seconds after sending
+	ExpiresIn int `json:"expires_in,omitempty"`
+	// TraceParent optionally continues a client-side trace (W3C traceparent format)
+	TraceParent string `json:"traceparent,omitempty"`
+	// ClientMsgID is the client's own ID for the message, returned in the echo and
+	// in send_failed so the client can match them to what it sent
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+}
+
+// Client frames that are not messages, they only need a receiver or room where noted
+const (
+	ClientActionActivity = "activity"           // Keeps the user from going away, e.g. on mouse or key input
+	ClientActionTyping   = "typing"             // Relayed to the receiver or room members
+	ClientActionFocus    = "conversation_focus" // The receiver's or room's conversation is in view, neither when none is
+)
+
+// Message types
+const (
+	MessageTypeText      = "text"
+	MessageTypeImage     = "image"
+	MessageTypeEncrypted = "encrypted" // Opaque ciphertext, never inspected by the server
+	MessageTypeDeleted   = "deleted"
+	MessageTypeExpired   = "expired" // View-once or expiring message whose content was removed
+	MessageTypeSystem    = "system"  // Generated by the server for room events, never sent by clients
+)
+
+// System message actions
+const (
+	SystemRoomCreated          = "room_created"
+	SystemMemberJoined         = "member_joined" // Joined through an invite link
+	SystemMemberAdded          = "member_added"
+	SystemMemberLeft           = "member_left"
+	SystemMemberRemoved        = "member_removed"
+	SystemRoomRenamed          = "room_renamed"
+	SystemTopicChanged         = "topic_changed"
+	SystemDisappearingEnabled  = "disappearing_enabled"
+	SystemDisappearingDisabled = "disappearing_disabled"
+	SystemSlowModeEnabled      = "slow_mode_enabled"
+	SystemSlowModeDisabled     = "slow_mode_disabled"
+)
+
+// SystemEvent is what happened in a system message. ActorID did it, TargetID is the
+// member it happened to, Name the new room name or topic and TTL the new message timer
+// or slow mode interval.
+type SystemEvent struct {
+	Action   string `bson:"action" json:"action"`
+	ActorID  string `bson:"actor_id" json:"actor_id"`
+	TargetID string `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	Name     string `bson:"name,omitempty" json:"name,omitempty"`
+	TTL      int    `bson:"ttl,omitempty" json:"ttl,omitempty"`
+}
+
+// Limits of ExpiresIn, in seconds
+const (
+	MinMessageExpiry = 5
+	MaxMessageExpiry = 7 * 24 * 60 * 60
+)
+
+// Disappears reports whether the message content is removed after reading or expiry
+func (m *Message) Disappears() bool {
+	return m.ViewOnce || m.ExpiresAt != nil
 }
 
+// MaxEncryptedContentLength allows room for ciphertext and encoding overhead
+const MaxEncryptedContentLength = 8192
+
+// MaxClientMsgIDLength fits UUIDs and similar client generated IDs
+const MaxClientMsgIDLength = 64
+
 func (r *SendMessageRequest) Validate() []string {
 	var errors []string
 
-	if r.ReceiverID == "" {
-		errors = append(errors, "Receiver ID is required")
+	if r.ReceiverID == "" && r.RoomID == "" {
+		errors = append(errors, "Receiver ID or room ID is required")
+	}
+
+	if r.ReceiverID != "" && r.RoomID != "" {
+		errors = append(errors, "Specify either receiver ID or room ID, not both")
 	}
 
 	if r.Content == "" {
 		errors = append(errors, "Message content is required")
 	}
 
-	if len(r.Content) > 1000 {
-		errors = append(errors, "Message too long (max 1000 characters)")
+	if r.Type == "" {
+		r.Type = MessageTypeText
 	}
 
-	if r.Type == "" {
-		r.Type = "text"
+	switch r.Type {
+	case MessageTypeEncrypted:
+		if len(r.Content) > MaxEncryptedContentLength {
+			errors = append(errors, "Encrypted payload too large (max 8192 bytes)")
+		}
+		if r.RoomID != "" {
+			errors = append(errors, "Encrypted messages are only supported in direct conversations")
+		}
+	case MessageTypeText, MessageTypeImage:
+		if len(r.Content) > 1000 {
+			errors = append(errors, "Message too long (max 1000 characters)")
+		}
+	default:
+		errors = append(errors, "Invalid message type")
+	}
+
+	if len(r.ClientMsgID) > MaxClientMsgIDLength {
+		errors = append(errors, "client_msg_id too long (max 64 characters)")
+	}
+
+	if r.ViewOnce || r.ExpiresIn != 0 {
+		if r.RoomID != "" {
+			errors = append(errors, "Disappearing messages are only supported in direct conversations")
+		}
+		if r.ExpiresIn != 0 && (r.ExpiresIn < MinMessageExpiry || r.ExpiresIn > MaxMessageExpiry) {
+			errors = append(errors, "expires_in must be between 5 seconds and 7 days")
+		}
 	}
 
 	return errors
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Outbox topics, the event name external consumers receive
+const (
+	TopicMessageCreated = "message.created"
+)
+
+// OutboxEntry is an event for external systems, written in the same transaction as
+// the change it describes and published by the outbox relay at least once
+type OutboxEntry struct {
+	ID      primitive.ObjectID `bson:"_id" json:"id"` // Doubles as the delivery ID consumers deduplicate on
+	Topic   string             `bson:"topic" json:"topic"`
+	Key     string             `bson:"key" json:"key"` // Conversation the event belongs to
+	Payload []byte             `bson:"payload" json:"payload"`
+
+	CreatedAt     time.Time  `bson:"created_at" json:"created_at"`
+	Attempts      int        `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time  `bson:"next_attempt_at" json:"next_attempt_at"` // Also the lease of the relay that claimed it
+	LastError     string     `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	PublishedAt   *time.Time `bson:"published_at,omitempty" json:"published_at,omitempty"`
+}
+
+// MessageCreatedEvent describes a stored message without its content, so the
+// outbox never holds text that encryption at rest or disappearing messages
+// would otherwise protect. Consumers fetch the message if they need it.
+type MessageCreatedEvent struct {
+	MessageID      string     `json:"message_id"`
+	ConversationID string     `json:"conversation_id"`
+	SenderID       string     `json:"sender_id"`
+	ReceiverID     string     `json:"receiver_id,omitempty"`
+	RoomID         string     `json:"room_id,omitempty"`
+	ChannelID      string     `json:"channel_id,omitempty"`
+	Type           string     `json:"type"`
+	ViewOnce       bool       `json:"view_once,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// MessageCreated builds the outbox entry announcing a new message
+func MessageCreated(m *Message) OutboxEntry {
+	key := m.RoomID
+	switch {
+	case m.ChannelID != "":
+		key = m.ChannelID
+	case key == "":
+		key = ConversationID(m.SenderID, m.ReceiverID)
+	}
+
+	// Marshalling a struct of strings and times cannot fail
+	payload, _ := json.Marshal(MessageCreatedEvent{
+		MessageID:      m.ID.Hex(),
+		ConversationID: key,
+		SenderID:       m.SenderID,
+		ReceiverID:     m.ReceiverID,
+		RoomID:         m.RoomID,
+		ChannelID:      m.ChannelID,
+		Type:           m.Type,
+		ViewOnce:       m.ViewOnce,
+		ExpiresAt:      m.ExpiresAt,
+		CreatedAt:      m.CreatedAt,
+	})
+
+	return OutboxEntry{
+		ID:            primitive.NewObjectID(),
+		Topic:         TopicMessageCreated,
+		Key:           key,
+		Payload:       payload,
+		CreatedAt:     m.CreatedAt,
+		NextAttemptAt: m.CreatedAt,
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// QR login challenge statuses, sent as the event name on the desktop's event stream
+const (
+	QRLoginPending   = "pending"   // Waiting for a phone to scan and approve
+	QRLoginApproved  = "approved"  // Approved, the desktop can exchange it for a session
+	QRLoginRejected  = "rejected"  // The phone declined
+	QRLoginExpired   = "expired"   // Nobody approved in time
+	QRLoginCompleted = "completed" // The desktop already got its session
+)
+
+// QRLogin is a desktop waiting to be logged in, stored so that any instance can
+// answer it. The code is shown in the QR payload for the phone, the secret stays on
+// the desktop and claims the session, only its hash is kept.
+type QRLogin struct {
+	Code       string    `bson:"_id"`
+	SecretHash string    `bson:"secret_hash"`
+	UserAgent  string    `bson:"user_agent"`
+	IP         string    `bson:"ip"`
+	Status     string    `bson:"status"`
+	UserID     string    `bson:"user_id,omitempty"` // Set when the phone answers
+	CreatedAt  time.Time `bson:"created_at"`
+	ExpiresAt  time.Time `bson:"expires_at"`
+}
+
+// StatusAt reports the status, pending challenges past their expiry are expired
+func (l *QRLogin) StatusAt(now time.Time) string {
+	if l.Status == QRLoginPending && now.After(l.ExpiresAt) {
+		return QRLoginExpired
+	}
+	return l.Status
+}
+
+type QRLoginDecisionRequest struct {
+	Code string `json:"code" validate:"required"` // Scanned from the QR payload
+}
+
+type QRLoginSessionRequest struct {
+	Secret string `json:"secret" validate:"required"` // Returned to the desktop with the challenge
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReporterSystem marks reports filed automatically by the server
+const ReporterSystem = "system"
+
+// Report statuses
+const (
+	ReportStatusOpen     = "open"
+	ReportStatusResolved = "resolved"
+)
+
+type Report struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	MessageID  primitive.ObjectID `bson:"message_id" json:"message_id"`
+	SenderID   string             `bson:"sender_id" json:"sender_id"`
+	ReporterID string             `bson:"reporter_id" json:"reporter_id"`
+	Reasons    []string           `bson:"reasons" json:"reasons"`
+	Status     string             `bson:"status" json:"status"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
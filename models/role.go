@@ -0,0 +1,103 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// Platform permissions checked by middleware.RequirePermission
+const (
+	PermStatsView          = "stats.view"          // Usage metrics
+	PermModerationView     = "moderation.view"     // Moderation counters and user reports
+	PermSpamManage         = "spam.manage"         // List and lift spam restrictions
+	PermUsersBan           = "users.ban"           // Ban and unban IPs, users and devices
+	PermSessionsDisconnect = "sessions.disconnect" // Kick a user's WebSocket session
+	PermMessagesDeleteAny  = "messages.delete.any" // Delete any direct or room message
+	PermRolesManage        = "roles.manage"        // Edit roles and assign them to users
+	PermNoticesSend        = "notices.send"        // Broadcast service notices to all connected users
+	PermStorageManage      = "storage.manage"      // View attachment usage and adjust storage quotas
+	PermCommandsManage     = "commands.manage"     // Register and remove bot slash commands
+	PermFlagsManage        = "flags.manage"        // Roll feature flags out or back
+	PermSupportInspect     = "support.inspect"     // Inspect a consenting user's message metadata
+	PermIntegrationsManage = "integrations.manage" // Issue and revoke integration API keys
+)
+
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions is the registry of every permission a role can grant
+var Permissions = []PermissionInfo{
+	{PermStatsView, "View usage metrics"},
+	{PermModerationView, "View moderation counters and user reports"},
+	{PermSpamManage, "List and lift spam restrictions"},
+	{PermUsersBan, "Ban and unban IP ranges, users and devices"},
+	{PermSessionsDisconnect, "Force-close a user's WebSocket session"},
+	{PermMessagesDeleteAny, "Delete any direct or room message"},
+	{PermRolesManage, "Edit roles and assign them to users"},
+	{PermNoticesSend, "Broadcast service notices to all connected users"},
+	{PermStorageManage, "View attachment usage and adjust per-account storage quotas"},
+	{PermCommandsManage, "Register and remove bot slash commands"},
+	{PermFlagsManage, "Turn feature flags on or off and change their rollout"},
+	{PermSupportInspect, "Request time-boxed access to a user's message metadata and delivery status, with their consent"},
+	{PermIntegrationsManage, "Create integrations, map their users and revoke their API keys"},
+}
+
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// UserRoleModerator is seeded with the moderation permissions, admins can edit it
+const UserRoleModerator = "moderator"
+
+// DefaultModeratorPermissions seeds the moderator role
+var DefaultModeratorPermissions = []string{
+	PermModerationView, PermSpamManage, PermUsersBan, PermSessionsDisconnect, PermMessagesDeleteAny,
+}
+
+// Role maps a user role to the permissions it grants, stored in the roles collection.
+// The admin role is built in and always holds every permission.
+type Role struct {
+	Name        string    `bson:"_id" json:"name"`
+	Description string    `bson:"description" json:"description"`
+	Permissions []string  `bson:"permissions" json:"permissions"`
+	UpdatedBy   string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+var roleNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// IsValidRoleName accepts short lowercase names such as "moderator" or "support_lead"
+func IsValidRoleName(name string) bool {
+	return roleNameRegex.MatchString(name)
+}
+
+type UpdateRoleRequest struct {
+	Description string   `json:"description" validate:"max=200"`
+	Permissions []string `json:"permissions"`
+}
+
+func (r *UpdateRoleRequest) Validate() []string {
+	var errors []string
+
+	if len(r.Description) > 200 {
+		errors = append(errors, "Description must be at most 200 characters")
+	}
+	for _, p := range r.Permissions {
+		if !IsPermission(p) {
+			errors = append(errors, "Unknown permission: "+p)
+		}
+	}
+
+	return errors
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role"` // Empty removes the user's role
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Room roles, ordered from most to least privileged
+const (
+	RoomRoleOwner  = "owner"
+	RoomRoleAdmin  = "admin"
+	RoomRoleMember = "member"
+)
+
+// Room permissions checked by the room controllers
+const (
+	RoomPermAddMembers     = "add_members"
+	RoomPermRemoveMembers  = "remove_members"
+	RoomPermRenameRoom     = "rename_room"
+	RoomPermPinMessages    = "pin_messages"
+	RoomPermDeleteMessages = "delete_messages" // Delete messages sent by other members
+	RoomPermManageRoles    = "manage_roles"
+)
+
+var roomRolePermissions = map[string][]string{
+	RoomRoleOwner: {
+		RoomPermAddMembers, RoomPermRemoveMembers, RoomPermRenameRoom,
+		RoomPermPinMessages, RoomPermDeleteMessages, RoomPermManageRoles,
+	},
+	RoomRoleAdmin: {
+		RoomPermAddMembers, RoomPermRemoveMembers, RoomPermRenameRoom,
+		RoomPermPinMessages, RoomPermDeleteMessages,
+	},
+	RoomRoleMember: {},
+}
+
+var roomRoleRank = map[string]int{
+	RoomRoleOwner:  3,
+	RoomRoleAdmin:  2,
+	RoomRoleMember: 1,
+}
+
+type RoomMember struct {
+	UserID     string    `bson:"user_id" json:"user_id"`
+	Role       string    `bson:"role" json:"role"`
+	JoinedAt   time.Time `bson:"joined_at" json:"joined_at"`
+	LastReadAt time.Time `bson:"last_read_at" json:"last_read_at"` // Read watermark: every message up to here is read
+}
+
+type Room struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name    string             `bson:"name" json:"name"`
+	Topic   string             `bson:"topic" json:"topic"`
+	OwnerID string             `bson:"owner_id" json:"owner_id"`
+	Members []RoomMember       `bson:"members" json:"members"`
+	Pinned  []PinnedMessage    `bson:"pinned,omitempty" json:"pinned"`
+
+	Discoverable bool      `bson:"discoverable" json:"discoverable"`                   // Listed by room discovery, off unless the room opts in
+	MessageTTL   int       `bson:"message_ttl,omitempty" json:"message_ttl,omitempty"` // Seconds until new messages disappear, 0 = never
+	SlowMode     int       `bson:"slow_mode,omitempty" json:"slow_mode"`               // Seconds each member waits between messages, 0 = off
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+	ImportKey    string    `bson:"import_key,omitempty" json:"-"` // Set on rooms created by the importer
+
+	// SlowModeUntil is when the requesting member may send again, set per response
+	SlowModeUntil *time.Time `bson:"-" json:"slow_mode_until,omitempty"`
+}
+
+// Longest slow mode interval, in seconds
+const MaxSlowMode = 6 * 60 * 60
+
+// SlowModeFor is how long the member waits between messages, admins and the owner
+// are exempt
+func (r *Room) SlowModeFor(userID string) time.Duration {
+	member := r.Member(userID)
+	if r.SlowMode <= 0 || member == nil || RoomRoleOutranks(member.Role, RoomRoleMember) {
+		return 0
+	}
+	return time.Duration(r.SlowMode) * time.Second
+}
+
+// Member returns the membership entry of the given user, or nil if not a member
+func (r *Room) Member(userID string) *RoomMember {
+	for i := range r.Members {
+		if r.Members[i].UserID == userID {
+			return &r.Members[i]
+		}
+	}
+	return nil
+}
+
+func (r *Room) MemberIDs() []string {
+	ids := make([]string, 0, len(r.Members))
+	for _, m := range r.Members {
+		ids = append(ids, m.UserID)
+	}
+	return ids
+}
+
+// ReadBy returns the members, other than the sender, whose read watermark covers the message
+func (r *Room) ReadBy(message *Message) []string {
+	readBy := []string{}
+	for _, m := range r.Members {
+		if m.UserID != message.SenderID && !m.LastReadAt.Before(message.CreatedAt) {
+			readBy = append(readBy, m.UserID)
+		}
+	}
+	return readBy
+}
+
+// Can reports whether the user's role in the room grants the permission
+func (r *Room) Can(userID, permission string) bool {
+	member := r.Member(userID)
+	if member == nil {
+		return false
+	}
+	return RoomRoleCan(member.Role, permission)
+}
+
+func RoomRoleCan(role, permission string) bool {
+	for _, p := range roomRolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RoomRoleOutranks reports whether role a is strictly more privileged than role b
+func RoomRoleOutranks(a, b string) bool {
+	return roomRoleRank[a] > roomRoleRank[b]
+}
+
+type RoomInvite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Token     string             `bson:"token" json:"token"`
+	RoomID    primitive.ObjectID `bson:"room_id" json:"room_id"`
+	CreatedBy string             `bson:"created_by" json:"created_by"`
+	MaxUses   int                `bson:"max_uses" json:"max_uses"` // 0 means unlimited
+	Uses      int                `bson:"uses" json:"uses"`
+	Revoked   bool               `bson:"revoked" json:"revoked"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type CreateRoomInviteRequest struct {
+	ExpiresIn int `json:"expires_in"` // Seconds, defaults to 24 hours
+	MaxUses   int `json:"max_uses"`
+}
+
+type CreateRoomRequest struct {
+	Name         string   `json:"name" validate:"required,max=100"`
+	Topic        string   `json:"topic" validate:"max=300"`
+	MemberIDs    []string `json:"member_ids"`
+	Discoverable bool     `json:"discoverable"`
+}
+
+type MarkRoomReadRequest struct {
+	MessageID string `json:"message_id" validate:"required"`
+}
+
+type UpdateRoomRequest struct {
+	Name         string  `json:"name" validate:"max=100"`
+	Topic        *string `json:"topic" validate:"omitempty,max=300"`
+	Discoverable *bool   `json:"discoverable"`
+	// MessageTTL makes new messages disappear after this many seconds, 0 turns it off
+	MessageTTL *int `json:"message_ttl"`
+	// SlowMode lets each member send one message per this many seconds, 0 turns it off
+	SlowMode *int `json:"slow_mode"`
+}
+
+type AddRoomMemberRequest struct {
+	UserID string `json:"user_id" validate:"required"`
+}
+
+type UpdateRoomRoleRequest struct {
+	Role string `json:"role" validate:"oneof=admin member"`
+}
+
+func (r *CreateRoomRequest) Validate() []string {
+	var errors []string
+
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || utf8.RuneCountInString(r.Name) > 100 {
+		errors = append(errors, "Room name must be 1-100 characters")
+	}
+
+	r.Topic = strings.TrimSpace(r.Topic)
+	if utf8.RuneCountInString(r.Topic) > 300 {
+		errors = append(errors, "Topic too long (max 300 characters)")
+	}
+
+	if len(r.MemberIDs) > 256 {
+		errors = append(errors, "Too many members (max 256)")
+	}
+
+	return errors
+}
+
+func (r *CreateRoomInviteRequest) Validate() []string {
+	var errors []string
+
+	if r.ExpiresIn == 0 {
+		r.ExpiresIn = int((24 * time.Hour).Seconds())
+	}
+
+	if r.ExpiresIn < 60 || r.ExpiresIn > int((30*24*time.Hour).Seconds()) {
+		errors = append(errors, "Invite expiry must be between 1 minute and 30 days")
+	}
+
+	if r.MaxUses < 0 {
+		errors = append(errors, "Max uses cannot be negative")
+	}
+
+	return errors
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of the user search index
+const (
+	maxSearchQuery = 50 // Longer queries are cut
+	maxIndexedWord = 20 // Prefixes of longer words stop here
+)
+
+// NormalizeSearch lowercases the query, drops a leading @ and collapses whitespace
+func NormalizeSearch(query string) string {
+	query = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	query = strings.TrimPrefix(query, "@")
+	if utf8.RuneCountInString(query) > maxSearchQuery {
+		query = string([]rune(query)[:maxSearchQuery])
+	}
+	return query
+}
+
+// searchWords are the lowercased names a user can be found by: the username, each
+// word of the display name and, for multi-word queries, the whole display name
+func searchWords(username, displayName string) []string {
+	words := []string{strings.ToLower(username)}
+	if name := NormalizeSearch(displayName); name != "" {
+		words = append(words, strings.Fields(name)...)
+		if strings.Contains(name, " ") {
+			words = append(words, name)
+		}
+	}
+	return words
+}
+
+// SearchPrefixes returns every prefix of the user's search words, the values a
+// prefix query is looked up by
+func SearchPrefixes(username, displayName string) []string {
+	seen := map[string]bool{}
+	prefixes := []string{}
+	for _, word := range searchWords(username, displayName) {
+		limit := maxIndexedWord
+		if strings.Contains(word, " ") {
+			limit = maxSearchQuery
+		}
+		runes := []rune(word)
+		for i := 1; i <= len(runes) && i <= limit; i++ {
+			if prefix := string(runes[:i]); !seen[prefix] {
+				seen[prefix] = true
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	return prefixes
+}
+
+// trigrams splits a word into overlapping three letter pieces, shorter words are
+// kept whole
+func trigrams(word string) []string {
+	runes := []rune(word)
+	if len(runes) < 3 {
+		return []string{word}
+	}
+	grams := make([]string, 0, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+3]))
+	}
+	return grams
+}
+
+// SearchTrigrams returns the trigrams of the user's search words, used to find
+// candidates for typo tolerant search
+func SearchTrigrams(username, displayName string) []string {
+	seen := map[string]bool{}
+	grams := []string{}
+	for _, word := range searchWords(username, displayName) {
+		if strings.Contains(word, " ") {
+			continue
+		}
+		for _, gram := range trigrams(word) {
+			if !seen[gram] {
+				seen[gram] = true
+				grams = append(grams, gram)
+			}
+		}
+	}
+	return grams
+}
+
+// FuzzyKeys returns what typo tolerant candidates are looked up by: the first two
+// letters of the query, which survive most typos past the start, and its trigrams
+func FuzzyKeys(query string) (string, []string) {
+	runes := []rune(query)
+	if len(runes) > 2 {
+		runes = runes[:2]
+	}
+
+	grams := []string{}
+	for _, word := range strings.Fields(query) {
+		grams = append(grams, trigrams(word)...)
+	}
+	return string(runes), grams
+}
+
+// typoBudget is how many typos a query of n letters may contain
+func typoBudget(n int) int {
+	switch {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of
+// neighbouring letters needed to turn a into b
+func editDistance(a, b []rune) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// prefixDistance is the fewest typos that make the query a prefix of the word
+func prefixDistance(query, word []rune) int {
+	best := len(query)
+	for n := len(query) - 1; n <= len(query)+1; n++ {
+		if n < 0 || n > len(word) {
+			continue
+		}
+		best = min(best, editDistance(query, word[:n]))
+	}
+	return best
+}
+
+// Search match scores, higher ranks first
+const (
+	scoreExactUsername  = 100
+	scoreUsernamePrefix = 80
+	scoreNamePrefix     = 60
+	scoreFuzzy          = 40 // Less 10 per typo
+)
+
+// MatchUser scores how well a normalized query matches the user's username or
+// display name. Reports false when it does not match, typos are only allowed with fuzzy.
+func MatchUser(user *User, query string, fuzzy bool) (int, bool) {
+	if query == "" {
+		return 0, false
+	}
+
+	username := strings.ToLower(user.Username)
+	switch {
+	case username == query:
+		return scoreExactUsername, true
+	case strings.HasPrefix(username, query):
+		return scoreUsernamePrefix, true
+	}
+
+	words := searchWords(user.Username, user.DisplayName)
+	for _, word := range words[1:] {
+		if strings.HasPrefix(word, query) {
+			return scoreNamePrefix, true
+		}
+	}
+
+	q := []rune(query)
+	budget := typoBudget(len(q))
+	if !fuzzy || budget == 0 {
+		return 0, false
+	}
+
+	best := budget + 1
+	for _, word := range words {
+		best = min(best, prefixDistance(q, []rune(word)))
+	}
+	if best > budget {
+		return 0, false
+	}
+	return scoreFuzzy - 10*best, true
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Notification levels
+const (
+	NotifyAll      = "all"
+	NotifyMentions = "mentions"
+	NotifyNone     = "none"
+)
+
+// NotificationSetting overrides the default ("all") notification level for one
+// conversation. ConversationID is a direct conversation ID or a room ID.
+type NotificationSetting struct {
+	UserID         string    `bson:"user_id" json:"-"`
+	ConversationID string    `bson:"conversation_id" json:"conversation_id"`
+	Level          string    `bson:"level" json:"level"`
+	UpdatedAt      time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type UpdateNotificationSettingRequest struct {
+	Level string `json:"level" validate:"required,oneof=all mentions none"`
+}
+
+func (r *UpdateNotificationSettingRequest) Validate() []string {
+	switch r.Level {
+	case NotifyAll, NotifyMentions, NotifyNone:
+		return nil
+	default:
+		return []string{"Level must be one of: all, mentions, none"}
+	}
+}
+
+var mentionPattern = regexp.MustCompile(`@([a-zA-Z0-9_]{3,20})`)
+
+// ParseMentions returns the lowercased usernames mentioned with @ in the content
+func ParseMentions(content string) map[string]bool {
+	mentions := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		mentions[strings.ToLower(match[1])] = true
+	}
+	return mentions
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SpamFlag records a restriction applied by the spam heuristics
+type SpamFlag struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Action    string             `bson:"action" json:"action"`
+	Reasons   []string           `bson:"reasons" json:"reasons"`
+	Score     float64            `bson:"score" json:"score"`
+	Lifted    bool               `bson:"lifted" json:"lifted"`
+	LiftedBy  string             `bson:"lifted_by,omitempty" json:"lifted_by,omitempty"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// StatsDayLayout formats the _id of daily rollup documents (UTC)
+const StatsDayLayout = "2006-01-02"
+
+// DailyStats is a pre-aggregated rollup of one UTC day, maintained by the stats job
+type DailyStats struct {
+	Day              string    `bson:"_id" json:"day"`
+	Messages         int64     `bson:"messages" json:"messages"`
+	NewRegistrations int64     `bson:"new_registrations" json:"new_registrations"`
+	ActiveUsers      int64     `bson:"active_users" json:"active_users"`
+	PeakConnections  int       `bson:"peak_connections" json:"peak_connections"`
+	LatencyTotalMs   int64     `bson:"latency_total_ms" json:"-"`
+	LatencySamples   int64     `bson:"latency_samples" json:"-"`
+	UpdatedAt        time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// AvgDeliveryLatencyMs is the mean time from a message being received to it
+// being written to a recipient's socket
+func (s *DailyStats) AvgDeliveryLatencyMs() float64 {
+	if s.LatencySamples == 0 {
+		return 0
+	}
+	return float64(s.LatencyTotalMs) / float64(s.LatencySamples)
+}
+
+// DailyActiveUser records that a user was active on a given day
+type DailyActiveUser struct {
+	ID     string `bson:"_id"` // day:user_id
+	Day    string `bson:"day"`
+	UserID string `bson:"user_id"`
+}
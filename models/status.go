@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Subsystem states reported by GET /status
+const (
+	SubsystemOK       = "ok"
+	SubsystemDegraded = "degraded"
+	SubsystemDown     = "down"
+	SubsystemDisabled = "disabled" // Not configured on this deployment
+)
+
+// Incident is an operator-declared problem shown as a banner in clients until it
+// is resolved, stored in the incidents collection. At most one is open at a time.
+type Incident struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Message    string             `bson:"message" json:"message"`
+	Level      string             `bson:"level" json:"level"` // A service notice level
+	CreatedBy  string             `bson:"created_by" json:"-"`
+	StartedAt  time.Time          `bson:"started_at" json:"started_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	ResolvedAt *time.Time         `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Support access statuses
+const (
+	SupportAccessPending  = "pending"  // Waiting for the user's answer
+	SupportAccessApproved = "approved" // Usable until ExpiresAt
+	SupportAccessDenied   = "denied"
+	SupportAccessRevoked  = "revoked" // Ended early by the user or the agent
+)
+
+// Support audit actions
+const (
+	SupportActionRequested = "requested"
+	SupportActionApproved  = "approved"
+	SupportActionDenied    = "denied"
+	SupportActionRevoked   = "revoked"
+	SupportActionViewed    = "viewed"
+)
+
+// Limits of support access
+const (
+	MaxSupportAccessMinutes = 60
+	SupportRequestTTL       = 24 * time.Hour // Unanswered requests cannot be approved after this
+)
+
+// SupportAccess lets one support agent inspect the metadata and delivery status of
+// one user's messages, stored in the support_access collection. The user has to
+// approve it, and it lapses Minutes after that. Message content is never shown.
+type SupportAccess struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	UserID      string             `bson:"user_id" json:"user_id"`
+	AgentID     string             `bson:"agent_id" json:"agent_id"`
+	Reason      string             `bson:"reason" json:"reason"`
+	Minutes     int                `bson:"minutes" json:"minutes"`
+	Status      string             `bson:"status" json:"status"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	RespondedAt *time.Time         `bson:"responded_at,omitempty" json:"responded_at,omitempty"`
+	ExpiresAt   *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // Set on approval
+}
+
+// Active reports whether the agent may inspect the user's messages at now
+func (a *SupportAccess) Active(now time.Time) bool {
+	return a.Status == SupportAccessApproved && a.ExpiresAt != nil && now.Before(*a.ExpiresAt)
+}
+
+// Answerable reports whether the user can still approve or deny the request
+func (a *SupportAccess) Answerable(now time.Time) bool {
+	return a.Status == SupportAccessPending && now.Before(a.CreatedAt.Add(SupportRequestTTL))
+}
+
+// SupportAudit records every step of a support access, including each message
+// inspected, in the support_audit collection
+type SupportAudit struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AccessID  primitive.ObjectID `bson:"access_id" json:"access_id"`
+	Action    string             `bson:"action" json:"action"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	AgentID   string             `bson:"agent_id" json:"agent_id"`
+	ActorID   string             `bson:"actor_id" json:"actor_id"` // Who took the action, the agent or the user
+	MessageID string             `bson:"message_id,omitempty" json:"message_id,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type SupportAccessRequest struct {
+	Reason  string `json:"reason" validate:"required,max=500"`
+	Minutes int    `json:"minutes" validate:"min=1,max=60"`
+}
+
+func (r *SupportAccessRequest) Validate() []string {
+	var errors []string
+
+	if r.Reason == "" || len(r.Reason) > 500 {
+		errors = append(errors, "Reason must be 1-500 characters")
+	}
+	if r.Minutes < 1 || r.Minutes > MaxSupportAccessMinutes {
+		errors = append(errors, "Minutes must be between 1 and 60")
+	}
+
+	return errors
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 	"time"
@@ -13,11 +14,99 @@ type User struct {
 	Password  string    `bson:"password" json:"-"` // Hide password in JSON
 	Bio       string    `bson:"bio" json:"bio"`
 	Avatar    string    `bson:"avatar" json:"avatar"`
+	Role      string    `bson:"role,omitempty" json:"role,omitempty"`
+	Status    string    `bson:"status" json:"status"`
 	Online    bool      `bson:"online" json:"online"`
 	LastSeen  time.Time `bson:"last_seen" json:"last_seen"`
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+
+	// Lowercased, normalized forms the username and email are unique and looked up
+	// by, kept by Canonicalize
+	UsernameCanonical string `bson:"username_canonical" json:"-"`
+	EmailCanonical    string `bson:"email_canonical" json:"-"`
+
+	// Optional name shown instead of the username, need not be unique
+	DisplayName string `bson:"display_name,omitempty" json:"display_name,omitempty"`
+
+	HideFromDiscovery bool `bson:"hide_from_discovery" json:"hide_from_discovery"`
+
+	// Nonce of the latest email change link, cleared when a link is used
+	EmailChangeNonce string `bson:"email_change_nonce,omitempty" json:"-"`
+
+	// Language of server-written text like system messages and emails, empty
+	// follows the client's Accept-Language
+	Language string `bson:"language,omitempty" json:"language,omitempty"`
+
+	// Guest accounts expire unless upgraded, and may only message the users who invited them
+	GuestExpiresAt *time.Time `bson:"guest_expires_at,omitempty" json:"guest_expires_at,omitempty"`
+	GuestInviters  []string   `bson:"guest_inviters,omitempty" json:"-"`
+
+	// Search index over username and display name, kept by IndexSearch
+	SearchPrefixes []string `bson:"search_prefixes,omitempty" json:"-"`
+	SearchTrigrams []string `bson:"search_trigrams,omitempty" json:"-"`
+
+	// Former usernames, newest last, capped at MaxUsernameHistory
+	UsernameHistory   []UsernameChange `bson:"username_history,omitempty" json:"-"`
+	UsernameChangedAt *time.Time       `bson:"username_changed_at,omitempty" json:"-"`
+
+	// Email digest of missed messages, on unless the user unsubscribes
+	EmailDigestOptOut bool       `bson:"email_digest_opt_out,omitempty" json:"-"`
+	LastDigestAt      *time.Time `bson:"last_digest_at,omitempty" json:"-"`
+
+	// Account deletion: set when the user requests deletion, scrubbed after the grace period
+	DeletionScheduledAt *time.Time `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"`
+	DeletedAt           *time.Time `bson:"deleted_at,omitempty" json:"-"`
+}
+
+// IsGuest reports whether the account is a guest that has not been upgraded yet
+func (u *User) IsGuest() bool {
+	return u.GuestExpiresAt != nil
+}
+
+// InvitedGuest reports whether the user invited this guest, so the guest may message them
+func (u *User) InvitedGuest(inviterID string) bool {
+	for _, id := range u.GuestInviters {
+		if id == inviterID {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexSearch refreshes the search index after the username or display name changed
+func (u *User) IndexSearch() {
+	u.SearchPrefixes = SearchPrefixes(u.Username, u.DisplayName)
+	u.SearchTrigrams = SearchTrigrams(u.Username, u.DisplayName)
+}
+
+// UsernameChange records a username the user gave up
+type UsernameChange struct {
+	Username  string    `bson:"username" json:"username"`
+	Canonical string    `bson:"canonical" json:"canonical"` // CanonicalUsername of Username, reservations match on it
+	ChangedAt time.Time `bson:"changed_at" json:"changed_at"`
+}
+
+// MaxUsernameHistory caps how many former usernames are kept per user
+const MaxUsernameHistory = 10
+
+// AppendUsernameHistory records the given up username, dropping the oldest entries past the cap
+func AppendUsernameHistory(history []UsernameChange, username string, at time.Time) []UsernameChange {
+	history = append(history, UsernameChange{Username: username, Canonical: CanonicalUsername(username), ChangedAt: at})
+	if len(history) > MaxUsernameHistory {
+		history = history[len(history)-MaxUsernameHistory:]
+	}
+	return history
 }
 
+// UserRoleAdmin holds every permission, other roles are defined in the roles collection
+const UserRoleAdmin = "admin"
+
+// User account statuses
+const (
+	UserStatusActive      = "active"
+	UserStatusDeactivated = "deactivated" // Hidden from lists, reactivated on next login
+)
+
 type RegisterRequest struct {
 	Username string `json:"username" validate:"required,min=3,max=20"`
 	Email    string `json:"email" validate:"required,email"`
@@ -25,14 +114,51 @@ type RegisterRequest struct {
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
+	Login    string `json:"login"` // Email or username
+	Email    string `json:"email"` // Older clients send the email here
 	Password string `json:"password" validate:"required"`
 }
 
+// Identifier returns the email or username the user logs in with
+func (r *LoginRequest) Identifier() string {
+	if login := strings.TrimSpace(r.Login); login != "" {
+		return login
+	}
+	return strings.TrimSpace(r.Email)
+}
+
 type UpdateProfileRequest struct {
 	Username string `json:"username" validate:"min=3,max=20"`
 	Bio      string `json:"bio" validate:"max=500"`
 	Avatar   string `json:"avatar" validate:"url"`
+
+	DisplayName *string `json:"display_name" validate:"max=50"` // Empty clears it
+
+	HideFromDiscovery *bool `json:"hide_from_discovery"`
+	EmailDigest       *bool `json:"email_digest"`
+
+	Language *string `json:"language"` // Empty clears it
+}
+
+type GuestRequest struct {
+	DisplayName string `json:"display_name" validate:"max=50"`
+	Invite      string `json:"invite"` // Guest invite of the user the guest may message
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// MaxPresenceLookup caps how many users one presence request may ask about
+const MaxPresenceLookup = 200
+
+type PresenceRequest struct {
+	UserIDs []string `json:"user_ids" validate:"required,max=200"`
 }
 
 // Validation methods
@@ -63,3 +189,27 @@ func isValidEmail(email string) bool {
 	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	return emailRegex.MatchString(strings.ToLower(email))
 }
+
+func (r *ChangeEmailRequest) Validate() []string {
+	var errors []string
+
+	if !isValidEmail(r.Email) {
+		errors = append(errors, "Invalid email format")
+	}
+
+	if r.Password == "" {
+		errors = append(errors, "Password is required")
+	}
+
+	return errors
+}
+
+func (r *PresenceRequest) Validate() []string {
+	var errors []string
+
+	if len(r.UserIDs) == 0 || len(r.UserIDs) > MaxPresenceLookup {
+		errors = append(errors, fmt.Sprintf("user_ids must hold 1-%d user IDs", MaxPresenceLookup))
+	}
+
+	return errors
+}
@@ -0,0 +1,67 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ExternalModerator calls a moderation HTTP API.
+// Request:  POST {"content": "..."}
+// Response: {"flagged": true, "categories": ["harassment"]}
+type ExternalModerator struct {
+	URL     string
+	APIKey  string
+	Timeout time.Duration
+}
+
+func (m *ExternalModerator) Name() string {
+	return "external"
+}
+
+func (m *ExternalModerator) Check(ctx context.Context, content string) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return Result{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.APIKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("moderation API returned status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Flagged    bool     `json:"flagged"`
+		Categories []string `json:"categories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Result{}, err
+	}
+
+	reasons := out.Categories
+	if out.Flagged && len(reasons) == 0 {
+		reasons = []string{"external"}
+	}
+
+	return Result{Flagged: out.Flagged, Content: content, Reasons: reasons}, nil
+}
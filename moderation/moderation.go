@@ -0,0 +1,153 @@
+package moderation
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+)
+
+// Policies decide what happens to flagged content
+const (
+	PolicyLog    = "log"    // Deliver unchanged, only log
+	PolicyBlock  = "block"  // Reject the message
+	PolicyReport = "report" // Deliver and file an automatic report
+)
+
+// Result is the outcome of a single moderator
+type Result struct {
+	Flagged bool
+	Content string // Content to continue with, possibly masked
+	Masked  bool
+	Reasons []string
+}
+
+// Moderator inspects message content before it is persisted
+type Moderator interface {
+	Name() string
+	Check(ctx context.Context, content string) (Result, error)
+}
+
+// Decision is the combined outcome of the pipeline after applying the policy
+type Decision struct {
+	Content string
+	Flagged bool
+	Blocked bool
+	Report  bool
+	Reasons []string
+}
+
+type Metrics struct {
+	checked  int64
+	masked   int64
+	flagged  int64
+	blocked  int64
+	reported int64
+	errors   int64
+}
+
+func (m *Metrics) Snapshot() map[string]int64 {
+	return map[string]int64{
+		"checked":  atomic.LoadInt64(&m.checked),
+		"masked":   atomic.LoadInt64(&m.masked),
+		"flagged":  atomic.LoadInt64(&m.flagged),
+		"blocked":  atomic.LoadInt64(&m.blocked),
+		"reported": atomic.LoadInt64(&m.reported),
+		"errors":   atomic.LoadInt64(&m.errors),
+	}
+}
+
+type Pipeline struct {
+	Moderators []Moderator
+	Policy     string
+	Metrics    Metrics
+}
+
+// Moderate runs every moderator in order. Moderator errors fail open so an
+// unavailable external service never blocks chat.
+func (p *Pipeline) Moderate(ctx context.Context, content string) Decision {
+	atomic.AddInt64(&p.Metrics.checked, 1)
+
+	decision := Decision{Content: content}
+	for _, m := range p.Moderators {
+		result, err := m.Check(ctx, decision.Content)
+		if err != nil {
+			atomic.AddInt64(&p.Metrics.errors, 1)
+			log.Printf("Moderator %s failed: %v", m.Name(), err)
+			continue
+		}
+
+		if result.Masked {
+			atomic.AddInt64(&p.Metrics.masked, 1)
+			decision.Content = result.Content
+		}
+
+		if result.Flagged {
+			decision.Flagged = true
+			decision.Reasons = append(decision.Reasons, result.Reasons...)
+		}
+	}
+
+	if !decision.Flagged {
+		return decision
+	}
+
+	atomic.AddInt64(&p.Metrics.flagged, 1)
+
+	switch p.Policy {
+	case PolicyBlock:
+		decision.Blocked = true
+		atomic.AddInt64(&p.Metrics.blocked, 1)
+	case PolicyReport:
+		decision.Report = true
+		atomic.AddInt64(&p.Metrics.reported, 1)
+	}
+
+	log.Printf("Moderation flagged content (policy %s): %s", p.Policy, strings.Join(decision.Reasons, ", "))
+	return decision
+}
+
+var (
+	defaultPipeline *Pipeline
+	defaultOnce     sync.Once
+)
+
+// Default returns the pipeline configured from the environment, built on first use
+// so that it sees variables loaded from .env
+func Default() *Pipeline {
+	defaultOnce.Do(func() {
+		defaultPipeline = newPipelineFromEnv()
+	})
+	return defaultPipeline
+}
+
+func newPipelineFromEnv() *Pipeline {
+	policy := strings.ToLower(config.GetEnvWithDefault("MODERATION_POLICY", PolicyLog))
+	if policy != PolicyLog && policy != PolicyBlock && policy != PolicyReport {
+		log.Printf("Unknown MODERATION_POLICY %q, falling back to %q", policy, PolicyLog)
+		policy = PolicyLog
+	}
+
+	p := &Pipeline{Policy: policy}
+
+	words := loadWordList()
+	if len(words) > 0 {
+		mode := strings.ToLower(config.GetEnvWithDefault("MODERATION_WORDLIST_MODE", WordListModeMask))
+		p.Moderators = append(p.Moderators, NewWordListFilter(words, mode))
+	}
+
+	if url := config.GetEnvWithDefault("MODERATION_API_URL", ""); url != "" {
+		p.Moderators = append(p.Moderators, &ExternalModerator{
+			URL:     url,
+			APIKey:  config.GetEnvWithDefault("MODERATION_API_KEY", ""),
+			Timeout: config.GetDurationEnv("MODERATION_API_TIMEOUT", 2*time.Second),
+		})
+	}
+
+	log.Printf("Moderation pipeline ready: %d moderators, policy %s", len(p.Moderators), p.Policy)
+	return p
+}
@@ -0,0 +1,238 @@
+package moderation
+
+import (
+	"crypto/sha1"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+)
+
+// Spam restriction actions
+const (
+	SpamActionThrottle = "throttle" // Sender may only send one message per throttle interval
+	SpamActionShadow   = "shadow"   // Messages are stored and echoed to the sender but not delivered
+)
+
+// Heuristic thresholds, all counted within spamWindow
+const (
+	spamWindow           = 10 * time.Minute
+	duplicateRecipients  = 5 // Same content to this many distinct recipients
+	linkBurstMessages    = 5 // Messages with links within linkBurstWindow
+	linkBurstWindow      = time.Minute
+	strangerRecipients   = 10 // Distinct never-replied recipients
+	spamScoreThreshold   = 1.0
+	spamThrottleInterval = 30 * time.Second
+	maxTrackedSends      = 200
+)
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+type sendRecord struct {
+	at        time.Time
+	recipient string
+	hash      [sha1.Size]byte
+	hasLink   bool
+	stranger  bool
+}
+
+type Restriction struct {
+	Action   string    `json:"action"`
+	Reasons  []string  `json:"reasons"`
+	Score    float64   `json:"score"`
+	Until    time.Time `json:"until"`
+	lastSend time.Time
+}
+
+// SpamVerdict tells the send path what to do with a message
+type SpamVerdict struct {
+	Allowed    bool          // False when throttled
+	Shadow     bool          // Store but do not deliver to recipients
+	RetryAfter time.Duration // Set when throttled
+	NewFlag    *Restriction  // Set when this message caused a new restriction
+}
+
+type SpamDetector struct {
+	Action   string
+	Duration time.Duration
+
+	mu           sync.Mutex
+	sends        map[string][]sendRecord
+	restrictions map[string]*Restriction
+	contacts     map[string]map[string]bool
+}
+
+func NewSpamDetector(action string, duration time.Duration) *SpamDetector {
+	if action != SpamActionShadow {
+		action = SpamActionThrottle
+	}
+	return &SpamDetector{
+		Action:       action,
+		Duration:     duration,
+		sends:        make(map[string][]sendRecord),
+		restrictions: make(map[string]*Restriction),
+		contacts:     make(map[string]map[string]bool),
+	}
+}
+
+// IsKnownContact reports a cached positive contact lookup
+func (d *SpamDetector) IsKnownContact(senderID, recipientID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.contacts[senderID][recipientID]
+}
+
+// RememberContact caches that recipient has talked to sender before
+func (d *SpamDetector) RememberContact(senderID, recipientID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.contacts[senderID] == nil {
+		d.contacts[senderID] = make(map[string]bool)
+	}
+	d.contacts[senderID][recipientID] = true
+}
+
+// Check records the send and scores the sender's recent activity
+func (d *SpamDetector) Check(senderID, recipient, content string, stranger bool) SpamVerdict {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Existing restriction takes precedence over scoring
+	if r, ok := d.restrictions[senderID]; ok {
+		if now.After(r.Until) {
+			delete(d.restrictions, senderID)
+		} else if r.Action == SpamActionShadow {
+			return SpamVerdict{Allowed: true, Shadow: true}
+		} else {
+			if wait := r.lastSend.Add(spamThrottleInterval).Sub(now); wait > 0 {
+				return SpamVerdict{Allowed: false, RetryAfter: wait}
+			}
+			r.lastSend = now
+			return SpamVerdict{Allowed: true}
+		}
+	}
+
+	record := sendRecord{
+		at:        now,
+		recipient: recipient,
+		hash:      sha1.Sum([]byte(strings.ToLower(strings.TrimSpace(content)))),
+		hasLink:   linkPattern.MatchString(content),
+		stranger:  stranger,
+	}
+
+	// Keep only the sliding window
+	history := d.sends[senderID]
+	cutoff := now.Add(-spamWindow)
+	kept := history[:0]
+	for _, s := range history {
+		if s.at.After(cutoff) {
+			kept = append(kept, s)
+		}
+	}
+	kept = append(kept, record)
+	if len(kept) > maxTrackedSends {
+		kept = kept[len(kept)-maxTrackedSends:]
+	}
+	d.sends[senderID] = kept
+
+	score, reasons := scoreSends(kept, record)
+	if score < spamScoreThreshold {
+		return SpamVerdict{Allowed: true}
+	}
+
+	restriction := &Restriction{
+		Action:   d.Action,
+		Reasons:  reasons,
+		Score:    score,
+		Until:    now.Add(d.Duration),
+		lastSend: now,
+	}
+	d.restrictions[senderID] = restriction
+	delete(d.sends, senderID)
+
+	return SpamVerdict{
+		Allowed: true,
+		Shadow:  d.Action == SpamActionShadow,
+		NewFlag: restriction,
+	}
+}
+
+func scoreSends(sends []sendRecord, latest sendRecord) (float64, []string) {
+	var score float64
+	var reasons []string
+
+	duplicates := map[string]bool{}
+	strangers := map[string]bool{}
+	links := 0
+	linkCutoff := latest.at.Add(-linkBurstWindow)
+
+	for _, s := range sends {
+		if s.hash == latest.hash {
+			duplicates[s.recipient] = true
+		}
+		if s.stranger {
+			strangers[s.recipient] = true
+		}
+		if s.hasLink && s.at.After(linkCutoff) {
+			links++
+		}
+	}
+
+	if len(duplicates) >= duplicateRecipients {
+		score += float64(len(duplicates)) / duplicateRecipients
+		reasons = append(reasons, "identical_messages")
+	}
+	if links >= linkBurstMessages {
+		score += float64(links) / linkBurstMessages
+		reasons = append(reasons, "link_burst")
+	}
+	if len(strangers) >= strangerRecipients {
+		score += float64(len(strangers)) / strangerRecipients
+		reasons = append(reasons, "many_strangers")
+	}
+
+	return score, reasons
+}
+
+// Shadowed reports whether the user's messages are currently hidden from recipients
+func (d *SpamDetector) Shadowed(userID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r, ok := d.restrictions[userID]
+	return ok && r.Action == SpamActionShadow && time.Now().Before(r.Until)
+}
+
+// Restrict applies a restriction directly, used to restore persisted flags
+func (d *SpamDetector) Restrict(userID string, r Restriction) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.restrictions[userID] = &r
+}
+
+// Lift removes any restriction on the user
+func (d *SpamDetector) Lift(userID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.restrictions, userID)
+	delete(d.sends, userID)
+}
+
+var (
+	defaultSpam     *SpamDetector
+	defaultSpamOnce sync.Once
+)
+
+// Spam returns the detector configured from SPAM_ACTION and SPAM_RESTRICTION_DURATION
+func Spam() *SpamDetector {
+	defaultSpamOnce.Do(func() {
+		defaultSpam = NewSpamDetector(
+			strings.ToLower(config.GetEnvWithDefault("SPAM_ACTION", SpamActionThrottle)),
+			config.GetDurationEnv("SPAM_RESTRICTION_DURATION", time.Hour),
+		)
+	})
+	return defaultSpam
+}
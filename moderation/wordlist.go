@@ -0,0 +1,89 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+)
+
+// Word list modes
+const (
+	WordListModeMask   = "mask"   // Replace matches with asterisks
+	WordListModeReject = "reject" // Flag the message, the policy decides what happens
+)
+
+type WordListFilter struct {
+	pattern *regexp.Regexp
+	mode    string
+}
+
+func NewWordListFilter(words []string, mode string) *WordListFilter {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		quoted = append(quoted, regexp.QuoteMeta(w))
+	}
+
+	if mode != WordListModeReject {
+		mode = WordListModeMask
+	}
+
+	return &WordListFilter{
+		pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`),
+		mode:    mode,
+	}
+}
+
+func (f *WordListFilter) Name() string {
+	return "wordlist"
+}
+
+func (f *WordListFilter) Check(ctx context.Context, content string) (Result, error) {
+	matches := f.pattern.FindAllString(content, -1)
+	if len(matches) == 0 {
+		return Result{Content: content}, nil
+	}
+
+	if f.mode == WordListModeReject {
+		return Result{Flagged: true, Content: content, Reasons: []string{"wordlist"}}, nil
+	}
+
+	masked := f.pattern.ReplaceAllStringFunc(content, func(match string) string {
+		return strings.Repeat("*", len([]rune(match)))
+	})
+	return Result{Content: masked, Masked: true}, nil
+}
+
+// loadWordList reads MODERATION_WORDLIST (comma separated) and MODERATION_WORDLIST_FILE (one word per line)
+func loadWordList() []string {
+	var words []string
+
+	for _, w := range strings.Split(config.GetEnvWithDefault("MODERATION_WORDLIST", ""), ",") {
+		if w = strings.TrimSpace(w); w != "" {
+			words = append(words, w)
+		}
+	}
+
+	if path := config.GetEnvWithDefault("MODERATION_WORDLIST_FILE", ""); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Failed to open moderation word list %s: %v", path, err)
+			return words
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			w := strings.TrimSpace(scanner.Text())
+			if w != "" && !strings.HasPrefix(w, "#") {
+				words = append(words, w)
+			}
+		}
+	}
+
+	return words
+}
@@ -0,0 +1,190 @@
+// Package outbox publishes the events stored in the outbox to external systems.
+// Entries are written in the same transaction as the change they describe, the
+// relay publishes them and marks them published, retrying failures with backoff.
+// Delivery is at least once: an entry whose publish succeeded but could not be
+// marked is published again, consumers deduplicate on the entry ID.
+package outbox
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+// Publisher delivers an outbox entry to an external system
+type Publisher interface {
+	Publish(ctx context.Context, entry models.OutboxEntry) error
+}
+
+// logPublisher is used when no external system is configured
+type logPublisher struct{}
+
+func (logPublisher) Publish(ctx context.Context, entry models.OutboxEntry) error {
+	log.Printf("Outbox (no publisher configured) %s %s: %s", entry.Topic, entry.ID.Hex(), entry.Payload)
+	return nil
+}
+
+// Relay claims due entries in batches and publishes them
+type Relay struct {
+	Publisher Publisher
+	Interval  time.Duration // Pause between polls when the outbox is drained
+	Batch     int
+	Timeout   time.Duration // Per publish, also bounds how long a claim is held
+	MaxDelay  time.Duration // Cap of the retry backoff
+	Retention time.Duration // How long published entries are kept
+
+	mu         sync.Mutex
+	lastPurge  time.Time
+	publishedN int64
+	failedN    int64
+}
+
+// New returns a relay configured from OUTBOX_* env vars
+func New() *Relay {
+	var publisher Publisher = logPublisher{}
+	if url := config.GetEnvWithDefault("OUTBOX_WEBHOOK_URL", ""); url != "" {
+		publisher = &WebhookPublisher{
+			URL:    url,
+			Secret: config.GetEnvWithDefault("OUTBOX_WEBHOOK_SECRET", ""),
+		}
+	}
+
+	return &Relay{
+		Publisher: publisher,
+		Interval:  config.GetDurationEnv("OUTBOX_POLL_INTERVAL", time.Second),
+		Batch:     config.GetIntEnv("OUTBOX_BATCH_SIZE", 100),
+		Timeout:   config.GetDurationEnv("OUTBOX_PUBLISH_TIMEOUT", 10*time.Second),
+		MaxDelay:  config.GetDurationEnv("OUTBOX_MAX_RETRY_DELAY", time.Hour),
+		Retention: config.GetDurationEnv("OUTBOX_RETENTION", 24*time.Hour),
+	}
+}
+
+var (
+	defaultRelay *Relay
+	defaultOnce  sync.Once
+)
+
+// Start runs the process-wide relay in the background, every instance may run one
+func Start() *Relay {
+	defaultOnce.Do(func() {
+		defaultRelay = New()
+		go defaultRelay.run()
+	})
+	return defaultRelay
+}
+
+func (r *Relay) run() {
+	for {
+		// Keep draining while batches come back full, otherwise wait for new entries
+		if n := r.RunOnce(context.Background()); n < r.Batch {
+			time.Sleep(r.Interval)
+		}
+	}
+}
+
+// RunOnce publishes one batch and returns how many entries it claimed
+func (r *Relay) RunOnce(ctx context.Context) int {
+	now := time.Now()
+
+	claimCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	entries, err := store.Outbox().Claim(claimCtx, now, r.lease(), r.Batch)
+	cancel()
+	if err != nil {
+		log.Printf("Failed to claim outbox entries: %v", err)
+	}
+
+	for _, entry := range entries {
+		r.publish(ctx, entry)
+	}
+
+	r.purge(ctx, now)
+	return len(entries)
+}
+
+// lease covers publishing a whole batch, an entry still claimed when a relay
+// crashes becomes due again once it passes
+func (r *Relay) lease() time.Duration {
+	return time.Duration(r.Batch)*r.Timeout + time.Minute
+}
+
+func (r *Relay) publish(ctx context.Context, entry models.OutboxEntry) {
+	publishCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+	err := r.Publisher.Publish(publishCtx, entry)
+	cancel()
+
+	updateCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err != nil {
+		r.count(false)
+		next := time.Now().Add(r.backoff(entry.Attempts))
+		log.Printf("Failed to publish outbox entry %s (%s, attempt %d), retrying at %s: %v",
+			entry.ID.Hex(), entry.Topic, entry.Attempts, next.Format(time.RFC3339), err)
+		if err := store.Outbox().Retry(updateCtx, entry.ID, next, err.Error()); err != nil {
+			log.Printf("Failed to schedule retry of outbox entry %s: %v", entry.ID.Hex(), err)
+		}
+		return
+	}
+
+	r.count(true)
+	if err := store.Outbox().MarkPublished(updateCtx, entry.ID, time.Now()); err != nil {
+		// Published again after the lease, consumers deduplicate on the ID
+		log.Printf("Failed to mark outbox entry %s published: %v", entry.ID.Hex(), err)
+	}
+}
+
+// backoff doubles from one second per attempt, capped at MaxDelay
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < r.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, r.MaxDelay)
+}
+
+// purge deletes published entries past the retention, at most once a minute
+func (r *Relay) purge(ctx context.Context, now time.Time) {
+	r.mu.Lock()
+	due := now.Sub(r.lastPurge) >= time.Minute
+	if due {
+		r.lastPurge = now
+	}
+	r.mu.Unlock()
+	if !due {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	purged, err := store.Outbox().PurgePublished(ctx, now.Add(-r.Retention))
+	if err != nil {
+		log.Printf("Failed to purge published outbox entries: %v", err)
+	} else if purged > 0 {
+		log.Printf("Purged %d published outbox entries", purged)
+	}
+}
+
+func (r *Relay) count(published bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if published {
+		r.publishedN++
+	} else {
+		r.failedN++
+	}
+}
+
+// Stats reports how many publishes succeeded and failed since the relay started
+func (r *Relay) Stats() (published, failed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.publishedN, r.failedN
+}
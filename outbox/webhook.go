@@ -0,0 +1,56 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+)
+
+// WebhookPublisher posts each entry's payload to an HTTP endpoint.
+//
+// Headers: X-Ngobrolyuk-Event (topic), X-Ngobrolyuk-Delivery (entry ID, the same
+// on every retry), X-Ngobrolyuk-Timestamp and, with a secret, X-Ngobrolyuk-Signature:
+// the hex HMAC-SHA256 of "<timestamp>.<body>" like bot command webhooks.
+// Any 2xx answer counts as published.
+type WebhookPublisher struct {
+	URL    string
+	Secret string
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, entry models.OutboxEntry) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(entry.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ngobrolyuk-Event", entry.Topic)
+	req.Header.Set("X-Ngobrolyuk-Delivery", entry.ID.Hex())
+	req.Header.Set("X-Ngobrolyuk-Timestamp", timestamp)
+	if p.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.Secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(entry.Payload)
+		req.Header.Set("X-Ngobrolyuk-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("outbox webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
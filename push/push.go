@@ -0,0 +1,106 @@
+// Package push delivers notifications to users who are not connected over WebSocket.
+package push
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+)
+
+// Notification is a single push addressed to one user.
+// Device tokens are resolved by the push gateway, not by this server.
+type Notification struct {
+	UserID         string    `json:"user_id"`
+	Title          string    `json:"title"`
+	Body           string    `json:"body"`
+	ConversationID string    `json:"conversation_id"`
+	MessageID      string    `json:"message_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Sender delivers a notification to a push provider
+type Sender interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// logSender is used when no push gateway is configured
+type logSender struct{}
+
+func (logSender) Send(ctx context.Context, n Notification) error {
+	log.Printf("Push (no gateway configured) to %s: %s", n.UserID, n.Title)
+	return nil
+}
+
+// Worker drains a bounded queue of notifications in the background
+type Worker struct {
+	Sender  Sender
+	Timeout time.Duration
+	queue   chan Notification
+
+	failures atomic.Int64 // Consecutive failed sends, reset by a success
+}
+
+var (
+	defaultWorker *Worker
+	defaultOnce   sync.Once
+)
+
+// Default returns the process-wide worker configured from PUSH_* env vars, starting it on first use
+func Default() *Worker {
+	defaultOnce.Do(func() {
+		var sender Sender = logSender{}
+		if url := config.GetEnvWithDefault("PUSH_WEBHOOK_URL", ""); url != "" {
+			sender = &WebhookSender{
+				URL:    url,
+				APIKey: config.GetEnvWithDefault("PUSH_WEBHOOK_KEY", ""),
+			}
+		}
+
+		defaultWorker = &Worker{
+			Sender:  sender,
+			Timeout: config.GetDurationEnv("PUSH_TIMEOUT", 5*time.Second),
+			queue:   make(chan Notification, 1000),
+		}
+		go defaultWorker.run()
+	})
+	return defaultWorker
+}
+
+// Enqueue schedules a notification without blocking. Returns false if the queue is full.
+func (w *Worker) Enqueue(n Notification) bool {
+	select {
+	case w.queue <- n:
+		return true
+	default:
+		log.Printf("Push queue full, dropping notification for %s", n.UserID)
+		return false
+	}
+}
+
+func (w *Worker) run() {
+	for n := range w.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), w.Timeout)
+		if err := w.Sender.Send(ctx, n); err != nil {
+			log.Printf("Failed to send push to %s: %v", n.UserID, err)
+			w.failures.Add(1)
+		} else {
+			w.failures.Store(0)
+		}
+		cancel()
+	}
+}
+
+// Configured reports whether notifications go to a push gateway rather than the log
+func (w *Worker) Configured() bool {
+	_, logged := w.Sender.(logSender)
+	return !logged
+}
+
+// Health returns how many sends failed in a row and how full the queue is (0-1)
+func (w *Worker) Health() (failures int64, backlog float64) {
+	return w.failures.Load(), float64(len(w.queue)) / float64(cap(w.queue))
+}
@@ -0,0 +1,187 @@
+// Package richtext parses the supported markdown subset into plain text plus
+// formatting entities, so clients never have to render user-supplied markup.
+//
+// Supported syntax: **bold**, *italic* or _italic_, `code`, [text](url).
+// Links are only kept for http, https and mailto URLs. A backslash escapes
+// the next character. Formatting does not nest.
+package richtext
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Entity types
+const (
+	EntityBold   = "bold"
+	EntityItalic = "italic"
+	EntityCode   = "code"
+	EntityLink   = "link"
+)
+
+// Entity marks a formatted span of the plain text. Offset and Length are in
+// UTF-16 code units, matching JavaScript string indexing.
+type Entity struct {
+	Type   string `bson:"type" json:"type"`
+	Offset int    `bson:"offset" json:"offset"`
+	Length int    `bson:"length" json:"length"`
+	URL    string `bson:"url,omitempty" json:"url,omitempty"`
+}
+
+var allowedSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+type parser struct {
+	src      []rune
+	out      strings.Builder
+	offset   int // Output length in UTF-16 code units
+	entities []Entity
+}
+
+// Parse normalizes the text and strips supported markup, returning the plain
+// text and its entities. Unsupported or malformed markup is kept as literal text.
+func Parse(text string) (string, []Entity) {
+	p := &parser{src: []rune(normalize(text))}
+
+	for i := 0; i < len(p.src); {
+		i = p.step(i)
+	}
+
+	return p.out.String(), p.entities
+}
+
+// normalize unifies line endings and drops control characters other than newline and tab
+func normalize(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// step consumes markup or a literal rune at i and returns the next position
+func (p *parser) step(i int) int {
+	r := p.src[i]
+
+	switch {
+	case r == '\\' && i+1 < len(p.src) && isMarkup(p.src[i+1]):
+		p.write(p.src[i+1 : i+2])
+		return i + 2
+
+	case r == '`':
+		if end := p.find(i+1, "`"); end > i+1 {
+			p.entity(EntityCode, p.src[i+1:end], "")
+			return end + 1
+		}
+
+	case r == '*' && p.hasPrefix(i, "**"):
+		if end := p.find(i+2, "**"); end > i+2 && trimmed(p.src[i+2:end], r) {
+			p.entity(EntityBold, p.src[i+2:end], "")
+			return end + 2
+		}
+
+	case r == '*' || (r == '_' && !wordBefore(p.src, i)):
+		if end := p.find(i+1, string(r)); end > i+1 && trimmed(p.src[i+1:end], r) {
+			if r == '*' || !wordAfter(p.src, end) {
+				p.entity(EntityItalic, p.src[i+1:end], "")
+				return end + 1
+			}
+		}
+
+	case r == '[':
+		if next, ok := p.link(i); ok {
+			return next
+		}
+	}
+
+	p.write(p.src[i : i+1])
+	return i + 1
+}
+
+// link parses [text](url) starting at i
+func (p *parser) link(i int) (int, bool) {
+	closeText := p.find(i+1, "](")
+	if closeText <= i+1 {
+		return 0, false
+	}
+
+	closeURL := p.find(closeText+2, ")")
+	if closeURL < 0 {
+		return 0, false
+	}
+
+	target := strings.TrimSpace(string(p.src[closeText+2 : closeURL]))
+	u, err := url.Parse(target)
+	if err != nil || !allowedSchemes[strings.ToLower(u.Scheme)] {
+		return 0, false
+	}
+
+	p.entity(EntityLink, p.src[i+1:closeText], u.String())
+	return closeURL + 1, true
+}
+
+func (p *parser) write(runes []rune) {
+	for _, r := range runes {
+		p.out.WriteRune(r)
+		p.offset += utf16.RuneLen(r)
+	}
+}
+
+func (p *parser) entity(kind string, text []rune, link string) {
+	start := p.offset
+	p.write(text)
+	p.entities = append(p.entities, Entity{Type: kind, Offset: start, Length: p.offset - start, URL: link})
+}
+
+// find returns the index of the next occurrence of token at or after from, or -1
+func (p *parser) find(from int, token string) int {
+	for j := from; j < len(p.src); j++ {
+		if p.hasPrefix(j, token) {
+			return j
+		}
+	}
+	return -1
+}
+
+func (p *parser) hasPrefix(i int, token string) bool {
+	t := []rune(token)
+	if i+len(t) > len(p.src) {
+		return false
+	}
+	for k, r := range t {
+		if p.src[i+k] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func isMarkup(r rune) bool {
+	return strings.ContainsRune("\\`*_[]()", r)
+}
+
+// trimmed reports whether the span neither starts nor ends with whitespace or its delimiter
+func trimmed(span []rune, delim rune) bool {
+	first, last := span[0], span[len(span)-1]
+	return !unicode.IsSpace(first) && !unicode.IsSpace(last) && first != delim && last != delim
+}
+
+// wordBefore/wordAfter keep snake_case identifiers from turning italic
+func wordBefore(src []rune, i int) bool {
+	return i > 0 && isWordRune(src[i-1])
+}
+
+func wordAfter(src []rune, i int) bool {
+	return i+1 < len(src) && isWordRune(src[i+1])
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
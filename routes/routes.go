@@ -5,8 +5,8 @@ import (
 
 	"github.com/Adisonsmn/ngobrolyuk/controllers"
 	"github.com/Adisonsmn/ngobrolyuk/middleware"
+	"github.com/Adisonsmn/ngobrolyuk/models"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -23,13 +23,17 @@ func SetupRoutes(app *fiber.App) {
 		Format: "[${time}] ${status} - ${method} ${path} - ${latency}\n",
 	}))
 
-	// CORS configuration
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "http://localhost:3000,http://localhost:5173", // Add your frontend URLs
-		AllowCredentials: true,
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Requested-With",
-	}))
+	// Server span per request, see telemetry
+	app.Use(middleware.Tracing)
+
+	// CORS, origins and credentials from CORS_* env
+	app.Use(middleware.CORS())
+
+	// Error messages in the caller's language, see i18n
+	app.Use(middleware.Localize)
+
+	// Cookie-authenticated writes must come from an allowed origin
+	app.Use(middleware.CSRF())
 
 	// Rate limiting for auth endpoints
 	authLimiter := limiter.New(limiter.Config{
@@ -45,6 +49,51 @@ func SetupRoutes(app *fiber.App) {
 		},
 	})
 
+	// Guest sessions are cheap to create, limit them tighter than logins
+	guestLimiter := limiter.New(limiter.Config{
+		Max:        5,
+		Expiration: time.Hour,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many guest sessions, please try again later",
+			})
+		},
+	})
+
+	// Rate limiting for conversation exports (expensive, full-history reads)
+	exportLimiter := limiter.New(limiter.Config{
+		Max:        5,
+		Expiration: time.Hour,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			if userID, ok := c.Locals("user_id").(string); ok {
+				return userID
+			}
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Export limit reached, please try again later",
+			})
+		},
+	})
+
+	// The public status page is polled by clients and monitors, health checks are cached
+	statusLimiter := limiter.New(limiter.Config{
+		Max:        30,
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many requests, please try again later",
+			})
+		},
+	})
+
 	// API routes
 	api := app.Group("/api/v1")
 
@@ -56,26 +105,84 @@ func SetupRoutes(app *fiber.App) {
 		})
 	})
 
+	// Uptime, subsystem states and the open incident
+	api.Get("/status", statusLimiter, controllers.GetStatus)
+
 	// Public routes (with rate limiting)
 	auth := api.Group("/auth")
-	auth.Use(authLimiter)
+	auth.Use(authLimiter, middleware.RejectBanned)
 	auth.Post("/register", controllers.Register)
 	auth.Post("/login", controllers.Login)
+	auth.Post("/guest", guestLimiter, controllers.CreateGuest)  // Short-lived guest identity
+	auth.Post("/qr", controllers.CreateQRLogin)                 // Desktop asks for a QR login challenge
+	auth.Get("/qr/:code/events", controllers.QRLoginEvents)     // Desktop waits for approval (SSE)
+	auth.Post("/qr/:code/session", controllers.CompleteQRLogin) // Desktop exchanges approval for a session
+
+	// Links sent by email (signed tokens, no login required)
+	api.Get("/unsubscribe/digest", authLimiter, middleware.RequireMongo, controllers.UnsubscribeDigest)
+	api.Get("/email/confirm", authLimiter, controllers.ConfirmEmailChangePage) // Link sent to a new email address
+	api.Post("/email/confirm", authLimiter, controllers.ConfirmEmailChange)    // Submitted from that page
+
+	// Integrations mint conversation tokens with their API key
+	api.Post("/integrations/conversation-tokens", authLimiter, middleware.RequireMongo, middleware.RequireIntegration, controllers.CreateConversationToken)
+
+	// Embedded chat, only answers conversation tokens and only about their conversation
+	embed := api.Group("/embed", middleware.RequireMongo, middleware.ProtectConversation, middleware.RequireConversationScope)
+	embed.Use(middleware.GuestRateLimit())
+	embed.Get("/conversation", controllers.GetEmbedConversation) // The token's direct conversation or room
+	embed.Get("/messages", controllers.GetEmbedMessages)         // Its history, paged like /messages
 
 	// Protected routes
 	protected := api.Group("/", middleware.Protect)
+	protected.Use(middleware.GuestRateLimit())
 
 	// Auth protected routes
 	protected.Post("/auth/logout", controllers.Logout)
 	protected.Post("/auth/refresh", controllers.RefreshToken)
+	protected.Post("/auth/guest/upgrade", middleware.RequireGuest, controllers.UpgradeGuest) // Turn guest into full account
+	protected.Post("/auth/qr/approve", middleware.DenyGuests, controllers.ApproveQRLogin)    // Phone approves a desktop login
+	protected.Post("/auth/qr/reject", middleware.DenyGuests, controllers.RejectQRLogin)      // Phone declines a desktop login
+
+	// Routes marked RequireMongo are unavailable when STORAGE is not mongo,
+	// routes marked DenyGuests need a full account, routes marked RequireFlag
+	// only answer users the feature flag is rolled out to
+
+	protected.Get("/flags", controllers.GetMyFlags) // Feature flags on for the current user
 
 	// User routes
 	users := protected.Group("/users")
-	users.Get("/", controllers.ListUsers)            // List users with filters
-	users.Get("/online", controllers.GetOnlineUsers) // Get online users
-	users.Get("/profile", controllers.GetProfile)    // Get own profile
-	users.Put("/profile", controllers.UpdateProfile) // Update own profile
-	users.Get("/:id", controllers.GetUserProfile)    // Get specific user profile
+	users.Get("/", middleware.DenyGuests, controllers.ListUsers)                                                 // List users with filters
+	users.Get("/online", middleware.DenyGuests, controllers.GetOnlineUsers)                                      // Get online users
+	users.Post("/presence", controllers.GetPresence)                                                             // Status of many users at once
+	users.Get("/profile", controllers.GetProfile)                                                                // Get own profile
+	users.Put("/profile", middleware.DenyGuests, controllers.UpdateProfile)                                      // Update own profile
+	users.Post("/me/deactivate", middleware.DenyGuests, middleware.RequireMongo, controllers.DeactivateAccount)  // Temporarily hide account
+	users.Delete("/me", middleware.DenyGuests, middleware.RequireMongo, controllers.DeleteAccount)               // Deactivate and schedule deletion
+	users.Post("/me/restore", middleware.DenyGuests, middleware.RequireMongo, controllers.CancelAccountDeletion) // Cancel pending deletion
+	users.Get("/me/appearance", middleware.RequireMongo, controllers.GetAppearances)                             // Per-conversation themes
+	users.Get("/me/notifications", middleware.RequireMongo, controllers.GetNotificationSettings)                 // Per-conversation notification levels
+	users.Post("/me/email", middleware.DenyGuests, authLimiter, controllers.RequestEmailChange)                  // Change email, confirmed from the new address
+	users.Post("/me/guest-invite", middleware.DenyGuests, controllers.CreateGuestInvite)                         // Let a guest message you
+	users.Get("/me/usage", middleware.RequireMongo, controllers.GetStorageUsage)                                 // Attachment bytes used and quota
+	users.Get("/me/support-access", middleware.RequireMongo, controllers.GetMySupportAccess)                     // Support access requested on the account
+	users.Post("/me/support-access/:id/approve", middleware.RequireMongo, controllers.ApproveSupportAccess)      // Consent to a support request
+	users.Post("/me/support-access/:id/deny", middleware.RequireMongo, controllers.DenySupportAccess)            // Refuse a support request
+	users.Delete("/me/support-access/:id", middleware.RequireMongo, controllers.EndSupportAccess)                // Take back approved access
+	users.Get("/resolve", middleware.DenyGuests, controllers.ResolveUsername)                                    // Find by current or recent former username
+	users.Get("/:id", controllers.GetUserProfile)                                                                // Get specific user profile
+
+	// Contact routes, private favorites, nicknames and notes
+	contacts := protected.Group("/contacts", middleware.DenyGuests, middleware.RequireMongo)
+	contacts.Get("/", controllers.GetContacts)              // List annotated contacts
+	contacts.Put("/:user_id", controllers.UpdateContact)    // Set favorite, nickname or note
+	contacts.Delete("/:user_id", controllers.DeleteContact) // Forget a contact
+
+	// Label routes, private folders for conversations and rooms
+	labels := protected.Group("/labels", middleware.DenyGuests, middleware.RequireMongo)
+	labels.Get("/", controllers.GetLabels)         // List labels with their conversations
+	labels.Post("/", controllers.CreateLabel)      // Create label
+	labels.Put("/:id", controllers.UpdateLabel)    // Rename or recolor label
+	labels.Delete("/:id", controllers.DeleteLabel) // Delete label, conversations stay
 
 	// Chat routes
 	chat := protected.Group("/chat")
@@ -84,9 +191,134 @@ func SetupRoutes(app *fiber.App) {
 	chat.Put("/read/:user_id", controllers.MarkMessagesRead) // Mark messages as read
 	chat.Get("/unread", controllers.GetUnreadCount)          // Get unread count
 
+	// Conversation routes (id = both user IDs sorted, joined with "_")
+	conversations := protected.Group("/conversations")
+	conversations.Get("/search", controllers.SearchConversations)                                                                   // Find by partner name or message content
+	conversations.Get("/requests", controllers.GetMessageRequests)                                                                  // First contacts waiting for acceptance
+	conversations.Post("/:id/request/accept", controllers.AcceptMessageRequest)                                                     // Move a request into conversations
+	conversations.Delete("/:id/request", controllers.DeleteMessageRequest)                                                          // Hide a request until the sender writes again
+	conversations.Put("/:id/block", controllers.BlockUser)                                                                          // Stop the other participant's messages
+	conversations.Delete("/:id/block", controllers.UnblockUser)                                                                     // Let them through again
+	conversations.Put("/:id/read-cursor", controllers.UpdateReadCursor)                                                             // Mark read up to a message or timestamp
+	conversations.Get("/:id/pins", controllers.GetConversationPins)                                                                 // List pinned messages
+	conversations.Post("/:id/pins/:message_id", controllers.PinConversationMessage)                                                 // Pin message
+	conversations.Delete("/:id/pins/:message_id", controllers.UnpinConversationMessage)                                             // Unpin message
+	conversations.Put("/:id/notifications", middleware.RequireMongo, controllers.UpdateConversationNotifications)                   // Set notification level
+	conversations.Put("/:id/appearance", middleware.RequireMongo, controllers.UpdateConversationAppearance)                         // Set own wallpaper and accent color
+	conversations.Put("/:id/labels", middleware.DenyGuests, middleware.RequireMongo, controllers.SetConversationLabels)             // Set own labels
+	conversations.Get("/:id/export", middleware.DenyGuests, middleware.RequireMongo, exportLimiter, controllers.ExportConversation) // Export history (json, csv, html)
+
+	// Room routes
+	rooms := protected.Group("/rooms", middleware.RequireMongo, middleware.RequireFlag(models.FeatureRooms))
+	rooms.Post("/join/:token", controllers.JoinRoomByInvite)                         // Join via invite link
+	rooms.Post("/", middleware.DenyGuests, controllers.CreateRoom)                   // Create room
+	rooms.Get("/", controllers.GetRooms)                                             // List own rooms
+	rooms.Get("/:id", controllers.GetRoom)                                           // Get room details
+	rooms.Put("/:id", controllers.UpdateRoom)                                        // Rename room
+	rooms.Post("/:id/members", controllers.AddRoomMember)                            // Add member
+	rooms.Delete("/:id/members/:user_id", controllers.RemoveRoomMember)              // Remove member or leave
+	rooms.Put("/:id/members/:user_id/role", controllers.UpdateRoomMemberRole)        // Change member role
+	rooms.Post("/:id/invites", controllers.CreateRoomInvite)                         // Create invite link
+	rooms.Get("/:id/invites", controllers.GetRoomInvites)                            // List active invites
+	rooms.Delete("/:id/invites/:invite_id", controllers.RevokeRoomInvite)            // Revoke invite
+	rooms.Get("/:id/messages", controllers.GetRoomMessages)                          // Get room messages
+	rooms.Get("/:id/pins", controllers.GetRoomPins)                                  // List pinned messages
+	rooms.Post("/:id/pins/:message_id", controllers.PinRoomMessage)                  // Pin message
+	rooms.Delete("/:id/pins/:message_id", controllers.UnpinRoomMessage)              // Unpin message
+	rooms.Put("/:id/read", controllers.MarkRoomRead)                                 // Advance read watermark
+	rooms.Get("/:id/messages/:message_id/read-by", controllers.GetRoomMessageReadBy) // Members who read a message
+	rooms.Delete("/:id/messages/:message_id", controllers.DeleteRoomMessage)         // Delete room message
+	rooms.Put("/:id/notifications", controllers.UpdateRoomNotifications)             // Set notification level
+	rooms.Put("/:id/appearance", controllers.UpdateRoomAppearance)                   // Set own wallpaper and accent color
+	rooms.Put("/:id/labels", middleware.DenyGuests, controllers.SetRoomLabels)       // Set own labels
+
+	// Discovery routes
+	discover := protected.Group("/discover", middleware.RequireMongo)
+	discover.Get("/rooms", controllers.DiscoverRooms)                        // Search public rooms
+	discover.Get("/users", middleware.DenyGuests, controllers.DiscoverUsers) // Search users
+
+	// Broadcast channel routes
+	channels := protected.Group("/channels", middleware.RequireMongo, middleware.RequireFlag(models.FeatureChannels))
+	channels.Post("/", middleware.DenyGuests, controllers.CreateChannel)            // Create channel
+	channels.Get("/", controllers.GetSubscribedChannels)                            // List subscribed channels
+	channels.Get("/:id", controllers.GetChannel)                                    // Get channel details
+	channels.Post("/:id/subscribe", controllers.SubscribeChannel)                   // Subscribe
+	channels.Delete("/:id/subscribe", controllers.UnsubscribeChannel)               // Unsubscribe
+	channels.Post("/:id/publishers", controllers.AddChannelPublisher)               // Add publisher (owner only)
+	channels.Delete("/:id/publishers/:user_id", controllers.RemoveChannelPublisher) // Remove publisher (owner only)
+	channels.Post("/:id/messages", controllers.PublishChannelMessage)               // Publish message (publishers only)
+	channels.Get("/:id/messages", controllers.GetChannelMessages)                   // Get channel messages
+
+	// Attachment routes, files stored in GridFS count against the uploader's quota
+	attachments := protected.Group("/attachments", middleware.RequireMongo)
+	attachments.Post("/", controllers.UploadAttachment)         // Upload file (multipart "file")
+	attachments.Get("/:id", controllers.GetAttachment)          // Download file
+	attachments.Get("/:id/info", controllers.GetAttachmentInfo) // Metadata and scan status
+	attachments.Delete("/:id", controllers.DeleteAttachment)    // Delete own file, frees quota
+
+	// Slash command routes, built-ins plus commands bots registered
+	slash := protected.Group("/commands")
+	slash.Get("/", controllers.ListCommands)                                                                                            // Commands for autocompletion
+	slash.Post("/", middleware.RequireMongo, middleware.RequirePermission(models.PermCommandsManage), controllers.RegisterCommand)      // Register bot command (webhook)
+	slash.Delete("/:name", middleware.RequireMongo, middleware.RequirePermission(models.PermCommandsManage), controllers.DeleteCommand) // Remove bot command
+
+	// E2EE key distribution routes
+	keys := protected.Group("/keys", middleware.RequireMongo, middleware.RequireFlag(models.FeatureE2EE))
+	keys.Put("/bundle", controllers.UploadKeyBundle)    // Upload identity key and signed prekey
+	keys.Post("/prekeys", controllers.UploadPreKeys)    // Add one-time prekeys
+	keys.Get("/count", controllers.GetPreKeyCount)      // Remaining one-time prekeys
+	keys.Get("/:user_id", controllers.GetUserKeyBundle) // Fetch a recipient's prekey bundle
+
+	// Admin routes, each guarded by a permission from models.Permissions
+	admin := protected.Group("/admin", middleware.RequireMongo)
+	admin.Get("/stats", middleware.RequirePermission(models.PermStatsView), controllers.GetAdminStats)                                  // Usage metrics from daily rollups
+	admin.Get("/outbox", middleware.RequirePermission(models.PermStatsView), controllers.GetOutboxStatus)                               // Events waiting to be published
+	admin.Get("/moderation/stats", middleware.RequirePermission(models.PermModerationView), controllers.GetModerationStats)             // Moderation counters
+	admin.Get("/reports", middleware.RequirePermission(models.PermModerationView), controllers.GetReports)                              // List reports
+	admin.Get("/spam-flags", middleware.RequirePermission(models.PermSpamManage), controllers.GetSpamFlags)                             // List spam restrictions
+	admin.Delete("/spam-flags/:user_id", middleware.RequirePermission(models.PermSpamManage), controllers.LiftSpamFlag)                 // Lift spam restriction
+	admin.Post("/bans", middleware.RequirePermission(models.PermUsersBan), controllers.CreateBan)                                       // Ban IP range, user, or device
+	admin.Get("/bans", middleware.RequirePermission(models.PermUsersBan), controllers.GetBans)                                          // List bans
+	admin.Delete("/bans/:id", middleware.RequirePermission(models.PermUsersBan), controllers.DeleteBan)                                 // Remove ban
+	admin.Get("/bans/audit", middleware.RequirePermission(models.PermUsersBan), controllers.GetBanAudit)                                // Ban audit trail
+	admin.Get("/sessions", middleware.RequirePermission(models.PermSessionsDisconnect), controllers.GetSessionCounts)                   // Open WebSocket sessions per user
+	admin.Get("/users/:id/sessions", middleware.RequirePermission(models.PermSessionsDisconnect), controllers.GetUserSessions)          // A user's open sessions
+	admin.Post("/users/:id/disconnect", middleware.RequirePermission(models.PermSessionsDisconnect), controllers.DisconnectUserSession) // Kick WebSocket session
+	admin.Post("/notices", middleware.RequirePermission(models.PermNoticesSend), controllers.SendServiceNotice)                         // Notice to every connected user
+	admin.Put("/incident", middleware.RequirePermission(models.PermNoticesSend), controllers.SetIncident)                               // Open or update the incident banner
+	admin.Delete("/incident", middleware.RequirePermission(models.PermNoticesSend), controllers.ResolveIncident)                        // Resolve the incident
+	admin.Delete("/messages/:id", middleware.RequirePermission(models.PermMessagesDeleteAny), controllers.DeleteAnyMessage)             // Delete any message
+	admin.Get("/permissions", middleware.RequirePermission(models.PermRolesManage), controllers.GetPermissions)                         // Permission registry
+	admin.Get("/roles", middleware.RequirePermission(models.PermRolesManage), controllers.GetRoles)                                     // Roles and their permissions
+	admin.Put("/roles/:name", middleware.RequirePermission(models.PermRolesManage), controllers.UpdateRole)                             // Create or update role
+	admin.Delete("/roles/:name", middleware.RequirePermission(models.PermRolesManage), controllers.DeleteRole)                          // Delete unused role
+	admin.Put("/users/:id/role", middleware.RequirePermission(models.PermRolesManage), controllers.AssignUserRole)                      // Assign role to user
+	admin.Get("/users/:id/usage", middleware.RequirePermission(models.PermStorageManage), controllers.GetUserStorageUsage)              // Attachment usage of an account
+	admin.Get("/attachments/scan-audit", middleware.RequirePermission(models.PermStorageManage), controllers.GetAttachmentScanAudit)    // Uploads rejected as malware
+	admin.Put("/users/:id/quota", middleware.RequirePermission(models.PermStorageManage), controllers.UpdateUserStorageQuota)           // Set or reset an account's quota
+	admin.Get("/flags", middleware.RequirePermission(models.PermFlagsManage), controllers.GetFlags)                                     // Feature flags in effect
+	admin.Put("/flags/:name", middleware.RequirePermission(models.PermFlagsManage), controllers.UpdateFlag)                             // Set flag rollout
+	admin.Delete("/flags/:name", middleware.RequirePermission(models.PermFlagsManage), controllers.DeleteFlag)                          // Reset flag to default
+
+	// Support access, usable only after the user approves it
+	admin.Post("/users/:id/support-access", middleware.RequirePermission(models.PermSupportInspect), controllers.RequestSupportAccess)                // Ask the user for time-boxed access
+	admin.Delete("/support-access/:id", middleware.RequirePermission(models.PermSupportInspect), controllers.RevokeSupportAccess)                     // End own access early
+	admin.Get("/support-access/:id/messages/:message_id", middleware.RequirePermission(models.PermSupportInspect), controllers.InspectSupportMessage) // Message metadata and delivery status
+	admin.Get("/support-access/audit", middleware.RequirePermission(models.PermSupportInspect), controllers.GetSupportAudit)                          // Support access audit trail
+
+	// Integrations embedding chat in other products
+	admin.Post("/integrations", middleware.RequirePermission(models.PermIntegrationsManage), controllers.CreateIntegration)       // Register and get the API key once
+	admin.Get("/integrations", middleware.RequirePermission(models.PermIntegrationsManage), controllers.GetIntegrations)          // List integrations
+	admin.Put("/integrations/:id", middleware.RequirePermission(models.PermIntegrationsManage), controllers.UpdateIntegration)    // Rename or remap users
+	admin.Delete("/integrations/:id", middleware.RequirePermission(models.PermIntegrationsManage), controllers.RevokeIntegration) // Revoke key and tokens
+
 	// WebSocket route (token in query param)
-	// Apply Protect middleware to /ws
-	app.Use("/ws", middleware.Protect)
+	// Apply Protect middleware to /ws (also enforces the ban list before the upgrade),
+	// conversation tokens connect embedded sessions limited to their conversation
+	app.Use("/ws", middleware.CheckOrigin(), middleware.ProtectConversation, func(c *fiber.Ctx) error {
+		c.Locals("ip", c.IP()) // Shown in the admin session list
+		return c.Next()
+	})
 
 	// Now define WebSocket route
 	app.Get("/ws", websocket.New(func(c *websocket.Conn) {
@@ -0,0 +1,56 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// External calls a scanning HTTP API.
+// Request:  POST with the file as the body
+// Response: {"infected": true, "signature": "Win.Test.EICAR_HDB-1"}
+type External struct {
+	URL     string
+	APIKey  string
+	Timeout time.Duration
+}
+
+func (s *External) Name() string {
+	return "external"
+}
+
+func (s *External) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, r)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("scanning API returned status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Infected  bool   `json:"infected"`
+		Signature string `json:"signature"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Result{}, err
+	}
+	return Result{Infected: out.Infected, Signature: out.Signature}, nil
+}
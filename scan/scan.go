@@ -0,0 +1,67 @@
+// Package scan checks uploaded files for viruses and malware before they are served.
+package scan
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+)
+
+// Result is what a scanner found in a file
+type Result struct {
+	Infected  bool
+	Signature string // Name of the detected threat, empty when clean
+}
+
+// Scanner inspects file contents. An error means the file could not be scanned,
+// not that it is unsafe.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+var (
+	defaultScanner Scanner
+	defaultOnce    sync.Once
+)
+
+// Default returns the scanner configured with ATTACHMENT_SCANNER, nil when uploads
+// are not scanned. It is built on first use so that it sees variables loaded from .env.
+func Default() Scanner {
+	defaultOnce.Do(func() {
+		defaultScanner = newScannerFromEnv()
+	})
+	return defaultScanner
+}
+
+func newScannerFromEnv() Scanner {
+	timeout := config.GetDurationEnv("ATTACHMENT_SCAN_TIMEOUT", 30*time.Second)
+
+	switch kind := strings.ToLower(config.GetEnvWithDefault("ATTACHMENT_SCANNER", "")); kind {
+	case "":
+		return nil
+	case "clamav":
+		address := config.GetEnvWithDefault("CLAMAV_ADDRESS", "localhost:3310")
+		log.Printf("Scanning attachments with ClamAV at %s", address)
+		return &ClamAV{Address: address, Timeout: timeout}
+	case "external":
+		url := config.GetEnvWithDefault("ATTACHMENT_SCAN_URL", "")
+		if url == "" {
+			log.Fatal("ATTACHMENT_SCAN_URL is required when ATTACHMENT_SCANNER=external")
+		}
+		log.Printf("Scanning attachments with %s", url)
+		return &External{
+			URL:     url,
+			APIKey:  config.GetEnvWithDefault("ATTACHMENT_SCAN_KEY", ""),
+			Timeout: timeout,
+		}
+	default:
+		log.Fatalf("Unknown ATTACHMENT_SCANNER %q (expected clamav or external)", kind)
+		return nil
+	}
+}
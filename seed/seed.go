@@ -0,0 +1,229 @@
+// Package seed generates demo users, conversations and message histories for
+// local development and load testing.
+package seed
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/config"
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Options controls how much data is generated
+type Options struct {
+	Users                   int
+	Conversations           int
+	MessagesPerConversation int
+	Span                    time.Duration // Message timestamps are spread over this window ending now
+	Password                string        // Shared password of all demo users
+	RandSeed                int64         // 0 = random
+}
+
+// DefaultOptions is a small dataset suitable for frontend development
+func DefaultOptions() Options {
+	return Options{
+		Users:                   20,
+		Conversations:           30,
+		MessagesPerConversation: 40,
+		Span:                    21 * 24 * time.Hour,
+		Password:                "password123",
+	}
+}
+
+// Stats summarizes what was written
+type Stats struct {
+	Users         int
+	Conversations int
+	Messages      int
+}
+
+const insertBatchSize = 1000
+
+var phrases = []string{
+	"Halo, apa kabar?", "Baik, kamu gimana?", "Lagi sibuk nggak?", "Nanti sore jadi ketemu?",
+	"Oke, sampai nanti ya", "Udah makan belum?", "Wkwk iya bener", "Besok meeting jam 9",
+	"Sip, noted", "Lagi di jalan, bentar lagi sampai", "Thanks ya!", "Sama-sama 🙏",
+	"Did you see the new release?", "Let me check and get back to you", "Sounds good",
+	"Can you send me the file?", "On my way", "Haha that's great", "See you tomorrow",
+	"Jangan lupa bawa laptop", "Mantap 👍", "Nanti aku kabarin lagi", "**Penting**: deadline Jumat",
+}
+
+// Run inserts demo data. Demo users are named demo_N and numbering continues
+// after any demo users that already exist, so running it twice adds more data.
+func Run(ctx context.Context, db *mongo.Database, opts Options) (*Stats, error) {
+	if opts.Users < 2 {
+		return nil, fmt.Errorf("need at least 2 users")
+	}
+	if opts.MessagesPerConversation < 1 {
+		return nil, fmt.Errorf("need at least 1 message per conversation")
+	}
+	if opts.Span <= 0 {
+		opts.Span = DefaultOptions().Span
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultOptions().Password
+	}
+
+	randSeed := opts.RandSeed
+	if randSeed == 0 {
+		randSeed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(randSeed))
+
+	userIDs, err := createUsers(ctx, db, opts)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{Users: len(userIDs)}
+
+	now := time.Now()
+	var batch []interface{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := db.Collection("messages").InsertMany(ctx, batch, options.InsertMany().SetOrdered(false)); err != nil {
+			return err
+		}
+		stats.Messages += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < opts.Conversations; i++ {
+		a, b := pickPair(rng, userIDs)
+		conversationID := models.ConversationID(a, b)
+		if seen[conversationID] && len(seen) < len(userIDs)*(len(userIDs)-1)/2 {
+			i--
+			continue
+		}
+		seen[conversationID] = true
+
+		// Vary history length so some conversations are short and some are long
+		count := opts.MessagesPerConversation/2 + rng.Intn(opts.MessagesPerConversation+1)
+		messages := conversation(rng, a, b, count, now.Add(-opts.Span), now)
+		if len(messages) == 0 {
+			continue
+		}
+
+		_, err := db.Collection("conversations").UpdateOne(ctx,
+			bson.M{"_id": conversationID},
+			bson.M{"$setOnInsert": bson.M{"participants": []string{a, b}, "created_at": messages[0].CreatedAt}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return nil, err
+		}
+		stats.Conversations++
+
+		for _, m := range messages {
+			batch = append(batch, m)
+			if len(batch) >= insertBatchSize {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func createUsers(ctx context.Context, db *mongo.Database, opts Options) ([]string, error) {
+	// Hash once, bcrypt at cost 14 per user would take minutes
+	hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := db.Collection("users").CountDocuments(ctx,
+		bson.M{"username": bson.M{"$regex": "^demo_[0-9]+$"}})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ids := make([]string, 0, opts.Users)
+	docs := make([]interface{}, 0, opts.Users)
+	for i := 0; i < opts.Users; i++ {
+		n := int(existing) + i + 1
+		user := models.User{
+			ID:        config.GetNextUserID(),
+			Username:  fmt.Sprintf("demo_%d", n),
+			Email:     fmt.Sprintf("demo_%d@example.com", n),
+			Password:  string(hash),
+			Bio:       "Demo account",
+			Status:    models.UserStatusActive,
+			LastSeen:  now,
+			CreatedAt: now.Add(-opts.Span),
+		}
+		user.Canonicalize()
+		ids = append(ids, user.ID)
+		docs = append(docs, user)
+	}
+
+	if _, err := db.Collection("users").InsertMany(ctx, docs); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func pickPair(rng *rand.Rand, ids []string) (string, string) {
+	a := rng.Intn(len(ids))
+	b := rng.Intn(len(ids) - 1)
+	if b >= a {
+		b++
+	}
+	return ids[a], ids[b]
+}
+
+// conversation builds a history of bursts: a few quick back-and-forth messages,
+// then a gap of hours or days
+func conversation(rng *rand.Rand, a, b string, count int, from, to time.Time) []models.Message {
+	window := to.Sub(from)
+	t := from.Add(time.Duration(rng.Int63n(int64(window / 2))))
+	sender, receiver := a, b
+
+	messages := make([]models.Message, 0, count)
+	for i := 0; i < count && t.Before(to); i++ {
+		messages = append(messages, models.Message{
+			ID:         primitive.NewObjectID(),
+			SenderID:   sender,
+			ReceiverID: receiver,
+			Content:    phrases[rng.Intn(len(phrases))],
+			Type:       models.MessageTypeText,
+			CreatedAt:  t,
+		})
+
+		if rng.Float64() < 0.6 {
+			sender, receiver = receiver, sender
+		}
+
+		if rng.Float64() < 0.15 {
+			t = t.Add(time.Duration(1+rng.Intn(48)) * time.Hour)
+		} else {
+			t = t.Add(time.Duration(5+rng.Intn(300)) * time.Second)
+		}
+	}
+
+	// Everything except the tail of the history has been read
+	for i := range messages {
+		messages[i].ParseFormatting()
+		messages[i].Read = i < len(messages)-rng.Intn(4)
+	}
+
+	return messages
+}
@@ -0,0 +1,191 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type conversationRepository struct {
+	s *Store
+}
+
+func (r conversationRepository) Get(ctx context.Context, id string) (*models.Conversation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	c, ok := r.s.conversations[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	conversation := copyConversation(c)
+	return &conversation, nil
+}
+
+func copyConversation(c *models.Conversation) models.Conversation {
+	conversation := *c
+	conversation.Participants = append([]string(nil), c.Participants...)
+	conversation.Pinned = append([]models.PinnedMessage(nil), c.Pinned...)
+	conversation.BlockedBy = append([]string(nil), c.BlockedBy...)
+	if c.Request != nil {
+		request := *c.Request
+		conversation.Request = &request
+	}
+	return conversation
+}
+
+// conversationLocked returns the stored conversation, creating it on first write.
+// Callers hold s.mu for writing.
+func (s *Store) conversationLocked(conversation *models.Conversation) *models.Conversation {
+	c, ok := s.conversations[conversation.ID]
+	if !ok {
+		c = &models.Conversation{
+			ID:           conversation.ID,
+			Participants: append([]string(nil), conversation.Participants...),
+			CreatedAt:    time.Now(),
+		}
+		s.conversations[conversation.ID] = c
+	}
+	return c
+}
+
+func (r conversationRepository) AddPin(ctx context.Context, conversation *models.Conversation, pin models.PinnedMessage) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c := r.s.conversationLocked(conversation)
+
+	if models.HasPin(c.Pinned, pin.MessageID) || len(c.Pinned) >= models.MaxPinnedMessages {
+		return store.ErrConflict
+	}
+	c.Pinned = append(c.Pinned, pin)
+	return nil
+}
+
+func (r conversationRepository) RemovePin(ctx context.Context, id string, messageID primitive.ObjectID) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c, ok := r.s.conversations[id]
+	if !ok {
+		return false, nil
+	}
+
+	for i, p := range c.Pinned {
+		if p.MessageID == messageID {
+			c.Pinned = append(c.Pinned[:i:i], c.Pinned[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func readCursorKey(userID, otherID string) string {
+	return userID + ":" + otherID
+}
+
+// readCursorLocked returns the user's read position, callers hold s.mu
+func (s *Store) readCursorLocked(userID, otherID string) models.ReadCursor {
+	return s.readCursors[readCursorKey(userID, otherID)]
+}
+
+func (r conversationRepository) AdvanceReadCursor(ctx context.Context, cursor models.ReadCursor) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	key := readCursorKey(cursor.UserID, cursor.OtherID)
+	if current, ok := r.s.readCursors[key]; ok && !current.ReadAt.Before(cursor.ReadAt) {
+		return false, nil
+	}
+	r.s.readCursors[key] = cursor
+	return true, nil
+}
+
+func (r conversationRepository) ReadCursor(ctx context.Context, userID, otherID string) (models.ReadCursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	cursor, ok := r.s.readCursors[readCursorKey(userID, otherID)]
+	if !ok {
+		return models.ReadCursor{UserID: userID, OtherID: otherID}, nil
+	}
+	return cursor, nil
+}
+
+func (r conversationRepository) OpenRequest(ctx context.Context, conversation *models.Conversation, request models.MessageRequest) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c := r.s.conversationLocked(conversation)
+	if c.AcceptedAt == nil {
+		c.Request = &request
+	}
+	return nil
+}
+
+func (r conversationRepository) Accept(ctx context.Context, conversation *models.Conversation, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c := r.s.conversationLocked(conversation)
+	c.Request = nil
+	if c.AcceptedAt == nil {
+		c.AcceptedAt = &at
+	}
+	return nil
+}
+
+func (r conversationRepository) DismissRequest(ctx context.Context, id, recipientID string, at time.Time) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c, ok := r.s.conversations[id]
+	if !ok || !c.PendingFor(recipientID) {
+		return false, nil
+	}
+
+	request := *c.Request
+	request.DismissedAt = &at
+	c.Request = &request
+	return true, nil
+}
+
+func (r conversationRepository) SetBlocked(ctx context.Context, conversation *models.Conversation, userID string, blocked bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c := r.s.conversationLocked(conversation)
+	blockedBy := []string{}
+	for _, id := range c.BlockedBy {
+		if id != userID {
+			blockedBy = append(blockedBy, id)
+		}
+	}
+	if blocked {
+		blockedBy = append(blockedBy, userID)
+	}
+	c.BlockedBy = blockedBy
+	return nil
+}
+
+func (r conversationRepository) Requests(ctx context.Context, recipientID string) ([]models.Conversation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var conversations []models.Conversation
+	for _, c := range r.s.conversations {
+		if c.HiddenFrom(recipientID) {
+			conversations = append(conversations, copyConversation(c))
+		}
+	}
+
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].Request.CreatedAt.After(conversations[j].Request.CreatedAt)
+	})
+	return conversations, nil
+}
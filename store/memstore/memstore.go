@@ -0,0 +1,63 @@
+// Package memstore implements the store repositories in process memory.
+// Data is lost on restart, it is meant for local demos and tests.
+package memstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+type Store struct {
+	mu            sync.RWMutex
+	userSeq       int
+	users         map[string]*models.User
+	messages      []*models.Message // Insertion order
+	conversations map[string]*models.Conversation
+	readCursors   map[string]models.ReadCursor // Keyed by readCursorKey
+	outbox        []*models.OutboxEntry        // Insertion order
+	qrLogins      map[string]*models.QRLogin
+}
+
+func New() *Store {
+	return &Store{
+		users:         make(map[string]*models.User),
+		conversations: make(map[string]*models.Conversation),
+		readCursors:   make(map[string]models.ReadCursor),
+		qrLogins:      make(map[string]*models.QRLogin),
+	}
+}
+
+func (s *Store) Users() store.UserRepository {
+	return userRepository{s}
+}
+
+func (s *Store) Messages() store.MessageRepository {
+	return messageRepository{s}
+}
+
+func (s *Store) Conversations() store.ConversationRepository {
+	return conversationRepository{s}
+}
+
+func (s *Store) Presence() store.PresenceRepository {
+	return presenceRepository{s}
+}
+
+func (s *Store) Outbox() store.OutboxRepository {
+	return outboxRepository{s}
+}
+
+func (s *Store) QRLogins() store.QRLoginRepository {
+	return qrLoginRepository{s}
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,185 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/richtext"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListHidesClosedAccounts(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	scheduled := time.Now().Add(24 * time.Hour)
+	guestExpiry := time.Now().Add(time.Hour)
+	for _, u := range []models.User{
+		{ID: "001", Username: "active", Status: models.UserStatusActive},
+		{ID: "002", Username: "deactivated", Status: models.UserStatusDeactivated},
+		{ID: "003", Username: "deleting", Status: models.UserStatusActive, DeletionScheduledAt: &scheduled},
+		{ID: "004", Username: "guest", Status: models.UserStatusActive, GuestExpiresAt: &guestExpiry},
+	} {
+		u.Email = u.Username + "@example.com"
+		if err := s.Users().Create(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	users, err := s.Users().List(ctx, store.UserFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != "001" {
+		t.Errorf("List returned %v, want only the active account", users)
+	}
+
+	count, err := s.Users().Count(ctx, store.UserFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Count = %d, want 1", count)
+	}
+}
+
+func insertMessage(t *testing.T, s *Store, m models.Message) primitive.ObjectID {
+	t.Helper()
+	m.ID = primitive.NewObjectID()
+	if m.Type == "" {
+		m.Type = models.MessageTypeText
+	}
+	if err := s.Messages().Insert(context.Background(), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m.ID
+}
+
+func getMessage(t *testing.T, s *Store, id primitive.ObjectID) models.Message {
+	t.Helper()
+	messages, err := s.Messages().GetByIDs(context.Background(), "001", []primitive.ObjectID{id})
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("GetByIDs(%s) = %v, %v", id.Hex(), messages, err)
+	}
+	return messages[0]
+}
+
+func TestExpireViewed(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	sent := time.Now().Add(-time.Minute)
+
+	viewOnce := insertMessage(t, s, models.Message{SenderID: "001", ReceiverID: "002", Content: "secret",
+		Entities: []richtext.Entity{{Type: "bold", Offset: 0, Length: 6}}, ViewOnce: true, CreatedAt: sent})
+	regular := insertMessage(t, s, models.Message{SenderID: "001", ReceiverID: "002", Content: "hello", CreatedAt: sent})
+	unread := insertMessage(t, s, models.Message{SenderID: "001", ReceiverID: "002", Content: "later", ViewOnce: true,
+		CreatedAt: time.Now().Add(time.Minute)})
+
+	expired, err := s.Messages().ExpireViewed(ctx, "002", "001", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].ID != viewOnce {
+		t.Fatalf("ExpireViewed returned %v, want only the read view-once message", expired)
+	}
+
+	if m := getMessage(t, s, viewOnce); m.Content != "" || m.Entities != nil || m.Type != models.MessageTypeExpired {
+		t.Errorf("view-once message kept its content: %+v", m)
+	}
+	if m := getMessage(t, s, regular); m.Content != "hello" {
+		t.Errorf("regular message lost its content: %+v", m)
+	}
+	if m := getMessage(t, s, unread); m.Content != "later" {
+		t.Errorf("unread view-once message lost its content: %+v", m)
+	}
+
+	// The sender reading their own messages expires nothing
+	if expired, _ := s.Messages().ExpireViewed(ctx, "001", "002", time.Now()); len(expired) != 0 {
+		t.Errorf("ExpireViewed for the sender returned %v", expired)
+	}
+
+	// Already expired messages are not reported again
+	if expired, _ := s.Messages().ExpireViewed(ctx, "002", "001", time.Now()); len(expired) != 0 {
+		t.Errorf("second ExpireViewed returned %v", expired)
+	}
+}
+
+func TestExpireDue(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	now := time.Now()
+	past, future := now.Add(-time.Second), now.Add(time.Hour)
+
+	due := []primitive.ObjectID{
+		insertMessage(t, s, models.Message{SenderID: "001", ReceiverID: "002", Content: "a", ExpiresAt: &past, CreatedAt: now}),
+		insertMessage(t, s, models.Message{SenderID: "001", ReceiverID: "002", Content: "b", ExpiresAt: &past, CreatedAt: now}),
+	}
+	later := insertMessage(t, s, models.Message{SenderID: "001", ReceiverID: "002", Content: "c", ExpiresAt: &future, CreatedAt: now})
+
+	first, err := s.Messages().ExpireDue(ctx, now, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Messages().ExpireDue(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("ExpireDue returned %d then %d messages, want 1 and 1", len(first), len(second))
+	}
+
+	for _, id := range due {
+		if m := getMessage(t, s, id); m.Content != "" || m.Type != models.MessageTypeExpired {
+			t.Errorf("due message kept its content: %+v", m)
+		}
+	}
+	if m := getMessage(t, s, later); m.Content != "c" {
+		t.Errorf("message not yet due lost its content: %+v", m)
+	}
+}
+
+func TestQRLoginAnsweredOnce(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	now := time.Now()
+
+	for _, login := range []models.QRLogin{
+		{Code: "pending", Status: models.QRLoginPending, ExpiresAt: now.Add(time.Minute)},
+		{Code: "expired", Status: models.QRLoginPending, ExpiresAt: now.Add(-time.Second)},
+	} {
+		if err := s.QRLogins().Create(ctx, &login); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.QRLogins().Decide(ctx, "expired", "001", models.QRLoginApproved, now); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("approving an expired challenge: err = %v, want ErrNotFound", err)
+	}
+
+	// Only approved challenges can be completed
+	if _, err := s.QRLogins().Complete(ctx, "pending"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("completing a pending challenge: err = %v, want ErrNotFound", err)
+	}
+
+	if err := s.QRLogins().Decide(ctx, "pending", "001", models.QRLoginApproved, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.QRLogins().Decide(ctx, "pending", "002", models.QRLoginRejected, now); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("answering twice: err = %v, want ErrNotFound", err)
+	}
+
+	login, err := s.QRLogins().Complete(ctx, "pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.UserID != "001" || login.Status != models.QRLoginCompleted {
+		t.Errorf("Complete returned %+v, want completed for 001", login)
+	}
+	if _, err := s.QRLogins().Complete(ctx, "pending"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("completing twice: err = %v, want ErrNotFound", err)
+	}
+}
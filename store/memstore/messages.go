@@ -0,0 +1,207 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type messageRepository struct {
+	s *Store
+}
+
+// between reports whether the message was exchanged directly between users a and b
+func between(m *models.Message, a, b string) bool {
+	return m.RoomID == "" && m.ChannelID == "" &&
+		((m.SenderID == a && m.ReceiverID == b) || (m.SenderID == b && m.ReceiverID == a))
+}
+
+// visibleTo hides messages of shadow-restricted senders from everyone but the sender
+func visibleTo(m *models.Message, userID string) bool {
+	return !m.Shadowed || m.SenderID == userID
+}
+
+// olderThan reports whether m comes after the cursor in a newest first listing
+func olderThan(m *models.Message, before *store.MessageCursor) bool {
+	if !m.CreatedAt.Equal(before.CreatedAt) {
+		return m.CreatedAt.Before(before.CreatedAt)
+	}
+	return m.ID.Hex() < before.ID.Hex()
+}
+
+func (r messageRepository) Insert(ctx context.Context, message *models.Message, events ...models.OutboxEntry) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored := *message
+	r.s.messages = append(r.s.messages, &stored)
+	for _, event := range events {
+		r.s.outbox = append(r.s.outbox, &event)
+	}
+	return nil
+}
+
+func (r messageRepository) GetByIDs(ctx context.Context, viewerID string, ids []primitive.ObjectID) ([]models.Message, error) {
+	wanted := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	messages := []models.Message{}
+	for _, m := range r.s.messages {
+		if wanted[m.ID] && visibleTo(m, viewerID) {
+			messages = append(messages, *m)
+		}
+	}
+	return messages, nil
+}
+
+func (r messageRepository) GetDirect(ctx context.Context, id primitive.ObjectID, viewerID, otherID string) (*models.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, m := range r.s.messages {
+		if m.ID == id && between(m, viewerID, otherID) && visibleTo(m, viewerID) {
+			message := *m
+			return &message, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (r messageRepository) ListDirect(ctx context.Context, viewerID, otherID string, before *store.MessageCursor, skip, limit int64) ([]models.Message, error) {
+	r.s.mu.RLock()
+	var messages []models.Message
+	for _, m := range r.s.messages {
+		if between(m, viewerID, otherID) && visibleTo(m, viewerID) && (before == nil || olderThan(m, before)) {
+			messages = append(messages, *m)
+		}
+	}
+	r.s.mu.RUnlock()
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		if !messages[i].CreatedAt.Equal(messages[j].CreatedAt) {
+			return messages[i].CreatedAt.After(messages[j].CreatedAt)
+		}
+		return messages[i].ID.Hex() > messages[j].ID.Hex()
+	})
+	return page(messages, skip, limit), nil
+}
+
+func (r messageRepository) RecentText(ctx context.Context, userID string, limit int64) ([]models.Message, error) {
+	r.s.mu.RLock()
+	var messages []models.Message
+	for _, m := range r.s.messages {
+		if m.RoomID == "" && m.ChannelID == "" && (m.SenderID == userID || m.ReceiverID == userID) &&
+			visibleTo(m, userID) && m.Type == models.MessageTypeText && !m.Disappears() && !m.Archived {
+			messages = append(messages, *m)
+		}
+	}
+	r.s.mu.RUnlock()
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.After(messages[j].CreatedAt)
+	})
+	return page(messages, 0, limit), nil
+}
+
+func (r messageRepository) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var count int64
+	for _, m := range r.s.messages {
+		if m.ReceiverID != userID || m.Shadowed || r.s.readCursorLocked(userID, m.SenderID).Covers(m) {
+			continue
+		}
+		// Requests are counted apart, as requests
+		if c, ok := r.s.conversations[models.ConversationID(userID, m.SenderID)]; ok && c.HiddenFrom(userID) {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (r messageRepository) DirectConversations(ctx context.Context, userID string) ([]store.ConversationSummary, error) {
+	r.s.mu.RLock()
+	byUser := make(map[string]*store.ConversationSummary)
+	for _, m := range r.s.messages {
+		if m.RoomID != "" || m.ChannelID != "" || !visibleTo(m, userID) {
+			continue
+		}
+
+		var other string
+		switch userID {
+		case m.SenderID:
+			other = m.ReceiverID
+		case m.ReceiverID:
+			other = m.SenderID
+		default:
+			continue
+		}
+
+		summary, ok := byUser[other]
+		if !ok {
+			summary = &store.ConversationSummary{OtherUserID: other, LastMessage: *m}
+			byUser[other] = summary
+		} else if m.CreatedAt.After(summary.LastMessage.CreatedAt) {
+			summary.LastMessage = *m
+		}
+		if m.ReceiverID == userID && !r.s.readCursorLocked(userID, other).Covers(m) {
+			summary.UnreadCount++
+		}
+	}
+	r.s.mu.RUnlock()
+
+	summaries := make([]store.ConversationSummary, 0, len(byUser))
+	for _, summary := range byUser {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].LastMessage.CreatedAt.After(summaries[j].LastMessage.CreatedAt)
+	})
+	return summaries, nil
+}
+
+// expireLocked removes the content of the matching messages, callers hold r.s.mu
+func (r messageRepository) expireLocked(match func(m *models.Message) bool, limit int64) []models.Message {
+	expired := []models.Message{}
+	for _, m := range r.s.messages {
+		if limit > 0 && int64(len(expired)) >= limit {
+			break
+		}
+		if m.Type == models.MessageTypeExpired || !match(m) {
+			continue
+		}
+		m.Content, m.Entities, m.Type = "", nil, models.MessageTypeExpired
+		expired = append(expired, *m)
+	}
+	return expired
+}
+
+func (r messageRepository) ExpireViewed(ctx context.Context, receiverID, senderID string, readAt time.Time) ([]models.Message, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.expireLocked(func(m *models.Message) bool {
+		return m.ViewOnce && m.SenderID == senderID && m.ReceiverID == receiverID &&
+			m.RoomID == "" && m.ChannelID == "" && !m.CreatedAt.After(readAt)
+	}, 0), nil
+}
+
+func (r messageRepository) ExpireDue(ctx context.Context, now time.Time, limit int64) ([]models.Message, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.expireLocked(func(m *models.Message) bool {
+		return m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+	}, limit), nil
+}
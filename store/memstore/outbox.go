@@ -0,0 +1,103 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type outboxRepository struct {
+	s *Store
+}
+
+func (r outboxRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEntry, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	claimed := []models.OutboxEntry{}
+	for _, e := range r.s.outbox {
+		if len(claimed) == limit {
+			break
+		}
+		if e.PublishedAt != nil || e.NextAttemptAt.After(now) {
+			continue
+		}
+		e.NextAttemptAt = now.Add(lease)
+		e.Attempts++
+		claimed = append(claimed, *e)
+	}
+	return claimed, nil
+}
+
+func (r outboxRepository) find(id primitive.ObjectID) *models.OutboxEntry {
+	for _, e := range r.s.outbox {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+func (r outboxRepository) MarkPublished(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	e := r.find(id)
+	if e == nil {
+		return store.ErrNotFound
+	}
+	e.PublishedAt = &at
+	e.LastError = ""
+	return nil
+}
+
+func (r outboxRepository) Retry(ctx context.Context, id primitive.ObjectID, next time.Time, lastErr string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	e := r.find(id)
+	if e == nil {
+		return store.ErrNotFound
+	}
+	e.NextAttemptAt = next
+	e.LastError = lastErr
+	return nil
+}
+
+func (r outboxRepository) Pending(ctx context.Context) (int64, time.Time, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var count int64
+	var oldest time.Time
+	for _, e := range r.s.outbox {
+		if e.PublishedAt != nil {
+			continue
+		}
+		if count == 0 || e.CreatedAt.Before(oldest) {
+			oldest = e.CreatedAt
+		}
+		count++
+	}
+	return count, oldest, nil
+}
+
+func (r outboxRepository) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	kept := r.s.outbox[:0]
+	var purged int64
+	for _, e := range r.s.outbox {
+		if e.PublishedAt != nil && e.PublishedAt.Before(before) {
+			purged++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	r.s.outbox = kept
+	return purged, nil
+}
@@ -0,0 +1,69 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+type qrLoginRepository struct {
+	s *Store
+}
+
+func (r qrLoginRepository) Create(ctx context.Context, login *models.QRLogin) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for code, old := range r.s.qrLogins {
+		if now.After(old.ExpiresAt) {
+			delete(r.s.qrLogins, code)
+		}
+	}
+	if _, ok := r.s.qrLogins[login.Code]; ok {
+		return store.ErrConflict
+	}
+	stored := *login
+	r.s.qrLogins[login.Code] = &stored
+	return nil
+}
+
+func (r qrLoginRepository) Get(ctx context.Context, code string) (*models.QRLogin, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	login, ok := r.s.qrLogins[code]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	found := *login
+	return &found, nil
+}
+
+func (r qrLoginRepository) Decide(ctx context.Context, code, userID, status string, now time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	login, ok := r.s.qrLogins[code]
+	if !ok || login.StatusAt(now) != models.QRLoginPending {
+		return store.ErrNotFound
+	}
+	login.Status = status
+	login.UserID = userID
+	return nil
+}
+
+func (r qrLoginRepository) Complete(ctx context.Context, code string) (*models.QRLogin, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	login, ok := r.s.qrLogins[code]
+	if !ok || login.Status != models.QRLoginApproved {
+		return nil, store.ErrNotFound
+	}
+	login.Status = models.QRLoginCompleted
+	completed := *login
+	return &completed, nil
+}
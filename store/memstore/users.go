@@ -0,0 +1,349 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+type userRepository struct {
+	s *Store
+}
+
+func (r userRepository) NextID(ctx context.Context) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.userSeq++
+
+	// Format as 3-digit string with leading zeros
+	return fmt.Sprintf("%03d", r.s.userSeq), nil
+}
+
+func (r userRepository) Create(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user.Canonicalize()
+	if _, ok := r.s.users[user.ID]; ok {
+		return store.ErrConflict
+	}
+	for _, u := range r.s.users {
+		if u.UsernameCanonical == user.UsernameCanonical || u.EmailCanonical == user.EmailCanonical {
+			return store.ErrConflict
+		}
+	}
+
+	stored := *user
+	r.s.users[user.ID] = &stored
+	return nil
+}
+
+// find returns a copy of the first user matching fn
+func (r userRepository) find(fn func(*models.User) bool) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, u := range r.s.users {
+		if fn(u) {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (r userRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (r userRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	email = models.CanonicalEmail(email)
+	return r.find(func(u *models.User) bool { return u.EmailCanonical == email })
+}
+
+func (r userRepository) FindByEmailOrUsername(ctx context.Context, email, username string) (*models.User, error) {
+	email, username = models.CanonicalEmail(email), models.CanonicalUsername(username)
+	return r.find(func(u *models.User) bool { return u.EmailCanonical == email || u.UsernameCanonical == username })
+}
+
+func (r userRepository) UsernameTaken(ctx context.Context, username, exceptID string) (bool, error) {
+	username = models.CanonicalUsername(username)
+	_, err := r.find(func(u *models.User) bool { return u.UsernameCanonical == username && u.ID != exceptID })
+	return err == nil, nil
+}
+
+func (r userRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	username = models.CanonicalUsername(username)
+	return r.find(func(u *models.User) bool { return u.UsernameCanonical == username })
+}
+
+func (r userRepository) ChangeUsername(ctx context.Context, id, username string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok || u.Username == username {
+		return nil
+	}
+	canonical := models.CanonicalUsername(username)
+	for _, other := range r.s.users {
+		if other.ID != id && other.UsernameCanonical == canonical {
+			return store.ErrConflict
+		}
+	}
+
+	u.UsernameHistory = models.AppendUsernameHistory(u.UsernameHistory, u.Username, at)
+	u.Username = username
+	u.UsernameCanonical = canonical
+	u.UsernameChangedAt = &at
+	return nil
+}
+
+func (r userRepository) FindByFormerUsername(ctx context.Context, username string, since time.Time) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	username = models.CanonicalUsername(username)
+
+	var found *models.User
+	var foundAt time.Time
+	for _, u := range r.s.users {
+		for _, change := range u.UsernameHistory {
+			if change.Canonical == username && !change.ChangedAt.Before(since) && change.ChangedAt.After(foundAt) {
+				found, foundAt = u, change.ChangedAt
+			}
+		}
+	}
+	if found == nil {
+		return nil, store.ErrNotFound
+	}
+
+	user := *found
+	return &user, nil
+}
+
+func (r userRepository) UpgradeGuest(ctx context.Context, id, username, email, password string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok || !u.IsGuest() {
+		return store.ErrNotFound
+	}
+	upgraded := models.User{Username: username, Email: email}
+	upgraded.Canonicalize()
+	for _, other := range r.s.users {
+		if other.ID != id && (other.UsernameCanonical == upgraded.UsernameCanonical || other.EmailCanonical == upgraded.EmailCanonical) {
+			return store.ErrConflict
+		}
+	}
+
+	u.Username = username
+	u.Email = email
+	u.UsernameCanonical = upgraded.UsernameCanonical
+	u.EmailCanonical = upgraded.EmailCanonical
+	u.Password = password
+	u.GuestExpiresAt = nil
+	u.GuestInviters = nil
+	return nil
+}
+
+func (r userRepository) ChangeEmail(ctx context.Context, id, from, to, nonce string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok || u.Email != from || u.EmailChangeNonce != nonce {
+		return store.ErrNotFound
+	}
+	canonical := models.CanonicalEmail(to)
+	for _, other := range r.s.users {
+		if other.ID != id && other.EmailCanonical == canonical {
+			return store.ErrConflict
+		}
+	}
+
+	u.Email = to
+	u.EmailCanonical = canonical
+	u.EmailChangeNonce = ""
+	return nil
+}
+
+func (r userRepository) Update(ctx context.Context, id string, update store.UserUpdate) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return nil
+	}
+
+	if update.DisplayName != nil {
+		u.DisplayName = *update.DisplayName
+	}
+	if update.Bio != nil {
+		u.Bio = *update.Bio
+	}
+	if update.Avatar != nil {
+		u.Avatar = *update.Avatar
+	}
+	if update.Status != nil {
+		u.Status = *update.Status
+	}
+	if update.HideFromDiscovery != nil {
+		u.HideFromDiscovery = *update.HideFromDiscovery
+	}
+	if update.EmailDigestOptOut != nil {
+		u.EmailDigestOptOut = *update.EmailDigestOptOut
+	}
+	if update.Language != nil {
+		u.Language = *update.Language
+	}
+	if update.EmailChangeNonce != nil {
+		u.EmailChangeNonce = *update.EmailChangeNonce
+	}
+	return nil
+}
+
+// match returns the users selected by the filter, online first then by last seen
+func (r userRepository) match(f store.UserFilter) ([]models.User, error) {
+	r.s.mu.RLock()
+	var users []models.User
+	for _, u := range r.s.users {
+		// Hide guests, deactivated and deleted accounts
+		if u.IsGuest() || u.Status == models.UserStatusDeactivated || u.DeletionScheduledAt != nil {
+			continue
+		}
+		if u.ID == f.ExcludeID || (f.OnlineOnly && !u.Online) || u.LastSeen.Before(f.ActiveSince) {
+			continue
+		}
+		// Users who opted out of discovery never show up in search results
+		if f.Search != "" {
+			if _, ok := models.MatchUser(u, f.Search, f.Fuzzy); u.HideFromDiscovery || !ok {
+				continue
+			}
+		}
+		users = append(users, *u)
+	}
+	r.s.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Online != users[j].Online {
+			return users[i].Online
+		}
+		return users[i].LastSeen.After(users[j].LastSeen)
+	})
+	return users, nil
+}
+
+func (r userRepository) List(ctx context.Context, f store.UserFilter) ([]models.User, error) {
+	users, err := r.match(f)
+	if err != nil {
+		return nil, err
+	}
+	return page(users, f.Skip, f.Limit), nil
+}
+
+func (r userRepository) Count(ctx context.Context, f store.UserFilter) (int64, error) {
+	users, err := r.match(f)
+	return int64(len(users)), err
+}
+
+func (r userRepository) EstimatedCount(ctx context.Context) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return int64(len(r.s.users)), nil
+}
+
+type presenceRepository struct {
+	s *Store
+}
+
+func (r presenceRepository) SetOnline(ctx context.Context, userID string, online bool, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if u, ok := r.s.users[userID]; ok {
+		u.Online = online
+		u.LastSeen = at
+	}
+	return nil
+}
+
+func (r presenceRepository) Touch(ctx context.Context, userID string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if u, ok := r.s.users[userID]; ok {
+		u.LastSeen = at
+	}
+	return nil
+}
+
+func (r presenceRepository) Heartbeat(ctx context.Context, userIDs []string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, id := range userIDs {
+		if u, ok := r.s.users[id]; ok {
+			u.Online = true
+			u.LastSeen = at
+		}
+	}
+	return nil
+}
+
+func (r presenceRepository) ExpireOnline(ctx context.Context, before time.Time, limit int64) ([]store.UserPresence, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	expired := []store.UserPresence{}
+	for _, u := range r.s.users {
+		if int64(len(expired)) == limit {
+			break
+		}
+		if u.Online && u.LastSeen.Before(before) {
+			u.Online = false
+			expired = append(expired, store.UserPresence{UserID: u.ID, Online: true, LastSeen: u.LastSeen})
+		}
+	}
+	return expired, nil
+}
+
+func (r presenceRepository) Get(ctx context.Context, userIDs []string) ([]store.UserPresence, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	presence := make([]store.UserPresence, 0, len(userIDs))
+	for _, id := range userIDs {
+		if u, ok := r.s.users[id]; ok {
+			presence = append(presence, store.UserPresence{UserID: u.ID, Online: u.Online, LastSeen: u.LastSeen})
+		}
+	}
+	return presence, nil
+}
+
+// page applies skip and limit, a zero limit returns everything after skip
+func page[T any](items []T, skip, limit int64) []T {
+	if skip >= int64(len(items)) {
+		return []T{}
+	}
+	items = items[skip:]
+	if limit > 0 && limit < int64(len(items)) {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,173 @@
+package mongostore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type conversationRepository struct {
+	conversations *mongo.Collection
+	readCursors   *mongo.Collection
+}
+
+func (r conversationRepository) Get(ctx context.Context, id string) (*models.Conversation, error) {
+	var conversation models.Conversation
+	if err := r.conversations.FindOne(ctx, bson.M{"_id": id}).Decode(&conversation); err != nil {
+		return nil, notFound(err)
+	}
+	return &conversation, nil
+}
+
+func (r conversationRepository) AddPin(ctx context.Context, conversation *models.Conversation, pin models.PinnedMessage) error {
+	// The filter matches only if the message is not pinned and the list is not full,
+	// otherwise the upsert collides with the existing document
+	_, err := r.conversations.UpdateOne(ctx,
+		bson.M{
+			"_id":               conversation.ID,
+			"pinned.message_id": bson.M{"$ne": pin.MessageID},
+			fmt.Sprintf("pinned.%d", models.MaxPinnedMessages-1): bson.M{"$exists": false},
+		},
+		bson.M{
+			"$push":        bson.M{"pinned": pin},
+			"$setOnInsert": bson.M{"participants": conversation.Participants, "created_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r conversationRepository) RemovePin(ctx context.Context, id string, messageID primitive.ObjectID) (bool, error) {
+	result, err := r.conversations.UpdateOne(ctx,
+		bson.M{"_id": id, "pinned.message_id": messageID},
+		bson.M{"$pull": bson.M{"pinned": bson.M{"message_id": messageID}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func readCursorID(userID, otherID string) string {
+	return userID + ":" + otherID
+}
+
+func (r conversationRepository) AdvanceReadCursor(ctx context.Context, cursor models.ReadCursor) (bool, error) {
+	update := bson.M{"$set": cursor}
+	if cursor.MessageID.IsZero() {
+		// Set by timestamp, drop the message of an earlier position
+		update["$unset"] = bson.M{"message_id": ""}
+	}
+
+	// The filter matches only if the cursor moves forward, otherwise the upsert
+	// collides with the existing document
+	result, err := r.readCursors.UpdateOne(ctx,
+		bson.M{
+			"_id":     readCursorID(cursor.UserID, cursor.OtherID),
+			"read_at": bson.M{"$lt": cursor.ReadAt},
+		},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0 || result.UpsertedCount > 0, nil
+}
+
+func (r conversationRepository) ReadCursor(ctx context.Context, userID, otherID string) (models.ReadCursor, error) {
+	var cursor models.ReadCursor
+	err := r.readCursors.FindOne(ctx, bson.M{"_id": readCursorID(userID, otherID)}).Decode(&cursor)
+	if err == mongo.ErrNoDocuments {
+		return models.ReadCursor{UserID: userID, OtherID: otherID}, nil
+	}
+	return cursor, err
+}
+
+func (r conversationRepository) OpenRequest(ctx context.Context, conversation *models.Conversation, request models.MessageRequest) error {
+	// An accepted conversation does not match, the upsert then collides with it
+	_, err := r.conversations.UpdateOne(ctx,
+		bson.M{"_id": conversation.ID, "accepted_at": bson.M{"$exists": false}},
+		bson.M{
+			"$set":         bson.M{"request": request},
+			"$setOnInsert": bson.M{"participants": conversation.Participants, "created_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (r conversationRepository) Accept(ctx context.Context, conversation *models.Conversation, at time.Time) error {
+	// $min keeps the first acceptance
+	_, err := r.conversations.UpdateOne(ctx,
+		bson.M{"_id": conversation.ID},
+		bson.M{
+			"$unset":       bson.M{"request": ""},
+			"$min":         bson.M{"accepted_at": at},
+			"$setOnInsert": bson.M{"participants": conversation.Participants, "created_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (r conversationRepository) DismissRequest(ctx context.Context, id, recipientID string, at time.Time) (bool, error) {
+	result, err := r.conversations.UpdateOne(ctx,
+		bson.M{
+			"_id":                  id,
+			"request.recipient_id": recipientID,
+			"request.dismissed_at": bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"request.dismissed_at": at}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r conversationRepository) SetBlocked(ctx context.Context, conversation *models.Conversation, userID string, blocked bool) error {
+	update := bson.M{
+		"$pull":        bson.M{"blocked_by": userID},
+		"$setOnInsert": bson.M{"participants": conversation.Participants, "created_at": time.Now()},
+	}
+	if blocked {
+		delete(update, "$pull")
+		update["$addToSet"] = bson.M{"blocked_by": userID}
+	}
+
+	_, err := r.conversations.UpdateOne(ctx, bson.M{"_id": conversation.ID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r conversationRepository) Requests(ctx context.Context, recipientID string) ([]models.Conversation, error) {
+	cursor, err := r.conversations.Find(ctx,
+		bson.M{"request.recipient_id": recipientID},
+		options.Find().SetSort(bson.D{{Key: "request.created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var conversations []models.Conversation
+	if err := cursor.All(ctx, &conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
@@ -0,0 +1,363 @@
+package mongostore
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type messageRepository struct {
+	messages      *mongo.Collection
+	readCursors   *mongo.Collection
+	outbox        *mongo.Collection
+	conversations *mongo.Collection
+}
+
+func (r messageRepository) Insert(ctx context.Context, message *models.Message, events ...models.OutboxEntry) error {
+	err := r.insertWithOutbox(ctx, message, events)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r messageRepository) insertWithOutbox(ctx context.Context, message *models.Message, events []models.OutboxEntry) error {
+	if len(events) == 0 {
+		_, err := r.messages.InsertOne(ctx, message)
+		return err
+	}
+
+	documents := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		documents = append(documents, event)
+	}
+
+	insert := func(ctx context.Context) (interface{}, error) {
+		if _, err := r.messages.InsertOne(ctx, message); err != nil {
+			return nil, err
+		}
+		_, err := r.outbox.InsertMany(ctx, documents)
+		return nil, err
+	}
+
+	if !standalone.Load() {
+		session, err := r.messages.Database().Client().StartSession()
+		if err != nil {
+			return err
+		}
+		defer session.EndSession(ctx)
+
+		_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return insert(sc)
+		})
+		if !transactionsUnsupported(err) {
+			return err
+		}
+		standalone.Store(true)
+		log.Println("MongoDB does not support transactions (not a replica set), outbox entries are written after their message and lost if the server stops in between")
+	}
+
+	_, err := insert(ctx)
+	return err
+}
+
+func (r messageRepository) GetByIDs(ctx context.Context, viewerID string, ids []primitive.ObjectID) ([]models.Message, error) {
+	cursor, err := r.messages.Find(ctx, bson.M{
+		"_id":  bson.M{"$in": ids},
+		"$and": []bson.M{VisibleTo(viewerID)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []models.Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r messageRepository) GetDirect(ctx context.Context, id primitive.ObjectID, viewerID, otherID string) (*models.Message, error) {
+	var message models.Message
+	err := r.messages.FindOne(ctx, bson.M{
+		"_id":     id,
+		"room_id": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"sender_id": viewerID, "receiver_id": otherID},
+			{"sender_id": otherID, "receiver_id": viewerID},
+		},
+		"$and": []bson.M{VisibleTo(viewerID)},
+	}).Decode(&message)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &message, nil
+}
+
+func (r messageRepository) ListDirect(ctx context.Context, viewerID, otherID string, before *store.MessageCursor, skip, limit int64) ([]models.Message, error) {
+	and := []bson.M{VisibleTo(viewerID)}
+	if before != nil {
+		and = append(and, olderThan(before))
+	}
+	filter := bson.M{
+		"$or": []bson.M{
+			{"sender_id": viewerID, "receiver_id": otherID},
+			{"sender_id": otherID, "receiver_id": viewerID},
+		},
+		"$and": and,
+	}
+
+	opts := options.Find().
+		SetSort(newestFirst).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := r.messages.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []models.Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r messageRepository) RecentText(ctx context.Context, userID string, limit int64) ([]models.Message, error) {
+	filter := bson.M{
+		"$or": []bson.M{
+			{"sender_id": userID},
+			{"receiver_id": userID},
+		},
+		"room_id":    bson.M{"$exists": false},
+		"channel_id": bson.M{"$exists": false},
+		"type":       models.MessageTypeText,
+		"view_once":  bson.M{"$ne": true},
+		"expires_at": nil,
+		"archived":   bson.M{"$ne": true},
+		"$and":       []bson.M{VisibleTo(userID)},
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(limit)
+
+	cursor, err := r.messages.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []models.Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r messageRepository) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	cursors, err := loadReadCursors(ctx, r.readCursors, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Requests are counted apart, as requests
+	requesters, err := r.conversations.Distinct(ctx, "request.sender_id", bson.M{"request.recipient_id": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	return r.messages.CountDocuments(ctx, bson.M{
+		"receiver_id": userID,
+		"sender_id":   bson.M{"$nin": requesters},
+		"read":        false,
+		"shadowed":    bson.M{"$ne": true},
+		"$or":         unreadFilter(cursors),
+	})
+}
+
+func (r messageRepository) DirectConversations(ctx context.Context, userID string) ([]store.ConversationSummary, error) {
+	cursors, err := loadReadCursors(ctx, r.readCursors, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Aggregation pipeline to get latest message for each conversation
+	pipeline := []bson.M{
+		{
+			"$match": bson.M{
+				"$or": []bson.M{
+					{"sender_id": userID},
+					{"receiver_id": userID},
+				},
+				"room_id":    bson.M{"$exists": false},
+				"channel_id": bson.M{"$exists": false},
+				"$and":       []bson.M{VisibleTo(userID)},
+			},
+		},
+		{
+			"$sort": bson.M{"created_at": -1},
+		},
+		{
+			"$group": bson.M{
+				"_id": bson.M{
+					"$cond": []interface{}{
+						bson.M{"$eq": []interface{}{"$sender_id", userID}},
+						"$receiver_id",
+						"$sender_id",
+					},
+				},
+				"last_message": bson.M{"$first": "$$ROOT"},
+				"unread_count": bson.M{
+					"$sum": bson.M{
+						"$cond": []interface{}{
+							bson.M{
+								"$and": []bson.M{
+									{"$eq": []interface{}{"$receiver_id", userID}},
+									{"$eq": []interface{}{"$read", false}},
+									unreadExpr(cursors),
+								},
+							},
+							1,
+							0,
+						},
+					},
+				},
+			},
+		},
+		{
+			"$sort": bson.M{"last_message.created_at": -1},
+		},
+	}
+
+	cursor, err := r.messages.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID          string         `bson:"_id"`
+		LastMessage models.Message `bson:"last_message"`
+		UnreadCount int            `bson:"unread_count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	summaries := make([]store.ConversationSummary, 0, len(results))
+	for _, result := range results {
+		summaries = append(summaries, store.ConversationSummary{
+			OtherUserID: result.ID,
+			LastMessage: result.LastMessage,
+			UnreadCount: result.UnreadCount,
+		})
+	}
+	return summaries, nil
+}
+
+// loadReadCursors maps the other participant to the user's read position
+func loadReadCursors(ctx context.Context, readCursors *mongo.Collection, userID string) (map[string]time.Time, error) {
+	cursor, err := readCursors.Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetProjection(bson.M{"other_id": 1, "read_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []models.ReadCursor
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	cursors := make(map[string]time.Time, len(docs))
+	for _, doc := range docs {
+		cursors[doc.OtherID] = doc.ReadAt
+	}
+	return cursors, nil
+}
+
+// unreadFilter matches received messages past the read cursors, as $or clauses
+func unreadFilter(cursors map[string]time.Time) []bson.M {
+	senders := make([]string, 0, len(cursors))
+	clauses := make([]bson.M, 0, len(cursors)+1)
+	for otherID, readAt := range cursors {
+		senders = append(senders, otherID)
+		clauses = append(clauses, bson.M{"sender_id": otherID, "created_at": bson.M{"$gt": readAt}})
+	}
+	return append(clauses, bson.M{"sender_id": bson.M{"$nin": senders}})
+}
+
+// unreadExpr is unreadFilter as an aggregation expression
+func unreadExpr(cursors map[string]time.Time) bson.M {
+	senders := make([]string, 0, len(cursors))
+	clauses := make([]bson.M, 0, len(cursors)+1)
+	for otherID, readAt := range cursors {
+		senders = append(senders, otherID)
+		clauses = append(clauses, bson.M{"$and": []bson.M{
+			{"$eq": []interface{}{"$sender_id", otherID}},
+			{"$gt": []interface{}{"$created_at", readAt}},
+		}})
+	}
+	clauses = append(clauses, bson.M{"$not": []interface{}{bson.M{"$in": []interface{}{"$sender_id", senders}}}})
+	return bson.M{"$or": clauses}
+}
+
+// expire removes the content of up to limit messages matching filter, limit 0 means all
+func (r messageRepository) expire(ctx context.Context, filter bson.M, limit int64) ([]models.Message, error) {
+	filter["type"] = bson.M{"$ne": models.MessageTypeExpired}
+
+	cursor, err := r.messages.Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var candidates []models.Message
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	// Filtering on the type again leaves messages expired concurrently to the other caller
+	expired := []models.Message{}
+	for _, message := range candidates {
+		result, err := r.messages.UpdateOne(ctx,
+			bson.M{"_id": message.ID, "type": bson.M{"$ne": models.MessageTypeExpired}},
+			bson.M{"$set": bson.M{"content": "", "type": models.MessageTypeExpired}, "$unset": bson.M{"entities": "", "sealed_content": "", "sealed_entities": ""}},
+		)
+		if err != nil {
+			return expired, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		message.Content, message.Entities, message.Type = "", nil, models.MessageTypeExpired
+		expired = append(expired, message)
+	}
+	return expired, nil
+}
+
+func (r messageRepository) ExpireViewed(ctx context.Context, receiverID, senderID string, readAt time.Time) ([]models.Message, error) {
+	return r.expire(ctx, bson.M{
+		"sender_id":   senderID,
+		"receiver_id": receiverID,
+		"view_once":   true,
+		"room_id":     bson.M{"$exists": false},
+		"channel_id":  bson.M{"$exists": false},
+		"created_at":  bson.M{"$lte": readAt},
+	}, 0)
+}
+
+func (r messageRepository) ExpireDue(ctx context.Context, now time.Time, limit int64) ([]models.Message, error) {
+	return r.expire(ctx, bson.M{"expires_at": bson.M{"$lte": now}}, limit)
+}
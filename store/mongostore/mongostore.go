@@ -0,0 +1,95 @@
+// Package mongostore implements the store repositories on MongoDB
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Store struct {
+	db *mongo.Database
+}
+
+// New wraps a connected database, indexes are created by the migrations package
+func New(db *mongo.Database) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) Users() store.UserRepository {
+	return userRepository{s.db.Collection("users"), s.db.Collection("counters")}
+}
+
+func (s *Store) Messages() store.MessageRepository {
+	return messageRepository{s.db.Collection("messages"), s.db.Collection("read_cursors"), s.db.Collection("outbox"), s.db.Collection("conversations")}
+}
+
+func (s *Store) Conversations() store.ConversationRepository {
+	return conversationRepository{s.db.Collection("conversations"), s.db.Collection("read_cursors")}
+}
+
+func (s *Store) Presence() store.PresenceRepository {
+	return presenceRepository{s.db.Collection("users")}
+}
+
+func (s *Store) Outbox() store.OutboxRepository {
+	return outboxRepository{s.db.Collection("outbox")}
+}
+
+func (s *Store) QRLogins() store.QRLoginRepository {
+	return qrLoginRepository{s.db.Collection("qr_logins")}
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.Client().Ping(ctx, nil)
+}
+
+// Close is a no-op, the client is owned by the config package
+func (s *Store) Close(ctx context.Context) error {
+	return nil
+}
+
+// VisibleTo hides messages of shadow-restricted senders from everyone but the sender.
+// Handlers that still query the messages collection directly use it too.
+func VisibleTo(userID string) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"shadowed": bson.M{"$ne": true}},
+			{"sender_id": userID},
+		},
+	}
+}
+
+// newestFirst orders messages for listings paged with a store.MessageCursor
+var newestFirst = bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+
+// olderThan matches the messages after the cursor in a newest first listing
+func olderThan(before *store.MessageCursor) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"created_at": bson.M{"$lt": before.CreatedAt}},
+			{"created_at": before.CreatedAt, "_id": bson.M{"$lt": before.ID}},
+		},
+	}
+}
+
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// standalone is set once a write found that the server cannot run transactions
+var standalone atomic.Bool
+
+// transactionsUnsupported reports the error a standalone server (not a replica
+// set or sharded cluster) returns for writes inside a transaction
+func transactionsUnsupported(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && commandErr.Code == 20 // IllegalOperation
+}
@@ -0,0 +1,91 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type outboxRepository struct {
+	outbox *mongo.Collection
+}
+
+func (r outboxRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEntry, error) {
+	// One entry at a time, so relays on other instances never claim the same entry
+	due := bson.M{"published_at": bson.M{"$exists": false}, "next_attempt_at": bson.M{"$lte": now}}
+	update := bson.M{
+		"$set": bson.M{"next_attempt_at": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"_id": 1}).SetReturnDocument(options.After)
+
+	entries := []models.OutboxEntry{}
+	for len(entries) < limit {
+		var entry models.OutboxEntry
+		err := r.outbox.FindOneAndUpdate(ctx, due, update, opts).Decode(&entry)
+		if err == mongo.ErrNoDocuments {
+			break
+		} else if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r outboxRepository) MarkPublished(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	result, err := r.outbox.UpdateByID(ctx, id, bson.M{
+		"$set":   bson.M{"published_at": at},
+		"$unset": bson.M{"last_error": ""},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r outboxRepository) Retry(ctx context.Context, id primitive.ObjectID, next time.Time, lastErr string) error {
+	result, err := r.outbox.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"next_attempt_at": next, "last_error": lastErr},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r outboxRepository) Pending(ctx context.Context) (int64, time.Time, error) {
+	unpublished := bson.M{"published_at": bson.M{"$exists": false}}
+
+	count, err := r.outbox.CountDocuments(ctx, unpublished)
+	if err != nil || count == 0 {
+		return count, time.Time{}, err
+	}
+
+	var oldest models.OutboxEntry
+	err = r.outbox.FindOne(ctx, unpublished, options.FindOne().SetSort(bson.M{"_id": 1})).Decode(&oldest)
+	if err == mongo.ErrNoDocuments {
+		return 0, time.Time{}, nil
+	}
+	return count, oldest.CreatedAt, err
+}
+
+func (r outboxRepository) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.outbox.DeleteMany(ctx, bson.M{"published_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
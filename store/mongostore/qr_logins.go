@@ -0,0 +1,65 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// qrLoginRepository relies on the TTL index on expires_at to drop old challenges
+type qrLoginRepository struct {
+	logins *mongo.Collection
+}
+
+func (r qrLoginRepository) Create(ctx context.Context, login *models.QRLogin) error {
+	_, err := r.logins.InsertOne(ctx, login)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r qrLoginRepository) Get(ctx context.Context, code string) (*models.QRLogin, error) {
+	var login models.QRLogin
+	err := r.logins.FindOne(ctx, bson.M{"_id": code}).Decode(&login)
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (r qrLoginRepository) Decide(ctx context.Context, code, userID, status string, now time.Time) error {
+	result, err := r.logins.UpdateOne(ctx,
+		bson.M{"_id": code, "status": models.QRLoginPending, "expires_at": bson.M{"$gte": now}},
+		bson.M{"$set": bson.M{"status": status, "user_id": userID}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r qrLoginRepository) Complete(ctx context.Context, code string) (*models.QRLogin, error) {
+	var login models.QRLogin
+	err := r.logins.FindOneAndUpdate(ctx,
+		bson.M{"_id": code, "status": models.QRLoginApproved},
+		bson.M{"$set": bson.M{"status": models.QRLoginCompleted}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&login)
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
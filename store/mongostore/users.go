@@ -0,0 +1,381 @@
+package mongostore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type userRepository struct {
+	users    *mongo.Collection
+	counters *mongo.Collection
+}
+
+func (r userRepository) NextID(ctx context.Context) (string, error) {
+	var result struct {
+		Seq int `bson:"seq"`
+	}
+	err := r.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": "user_id"},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+
+	// Format as 3-digit string with leading zeros
+	return fmt.Sprintf("%03d", result.Seq), nil
+}
+
+func (r userRepository) Create(ctx context.Context, user *models.User) error {
+	user.Canonicalize()
+	user.IndexSearch()
+	_, err := r.users.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r userRepository) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := r.users.FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r userRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r userRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email_canonical": models.CanonicalEmail(email)})
+}
+
+func (r userRepository) FindByEmailOrUsername(ctx context.Context, email, username string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{
+		"$or": []bson.M{
+			{"email_canonical": models.CanonicalEmail(email)},
+			{"username_canonical": models.CanonicalUsername(username)},
+		},
+	})
+}
+
+func (r userRepository) UsernameTaken(ctx context.Context, username, exceptID string) (bool, error) {
+	count, err := r.users.CountDocuments(ctx, bson.M{
+		"username_canonical": models.CanonicalUsername(username),
+		"_id":                bson.M{"$ne": exceptID},
+	})
+	return count > 0, err
+}
+
+func (r userRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"username_canonical": models.CanonicalUsername(username)})
+}
+
+func (r userRepository) ChangeUsername(ctx context.Context, id, username string, at time.Time) error {
+	// Pipeline update so the current username is read and moved in the same write
+	result, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": id, "username": bson.M{"$ne": username}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"username_history": bson.M{"$slice": []interface{}{
+				bson.M{"$concatArrays": []interface{}{
+					bson.M{"$ifNull": []interface{}{"$username_history", bson.A{}}},
+					bson.A{bson.M{"username": "$username", "canonical": "$username_canonical", "changed_at": at}},
+				}},
+				-models.MaxUsernameHistory,
+			}},
+			"username":            username,
+			"username_canonical":  models.CanonicalUsername(username),
+			"username_changed_at": at,
+		}}}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrConflict
+	} else if err != nil || result.ModifiedCount == 0 {
+		return err
+	}
+	return r.indexSearch(ctx, id)
+}
+
+// indexSearch rebuilds the user's search index from the stored username and display name
+func (r userRepository) indexSearch(ctx context.Context, id string) error {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.IndexSearch()
+	_, err = r.users.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"search_prefixes": user.SearchPrefixes,
+		"search_trigrams": user.SearchTrigrams,
+	}})
+	return err
+}
+
+func (r userRepository) FindByFormerUsername(ctx context.Context, username string, since time.Time) (*models.User, error) {
+	var user models.User
+	err := r.users.FindOne(ctx,
+		bson.M{"username_history": bson.M{"$elemMatch": bson.M{
+			"canonical":  models.CanonicalUsername(username),
+			"changed_at": bson.M{"$gte": since},
+		}}},
+		options.FindOne().SetSort(bson.M{"username_changed_at": -1}),
+	).Decode(&user)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r userRepository) UpgradeGuest(ctx context.Context, id, username, email, password string) error {
+	result, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": id, "guest_expires_at": bson.M{"$exists": true}},
+		bson.M{
+			"$set": bson.M{
+				"username":           username,
+				"username_canonical": models.CanonicalUsername(username),
+				"email":              email,
+				"email_canonical":    models.CanonicalEmail(email),
+				"password":           password,
+			},
+			"$unset": bson.M{
+				"guest_expires_at": "",
+				"guest_inviters":   "",
+			},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrConflict
+	} else if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+	return r.indexSearch(ctx, id)
+}
+
+func (r userRepository) ChangeEmail(ctx context.Context, id, from, to, nonce string) error {
+	// The unique email index rejects the swap if the address was taken meanwhile
+	result, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": id, "email": from, "email_change_nonce": nonce},
+		bson.M{
+			"$set":   bson.M{"email": to, "email_canonical": models.CanonicalEmail(to)},
+			"$unset": bson.M{"email_change_nonce": ""},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrConflict
+	} else if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r userRepository) Update(ctx context.Context, id string, update store.UserUpdate) error {
+	set := bson.M{}
+	if update.DisplayName != nil {
+		set["display_name"] = *update.DisplayName
+	}
+	if update.Bio != nil {
+		set["bio"] = *update.Bio
+	}
+	if update.Avatar != nil {
+		set["avatar"] = *update.Avatar
+	}
+	if update.Status != nil {
+		set["status"] = *update.Status
+	}
+	if update.HideFromDiscovery != nil {
+		set["hide_from_discovery"] = *update.HideFromDiscovery
+	}
+	if update.EmailDigestOptOut != nil {
+		set["email_digest_opt_out"] = *update.EmailDigestOptOut
+	}
+	if update.Language != nil {
+		set["language"] = *update.Language
+	}
+	if update.EmailChangeNonce != nil {
+		set["email_change_nonce"] = *update.EmailChangeNonce
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	_, err := r.users.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrConflict
+	} else if err != nil {
+		return err
+	}
+
+	if update.DisplayName != nil {
+		return r.indexSearch(ctx, id)
+	}
+	return nil
+}
+
+func userFilter(f store.UserFilter) bson.M {
+	// Hide guests, deactivated and deleted accounts
+	filter := bson.M{
+		"status":                bson.M{"$ne": models.UserStatusDeactivated},
+		"deletion_scheduled_at": bson.M{"$exists": false},
+		"guest_expires_at":      bson.M{"$exists": false},
+	}
+
+	if f.ExcludeID != "" {
+		filter["_id"] = bson.M{"$ne": f.ExcludeID}
+	}
+	if f.OnlineOnly {
+		filter["online"] = true
+	}
+	if !f.ActiveSince.IsZero() {
+		filter["last_seen"] = bson.M{"$gte": f.ActiveSince}
+	}
+	if f.Search != "" {
+		// Users who opted out of discovery never show up in search results
+		filter["hide_from_discovery"] = bson.M{"$ne": true}
+		matches := []bson.M{{"search_prefixes": f.Search}}
+		if f.Fuzzy {
+			prefix, trigrams := models.FuzzyKeys(f.Search)
+			matches = append(matches,
+				bson.M{"search_prefixes": prefix},
+				bson.M{"search_trigrams": bson.M{"$in": trigrams}},
+			)
+		}
+		filter["$or"] = matches
+	}
+
+	return filter
+}
+
+func (r userRepository) List(ctx context.Context, f store.UserFilter) ([]models.User, error) {
+	opts := options.Find().
+		SetSkip(f.Skip).
+		SetSort(bson.D{
+			{Key: "online", Value: -1},
+			{Key: "last_seen", Value: -1},
+		})
+	if f.Limit > 0 {
+		opts.SetLimit(f.Limit)
+	}
+
+	cursor, err := r.users.Find(ctx, userFilter(f), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r userRepository) Count(ctx context.Context, f store.UserFilter) (int64, error) {
+	return r.users.CountDocuments(ctx, userFilter(f))
+}
+
+func (r userRepository) EstimatedCount(ctx context.Context) (int64, error) {
+	// Read from collection metadata, no documents are scanned
+	return r.users.EstimatedDocumentCount(ctx)
+}
+
+// presenceRepository keeps presence on the user documents
+type presenceRepository struct {
+	users *mongo.Collection
+}
+
+func (r presenceRepository) SetOnline(ctx context.Context, userID string, online bool, at time.Time) error {
+	_, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"online": online, "last_seen": at}},
+	)
+	return err
+}
+
+func (r presenceRepository) Touch(ctx context.Context, userID string, at time.Time) error {
+	_, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"last_seen": at}},
+	)
+	return err
+}
+
+func (r presenceRepository) Heartbeat(ctx context.Context, userIDs []string, at time.Time) error {
+	_, err := r.users.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": userIDs}},
+		bson.M{"$set": bson.M{"online": true, "last_seen": at}},
+	)
+	return err
+}
+
+func (r presenceRepository) ExpireOnline(ctx context.Context, before time.Time, limit int64) ([]store.UserPresence, error) {
+	stale := bson.M{"online": true, "last_seen": bson.M{"$lt": before}}
+	cursor, err := r.users.Find(ctx, stale,
+		options.Find().SetProjection(bson.M{"last_seen": 1}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID       string    `bson:"_id"`
+		LastSeen time.Time `bson:"last_seen"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	// Each user is flipped only if still stale, a heartbeat may have come in since
+	expired := []store.UserPresence{}
+	for _, doc := range docs {
+		filter := bson.M{"_id": doc.ID, "online": true, "last_seen": bson.M{"$lt": before}}
+		result, err := r.users.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"online": false}})
+		if err != nil {
+			return expired, err
+		}
+		if result.ModifiedCount == 1 {
+			expired = append(expired, store.UserPresence{UserID: doc.ID, Online: true, LastSeen: doc.LastSeen})
+		}
+	}
+	return expired, nil
+}
+
+func (r presenceRepository) Get(ctx context.Context, userIDs []string) ([]store.UserPresence, error) {
+	cursor, err := r.users.Find(ctx,
+		bson.M{"_id": bson.M{"$in": userIDs}},
+		options.Find().SetProjection(bson.M{"online": 1, "last_seen": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID       string    `bson:"_id"`
+		Online   bool      `bson:"online"`
+		LastSeen time.Time `bson:"last_seen"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	presence := make([]store.UserPresence, 0, len(docs))
+	for _, doc := range docs {
+		presence = append(presence, store.UserPresence{UserID: doc.ID, Online: doc.Online, LastSeen: doc.LastSeen})
+	}
+	return presence, nil
+}
@@ -0,0 +1,266 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type conversationRepository struct {
+	db *sql.DB
+}
+
+const conversationColumns = `id, participants, created_at, request_sender_id, request_recipient_id,
+	request_created_at, request_dismissed_at, accepted_at, blocked_by`
+
+func scanConversation(row scanner) (models.Conversation, error) {
+	var conversation models.Conversation
+	var senderID, recipientID sql.NullString
+	var requestedAt, dismissedAt, acceptedAt sql.NullTime
+
+	types := pgtype.NewMap()
+	err := row.Scan(&conversation.ID, types.SQLScanner(&conversation.Participants), &conversation.CreatedAt,
+		&senderID, &recipientID, &requestedAt, &dismissedAt, &acceptedAt, types.SQLScanner(&conversation.BlockedBy))
+	if err != nil {
+		return conversation, err
+	}
+
+	if recipientID.Valid {
+		conversation.Request = &models.MessageRequest{
+			SenderID:    senderID.String,
+			RecipientID: recipientID.String,
+			CreatedAt:   requestedAt.Time,
+		}
+		if dismissedAt.Valid {
+			conversation.Request.DismissedAt = &dismissedAt.Time
+		}
+	}
+	if acceptedAt.Valid {
+		conversation.AcceptedAt = &acceptedAt.Time
+	}
+	return conversation, nil
+}
+
+func (r conversationRepository) Get(ctx context.Context, id string) (*models.Conversation, error) {
+	conversation, err := scanConversation(r.db.QueryRowContext(ctx,
+		"SELECT "+conversationColumns+" FROM conversations WHERE id = $1", id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT message_id, pinned_by, pinned_at FROM conversation_pins
+		WHERE conversation_id = $1 ORDER BY pinned_at`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pin models.PinnedMessage
+		var messageID string
+		if err := rows.Scan(&messageID, &pin.PinnedBy, &pin.PinnedAt); err != nil {
+			return nil, err
+		}
+		if pin.MessageID, err = primitive.ObjectIDFromHex(messageID); err != nil {
+			return nil, err
+		}
+		conversation.Pinned = append(conversation.Pinned, pin)
+	}
+
+	return &conversation, rows.Err()
+}
+
+func (r conversationRepository) AddPin(ctx context.Context, conversation *models.Conversation, pin models.PinnedMessage) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createConversation(ctx, tx, conversation); err != nil {
+		return err
+	}
+
+	// Lock the conversation so concurrent pins cannot exceed the cap
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM conversations WHERE id = $1 FOR UPDATE", conversation.ID); err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT count(*) FROM conversation_pins WHERE conversation_id = $1", conversation.ID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= models.MaxPinnedMessages {
+		return store.ErrConflict
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO conversation_pins (conversation_id, message_id, pinned_by, pinned_at)
+		VALUES ($1, $2, $3, $4)`,
+		conversation.ID, pin.MessageID.Hex(), pin.PinnedBy, pin.PinnedAt); err != nil {
+		return conflict(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r conversationRepository) RemovePin(ctx context.Context, id string, messageID primitive.ObjectID) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM conversation_pins WHERE conversation_id = $1 AND message_id = $2", id, messageID.Hex())
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (r conversationRepository) AdvanceReadCursor(ctx context.Context, cursor models.ReadCursor) (bool, error) {
+	var messageID sql.NullString
+	if !cursor.MessageID.IsZero() {
+		messageID = sql.NullString{String: cursor.MessageID.Hex(), Valid: true}
+	}
+
+	// The conflict update only applies when the cursor moves forward
+	result, err := r.db.ExecContext(ctx, `INSERT INTO read_cursors (user_id, other_id, message_id, read_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, other_id) DO UPDATE SET
+			message_id = EXCLUDED.message_id, read_at = EXCLUDED.read_at, updated_at = EXCLUDED.updated_at
+		WHERE read_cursors.read_at < EXCLUDED.read_at`,
+		cursor.UserID, cursor.OtherID, messageID, cursor.ReadAt, cursor.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	moved, err := result.RowsAffected()
+	return moved > 0, err
+}
+
+func (r conversationRepository) ReadCursor(ctx context.Context, userID, otherID string) (models.ReadCursor, error) {
+	cursor := models.ReadCursor{UserID: userID, OtherID: otherID}
+
+	var messageID sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		"SELECT message_id, read_at, updated_at FROM read_cursors WHERE user_id = $1 AND other_id = $2",
+		userID, otherID).Scan(&messageID, &cursor.ReadAt, &cursor.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return cursor, nil
+	} else if err != nil {
+		return cursor, err
+	}
+
+	if messageID.Valid {
+		if cursor.MessageID, err = primitive.ObjectIDFromHex(messageID.String); err != nil {
+			return cursor, err
+		}
+	}
+	return cursor, nil
+}
+
+// createConversation inserts the conversation state on first write
+func createConversation(ctx context.Context, tx *sql.Tx, conversation *models.Conversation) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO conversations (id, participants, created_at)
+		VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING`,
+		conversation.ID, conversation.Participants, time.Now())
+	return err
+}
+
+func (r conversationRepository) OpenRequest(ctx context.Context, conversation *models.Conversation, request models.MessageRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createConversation(ctx, tx, conversation); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE conversations SET
+			request_sender_id = $2, request_recipient_id = $3, request_created_at = $4, request_dismissed_at = NULL
+		WHERE id = $1 AND accepted_at IS NULL`,
+		conversation.ID, request.SenderID, request.RecipientID, request.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r conversationRepository) Accept(ctx context.Context, conversation *models.Conversation, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createConversation(ctx, tx, conversation); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE conversations SET
+			request_sender_id = NULL, request_recipient_id = NULL, request_created_at = NULL,
+			request_dismissed_at = NULL, accepted_at = COALESCE(accepted_at, $2)
+		WHERE id = $1`,
+		conversation.ID, at); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r conversationRepository) DismissRequest(ctx context.Context, id, recipientID string, at time.Time) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `UPDATE conversations SET request_dismissed_at = $3
+		WHERE id = $1 AND request_recipient_id = $2 AND request_dismissed_at IS NULL`,
+		id, recipientID, at)
+	if err != nil {
+		return false, err
+	}
+
+	dismissed, err := result.RowsAffected()
+	return dismissed > 0, err
+}
+
+func (r conversationRepository) SetBlocked(ctx context.Context, conversation *models.Conversation, userID string, blocked bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createConversation(ctx, tx, conversation); err != nil {
+		return err
+	}
+
+	// Removing first keeps the user listed once
+	query := "UPDATE conversations SET blocked_by = array_remove(blocked_by, $2) WHERE id = $1"
+	if blocked {
+		query = "UPDATE conversations SET blocked_by = array_append(array_remove(blocked_by, $2), $2) WHERE id = $1"
+	}
+	if _, err := tx.ExecContext(ctx, query, conversation.ID, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r conversationRepository) Requests(ctx context.Context, recipientID string) ([]models.Conversation, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+conversationColumns+` FROM conversations
+		WHERE request_recipient_id = $1 ORDER BY request_created_at DESC`, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []models.Conversation
+	for rows.Next() {
+		conversation, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, rows.Err()
+}
@@ -0,0 +1,240 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const messageColumns = "id, sender_id, receiver_id, room_id, channel_id, content, entities, type, read, shadowed, created_at, view_once, expires_at"
+
+// directOnly excludes room and channel messages
+const directOnly = "room_id IS NULL AND channel_id IS NULL"
+
+type messageRepository struct {
+	db *sql.DB
+}
+
+func scanMessage(row scanner, extra ...any) (*models.Message, error) {
+	var message models.Message
+	var id string
+	var roomID, channelID sql.NullString
+	var entities []byte
+	var expiresAt sql.NullTime
+
+	dest := append([]any{&id, &message.SenderID, &message.ReceiverID, &roomID, &channelID,
+		&message.Content, &entities, &message.Type, &message.Read, &message.Shadowed, &message.CreatedAt,
+		&message.ViewOnce, &expiresAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, notFound(err)
+	}
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	message.ID = objID
+	message.RoomID = roomID.String
+	message.ChannelID = channelID.String
+	if expiresAt.Valid {
+		message.ExpiresAt = &expiresAt.Time
+	}
+
+	if len(entities) > 0 {
+		if err := json.Unmarshal(entities, &message.Entities); err != nil {
+			return nil, err
+		}
+	}
+
+	return &message, nil
+}
+
+func scanMessages(rows *sql.Rows) ([]models.Message, error) {
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *message)
+	}
+	return messages, rows.Err()
+}
+
+func (r messageRepository) Insert(ctx context.Context, message *models.Message, events ...models.OutboxEntry) error {
+	var entities []byte
+	if len(message.Entities) > 0 {
+		var err error
+		if entities, err = json.Marshal(message.Entities); err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO messages (`+messageColumns+`)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13)`,
+		message.ID.Hex(), message.SenderID, message.ReceiverID, message.RoomID, message.ChannelID,
+		message.Content, entities, message.Type, message.Read, message.Shadowed, message.CreatedAt,
+		message.ViewOnce, message.ExpiresAt); err != nil {
+		return conflict(err)
+	}
+	for _, event := range events {
+		if err := insertOutbox(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r messageRepository) GetByIDs(ctx context.Context, viewerID string, ids []primitive.ObjectID) ([]models.Message, error) {
+	hexIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		hexIDs = append(hexIDs, id.Hex())
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+messageColumns+` FROM messages
+		WHERE id = ANY($1) AND (NOT shadowed OR sender_id = $2)`,
+		hexIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+func (r messageRepository) GetDirect(ctx context.Context, id primitive.ObjectID, viewerID, otherID string) (*models.Message, error) {
+	return scanMessage(r.db.QueryRowContext(ctx, "SELECT "+messageColumns+` FROM messages
+		WHERE id = $1 AND room_id IS NULL
+		AND ((sender_id = $2 AND receiver_id = $3) OR (sender_id = $3 AND receiver_id = $2))
+		AND (NOT shadowed OR sender_id = $2)`,
+		id.Hex(), viewerID, otherID))
+}
+
+func (r messageRepository) ListDirect(ctx context.Context, viewerID, otherID string, before *store.MessageCursor, skip, limit int64) ([]models.Message, error) {
+	var beforeAt *time.Time
+	var beforeID string
+	if before != nil {
+		beforeAt, beforeID = &before.CreatedAt, before.ID.Hex()
+	}
+
+	// Hex IDs sort like the ObjectIDs they encode
+	rows, err := r.db.QueryContext(ctx, "SELECT "+messageColumns+` FROM messages
+		WHERE ((sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1))
+		AND (NOT shadowed OR sender_id = $1)
+		AND ($5::timestamptz IS NULL OR (created_at, id) < ($5, $6))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4`,
+		viewerID, otherID, limit, skip, beforeAt, beforeID)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+func (r messageRepository) RecentText(ctx context.Context, userID string, limit int64) ([]models.Message, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+messageColumns+` FROM messages
+		WHERE (sender_id = $1 OR receiver_id = $1) AND `+directOnly+`
+		AND (NOT shadowed OR sender_id = $1)
+		AND type = $2 AND NOT view_once AND expires_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT $3`,
+		userID, models.MessageTypeText, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+func (r messageRepository) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM messages m
+		LEFT JOIN read_cursors c ON c.user_id = m.receiver_id AND c.other_id = m.sender_id
+		WHERE m.receiver_id = $1 AND NOT m.read AND NOT m.shadowed
+		AND (c.read_at IS NULL OR m.created_at > c.read_at)
+		AND NOT EXISTS (SELECT 1 FROM conversations v
+			WHERE v.request_recipient_id = $1 AND v.request_sender_id = m.sender_id)`, userID).Scan(&count)
+	return count, err
+}
+
+func (r messageRepository) DirectConversations(ctx context.Context, userID string) ([]store.ConversationSummary, error) {
+	// Latest visible message per counterpart with the number of messages received from them past the read cursor
+	rows, err := r.db.QueryContext(ctx, `WITH direct AS (
+			SELECT m.*, CASE WHEN sender_id = $1 THEN receiver_id ELSE sender_id END AS other_id
+			FROM messages m
+			WHERE (sender_id = $1 OR receiver_id = $1) AND `+directOnly+`
+			AND (NOT shadowed OR sender_id = $1)
+		)
+		SELECT DISTINCT ON (other_id) `+messageColumns+`, other_id,
+			(SELECT count(*) FROM direct d WHERE d.other_id = direct.other_id AND d.receiver_id = $1 AND NOT d.read
+				AND d.created_at > COALESCE((SELECT read_at FROM read_cursors c
+					WHERE c.user_id = $1 AND c.other_id = direct.other_id), '-infinity'))
+		FROM direct
+		ORDER BY other_id, created_at DESC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []store.ConversationSummary{}
+	for rows.Next() {
+		var summary store.ConversationSummary
+		message, err := scanMessage(rows, &summary.OtherUserID, &summary.UnreadCount)
+		if err != nil {
+			return nil, err
+		}
+		summary.LastMessage = *message
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].LastMessage.CreatedAt.After(summaries[j].LastMessage.CreatedAt)
+	})
+	return summaries, nil
+}
+
+// expireSet removes the content of the rows it is applied to
+const expireSet = "SET content = '', entities = NULL, type = '" + models.MessageTypeExpired + "'"
+
+func (r messageRepository) ExpireViewed(ctx context.Context, receiverID, senderID string, readAt time.Time) ([]models.Message, error) {
+	rows, err := r.db.QueryContext(ctx, "UPDATE messages "+expireSet+`
+		WHERE receiver_id = $1 AND sender_id = $2 AND view_once AND created_at <= $3
+		AND type <> '`+models.MessageTypeExpired+"' AND "+directOnly+`
+		RETURNING `+messageColumns,
+		receiverID, senderID, readAt)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+func (r messageRepository) ExpireDue(ctx context.Context, now time.Time, limit int64) ([]models.Message, error) {
+	// SKIP LOCKED lets several instances sweep without expiring a message twice
+	rows, err := r.db.QueryContext(ctx, "UPDATE messages "+expireSet+`
+		WHERE id IN (
+			SELECT id FROM messages
+			WHERE expires_at <= $1 AND type <> '`+models.MessageTypeExpired+`'
+			LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+messageColumns,
+		now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
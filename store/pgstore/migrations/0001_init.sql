@@ -0,0 +1,61 @@
+-- Core tables for users, direct messages and conversations,
+-- indexes mirror the MongoDB baseline migration
+
+CREATE SEQUENCE IF NOT EXISTS user_id_seq;
+
+CREATE TABLE IF NOT EXISTS users (
+    id                    TEXT PRIMARY KEY,
+    username              TEXT NOT NULL,
+    email                 TEXT NOT NULL,
+    password              TEXT NOT NULL DEFAULT '',
+    bio                   TEXT NOT NULL DEFAULT '',
+    avatar                TEXT NOT NULL DEFAULT '',
+    role                  TEXT NOT NULL DEFAULT '',
+    status                TEXT NOT NULL DEFAULT 'active',
+    online                BOOLEAN NOT NULL DEFAULT FALSE,
+    last_seen             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    hide_from_discovery   BOOLEAN NOT NULL DEFAULT FALSE,
+    email_digest_opt_out  BOOLEAN NOT NULL DEFAULT FALSE,
+    last_digest_at        TIMESTAMPTZ,
+    deletion_scheduled_at TIMESTAMPTZ,
+    deleted_at            TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_key ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email);
+CREATE INDEX IF NOT EXISTS users_online_last_seen_idx ON users (online, last_seen DESC);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id          TEXT PRIMARY KEY,
+    sender_id   TEXT NOT NULL,
+    receiver_id TEXT NOT NULL DEFAULT '',
+    room_id     TEXT,
+    channel_id  TEXT,
+    content     TEXT NOT NULL,
+    entities    JSONB,
+    type        TEXT NOT NULL,
+    read        BOOLEAN NOT NULL DEFAULT FALSE,
+    shadowed    BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS messages_sender_receiver_created_idx ON messages (sender_id, receiver_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS messages_receiver_read_idx ON messages (receiver_id, read);
+CREATE INDEX IF NOT EXISTS messages_created_idx ON messages (created_at DESC);
+CREATE INDEX IF NOT EXISTS messages_room_created_idx ON messages (room_id, created_at DESC) WHERE room_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS messages_channel_created_idx ON messages (channel_id, created_at DESC) WHERE channel_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id           TEXT PRIMARY KEY,
+    participants TEXT[] NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS conversation_pins (
+    conversation_id TEXT NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    message_id      TEXT NOT NULL,
+    pinned_by       TEXT NOT NULL,
+    pinned_at       TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (conversation_id, message_id)
+);
@@ -0,0 +1,11 @@
+-- Read positions in direct conversations, unread counts are the received
+-- messages newer than the receiver's cursor for that sender
+
+CREATE TABLE IF NOT EXISTS read_cursors (
+    user_id    TEXT NOT NULL,
+    other_id   TEXT NOT NULL,
+    message_id TEXT,
+    read_at    TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, other_id)
+);
@@ -0,0 +1,6 @@
+-- Former usernames for the change cooldown, reservation and resolve lookups
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_history JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_changed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS users_username_history_idx ON users USING GIN (username_history jsonb_path_ops);
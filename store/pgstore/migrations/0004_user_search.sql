@@ -0,0 +1,9 @@
+-- Display names and indexed user search, prefix and typo candidate lookups are
+-- LIKE patterns served by trigram indexes instead of scanning with ~*
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING GIN (lower(username) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_display_name_trgm_idx ON users USING GIN (lower(display_name) gin_trgm_ops);
@@ -0,0 +1,4 @@
+-- Guest accounts expire unless upgraded and only message the users who invited them
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS guest_expires_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS guest_inviters JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,10 @@
+-- Disappearing messages: view-once content is removed after the receiver reads it,
+-- content with an expiry is removed by the sweeper
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS view_once BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS messages_expires_at_idx ON messages (expires_at)
+    WHERE expires_at IS NOT NULL AND type <> 'expired';
+CREATE INDEX IF NOT EXISTS messages_view_once_idx ON messages (receiver_id, sender_id, created_at)
+    WHERE view_once AND type <> 'expired';
@@ -0,0 +1,25 @@
+-- Usernames and emails are unique and looked up by a lowercased, NFKC normalized
+-- form so that case differences can't create look-alike accounts. The display
+-- forms stay as the user typed them. Creating the unique indexes fails if existing
+-- accounts only differ by case, those have to be renamed first.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_canonical TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_canonical TEXT;
+
+UPDATE users SET
+    username_canonical = lower(normalize(btrim(username), NFKC)),
+    email_canonical = lower(normalize(btrim(email), NFKC))
+WHERE username_canonical IS NULL OR email_canonical IS NULL;
+
+ALTER TABLE users ALTER COLUMN username_canonical SET NOT NULL;
+ALTER TABLE users ALTER COLUMN email_canonical SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_canonical_key ON users (username_canonical);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_canonical_key ON users (email_canonical);
+
+-- Reservations of given up usernames match on the canonical form too
+UPDATE users SET username_history = (
+    SELECT jsonb_agg(h || jsonb_build_object('canonical', lower(normalize(btrim(h->>'username'), NFKC))) ORDER BY i)
+    FROM jsonb_array_elements(username_history) WITH ORDINALITY AS e(h, i)
+)
+WHERE username_history <> '[]';
@@ -0,0 +1,17 @@
+-- Events for external systems, written in the same transaction as the message
+-- they describe and published at least once by the outbox relay
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id              TEXT PRIMARY KEY,
+    topic           TEXT NOT NULL,
+    key             TEXT NOT NULL,
+    payload         BYTEA NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT '',
+    published_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_due_idx ON outbox (next_attempt_at) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_published_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
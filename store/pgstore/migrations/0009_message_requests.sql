@@ -0,0 +1,13 @@
+-- First contacts from strangers wait in the recipient's message requests until
+-- accepted, and either participant can block the other
+
+ALTER TABLE conversations
+    ADD COLUMN IF NOT EXISTS request_sender_id    TEXT,
+    ADD COLUMN IF NOT EXISTS request_recipient_id TEXT,
+    ADD COLUMN IF NOT EXISTS request_created_at   TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS request_dismissed_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS accepted_at          TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS blocked_by           TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS conversations_request_recipient_idx ON conversations (request_recipient_id)
+    WHERE request_recipient_id IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Language of the text the server writes for the user, empty follows the client
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Nonce of the latest email change link, makes each link single-use
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_change_nonce TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- QR login challenges, shared so any instance can answer a desktop waiting to log in
+
+CREATE TABLE IF NOT EXISTS qr_logins (
+    code        TEXT PRIMARY KEY,
+    secret_hash TEXT NOT NULL,
+    user_agent  TEXT NOT NULL DEFAULT '',
+    ip          TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL,
+    user_id     TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS qr_logins_expires_at_idx ON qr_logins (expires_at);
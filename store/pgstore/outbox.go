@@ -0,0 +1,114 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const outboxColumns = "id, topic, key, payload, created_at, attempts, next_attempt_at, last_error, published_at"
+
+type outboxRepository struct {
+	db *sql.DB
+}
+
+// insertOutbox writes an entry inside the transaction of the change it describes
+func insertOutbox(ctx context.Context, tx *sql.Tx, e models.OutboxEntry) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO outbox (`+outboxColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		e.ID.Hex(), e.Topic, e.Key, e.Payload, e.CreatedAt, e.Attempts, e.NextAttemptAt, e.LastError, e.PublishedAt)
+	return err
+}
+
+func scanOutbox(row scanner) (models.OutboxEntry, error) {
+	var e models.OutboxEntry
+	var id string
+	var publishedAt sql.NullTime
+	if err := row.Scan(&id, &e.Topic, &e.Key, &e.Payload, &e.CreatedAt, &e.Attempts,
+		&e.NextAttemptAt, &e.LastError, &publishedAt); err != nil {
+		return e, err
+	}
+	e.ID, _ = primitive.ObjectIDFromHex(id)
+	e.PublishedAt = timePtr(publishedAt)
+	return e, nil
+}
+
+func (r outboxRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEntry, error) {
+	// SKIP LOCKED lets relays on other instances claim the next batch instead of waiting
+	rows, err := r.db.QueryContext(ctx, `UPDATE outbox SET next_attempt_at = $2, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox WHERE published_at IS NULL AND next_attempt_at <= $1
+			ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+outboxColumns, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.OutboxEntry{}
+	for rows.Next() {
+		e, err := scanOutbox(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING has no order, IDs grow with time
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID.Hex() < entries[j].ID.Hex() })
+	return entries, nil
+}
+
+func (r outboxRepository) MarkPublished(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE outbox SET published_at = $2, last_error = '' WHERE id = $1", id.Hex(), at)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r outboxRepository) Retry(ctx context.Context, id primitive.ObjectID, next time.Time, lastErr string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE outbox SET next_attempt_at = $2, last_error = $3 WHERE id = $1", id.Hex(), next, lastErr)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r outboxRepository) Pending(ctx context.Context) (int64, time.Time, error) {
+	var count int64
+	var oldest sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		"SELECT count(*), min(created_at) FROM outbox WHERE published_at IS NULL").Scan(&count, &oldest)
+	return count, oldest.Time, err
+}
+
+func (r outboxRepository) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM outbox WHERE published_at IS NOT NULL AND published_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,204 @@
+// Package pgstore implements the store repositories on PostgreSQL
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID keys the advisory lock that serializes migrations across instances
+const migrationLockID = 7316207
+
+type Store struct {
+	db *sql.DB
+}
+
+// Open connects to the database at url
+func Open(ctx context.Context, url string) (*Store, error) {
+	cfg, err := pgx.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Tracer = queryTracer{}
+
+	db := stdlib.OpenDB(*cfg)
+
+	db.SetMaxOpenConns(20)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxIdleTime(30 * time.Second)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Users() store.UserRepository {
+	return userRepository{s.db}
+}
+
+func (s *Store) Messages() store.MessageRepository {
+	return messageRepository{s.db}
+}
+
+func (s *Store) Conversations() store.ConversationRepository {
+	return conversationRepository{s.db}
+}
+
+func (s *Store) Presence() store.PresenceRepository {
+	return presenceRepository{s.db}
+}
+
+func (s *Store) Outbox() store.OutboxRepository {
+	return outboxRepository{s.db}
+}
+
+func (s *Store) QRLogins() store.QRLoginRepository {
+	return qrLoginRepository{s.db}
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Store) Close(ctx context.Context) error {
+	return s.db.Close()
+}
+
+type migrationFile struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations reads the embedded NNNN_name.sql files in version order
+func loadMigrations() ([]migrationFile, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []migrationFile
+	for _, entry := range entries {
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		content, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, migrationFile{version: version, name: name, sql: string(content)})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].version < files[j].version })
+	return files, nil
+}
+
+// Migrate applies pending SQL migrations and returns how many ran.
+// Each file runs in its own transaction, a session advisory lock keeps
+// concurrently starting instances from applying the same file twice.
+func (s *Store) Migrate(ctx context.Context) (int, error) {
+	files, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return 0, fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, file := range files {
+		var exists bool
+		err := conn.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", file.version).Scan(&exists)
+		if err != nil {
+			return applied, err
+		}
+		if exists {
+			continue
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return applied, err
+		}
+		if _, err := tx.ExecContext(ctx, file.sql); err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("migration %04d_%s: %w", file.version, file.name, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", file.version, file.name); err != nil {
+			tx.Rollback()
+			return applied, err
+		}
+		if err := tx.Commit(); err != nil {
+			return applied, err
+		}
+
+		log.Printf("Applied postgres migration %04d_%s", file.version, file.name)
+		applied++
+	}
+
+	return applied, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// conflict maps unique violations to store.ErrConflict
+func conflict(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return store.ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+const qrLoginColumns = "code, secret_hash, user_agent, ip, status, user_id, created_at, expires_at"
+
+type qrLoginRepository struct {
+	db *sql.DB
+}
+
+func scanQRLogin(row scanner) (*models.QRLogin, error) {
+	var login models.QRLogin
+	err := row.Scan(&login.Code, &login.SecretHash, &login.UserAgent, &login.IP, &login.Status,
+		&login.UserID, &login.CreatedAt, &login.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (r qrLoginRepository) Create(ctx context.Context, login *models.QRLogin) error {
+	// Challenges are only useful until they expire, drop the old ones on the way
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM qr_logins WHERE expires_at < $1", time.Now()); err != nil {
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, `INSERT INTO qr_logins (`+qrLoginColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		login.Code, login.SecretHash, login.UserAgent, login.IP, login.Status, login.UserID,
+		login.CreatedAt, login.ExpiresAt)
+	return conflict(err)
+}
+
+func (r qrLoginRepository) Get(ctx context.Context, code string) (*models.QRLogin, error) {
+	return scanQRLogin(r.db.QueryRowContext(ctx,
+		"SELECT "+qrLoginColumns+" FROM qr_logins WHERE code = $1", code))
+}
+
+func (r qrLoginRepository) Decide(ctx context.Context, code, userID, status string, now time.Time) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE qr_logins SET status = $1, user_id = $2 WHERE code = $3 AND status = $4 AND expires_at >= $5",
+		status, userID, code, models.QRLoginPending, now)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r qrLoginRepository) Complete(ctx context.Context, code string) (*models.QRLogin, error) {
+	return scanQRLogin(r.db.QueryRowContext(ctx,
+		"UPDATE qr_logins SET status = $1 WHERE code = $2 AND status = $3 RETURNING "+qrLoginColumns,
+		models.QRLoginCompleted, code, models.QRLoginApproved))
+}
@@ -0,0 +1,396 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"github.com/Adisonsmn/ngobrolyuk/store"
+)
+
+const userColumns = `id, username, email, password, bio, avatar, role, status, online, last_seen, created_at,
+	hide_from_discovery, email_digest_opt_out, last_digest_at, deletion_scheduled_at, deleted_at,
+	username_history, username_changed_at, display_name, guest_expires_at, guest_inviters,
+	username_canonical, email_canonical, language`
+
+type userRepository struct {
+	db *sql.DB
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	var user models.User
+	var lastDigestAt, deletionScheduledAt, deletedAt, usernameChangedAt, guestExpiresAt sql.NullTime
+	var usernameHistory, guestInviters []byte
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Bio, &user.Avatar,
+		&user.Role, &user.Status, &user.Online, &user.LastSeen, &user.CreatedAt,
+		&user.HideFromDiscovery, &user.EmailDigestOptOut, &lastDigestAt, &deletionScheduledAt, &deletedAt,
+		&usernameHistory, &usernameChangedAt, &user.DisplayName, &guestExpiresAt, &guestInviters,
+		&user.UsernameCanonical, &user.EmailCanonical, &user.Language)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if err := json.Unmarshal(usernameHistory, &user.UsernameHistory); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(guestInviters, &user.GuestInviters); err != nil {
+		return nil, err
+	}
+
+	user.LastDigestAt = timePtr(lastDigestAt)
+	user.DeletionScheduledAt = timePtr(deletionScheduledAt)
+	user.DeletedAt = timePtr(deletedAt)
+	user.UsernameChangedAt = timePtr(usernameChangedAt)
+	user.GuestExpiresAt = timePtr(guestExpiresAt)
+	return &user, nil
+}
+
+func (r userRepository) NextID(ctx context.Context) (string, error) {
+	var seq int64
+	if err := r.db.QueryRowContext(ctx, "SELECT nextval('user_id_seq')").Scan(&seq); err != nil {
+		return "", err
+	}
+
+	// Format as 3-digit string with leading zeros
+	return fmt.Sprintf("%03d", seq), nil
+}
+
+func (r userRepository) Create(ctx context.Context, user *models.User) error {
+	user.Canonicalize()
+	history, err := json.Marshal(usernameHistory(user.UsernameHistory))
+	if err != nil {
+		return err
+	}
+	inviters := user.GuestInviters
+	if inviters == nil {
+		inviters = []string{}
+	}
+	guestInviters, err := json.Marshal(inviters)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)`,
+		user.ID, user.Username, user.Email, user.Password, user.Bio, user.Avatar, user.Role, user.Status,
+		user.Online, user.LastSeen, user.CreatedAt, user.HideFromDiscovery, user.EmailDigestOptOut,
+		user.LastDigestAt, user.DeletionScheduledAt, user.DeletedAt, history, user.UsernameChangedAt, user.DisplayName,
+		user.GuestExpiresAt, guestInviters, user.UsernameCanonical, user.EmailCanonical, user.Language)
+	return conflict(err)
+}
+
+func (r userRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+func (r userRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email_canonical = $1", models.CanonicalEmail(email)))
+}
+
+func (r userRepository) FindByEmailOrUsername(ctx context.Context, email, username string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE email_canonical = $1 OR username_canonical = $2 LIMIT 1",
+		models.CanonicalEmail(email), models.CanonicalUsername(username)))
+}
+
+func (r userRepository) UsernameTaken(ctx context.Context, username, exceptID string) (bool, error) {
+	var taken bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM users WHERE username_canonical = $1 AND id <> $2)",
+		models.CanonicalUsername(username), exceptID).Scan(&taken)
+	return taken, err
+}
+
+// usernameHistory keeps the column a JSON array when there is no history
+func usernameHistory(history []models.UsernameChange) []models.UsernameChange {
+	if history == nil {
+		return []models.UsernameChange{}
+	}
+	return history
+}
+
+func (r userRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username_canonical = $1", models.CanonicalUsername(username)))
+}
+
+func (r userRepository) ChangeUsername(ctx context.Context, id, username string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 FOR UPDATE", id))
+	if err == store.ErrNotFound || (err == nil && user.Username == username) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	history, err := json.Marshal(models.AppendUsernameHistory(user.UsernameHistory, user.Username, at))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE users SET username = $1, username_canonical = $2, username_history = $3, username_changed_at = $4 WHERE id = $5",
+		username, models.CanonicalUsername(username), history, at, id); err != nil {
+		return conflict(err)
+	}
+	return tx.Commit()
+}
+
+func (r userRepository) FindByFormerUsername(ctx context.Context, username string, since time.Time) (*models.User, error) {
+	// The containment check uses the GIN index, the time window is checked per entry
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+` FROM users u,
+		LATERAL (SELECT max((h->>'changed_at')::timestamptz) AS released_at
+			FROM jsonb_array_elements(u.username_history) h WHERE h->>'canonical' = $1) former
+		WHERE u.username_history @> jsonb_build_array(jsonb_build_object('canonical', $1::text))
+		AND former.released_at >= $2
+		ORDER BY former.released_at DESC
+		LIMIT 1`, models.CanonicalUsername(username), since))
+}
+
+func (r userRepository) UpgradeGuest(ctx context.Context, id, username, email, password string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE users
+		SET username = $1, email = $2, password = $3, guest_expires_at = NULL, guest_inviters = '[]',
+			username_canonical = $5, email_canonical = $6
+		WHERE id = $4 AND guest_expires_at IS NOT NULL`,
+		username, email, password, id, models.CanonicalUsername(username), models.CanonicalEmail(email))
+	if err != nil {
+		return conflict(err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r userRepository) ChangeEmail(ctx context.Context, id, from, to, nonce string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET email = $1, email_canonical = $2, email_change_nonce = '' WHERE id = $3 AND email = $4 AND email_change_nonce = $5",
+		to, models.CanonicalEmail(to), id, from, nonce)
+	if err != nil {
+		return conflict(err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (r userRepository) Update(ctx context.Context, id string, update store.UserUpdate) error {
+	var sets []string
+	var args []any
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if update.DisplayName != nil {
+		set("display_name", *update.DisplayName)
+	}
+	if update.Bio != nil {
+		set("bio", *update.Bio)
+	}
+	if update.Avatar != nil {
+		set("avatar", *update.Avatar)
+	}
+	if update.Status != nil {
+		set("status", *update.Status)
+	}
+	if update.HideFromDiscovery != nil {
+		set("hide_from_discovery", *update.HideFromDiscovery)
+	}
+	if update.EmailDigestOptOut != nil {
+		set("email_digest_opt_out", *update.EmailDigestOptOut)
+	}
+	if update.Language != nil {
+		set("language", *update.Language)
+	}
+	if update.EmailChangeNonce != nil {
+		set("email_change_nonce", *update.EmailChangeNonce)
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d", strings.Join(sets, ", "), len(args))
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return conflict(err)
+}
+
+// likeEscaper escapes the LIKE wildcards, backslash is the default escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// userWhere mirrors the MongoDB filter. Search prefixes are LIKE patterns on the
+// lowercased names, typo candidates share the first two letters or a trigram.
+func userWhere(f store.UserFilter) (string, []any) {
+	conditions := []string{"status <> $1", "deletion_scheduled_at IS NULL", "guest_expires_at IS NULL"}
+	args := []any{models.UserStatusDeactivated}
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.ExcludeID != "" {
+		conditions = append(conditions, "id <> "+arg(f.ExcludeID))
+	}
+	if f.OnlineOnly {
+		conditions = append(conditions, "online")
+	}
+	if !f.ActiveSince.IsZero() {
+		conditions = append(conditions, "last_seen >= "+arg(f.ActiveSince))
+	}
+	if f.Search != "" {
+		// Users who opted out of discovery never show up in search results
+		query := likeEscaper.Replace(f.Search)
+		prefix, word := arg(query+"%"), arg("% "+query+"%")
+		matches := []string{
+			"lower(username) LIKE " + prefix,
+			"lower(display_name) LIKE " + prefix,
+			"lower(display_name) LIKE " + word,
+		}
+		if f.Fuzzy {
+			start, trigrams := models.FuzzyKeys(f.Search)
+			patterns := make([]string, len(trigrams))
+			for i, gram := range trigrams {
+				patterns[i] = "%" + likeEscaper.Replace(gram) + "%"
+			}
+			startPattern, anyTrigram := arg(likeEscaper.Replace(start)+"%"), arg(patterns)
+			matches = append(matches,
+				"lower(username) LIKE "+startPattern,
+				"lower(display_name) LIKE "+startPattern,
+				"lower(username) LIKE ANY("+anyTrigram+")",
+				"lower(display_name) LIKE ANY("+anyTrigram+")",
+			)
+		}
+		conditions = append(conditions, "NOT hide_from_discovery", "("+strings.Join(matches, " OR ")+")")
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+func (r userRepository) List(ctx context.Context, f store.UserFilter) ([]models.User, error) {
+	where, args := userWhere(f)
+	query := "SELECT " + userColumns + " FROM users WHERE " + where + " ORDER BY online DESC, last_seen DESC"
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+	if f.Skip > 0 {
+		query += fmt.Sprintf(" OFFSET %d", f.Skip)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (r userRepository) Count(ctx context.Context, f store.UserFilter) (int64, error) {
+	where, args := userWhere(f)
+
+	var count int64
+	err := r.db.QueryRowContext(ctx, "SELECT count(*) FROM users WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+func (r userRepository) EstimatedCount(ctx context.Context) (int64, error) {
+	// Planner statistics, -1 until the table was first analyzed
+	var count int64
+	if err := r.db.QueryRowContext(ctx, "SELECT reltuples::bigint FROM pg_class WHERE oid = 'users'::regclass").Scan(&count); err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		err := r.db.QueryRowContext(ctx, "SELECT count(*) FROM users").Scan(&count)
+		return count, err
+	}
+	return count, nil
+}
+
+// presenceRepository keeps presence on the users table
+type presenceRepository struct {
+	db *sql.DB
+}
+
+func (r presenceRepository) SetOnline(ctx context.Context, userID string, online bool, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET online = $1, last_seen = $2 WHERE id = $3", online, at, userID)
+	return err
+}
+
+func (r presenceRepository) Touch(ctx context.Context, userID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET last_seen = $1 WHERE id = $2", at, userID)
+	return err
+}
+
+func (r presenceRepository) Heartbeat(ctx context.Context, userIDs []string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET online = TRUE, last_seen = $1 WHERE id = ANY($2)", at, userIDs)
+	return err
+}
+
+func (r presenceRepository) ExpireOnline(ctx context.Context, before time.Time, limit int64) ([]store.UserPresence, error) {
+	// SKIP LOCKED leaves users another instance is refreshing or expiring alone
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE users SET online = FALSE
+		WHERE id IN (
+			SELECT id FROM users WHERE online AND last_seen < $1
+			LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, last_seen`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expired := []store.UserPresence{}
+	for rows.Next() {
+		p := store.UserPresence{Online: true}
+		if err := rows.Scan(&p.UserID, &p.LastSeen); err != nil {
+			return nil, err
+		}
+		expired = append(expired, p)
+	}
+	return expired, rows.Err()
+}
+
+func (r presenceRepository) Get(ctx context.Context, userIDs []string) ([]store.UserPresence, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, online, last_seen FROM users WHERE id = ANY($1)", userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presence := make([]store.UserPresence, 0, len(userIDs))
+	for rows.Next() {
+		var p store.UserPresence
+		if err := rows.Scan(&p.UserID, &p.Online, &p.LastSeen); err != nil {
+			return nil, err
+		}
+		presence = append(presence, p)
+	}
+	return presence, rows.Err()
+}
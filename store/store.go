@@ -0,0 +1,236 @@
+// Package store defines the repositories behind the core chat features (users, direct
+// messages and conversations) so they can run on more than one database.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Adisonsmn/ngobrolyuk/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("store: not found")
+	// ErrConflict is returned when a write violates a uniqueness rule or limit
+	ErrConflict = errors.New("store: conflict")
+)
+
+// Store bundles the repositories of one storage backend
+type Store interface {
+	Users() UserRepository
+	Messages() MessageRepository
+	Conversations() ConversationRepository
+	Presence() PresenceRepository
+	Outbox() OutboxRepository
+	QRLogins() QRLoginRepository
+	// Ping reports whether the backend is reachable
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+type UserRepository interface {
+	// NextID allocates the next sequential user ID
+	NextID(ctx context.Context) (string, error)
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindByEmailOrUsername returns any user holding the email or the username
+	FindByEmailOrUsername(ctx context.Context, email, username string) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	UsernameTaken(ctx context.Context, username, exceptID string) (bool, error)
+	// ChangeUsername renames the user, moving the current username into the history.
+	// Returns ErrConflict if another user holds the username.
+	ChangeUsername(ctx context.Context, id, username string, at time.Time) error
+	// FindByFormerUsername returns the user who most recently gave up the username
+	// at or after since
+	FindByFormerUsername(ctx context.Context, username string, since time.Time) (*models.User, error)
+	// UpgradeGuest turns a guest into a full account with the given credentials.
+	// Returns ErrConflict if the username or email is taken, ErrNotFound if id is not a guest.
+	UpgradeGuest(ctx context.Context, id, username, email, password string) error
+	// ChangeEmail moves the user from one email to another and clears the email
+	// change nonce. Returns ErrNotFound if the user no longer holds from or nonce,
+	// ErrConflict if another user holds to.
+	ChangeEmail(ctx context.Context, id, from, to, nonce string) error
+	Update(ctx context.Context, id string, update UserUpdate) error
+	// List returns visible users, online first then by last seen
+	List(ctx context.Context, filter UserFilter) ([]models.User, error)
+	Count(ctx context.Context, filter UserFilter) (int64, error)
+	// EstimatedCount quickly approximates the number of stored accounts of any
+	// kind, without filtering
+	EstimatedCount(ctx context.Context) (int64, error)
+}
+
+// UserUpdate sets only the non-nil fields
+type UserUpdate struct {
+	DisplayName       *string
+	Bio               *string
+	Avatar            *string
+	Status            *string
+	HideFromDiscovery *bool
+	EmailDigestOptOut *bool
+	Language          *string
+	EmailChangeNonce  *string
+}
+
+// IsEmpty reports whether the update has no fields to set
+func (u UserUpdate) IsEmpty() bool {
+	return u == UserUpdate{}
+}
+
+// UserFilter selects active accounts, guests, deactivated and deleting accounts are always excluded
+type UserFilter struct {
+	ExcludeID   string
+	OnlineOnly  bool
+	ActiveSince time.Time // Zero means any last seen
+	Search      string    // Normalized prefix of the username or a display name word, skips hidden users
+	Fuzzy       bool      // Widen Search to typo candidates, callers rank them with models.MatchUser
+	Skip        int64
+	Limit       int64 // Zero means no limit
+}
+
+// PresenceRepository tracks whether users are connected and when they were last active
+type PresenceRepository interface {
+	SetOnline(ctx context.Context, userID string, online bool, at time.Time) error
+	// Touch refreshes last seen without changing the online flag
+	Touch(ctx context.Context, userID string, at time.Time) error
+	// Get returns the stored presence of the users that exist among userIDs
+	Get(ctx context.Context, userIDs []string) ([]UserPresence, error)
+	// Heartbeat marks the users connected to this instance online as of at
+	Heartbeat(ctx context.Context, userIDs []string, at time.Time) error
+	// ExpireOnline marks up to limit users offline whose online flag was not
+	// refreshed since before, returning them as they were
+	ExpireOnline(ctx context.Context, before time.Time, limit int64) ([]UserPresence, error)
+}
+
+// UserPresence is what the store knows about a user's connection
+type UserPresence struct {
+	UserID   string
+	Online   bool
+	LastSeen time.Time
+}
+
+type MessageRepository interface {
+	// Insert stores the message together with the outbox entries describing it,
+	// all or nothing. ErrConflict means a message with the same ID exists.
+	Insert(ctx context.Context, message *models.Message, events ...models.OutboxEntry) error
+	// GetByIDs returns the messages among ids that viewer can see
+	GetByIDs(ctx context.Context, viewerID string, ids []primitive.ObjectID) ([]models.Message, error)
+	// GetDirect loads a direct message exchanged between viewer and other, if viewer
+	// can see it
+	GetDirect(ctx context.Context, id primitive.ObjectID, viewerID, otherID string) (*models.Message, error)
+	// ListDirect returns the messages between viewer and other visible to viewer,
+	// newest first, starting after before when it is set
+	ListDirect(ctx context.Context, viewerID, otherID string, before *MessageCursor, skip, limit int64) ([]models.Message, error)
+	// UnreadCount counts received direct messages past the user's read cursors,
+	// leaving out message requests to the user that are pending or were deleted
+	UnreadCount(ctx context.Context, userID string) (int64, error)
+	// DirectConversations summarizes the user's direct conversations, latest first
+	DirectConversations(ctx context.Context, userID string) ([]ConversationSummary, error)
+	// RecentText returns up to limit of the newest text direct messages the user sent
+	// or received and can see, leaving out disappearing and archived ones
+	RecentText(ctx context.Context, userID string, limit int64) ([]models.Message, error)
+	// ExpireViewed removes the content of view-once messages sender sent to receiver
+	// up to readAt and returns the messages it expired
+	ExpireViewed(ctx context.Context, receiverID, senderID string, readAt time.Time) ([]models.Message, error)
+	// ExpireDue removes the content of up to limit messages whose expiry passed and
+	// returns the messages it expired
+	ExpireDue(ctx context.Context, now time.Time, limit int64) ([]models.Message, error)
+}
+
+// MessageCursor is the position of a message in a newest first listing, ties on
+// CreatedAt are broken by ID
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+type ConversationSummary struct {
+	OtherUserID string
+	LastMessage models.Message
+	UnreadCount int
+}
+
+type ConversationRepository interface {
+	Get(ctx context.Context, id string) (*models.Conversation, error)
+	// AddPin stores the pin, creating the conversation on first write.
+	// Returns ErrConflict if the message is already pinned or the list is full.
+	AddPin(ctx context.Context, conversation *models.Conversation, pin models.PinnedMessage) error
+	// RemovePin reports whether the message was pinned
+	RemovePin(ctx context.Context, id string, messageID primitive.ObjectID) (bool, error)
+	// AdvanceReadCursor moves the user's read position forward, reports false if it
+	// already was at or past cursor.ReadAt
+	AdvanceReadCursor(ctx context.Context, cursor models.ReadCursor) (bool, error)
+	// ReadCursor returns the user's read position in the conversation with other,
+	// a zero cursor if they never read it
+	ReadCursor(ctx context.Context, userID, otherID string) (models.ReadCursor, error)
+	// OpenRequest stores a pending message request, creating the conversation on
+	// first write. A request the recipient deleted is replaced, an accepted
+	// conversation is left alone.
+	OpenRequest(ctx context.Context, conversation *models.Conversation, request models.MessageRequest) error
+	// Accept ends any request, creating the conversation on first write
+	Accept(ctx context.Context, conversation *models.Conversation, at time.Time) error
+	// DismissRequest hides a pending request from its recipient until the next
+	// OpenRequest, reports false if none was pending to them
+	DismissRequest(ctx context.Context, id, recipientID string, at time.Time) (bool, error)
+	// SetBlocked records whether the user blocks the other participant, creating the
+	// conversation on first write
+	SetBlocked(ctx context.Context, conversation *models.Conversation, userID string, blocked bool) error
+	// Requests returns the conversations with a request to the user, deleted ones included
+	Requests(ctx context.Context, recipientID string) ([]models.Conversation, error)
+}
+
+// OutboxRepository is read by the outbox relay, entries are written by the
+// repository whose change they describe
+type OutboxRepository interface {
+	// Claim leases up to limit unpublished entries due at now, oldest first, by
+	// moving their next attempt to now+lease and counting the attempt. Other
+	// relays skip them until the lease passes.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEntry, error)
+	MarkPublished(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// Retry records a failed attempt and when to make the next one
+	Retry(ctx context.Context, id primitive.ObjectID, next time.Time, lastErr string) error
+	// Pending counts the unpublished entries and returns the oldest one's creation time
+	Pending(ctx context.Context) (int64, time.Time, error)
+	// PurgePublished deletes entries published before the cutoff and returns how many
+	PurgePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+// QRLoginRepository keeps QR login challenges for as long as they can be used
+type QRLoginRepository interface {
+	// Create stores a new challenge and may drop expired ones
+	Create(ctx context.Context, login *models.QRLogin) error
+	Get(ctx context.Context, code string) (*models.QRLogin, error)
+	// Decide answers a challenge that is pending and not expired at now. Returns
+	// ErrNotFound if there is no such challenge.
+	Decide(ctx context.Context, code, userID, status string, now time.Time) error
+	// Complete marks an approved challenge completed and returns it, once. Returns
+	// ErrNotFound if there is no approved challenge.
+	Complete(ctx context.Context, code string) (*models.QRLogin, error)
+}
+
+var current Store
+
+// Use sets the backend used by the application, called once at startup
+func Use(s Store) {
+	current = s
+}
+
+// Current returns the backend set by Use
+func Current() Store {
+	return current
+}
+
+func Users() UserRepository                 { return current.Users() }
+func Messages() MessageRepository           { return current.Messages() }
+func Conversations() ConversationRepository { return current.Conversations() }
+func Presence() PresenceRepository          { return current.Presence() }
+func Outbox() OutboxRepository              { return current.Outbox() }
+func QRLogins() QRLoginRepository           { return current.QRLogins() }
+
+// Ping reports whether the current backend is reachable
+func Ping(ctx context.Context) error {
+	return current.Ping(ctx)
+}